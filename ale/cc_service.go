@@ -0,0 +1,119 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ale
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+
+	"github.com/iomz/gosstrak/ccspec"
+	"github.com/iomz/gosstrak/reporting"
+)
+
+// CCService implements the ALE writing API on top of the ccspec.Manager
+type CCService struct {
+	manager *ccspec.Manager
+}
+
+// NewCCService returns the pointer to a new CCService instance
+func NewCCService(manager *ccspec.Manager) *CCService {
+	return &CCService{
+		manager: manager,
+	}
+}
+
+// ccSOAPRequest is a SOAP envelope containing any ALE writing operation
+type ccSOAPRequest struct {
+	Body struct {
+		Operation struct {
+			XMLName  xml.Name
+			SpecName string         `xml:"specName"`
+			Spec     *ccspec.CCSpec `xml:"spec"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// ccSpecResult is the result of an operation with a CCSpec
+type ccSpecResult struct {
+	XMLName xml.Name
+	*ccspec.CCSpec
+}
+
+// ccReportsResult is the result of an operation with CCReports
+type ccReportsResult struct {
+	XMLName xml.Name
+	*reporting.CCReports
+}
+
+// Define defines the CCSpec
+func (s *CCService) Define(specName string, spec *ccspec.CCSpec) error {
+	return s.manager.Define(specName, spec)
+}
+
+// GetCCSpec returns the CCSpec of the name
+func (s *CCService) GetCCSpec(specName string) (*ccspec.CCSpec, error) {
+	return s.manager.GetCCSpec(specName)
+}
+
+// GetCCSpecNames returns the names of the defined CCSpecs
+func (s *CCService) GetCCSpecNames() []string {
+	return s.manager.GetCCSpecNames()
+}
+
+// Immediate runs a command cycle of the unnamed CCSpec and returns the CCReports
+func (s *CCService) Immediate(spec *ccspec.CCSpec) (*reporting.CCReports, error) {
+	return s.manager.Immediate(spec)
+}
+
+// Poll runs a command cycle of the CCSpec and returns the CCReports
+func (s *CCService) Poll(specName string) (*reporting.CCReports, error) {
+	return s.manager.Poll(specName)
+}
+
+// Undefine undefines the CCSpec
+func (s *CCService) Undefine(specName string) error {
+	return s.manager.Undefine(specName)
+}
+
+// ServeHTTP handles the ALE writing operations in SOAP
+func (s *CCService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &ccSOAPRequest{}
+	serveSOAP(w, r, CCWSDLNamespace, req, func() (interface{}, error) {
+		op := req.Body.Operation
+		log.Printf("[ALECC] %s %s", op.XMLName.Local, op.SpecName)
+		return s.invoke(op.XMLName.Local, op.SpecName, op.Spec)
+	})
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// invoke calls the ALE writing operation and returns its result for the SOAP response
+func (s *CCService) invoke(operation string, specName string, spec *ccspec.CCSpec) (interface{}, error) {
+	name := xml.Name{Local: "alews:" + operation + "Result"}
+	switch operation {
+	case "Define":
+		return &voidResult{name}, s.Define(specName, spec)
+	case "Undefine":
+		return &voidResult{name}, s.Undefine(specName)
+	case "GetCCSpec":
+		spec, err := s.GetCCSpec(specName)
+		return &ccSpecResult{name, spec}, err
+	case "GetCCSpecNames":
+		return &arrayOfStringResult{name, s.GetCCSpecNames()}, nil
+	case "Poll":
+		ccr, err := s.Poll(specName)
+		return &ccReportsResult{name, ccr}, err
+	case "Immediate":
+		ccr, err := s.Immediate(spec)
+		return &ccReportsResult{name, ccr}, err
+	case "GetStandardVersion":
+		return &stringResult{name, StandardVersion}, nil
+	case "GetVendorVersion":
+		return &stringResult{name, reporting.ALEID}, nil
+	}
+	return nil, &unknownOperationError{operation}
+}
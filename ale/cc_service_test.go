@@ -0,0 +1,64 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ale
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iomz/gosstrak/ccspec"
+)
+
+func TestCCService_ServeHTTP(t *testing.T) {
+	manager := ccspec.NewManager()
+	manager.SetSender(func([]string, func(uint32) []byte) {})
+	ts := httptest.NewServer(NewCCService(manager))
+	defer ts.Close()
+
+	define := `<ale:Define>
+  <specName>encode</specName>
+  <spec>
+    <boundarySpec><duration unit="MS">10</duration></boundarySpec>
+    <cmdSpecs>
+      <cmdSpec name="sgtin">
+        <opSpecs>
+          <opSpec><opType>WRITE</opType><fieldspec><fieldname>epc</fieldname></fieldspec><dataSpec specType="LITERAL"><data>urn:epc:tag:sgtin-96:3.0614141.812345.6789</data></dataSpec></opSpec>
+        </opSpecs>
+        <reportIfEmpty>true</reportIfEmpty>
+      </cmdSpec>
+    </cmdSpecs>
+  </spec>
+</ale:Define>`
+	tests := []struct {
+		name       string
+		operation  string
+		wantStatus int
+		wantBody   string
+	}{
+		{"define", define, http.StatusOK, "<alews:DefineResult></alews:DefineResult>"},
+		{"duplicate define", define, http.StatusInternalServerError, "<alews:DuplicateNameException>"},
+		{"invalid define", strings.NewReplacer("<specName>encode", "<specName>invalid", "sgtin-96:3.0614141.812345.6789", "sgtin-96:3.0614141.812345").Replace(define), http.StatusInternalServerError, "<alews:CCSpecValidationException>"},
+		{"getCCSpecNames", "<ale:GetCCSpecNames/>", http.StatusOK, "<alews:GetCCSpecNamesResult><string>encode</string></alews:GetCCSpecNamesResult>"},
+		{"getCCSpec", "<ale:GetCCSpec><specName>encode</specName></ale:GetCCSpec>", http.StatusOK, "<opType>WRITE</opType>"},
+		{"poll", "<ale:Poll><specName>encode</specName></ale:Poll>", http.StatusOK, `<cmdReport cmdSpecName="sgtin">`},
+		{"undefine", "<ale:Undefine><specName>encode</specName></ale:Undefine>", http.StatusOK, "<alews:UndefineResult>"},
+		{"poll undefined", "<ale:Poll><specName>encode</specName></ale:Poll>", http.StatusInternalServerError, "<alews:NoSuchNameException>"},
+		{"unknown operation", "<ale:Subscribe/>", http.StatusInternalServerError, "<alews:ImplementationException>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := soapCall(t, ts.URL, tt.operation)
+			if status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", status, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %v, want %v", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package ale provides the ALE 1.1 reading API on top of the event cycles
+package ale
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/iomz/gosstrak/ecspec"
+	"github.com/iomz/gosstrak/filtering"
+	"github.com/iomz/gosstrak/reporting"
+)
+
+// MatchAllPattern is the include pattern of the reports without any, which matches all the tags
+const MatchAllPattern = "epcBank=*"
+
+// ReportKeyPrefix is the prefix of the reportURI used in Subscriptions for the reports in ECSpecs
+const ReportKeyPrefix = "urn:gosstrak:ale:report:"
+
+// SubscriptionManager applies the filter patterns to the filtering engines
+type SubscriptionManager interface {
+	AddSubscription(reportURI string, pattern string) error
+	DeleteSubscription(reportURI string, pattern string) error
+}
+
+// InvalidURIError is returned when the notificationURI is not supported
+type InvalidURIError struct {
+	URI string
+}
+
+func (e *InvalidURIError) Error() string {
+	return fmt.Sprintf("invalid notificationURI: %s", e.URI)
+}
+
+// ReportRef refers to a report in an ECSpec
+type ReportRef struct {
+	SpecName   string
+	ReportName string
+}
+
+// Service implements the ALE reading API
+type Service struct {
+	mutex          sync.Mutex
+	manager        *ecspec.Manager
+	subscriptions  SubscriptionManager
+	immediateCount uint64
+	// readerExists checks the logicalReaders in the ECSpecs
+	readerExists func(name string) bool
+	// memberOf maps the reportURIs of the include members to the report keys,
+	// and members is the number of the include members of each report key
+	memberOf     map[string]string
+	members      map[string]int
+	membersMutex sync.RWMutex
+}
+
+// NewService returns the pointer to a new Service instance
+func NewService(manager *ecspec.Manager, subscriptions SubscriptionManager) *Service {
+	return &Service{
+		manager:       manager,
+		subscriptions: subscriptions,
+		memberOf:      make(map[string]string),
+		members:       make(map[string]int),
+	}
+}
+
+// ReportKey returns the reportURI in Subscriptions for the report in the ECSpec
+func ReportKey(specName string, reportName string) string {
+	return ReportKeyPrefix + url.QueryEscape(specName) + ":" + url.QueryEscape(reportName)
+}
+
+// ParseReportKey returns the ECSpec name and the report name from the reportURI,
+// ok is false if the reportURI isn't made by ReportKey
+func ParseReportKey(reportURI string) (specName string, reportName string, ok bool) {
+	if !strings.HasPrefix(reportURI, ReportKeyPrefix) {
+		return "", "", false
+	}
+	names := strings.Split(strings.TrimPrefix(reportURI, ReportKeyPrefix), ":")
+	if len(names) != 2 {
+		return "", "", false
+	}
+	var err error
+	if specName, err = url.QueryUnescape(names[0]); err != nil {
+		return "", "", false
+	}
+	if reportName, err = url.QueryUnescape(names[1]); err != nil {
+		return "", "", false
+	}
+	return specName, reportName, true
+}
+
+// MatchedReports returns the reports in the ECSpecs of the reportURIs found for a tag,
+// the tag needs to be found for all the include members of a report, and the other reportURIs
+func (s *Service) MatchedReports(reportURIs []string) (reports []ReportRef, others []string) {
+	s.membersMutex.RLock()
+	defer s.membersMutex.RUnlock()
+	found := map[string]int{}
+	keys := []string{}
+	for _, uri := range reportURIs {
+		key, ok := s.memberOf[uri]
+		if !ok {
+			others = append(others, uri)
+			continue
+		}
+		if found[key] == 0 {
+			keys = append(keys, key)
+		}
+		found[key]++
+	}
+	for _, key := range keys {
+		if found[key] != s.members[key] {
+			continue
+		}
+		if specName, reportName, ok := ParseReportKey(key); ok {
+			reports = append(reports, ReportRef{specName, reportName})
+		}
+	}
+	return reports, others
+}
+
+// Define defines the ECSpec and subscribes its filter patterns to the engines
+func (s *Service) Define(specName string, spec *ecspec.ECSpec) error {
+	if spec == nil {
+		return &ecspec.ValidationError{Reason: "no ECSpec is given"}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, lr := range spec.LogicalReaders {
+		if s.readerExists != nil && !s.readerExists(lr) {
+			return &ecspec.ValidationError{Reason: "no such logical reader: " + lr}
+		}
+	}
+	if err := s.manager.Define(specName, spec); err != nil {
+		return err
+	}
+	if err := s.addPatterns(specName, spec); err != nil {
+		s.manager.Undefine(specName)
+		return &ecspec.ValidationError{Reason: err.Error()}
+	}
+	return nil
+}
+
+// GetECSpec returns the ECSpec of the name
+func (s *Service) GetECSpec(specName string) (*ecspec.ECSpec, error) {
+	return s.manager.GetECSpec(specName)
+}
+
+// GetECSpecNames returns the names of the defined ECSpecs
+func (s *Service) GetECSpecNames() []string {
+	return s.manager.GetECSpecNames()
+}
+
+// GetSubscribers returns the notificationURIs subscribed to the ECSpec
+func (s *Service) GetSubscribers(specName string) ([]string, error) {
+	return s.manager.GetSubscribers(specName)
+}
+
+// Immediate runs an event cycle of the unnamed ECSpec and returns the ECReports
+func (s *Service) Immediate(spec *ecspec.ECSpec) (*reporting.ECReports, error) {
+	s.mutex.Lock()
+	s.immediateCount++
+	specName := fmt.Sprintf("urn:gosstrak:ale:immediate:%v", s.immediateCount)
+	s.mutex.Unlock()
+
+	if err := s.Define(specName, spec); err != nil {
+		return nil, err
+	}
+	defer s.Undefine(specName)
+	return s.manager.Poll(specName)
+}
+
+// Poll runs the next event cycle of the ECSpec and returns the ECReports
+func (s *Service) Poll(specName string) (*reporting.ECReports, error) {
+	return s.manager.Poll(specName)
+}
+
+// SetLogicalReaders sets the function to check the logicalReaders in the ECSpecs to define
+func (s *Service) SetLogicalReaders(exists func(name string) bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.readerExists = exists
+}
+
+// Subscribe delivers the ECReports of the ECSpec to the notificationURI
+func (s *Service) Subscribe(specName string, notificationURI string) error {
+	if _, err := reporting.FormatOf(notificationURI); err != nil {
+		return &InvalidURIError{notificationURI}
+	}
+	return s.manager.Subscribe(specName, notificationURI)
+}
+
+// Undefine undefines the ECSpec and unsubscribes its filter patterns from the engines
+func (s *Service) Undefine(specName string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	spec, err := s.manager.GetECSpec(specName)
+	if err != nil {
+		return err
+	}
+	if err = s.manager.Undefine(specName); err != nil {
+		return err
+	}
+	s.deletePatterns(specName, spec)
+	return nil
+}
+
+// Unsubscribe stops delivering the ECReports of the ECSpec to the notificationURI
+func (s *Service) Unsubscribe(specName string, notificationURI string) error {
+	return s.manager.Unsubscribe(specName, notificationURI)
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// addPatterns subscribes the include and exclude patterns of all the reports in the ECSpec,
+// the patterns already added are deleted on error
+func (s *Service) addPatterns(specName string, spec *ecspec.ECSpec) error {
+	added := map[string][]string{}
+	for _, rs := range spec.ReportSpecs {
+		key := ReportKey(specName, rs.ReportName)
+		memberPatterns := reportPatterns(key, rs.Filter)
+		for _, uri := range sortedKeys(memberPatterns) {
+			for _, pat := range memberPatterns[uri] {
+				if err := s.subscriptions.AddSubscription(uri, pat); err != nil {
+					for uri, patterns := range added {
+						s.deleteReportPatterns(uri, patterns)
+					}
+					return err
+				}
+				added[uri] = append(added[uri], pat)
+			}
+		}
+	}
+	s.membersMutex.Lock()
+	defer s.membersMutex.Unlock()
+	for _, rs := range spec.ReportSpecs {
+		key := ReportKey(specName, rs.ReportName)
+		memberPatterns := reportPatterns(key, rs.Filter)
+		for uri := range memberPatterns {
+			s.memberOf[uri] = key
+		}
+		s.members[key] = len(memberPatterns)
+	}
+	return nil
+}
+
+// deletePatterns unsubscribes the include and exclude patterns of all the reports in the ECSpec
+func (s *Service) deletePatterns(specName string, spec *ecspec.ECSpec) {
+	s.membersMutex.Lock()
+	defer s.membersMutex.Unlock()
+	for _, rs := range spec.ReportSpecs {
+		key := ReportKey(specName, rs.ReportName)
+		for uri, patterns := range reportPatterns(key, rs.Filter) {
+			s.deleteReportPatterns(uri, patterns)
+			delete(s.memberOf, uri)
+		}
+		delete(s.members, key)
+	}
+}
+
+// deleteReportPatterns unsubscribes the patterns for the report key
+func (s *Service) deleteReportPatterns(key string, patterns []string) {
+	for _, pat := range patterns {
+		if err := s.subscriptions.DeleteSubscription(key, pat); err != nil {
+			log.Printf("[ALE] %v", err)
+		}
+	}
+}
+
+// memberKey returns the reportURI in Subscriptions for the include member of the report,
+// the first member uses the report key
+func memberKey(key string, member int) string {
+	if member == 0 {
+		return key
+	}
+	return fmt.Sprintf("%s:%d", key, member)
+}
+
+// reportPatterns returns the patterns in Subscriptions for the filterSpec by the reportURI of each include member,
+// the exclude patterns are marked with filtering.ExcludePrefix and added to every member
+func reportPatterns(key string, fs *ecspec.ECFilterSpec) map[string][]string {
+	if fs == nil {
+		fs = &ecspec.ECFilterSpec{}
+	}
+	members := fs.IncludeMembers()
+	if len(members) == 0 {
+		members = [][]string{{MatchAllPattern}}
+	}
+	memberPatterns := map[string][]string{}
+	for i, includes := range members {
+		patterns := append([]string{}, includes...)
+		for _, pat := range fs.Excludes() {
+			patterns = append(patterns, filtering.ExcludePrefix+pat)
+		}
+		memberPatterns[memberKey(key, i)] = patterns
+	}
+	return memberPatterns
+}
+
+// sortedKeys returns the keys of the map in order
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
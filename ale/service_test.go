@@ -0,0 +1,232 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ale
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iomz/gosstrak/ecspec"
+)
+
+// fakeSubscriptions records the patterns and rejects the ones starting with "invalid"
+type fakeSubscriptions map[string][]string
+
+func (fs fakeSubscriptions) AddSubscription(reportURI string, pattern string) error {
+	if strings.HasPrefix(pattern, "invalid") {
+		return fmt.Errorf("invalid pattern: %s", pattern)
+	}
+	fs[reportURI] = append(fs[reportURI], pattern)
+	return nil
+}
+
+func (fs fakeSubscriptions) DeleteSubscription(reportURI string, pattern string) error {
+	for i, pat := range fs[reportURI] {
+		if pat == pattern {
+			fs[reportURI] = append(fs[reportURI][:i], fs[reportURI][i+1:]...)
+			if len(fs[reportURI]) == 0 {
+				delete(fs, reportURI)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no such pattern: %s", pattern)
+}
+
+// newFilteredSpec returns an ECSpec with a report for each set of include patterns
+func newFilteredSpec(includes ...[]string) *ecspec.ECSpec {
+	spec := &ecspec.ECSpec{
+		Boundaries: ecspec.ECBoundarySpec{Duration: ecspec.NewECTime(50 * time.Millisecond)},
+	}
+	for i, pats := range includes {
+		spec.ReportSpecs = append(spec.ReportSpecs, ecspec.ECReportSpec{
+			ReportName: fmt.Sprintf("report%v", i),
+			ReportSet:  ecspec.ECReportSetSpec{Set: ecspec.Current},
+			Filter:     &ecspec.ECFilterSpec{IncludePatterns: pats},
+		})
+	}
+	return spec
+}
+
+func TestParseReportKey(t *testing.T) {
+	tests := []struct {
+		name           string
+		reportURI      string
+		wantSpecName   string
+		wantReportName string
+		wantOk         bool
+	}{
+		{"report key", ReportKey("spec", "report"), "spec", "report", true},
+		{"escaped names", ReportKey("urn:spec:1", "a report"), "urn:spec:1", "a report", true},
+		{"report uri", "http://localhost:8888/", "", "", false},
+		{"too many names", ReportKeyPrefix + "a:b:c", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specName, reportName, ok := ParseReportKey(tt.reportURI)
+			if specName != tt.wantSpecName || reportName != tt.wantReportName || ok != tt.wantOk {
+				t.Errorf("ParseReportKey() = %v, %v, %v, want %v, %v, %v", specName, reportName, ok, tt.wantSpecName, tt.wantReportName, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestService_Define(t *testing.T) {
+	exclude := newFilteredSpec([]string{"urn:epc:pat:sgtin-96:3.12345678"})
+	exclude.ReportSpecs[0].Filter.ExcludePatterns = []string{"urn:epc:pat:sgtin-96:3.12345678.00001"}
+	members := newFilteredSpec([]string{"urn:epc:pat:sgtin-96:3.12345678"})
+	members.ReportSpecs[0].Filter.FilterList = []ecspec.ECFilterListMember{
+		{IncludeExclude: "INCLUDE", FieldSpec: &ecspec.ECFieldSpec{FieldName: "tidBank"}, Patterns: []string{"xE280", "xE200"}},
+		{IncludeExclude: "EXCLUDE", Patterns: []string{"urn:epc:pat:sgtin-96:3.12345678.00001"}},
+	}
+	dock := newFilteredSpec([]string{"urn:epc:pat:sgtin-96:3.12345678"})
+	dock.LogicalReaders = []string{"dock"}
+	misspelled := newFilteredSpec([]string{"urn:epc:pat:sgtin-96:3.12345678"})
+	misspelled.LogicalReaders = []string{"dokc"}
+	tests := []struct {
+		name    string
+		spec    *ecspec.ECSpec
+		want    fakeSubscriptions
+		wantErr bool
+	}{
+		{
+			"two reports",
+			newFilteredSpec([]string{"urn:epc:pat:sgtin-96:3.12345678"}, []string{"urn:epc:pat:sscc-96:3.12345678", "urn:epc:pat:giai-96:3.12345678"}),
+			fakeSubscriptions{
+				ReportKey("spec", "report0"): {"urn:epc:pat:sgtin-96:3.12345678"},
+				ReportKey("spec", "report1"): {"urn:epc:pat:sscc-96:3.12345678", "urn:epc:pat:giai-96:3.12345678"},
+			},
+			false,
+		},
+		{
+			"no include pattern",
+			newFilteredSpec(nil),
+			fakeSubscriptions{ReportKey("spec", "report0"): {MatchAllPattern}},
+			false,
+		},
+		{
+			"exclude pattern",
+			exclude,
+			fakeSubscriptions{
+				ReportKey("spec", "report0"): {"urn:epc:pat:sgtin-96:3.12345678", "!urn:epc:pat:sgtin-96:3.12345678.00001"},
+			},
+			false,
+		},
+		{
+			"include members",
+			members,
+			fakeSubscriptions{
+				ReportKey("spec", "report0"):        {"urn:epc:pat:sgtin-96:3.12345678", "!urn:epc:pat:sgtin-96:3.12345678.00001"},
+				ReportKey("spec", "report0") + ":1": {"tidBank=xE280", "tidBank=xE200", "!urn:epc:pat:sgtin-96:3.12345678.00001"},
+			},
+			false,
+		},
+		{
+			"logical reader",
+			dock,
+			fakeSubscriptions{ReportKey("spec", "report0"): {"urn:epc:pat:sgtin-96:3.12345678"}},
+			false,
+		},
+		{
+			"no such logical reader",
+			misspelled,
+			fakeSubscriptions{},
+			true,
+		},
+		{
+			"rollback on invalid pattern",
+			newFilteredSpec([]string{"urn:epc:pat:sgtin-96:3.12345678"}, []string{"urn:epc:pat:sscc-96:3.12345678", "invalid"}),
+			fakeSubscriptions{},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := fakeSubscriptions{}
+			s := NewService(ecspec.NewManager(nil), fs)
+			s.SetLogicalReaders(func(name string) bool { return name == "dock" })
+			err := s.Define("spec", tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Service.Define() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if _, ok := err.(*ecspec.ValidationError); err != nil && !ok {
+				t.Errorf("Service.Define() error = %T, want *ecspec.ValidationError", err)
+			}
+			if !reflect.DeepEqual(fs, tt.want) {
+				t.Errorf("Service.Define() subscriptions = %v, want %v", fs, tt.want)
+			}
+			if names := s.GetECSpecNames(); tt.wantErr != (len(names) == 0) {
+				t.Errorf("Service.GetECSpecNames() = %v", names)
+			}
+			if err != nil {
+				return
+			}
+			if err = s.Undefine("spec"); err != nil {
+				t.Fatal(err)
+			}
+			if len(fs) != 0 {
+				t.Errorf("Service.Undefine() subscriptions = %v, want empty", fs)
+			}
+		})
+	}
+}
+
+func TestService_MatchedReports(t *testing.T) {
+	spec := newFilteredSpec([]string{"urn:epc:pat:sgtin-96:3.12345678"}, []string{"urn:epc:pat:sscc-96:3.12345678"})
+	spec.ReportSpecs[0].Filter.FilterList = []ecspec.ECFilterListMember{
+		{IncludeExclude: "INCLUDE", FieldSpec: &ecspec.ECFieldSpec{FieldName: "tidBank"}, Patterns: []string{"xE280"}},
+	}
+	s := NewService(ecspec.NewManager(nil), fakeSubscriptions{})
+	if err := s.Define("spec", spec); err != nil {
+		t.Fatal(err)
+	}
+	key0, key1 := ReportKey("spec", "report0"), ReportKey("spec", "report1")
+	tests := []struct {
+		name        string
+		reportURIs  []string
+		wantReports []ReportRef
+		wantOthers  []string
+	}{
+		{"all members", []string{key0, key0 + ":1", key1}, []ReportRef{{"spec", "report0"}, {"spec", "report1"}}, nil},
+		{"a member", []string{key0 + ":1", "http://localhost:8888/"}, nil, []string{"http://localhost:8888/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reports, others := s.MatchedReports(tt.reportURIs)
+			if !reflect.DeepEqual(reports, tt.wantReports) || !reflect.DeepEqual(others, tt.wantOthers) {
+				t.Errorf("Service.MatchedReports() = %v, %v, want %v, %v", reports, others, tt.wantReports, tt.wantOthers)
+			}
+		})
+	}
+	if err := s.Undefine("spec"); err != nil {
+		t.Fatal(err)
+	}
+	if reports, _ := s.MatchedReports([]string{key1}); len(reports) != 0 {
+		t.Errorf("Service.MatchedReports() after Undefine = %v", reports)
+	}
+}
+
+func TestService_Immediate(t *testing.T) {
+	fs := fakeSubscriptions{}
+	s := NewService(ecspec.NewManager(nil), fs)
+	ecr, err := s.Immediate(newFilteredSpec([]string{"urn:epc:pat:sgtin-96:3.12345678"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ecr.TerminationCondition != ecspec.TerminatedByDuration {
+		t.Errorf("Service.Immediate() terminationCondition = %v", ecr.TerminationCondition)
+	}
+	if names := s.GetECSpecNames(); len(names) != 0 {
+		t.Errorf("Service.Immediate() left ECSpecs %v", names)
+	}
+	if len(fs) != 0 {
+		t.Errorf("Service.Immediate() left subscriptions %v", fs)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ale
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+
+	"github.com/iomz/gosstrak/ccspec"
+	"github.com/iomz/gosstrak/ecspec"
+	"github.com/iomz/gosstrak/reporting"
+	"github.com/iomz/gosstrak/tagmemory"
+)
+
+// SOAP related constants
+const (
+	// SOAPNamespace is the namespace of SOAP 1.1 envelopes
+	SOAPNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	// WSDLNamespace is the namespace of the ALE 1.1 reading API messages
+	WSDLNamespace = "urn:epcglobal:ale:wsdl:1"
+	// TMWSDLNamespace is the namespace of the ALE 1.1 tag memory API messages
+	TMWSDLNamespace = "urn:epcglobal:aletm:wsdl:1"
+	// CCWSDLNamespace is the namespace of the ALE 1.1 writing API messages
+	CCWSDLNamespace = "urn:epcglobal:alecc:wsdl:1"
+	// StandardVersion is the ALE version implemented by the Service
+	StandardVersion = "1.1"
+)
+
+// soapRequest is a SOAP envelope containing any ALE operation
+type soapRequest struct {
+	Body struct {
+		Operation struct {
+			XMLName         xml.Name
+			SpecName        string         `xml:"specName"`
+			Spec            *ecspec.ECSpec `xml:"spec"`
+			NotificationURI string         `xml:"notificationURI"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// soapResponse is a SOAP envelope containing the result of an ALE operation
+type soapResponse struct {
+	XMLName xml.Name `xml:"soapenv:Envelope"`
+	SOAPNS  string   `xml:"xmlns:soapenv,attr"`
+	WSDLNS  string   `xml:"xmlns:alews,attr"`
+	Body    struct {
+		Content interface{}
+	} `xml:"soapenv:Body"`
+}
+
+// soapFault is the SOAP fault containing an ALE exception
+type soapFault struct {
+	XMLName xml.Name `xml:"soapenv:Fault"`
+	Code    string   `xml:"faultcode"`
+	String  string   `xml:"faultstring"`
+	Detail  struct {
+		Exception struct {
+			XMLName xml.Name
+			Reason  string `xml:"reason"`
+		}
+	} `xml:"detail"`
+}
+
+// voidResult is the result of an operation without any value
+type voidResult struct {
+	XMLName xml.Name
+}
+
+// stringResult is the result of an operation with a string
+type stringResult struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// arrayOfStringResult is the result of an operation with a list of strings
+type arrayOfStringResult struct {
+	XMLName xml.Name
+	Strings []string `xml:"string"`
+}
+
+// ecSpecResult is the result of an operation with an ECSpec
+type ecSpecResult struct {
+	XMLName xml.Name
+	*ecspec.ECSpec
+}
+
+// ecReportsResult is the result of an operation with ECReports
+type ecReportsResult struct {
+	XMLName xml.Name
+	*reporting.ECReports
+}
+
+// ServeHTTP handles the ALE operations in SOAP
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &soapRequest{}
+	serveSOAP(w, r, WSDLNamespace, req, func() (interface{}, error) {
+		op := req.Body.Operation
+		log.Printf("[ALE] %s %s", op.XMLName.Local, op.SpecName)
+		return s.invoke(op.XMLName.Local, op.SpecName, op.Spec, op.NotificationURI)
+	})
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// invoke calls the ALE operation and returns its result for the SOAP response
+func (s *Service) invoke(operation string, specName string, spec *ecspec.ECSpec, notificationURI string) (interface{}, error) {
+	name := xml.Name{Local: "alews:" + operation + "Result"}
+	switch operation {
+	case "Define":
+		return &voidResult{name}, s.Define(specName, spec)
+	case "Undefine":
+		return &voidResult{name}, s.Undefine(specName)
+	case "GetECSpec":
+		spec, err := s.GetECSpec(specName)
+		return &ecSpecResult{name, spec}, err
+	case "GetECSpecNames":
+		return &arrayOfStringResult{name, s.GetECSpecNames()}, nil
+	case "Subscribe":
+		return &voidResult{name}, s.Subscribe(specName, notificationURI)
+	case "Unsubscribe":
+		return &voidResult{name}, s.Unsubscribe(specName, notificationURI)
+	case "Poll":
+		ecr, err := s.Poll(specName)
+		return &ecReportsResult{name, ecr}, err
+	case "Immediate":
+		ecr, err := s.Immediate(spec)
+		return &ecReportsResult{name, ecr}, err
+	case "GetSubscribers":
+		subscribers, err := s.GetSubscribers(specName)
+		return &arrayOfStringResult{name, subscribers}, err
+	case "GetStandardVersion":
+		return &stringResult{name, StandardVersion}, nil
+	case "GetVendorVersion":
+		return &stringResult{name, reporting.ALEID}, nil
+	}
+	return nil, &unknownOperationError{operation}
+}
+
+// unknownOperationError is returned when the operation is not in the ALE reading API
+type unknownOperationError struct {
+	operation string
+}
+
+func (e *unknownOperationError) Error() string {
+	return "unknown ALE operation: " + e.operation
+}
+
+// exceptionName returns the ALE exception for the error
+func exceptionName(err error) string {
+	switch err.(type) {
+	case *ecspec.DuplicateNameError:
+		return "DuplicateNameException"
+	case *ecspec.NoSuchNameError:
+		return "NoSuchNameException"
+	case *ecspec.ValidationError:
+		return "ECSpecValidationException"
+	case *ecspec.DuplicateSubscriptionError:
+		return "DuplicateSubscriptionException"
+	case *ecspec.NoSuchSubscriberError:
+		return "NoSuchSubscriberException"
+	case *InvalidURIError:
+		return "InvalidURIException"
+	case *tagmemory.DuplicateNameError:
+		return "DuplicateNameException"
+	case *tagmemory.NoSuchNameError:
+		return "NoSuchNameException"
+	case *tagmemory.ValidationError:
+		return "TMSpecValidationException"
+	case *tagmemory.InUseError:
+		return "InUseException"
+	case *ccspec.DuplicateNameError:
+		return "DuplicateNameException"
+	case *ccspec.NoSuchNameError:
+		return "NoSuchNameException"
+	case *ccspec.ValidationError:
+		return "CCSpecValidationException"
+	}
+	return "ImplementationException"
+}
+
+// serveSOAP decodes the SOAP request into req and writes the result of invoke,
+// or the SOAP fault with the ALE exception, in the namespace of the API
+func serveSOAP(w http.ResponseWriter, r *http.Request, ns string, req interface{}, invoke func() (interface{}, error)) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := xml.NewDecoder(r.Body).Decode(req); err != nil {
+		writeFault(w, ns, "soapenv:Client", "ImplementationException", err.Error())
+		return
+	}
+	result, err := invoke()
+	if err != nil {
+		code := "soapenv:Client"
+		exception := exceptionName(err)
+		if exception == "ImplementationException" {
+			code = "soapenv:Server"
+		}
+		writeFault(w, ns, code, exception, err.Error())
+		return
+	}
+	writeResponse(w, ns, http.StatusOK, result)
+}
+
+// writeFault writes the SOAP fault with the ALE exception
+func writeFault(w http.ResponseWriter, ns string, code string, exception string, reason string) {
+	f := &soapFault{
+		Code:   code,
+		String: reason,
+	}
+	f.Detail.Exception.XMLName = xml.Name{Local: "alews:" + exception}
+	f.Detail.Exception.Reason = reason
+	writeResponse(w, ns, http.StatusInternalServerError, f)
+}
+
+// writeResponse writes the content in a SOAP envelope
+func writeResponse(w http.ResponseWriter, ns string, status int, content interface{}) {
+	res := &soapResponse{
+		SOAPNS: SOAPNamespace,
+		WSDLNS: ns,
+	}
+	res.Body.Content = content
+	out, err := xml.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
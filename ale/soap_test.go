@@ -0,0 +1,130 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ale
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iomz/gosstrak/ecspec"
+)
+
+// soapCall posts the ALE operation to the server and returns the status code and the body
+func soapCall(t *testing.T, url string, operation string) (int, string) {
+	envelope := `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ale="urn:epcglobal:ale:wsdl:1">
+  <soapenv:Body>` + operation + `</soapenv:Body>
+</soapenv:Envelope>`
+	res, err := http.Post(url, "text/xml", strings.NewReader(envelope))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(body)
+}
+
+func TestService_ServeHTTP(t *testing.T) {
+	manager := ecspec.NewManager(nil)
+	ts := httptest.NewServer(NewService(manager, fakeSubscriptions{}))
+	defer ts.Close()
+
+	define := `<ale:Define>
+  <specName>spec</specName>
+  <spec>
+    <boundarySpec><duration unit="MS">50</duration></boundarySpec>
+    <reportSpecs>
+      <reportSpec reportName="report">
+        <reportSet set="CURRENT"/>
+        <filterSpec><includePatterns><includePattern>urn:epc:pat:sgtin-96:3.12345678</includePattern></includePatterns></filterSpec>
+      </reportSpec>
+    </reportSpecs>
+  </spec>
+</ale:Define>`
+	tests := []struct {
+		name       string
+		operation  string
+		wantStatus int
+		wantBody   string
+	}{
+		{"define", define, http.StatusOK, "<alews:DefineResult></alews:DefineResult>"},
+		{"duplicate define", define, http.StatusInternalServerError, "<alews:DuplicateNameException>"},
+		{"getECSpecNames", "<ale:GetECSpecNames/>", http.StatusOK, "<alews:GetECSpecNamesResult><string>spec</string></alews:GetECSpecNamesResult>"},
+		{"getECSpec", "<ale:GetECSpec><specName>spec</specName></ale:GetECSpec>", http.StatusOK, `<duration unit="MS">50</duration>`},
+		{"subscribe invalid uri", "<ale:Subscribe><specName>spec</specName><notificationURI>tcp://localhost:8888</notificationURI></ale:Subscribe>", http.StatusInternalServerError, "<alews:InvalidURIException>"},
+		{"subscribe", "<ale:Subscribe><specName>spec</specName><notificationURI>http://localhost:8888</notificationURI></ale:Subscribe>", http.StatusOK, "<alews:SubscribeResult>"},
+		{"getSubscribers", "<ale:GetSubscribers><specName>spec</specName></ale:GetSubscribers>", http.StatusOK, "<string>http://localhost:8888</string>"},
+		{"unsubscribe", "<ale:Unsubscribe><specName>spec</specName><notificationURI>http://localhost:8888</notificationURI></ale:Unsubscribe>", http.StatusOK, "<alews:UnsubscribeResult>"},
+		{"unsubscribe twice", "<ale:Unsubscribe><specName>spec</specName><notificationURI>http://localhost:8888</notificationURI></ale:Unsubscribe>", http.StatusInternalServerError, "<alews:NoSuchSubscriberException>"},
+		{"undefine", "<ale:Undefine><specName>spec</specName></ale:Undefine>", http.StatusOK, "<alews:UndefineResult>"},
+		{"getECSpec undefined", "<ale:GetECSpec><specName>spec</specName></ale:GetECSpec>", http.StatusInternalServerError, "<alews:NoSuchNameException>"},
+		{"getStandardVersion", "<ale:GetStandardVersion/>", http.StatusOK, "<alews:GetStandardVersionResult>1.1</alews:GetStandardVersionResult>"},
+		{"unknown operation", "<ale:Reboot/>", http.StatusInternalServerError, "<alews:ImplementationException>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := soapCall(t, ts.URL, tt.operation)
+			if status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", status, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %v, want %v", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestService_ServeHTTP_Poll(t *testing.T) {
+	manager := ecspec.NewManager(nil)
+	s := NewService(manager, fakeSubscriptions{})
+	if err := s.Define("spec", newFilteredSpec([]string{"urn:epc:pat:sgtin-96:3.12345678"})); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	type pollResult struct {
+		status int
+		body   string
+	}
+	ch := make(chan pollResult)
+	go func() {
+		status, body := soapCall(t, ts.URL, "<ale:Poll><specName>spec</specName></ale:Poll>")
+		ch <- pollResult{status, body}
+	}()
+	for {
+		select {
+		case res := <-ch:
+			if res.status != http.StatusOK {
+				t.Fatalf("status = %v, body = %v", res.status, res.body)
+			}
+			decoded := struct {
+				Result struct {
+					XMLName  xml.Name
+					SpecName string   `xml:"specName,attr"`
+					EPCs     []string `xml:"reports>report>group>groupList>member>epc"`
+				} `xml:"Body>PollResult"`
+			}{}
+			if err := xml.Unmarshal([]byte(res.body), &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Result.SpecName != "spec" || len(decoded.Result.EPCs) != 1 || decoded.Result.EPCs[0] != "urn:epc:id:sgtin:12345678.00001.1" {
+				t.Errorf("PollResult = %+v", decoded.Result)
+			}
+			return
+		case <-time.After(time.Millisecond):
+			manager.AddToReport("spec", "report0", "urn:epc:id:sgtin:12345678.00001.1", nil)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ale
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+
+	"github.com/iomz/gosstrak/reporting"
+	"github.com/iomz/gosstrak/tagmemory"
+)
+
+// TMService implements the ALE tag memory API on top of the tagmemory.Registry
+type TMService struct {
+	fields *tagmemory.Registry
+}
+
+// NewTMService returns the pointer to a new TMService instance
+func NewTMService(fields *tagmemory.Registry) *TMService {
+	return &TMService{
+		fields: fields,
+	}
+}
+
+// tmSOAPRequest is a SOAP envelope containing any ALE tag memory operation
+type tmSOAPRequest struct {
+	Body struct {
+		Operation struct {
+			XMLName  xml.Name
+			SpecName string                          `xml:"specName"`
+			Spec     *tagmemory.TMFixedFieldListSpec `xml:"spec"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// tmSpecResult is the result of an operation with a TMSpec
+type tmSpecResult struct {
+	XMLName xml.Name
+	*tagmemory.TMFixedFieldListSpec
+}
+
+// DefineTMSpec defines the fieldnames in the TMSpec
+func (s *TMService) DefineTMSpec(specName string, spec *tagmemory.TMFixedFieldListSpec) error {
+	return s.fields.Define(specName, spec)
+}
+
+// GetTMSpec returns the TMSpec of the name
+func (s *TMService) GetTMSpec(specName string) (*tagmemory.TMFixedFieldListSpec, error) {
+	return s.fields.Get(specName)
+}
+
+// GetTMSpecNames returns the names of the defined TMSpecs
+func (s *TMService) GetTMSpecNames() []string {
+	return s.fields.Names()
+}
+
+// UndefineTMSpec undefines the fieldnames in the TMSpec unless they are in use
+func (s *TMService) UndefineTMSpec(specName string) error {
+	return s.fields.Undefine(specName)
+}
+
+// ServeHTTP handles the ALE tag memory operations in SOAP
+func (s *TMService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &tmSOAPRequest{}
+	serveSOAP(w, r, TMWSDLNamespace, req, func() (interface{}, error) {
+		op := req.Body.Operation
+		log.Printf("[ALETM] %s %s", op.XMLName.Local, op.SpecName)
+		return s.invoke(op.XMLName.Local, op.SpecName, op.Spec)
+	})
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// invoke calls the ALE tag memory operation and returns its result for the SOAP response
+func (s *TMService) invoke(operation string, specName string, spec *tagmemory.TMFixedFieldListSpec) (interface{}, error) {
+	name := xml.Name{Local: "alews:" + operation + "Result"}
+	switch operation {
+	case "DefineTMSpec":
+		return &voidResult{name}, s.DefineTMSpec(specName, spec)
+	case "UndefineTMSpec":
+		return &voidResult{name}, s.UndefineTMSpec(specName)
+	case "GetTMSpec":
+		spec, err := s.GetTMSpec(specName)
+		return &tmSpecResult{name, spec}, err
+	case "GetTMSpecNames":
+		return &arrayOfStringResult{name, s.GetTMSpecNames()}, nil
+	case "GetStandardVersion":
+		return &stringResult{name, StandardVersion}, nil
+	case "GetVendorVersion":
+		return &stringResult{name, reporting.ALEID}, nil
+	}
+	return nil, &unknownOperationError{operation}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ale
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iomz/gosstrak/tagmemory"
+)
+
+func TestTMService_ServeHTTP(t *testing.T) {
+	fields := tagmemory.NewRegistry()
+	inUse := false
+	fields.SetInUse(func(fieldname string) bool {
+		return inUse && fieldname == "mdid"
+	})
+	ts := httptest.NewServer(NewTMService(fields))
+	defer ts.Close()
+
+	define := `<ale:DefineTMSpec>
+  <specName>tid</specName>
+  <spec>
+    <fixedFields>
+      <fixedField><fieldname>mdid</fieldname><bank>2</bank><length>12</length><offset>8</offset><defaultDatatype>uint</defaultDatatype><defaultFormat>hex</defaultFormat></fixedField>
+    </fixedFields>
+  </spec>
+</ale:DefineTMSpec>`
+	tests := []struct {
+		name       string
+		operation  string
+		inUse      bool
+		wantStatus int
+		wantBody   string
+	}{
+		{"define", define, false, http.StatusOK, "<alews:DefineTMSpecResult></alews:DefineTMSpecResult>"},
+		{"duplicate define", define, false, http.StatusInternalServerError, "<alews:DuplicateNameException>"},
+		{"invalid define", strings.NewReplacer("<bank>2</bank>", "<bank>4</bank>", "<specName>tid", "<specName>invalid").Replace(define), false, http.StatusInternalServerError, "<alews:TMSpecValidationException>"},
+		{"getTMSpecNames", "<ale:GetTMSpecNames/>", false, http.StatusOK, "<alews:GetTMSpecNamesResult><string>tid</string></alews:GetTMSpecNamesResult>"},
+		{"getTMSpec", "<ale:GetTMSpec><specName>tid</specName></ale:GetTMSpec>", false, http.StatusOK, "<fieldname>mdid</fieldname>"},
+		{"undefine in use", "<ale:UndefineTMSpec><specName>tid</specName></ale:UndefineTMSpec>", true, http.StatusInternalServerError, "<alews:InUseException>"},
+		{"undefine", "<ale:UndefineTMSpec><specName>tid</specName></ale:UndefineTMSpec>", false, http.StatusOK, "<alews:UndefineTMSpecResult>"},
+		{"getTMSpec undefined", "<ale:GetTMSpec><specName>tid</specName></ale:GetTMSpec>", false, http.StatusInternalServerError, "<alews:NoSuchNameException>"},
+		{"unknown operation", "<ale:Define/>", false, http.StatusInternalServerError, "<alews:ImplementationException>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inUse = tt.inUse
+			status, body := soapCall(t, ts.URL, tt.operation)
+			if status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", status, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %v, want %v", body, tt.wantBody)
+			}
+		})
+	}
+}
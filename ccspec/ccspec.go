@@ -0,0 +1,145 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package ccspec implements the ALE command cycle specified by CCSpec
+// to write, lock, and kill the tags with the LLRP AccessSpecs
+package ccspec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iomz/gosstrak/ecspec"
+)
+
+// Operation types in CCOpSpec
+const (
+	OpWrite    = "WRITE"
+	OpKill     = "KILL"
+	OpLock     = "LOCK"
+	OpPassword = "PASSWORD"
+)
+
+// Lock operations in the data of the LOCK CCOpSpec
+const (
+	Unlock      = "UNLOCK"
+	Lock        = "LOCK"
+	Permalock   = "PERMALOCK"
+	Permaunlock = "PERMAUNLOCK"
+)
+
+// TerminatedByCount is the TerminationCondition of a command cycle ended by tagsProcessedCount
+const TerminatedByCount = "COUNT"
+
+// CCSpec is the ALE 1.1 command cycle specification
+type CCSpec struct {
+	IncludeSpecInReports bool           `xml:"includeSpecInReports,attr,omitempty" json:"includeSpecInReports,omitempty"`
+	LogicalReaders       []string       `xml:"logicalReaders>logicalReader" json:"logicalReaders,omitempty"`
+	Boundaries           CCBoundarySpec `xml:"boundarySpec" json:"boundarySpec"`
+	CmdSpecs             []CCCmdSpec    `xml:"cmdSpecs>cmdSpec" json:"cmdSpecs"`
+}
+
+// CCBoundarySpec specifies the end of command cycles, which start on request
+type CCBoundarySpec struct {
+	Duration ecspec.ECTime `xml:"duration" json:"duration"`
+	// TagsProcessedCount ends the command cycle after the tags if not 0
+	TagsProcessedCount int `xml:"tagsProcessedCount,omitempty" json:"tagsProcessedCount,omitempty"`
+}
+
+// CCCmdSpec specifies the operations on the tags matching the filter
+type CCCmdSpec struct {
+	Name          string        `xml:"name,attr" json:"name"`
+	Filter        *CCFilterSpec `xml:"filterSpec,omitempty" json:"filterSpec,omitempty"`
+	OpSpecs       []CCOpSpec    `xml:"opSpecs>opSpec" json:"opSpecs"`
+	ReportIfEmpty bool          `xml:"reportIfEmpty,omitempty" json:"reportIfEmpty,omitempty"`
+}
+
+// CCFilterSpec specifies the tags to operate on, the patterns apply to the epc field
+// unless the fieldspec specifies another
+type CCFilterSpec struct {
+	FilterList []ecspec.ECFilterListMember `xml:"filterList>filter" json:"filterList"`
+}
+
+// CCOpSpec specifies an operation on the field of the tags, the fieldspec is ignored by KILL and PASSWORD
+type CCOpSpec struct {
+	OpType    string              `xml:"opType" json:"opType"`
+	FieldSpec *ecspec.ECFieldSpec `xml:"fieldspec,omitempty" json:"fieldspec,omitempty"`
+	DataSpec  *CCOpDataSpec       `xml:"dataSpec,omitempty" json:"dataSpec,omitempty"`
+	OpName    string              `xml:"opName,omitempty" json:"opName,omitempty"`
+}
+
+// CCOpDataSpec is the data of an operation, only LITERAL is supported
+type CCOpDataSpec struct {
+	SpecType string `xml:"specType,attr,omitempty" json:"specType,omitempty"`
+	Data     string `xml:"data" json:"data"`
+}
+
+// Patterns returns the include and the exclude patterns of the CCFilterSpec,
+// prefixed with the fieldname for the fields other than epc
+func (fs *CCFilterSpec) Patterns() (includes []string, excludes []string) {
+	if fs == nil {
+		return nil, nil
+	}
+	ecfs := &ecspec.ECFilterSpec{FilterList: fs.FilterList}
+	return ecfs.Includes(), ecfs.Excludes()
+}
+
+// Validate checks the CCSpec as ALE define() does, the fields and the data are checked on compile
+func (spec *CCSpec) Validate() error {
+	d := spec.Boundaries.Duration
+	if d.Value <= 0 {
+		return errors.New("no duration is specified in boundarySpec")
+	}
+	if strings.ToUpper(d.Unit) != "MS" {
+		return fmt.Errorf("unsupported ECTime unit: %s", d.Unit)
+	}
+	if spec.Boundaries.TagsProcessedCount < 0 || 0xffff < spec.Boundaries.TagsProcessedCount {
+		return fmt.Errorf("invalid tagsProcessedCount: %v", spec.Boundaries.TagsProcessedCount)
+	}
+	if len(spec.CmdSpecs) == 0 {
+		return errors.New("no cmdSpec is specified")
+	}
+	names := map[string]bool{}
+	for _, cs := range spec.CmdSpecs {
+		if len(cs.Name) == 0 {
+			return errors.New("the name of a cmdSpec is empty")
+		}
+		if names[cs.Name] {
+			return fmt.Errorf("duplicate cmdSpec name: %s", cs.Name)
+		}
+		names[cs.Name] = true
+		if cs.Filter != nil {
+			for _, f := range cs.Filter.FilterList {
+				if f.IncludeExclude != "INCLUDE" && f.IncludeExclude != "EXCLUDE" {
+					return fmt.Errorf("invalid includeExclude in %s: %s", cs.Name, f.IncludeExclude)
+				}
+			}
+		}
+		operates := false
+		for _, op := range cs.OpSpecs {
+			switch op.OpType {
+			case OpWrite, OpLock:
+				if op.FieldSpec == nil || len(op.FieldSpec.FieldName) == 0 {
+					return fmt.Errorf("no fieldspec for %s in %s", op.OpType, cs.Name)
+				}
+			case OpKill, OpPassword:
+			default:
+				return fmt.Errorf("unsupported opType in %s: %s", cs.Name, op.OpType)
+			}
+			if op.DataSpec == nil {
+				return fmt.Errorf("no dataSpec for %s in %s", op.OpType, cs.Name)
+			}
+			if op.DataSpec.SpecType != "" && op.DataSpec.SpecType != "LITERAL" {
+				return fmt.Errorf("unsupported specType in %s: %s", cs.Name, op.DataSpec.SpecType)
+			}
+			operates = operates || op.OpType != OpPassword
+		}
+		if !operates {
+			return fmt.Errorf("no operation on the tags in %s", cs.Name)
+		}
+	}
+	return nil
+}
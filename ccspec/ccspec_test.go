@@ -0,0 +1,95 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ccspec
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/iomz/gosstrak/ecspec"
+)
+
+// newCCSpec returns a CCSpec with a command of the operations
+func newCCSpec(duration time.Duration, ops ...CCOpSpec) *CCSpec {
+	return &CCSpec{
+		Boundaries: CCBoundarySpec{Duration: ecspec.NewECTime(duration)},
+		CmdSpecs:   []CCCmdSpec{{Name: "cmd", OpSpecs: ops}},
+	}
+}
+
+// op returns a CCOpSpec of the type on the fieldname with the literal data
+func op(opType string, fieldname string, data string) CCOpSpec {
+	o := CCOpSpec{OpType: opType, DataSpec: &CCOpDataSpec{SpecType: "LITERAL", Data: data}}
+	if len(fieldname) != 0 {
+		o.FieldSpec = &ecspec.ECFieldSpec{FieldName: fieldname}
+	}
+	return o
+}
+
+func TestCCSpec_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    *CCSpec
+		wantErr bool
+	}{
+		{"write", newCCSpec(time.Second, op(OpWrite, "epc", "urn:epc:tag:sgtin-96:3.0614141.812345.6789")), false},
+		{"password and kill", newCCSpec(time.Second, op(OpPassword, "", "x1"), op(OpKill, "", "x2")), false},
+		{"no duration", newCCSpec(0, op(OpKill, "", "x2")), true},
+		{"no opSpec", newCCSpec(time.Second), true},
+		{"tagsProcessedCount over 16 bits", func() *CCSpec {
+			spec := newCCSpec(time.Second, op(OpKill, "", "x2"))
+			spec.Boundaries.TagsProcessedCount = 0x10000
+			return spec
+		}(), true},
+		{"password only", newCCSpec(time.Second, op(OpPassword, "", "x1")), true},
+		{"no fieldspec", newCCSpec(time.Second, op(OpWrite, "", "x1")), true},
+		{"unsupported opType", newCCSpec(time.Second, op("READ", "epc", "")), true},
+		{"no dataSpec", newCCSpec(time.Second, CCOpSpec{OpType: OpKill}), true},
+		{
+			"duplicate cmdSpec",
+			&CCSpec{
+				Boundaries: CCBoundarySpec{Duration: ecspec.NewECTime(time.Second)},
+				CmdSpecs:   []CCCmdSpec{{Name: "c", OpSpecs: []CCOpSpec{op(OpKill, "", "1")}}, {Name: "c", OpSpecs: []CCOpSpec{op(OpKill, "", "1")}}},
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.spec.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("CCSpec.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCCSpec_xml(t *testing.T) {
+	data := `<spec>
+  <logicalReaders><logicalReader>station</logicalReader></logicalReaders>
+  <boundarySpec><duration unit="MS">3000</duration><tagsProcessedCount>1</tagsProcessedCount></boundarySpec>
+  <cmdSpecs>
+    <cmdSpec name="encode">
+      <filterSpec><filterList><filter><includeExclude>INCLUDE</includeExclude><patList><pat>urn:epc:pat:sgtin-96:3.0614141.*.*</pat></patList></filter></filterList></filterSpec>
+      <opSpecs>
+        <opSpec><opType>WRITE</opType><fieldspec><fieldname>epc</fieldname></fieldspec><dataSpec specType="LITERAL"><data>urn:epc:tag:sgtin-96:3.0614141.812345.6789</data></dataSpec><opName>epc</opName></opSpec>
+      </opSpecs>
+    </cmdSpec>
+  </cmdSpecs>
+</spec>`
+	spec := &CCSpec{}
+	if err := xml.Unmarshal([]byte(data), spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cs := spec.CmdSpecs[0]
+	if spec.LogicalReaders[0] != "station" || spec.Boundaries.TagsProcessedCount != 1 || cs.Name != "encode" ||
+		cs.OpSpecs[0].FieldSpec.FieldName != "epc" || cs.OpSpecs[0].OpName != "epc" || len(cs.Filter.FilterList) != 1 {
+		t.Errorf("xml.Unmarshal() = %+v", spec)
+	}
+}
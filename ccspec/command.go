@@ -0,0 +1,353 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ccspec
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/iomz/gosstrak/ecspec"
+	"github.com/iomz/gosstrak/filtering"
+	"github.com/iomz/gosstrak/llrpclient"
+	"github.com/iomz/gosstrak/reporting"
+	"github.com/iomz/gosstrak/scheme"
+	"github.com/iomz/gosstrak/tagmemory"
+	"github.com/iomz/gosstrak/tdt"
+)
+
+// lockDataFields are the C1G2LockPayload DataFields of the fieldnames to lock
+var lockDataFields = map[string]byte{
+	"killPwd":   llrpclient.LockKillPassword,
+	"accessPwd": llrpclient.LockAccessPassword,
+	"epc":       llrpclient.LockEPC,
+	"epcBank":   llrpclient.LockEPC,
+	"tidBank":   llrpclient.LockTID,
+	"userBank":  llrpclient.LockUser,
+}
+
+// lockPrivileges are the C1G2LockPayload Privileges of the lock operations
+var lockPrivileges = map[string]byte{
+	Unlock:      llrpclient.LockUnlock,
+	Lock:        llrpclient.LockReadWrite,
+	Permalock:   llrpclient.LockPermalock,
+	Permaunlock: llrpclient.LockPermaunlock,
+}
+
+// maxTargetSets is the maximum number of the AccessSpecs of a command
+const maxTargetSets = 16
+
+// command is a CCCmdSpec compiled into the TargetTags and the OpSpecs
+type command struct {
+	spec *CCCmdSpec
+	// targetSets are the TargetTags of each AccessSpec, a tag matching any of them is operated on
+	targetSets [][]llrpclient.TargetTag
+	// opSpecs build the OpSpec of each operation with the OpSpecID, nil for PASSWORD
+	opSpecs []func(opSpecID uint16) []byte
+	// epc is the EPC written by the command if any
+	epc []byte
+}
+
+// compile returns the commands of the CCSpec, the fieldnames are resolved with the tagmemory.Registry
+// and the EPCs are encoded by the scheme package or the tdt.Core
+func compile(spec *CCSpec, fields *tagmemory.Registry, c *tdt.Core) ([]*command, error) {
+	cmds := []*command{}
+	for i := range spec.CmdSpecs {
+		cs := &spec.CmdSpecs[i]
+		cmd := &command{spec: cs}
+		var err error
+		if cmd.targetSets, err = targetSets(cs.Filter, fields); err != nil {
+			return nil, fmt.Errorf("%s: %v", cs.Name, err)
+		}
+		var password uint32
+		for _, op := range cs.OpSpecs {
+			build, err := cmd.compileOp(op, password, fields, c)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", cs.Name, err)
+			}
+			if op.OpType == OpPassword {
+				password, _ = parseUint32(op.DataSpec.Data)
+			}
+			cmd.opSpecs = append(cmd.opSpecs, build)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
+// opReports returns the CCOpReports of the OpSpecResults on a tag, the OpSpecIDs are of the operations,
+// the operations without the result were not executed after a failure
+func (cmd *command) opReports(results []llrpclient.OpSpecResult, opSpecIDs []uint16) []reporting.CCOpReport {
+	reports := make([]reporting.CCOpReport, len(cmd.spec.OpSpecs))
+	for i, op := range cmd.spec.OpSpecs {
+		reports[i] = reporting.CCOpReport{OpStatus: reporting.CCOpNotPossibleError, OpName: op.OpName}
+		if op.OpType == OpPassword {
+			reports[i].OpStatus = reporting.CCSuccess
+			continue
+		}
+		for _, r := range results {
+			if r.OpSpecID == opSpecIDs[i] {
+				reports[i].OpStatus = opStatus(r)
+			}
+		}
+	}
+	return reports
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// compileOp returns the builder of the OpSpec for the operation with the access password
+func (cmd *command) compileOp(op CCOpSpec, password uint32, fields *tagmemory.Registry, c *tdt.Core) (func(uint16) []byte, error) {
+	data := op.DataSpec.Data
+	switch op.OpType {
+	case OpPassword:
+		if _, err := parseUint32(data); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	case OpKill:
+		killPassword, err := parseUint32(data)
+		if err != nil {
+			return nil, err
+		}
+		return func(id uint16) []byte { return llrpclient.C1G2Kill(id, killPassword) }, nil
+	case OpLock:
+		dataField, ok := lockDataFields[op.FieldSpec.FieldName]
+		if !ok {
+			return nil, fmt.Errorf("%s can't be locked", op.FieldSpec.FieldName)
+		}
+		privilege, ok := lockPrivileges[data]
+		if !ok {
+			return nil, fmt.Errorf("invalid lock operation: %s", data)
+		}
+		return func(id uint16) []byte { return llrpclient.C1G2Lock(id, password, privilege, dataField) }, nil
+	}
+	f, err := fields.Field(op.FieldSpec.FieldName)
+	if err != nil {
+		return nil, err
+	}
+	if f, err = f.WithFormat(op.FieldSpec.DataType, op.FieldSpec.Format); err != nil {
+		return nil, err
+	}
+	wordPointer, words, err := writeData(f, data, c)
+	if err != nil {
+		return nil, err
+	}
+	if f.Name == "epc" {
+		cmd.epc = words[2:]
+	}
+	bank := byte(f.Bank)
+	return func(id uint16) []byte { return llrpclient.C1G2Write(id, password, bank, wordPointer, words) }, nil
+}
+
+// isWritten returns true if the tag already has the EPC written by the command
+func (cmd *command) isWritten(id []byte) bool {
+	return cmd.epc != nil && bytes.Equal(cmd.epc, id)
+}
+
+// encodeEPC returns the binary of the EPC in the tag URI or any level the tdt.Core translates
+func encodeEPC(uri string, c *tdt.Core) ([]byte, error) {
+	var id []byte
+	var err error
+	switch {
+	case strings.HasPrefix(uri, "urn:epc:tag:sgtin-96:"):
+		f := strings.Split(strings.TrimPrefix(uri, "urn:epc:tag:sgtin-96:"), ".")
+		if len(f) != 4 {
+			return nil, fmt.Errorf("invalid SGTIN-96: %s", uri)
+		}
+		id, _, _, err = scheme.MakeSGTIN96(false, f[0], f[1], f[2], f[3])
+	case strings.HasPrefix(uri, "urn:epc:tag:sscc-96:"):
+		f := strings.Split(strings.TrimPrefix(uri, "urn:epc:tag:sscc-96:"), ".")
+		if len(f) != 3 {
+			return nil, fmt.Errorf("invalid SSCC-96: %s", uri)
+		}
+		id, _, _, err = scheme.MakeSSCC96(false, f[0], f[1], f[2])
+	default:
+		_, id, err = c.Encode(uri, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// opStatus returns the CCStatus of the LLRP result code of the OpSpec
+func opStatus(r llrpclient.OpSpecResult) string {
+	if r.Result == 0 {
+		return reporting.CCSuccess
+	}
+	switch r.Kind {
+	case llrpclient.OpWrite:
+		switch r.Result {
+		case 1:
+			return reporting.CCMemoryOverflowError
+		case 2:
+			return reporting.CCPermissionError
+		case 7:
+			return reporting.CCPasswordError
+		}
+	case llrpclient.OpKill:
+		switch r.Result {
+		case 1: // zero kill password
+			return reporting.CCOpNotPossibleError
+		case 6:
+			return reporting.CCPasswordError
+		}
+	case llrpclient.OpLock:
+		switch r.Result {
+		case 5:
+			return reporting.CCPasswordError
+		case 6:
+			return reporting.CCMemoryOverflowError
+		case 7:
+			return reporting.CCPermissionError
+		}
+	}
+	return reporting.CCMiscErrorTotal
+}
+
+// parseUint returns the bytes of the value in hex with x or in decimal, in the bits rounded up to the bytes,
+// the bits of the hex digits are used if the bits are 0
+func parseUint(s string, bits int) ([]byte, error) {
+	base, digits := 10, s
+	if strings.HasPrefix(s, "x") {
+		base, digits = 16, s[1:]
+	}
+	v, ok := new(big.Int).SetString(digits, base)
+	if !ok || v.Sign() < 0 || strings.HasPrefix(digits, "+") {
+		return nil, fmt.Errorf("invalid value: %s", s)
+	}
+	if bits == 0 {
+		if base != 16 {
+			return nil, fmt.Errorf("the value needs to be in hex: %s", s)
+		}
+		bits = 4 * len(digits)
+	}
+	if v.BitLen() > bits {
+		return nil, fmt.Errorf("%s exceeds %v bits", s, bits)
+	}
+	return v.FillBytes(make([]byte, (bits+7)/8)), nil
+}
+
+// parseUint32 returns the 32-bit value of the password
+func parseUint32(s string) (uint32, error) {
+	b, err := parseUint(s, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]), nil
+}
+
+// targetSets returns the TargetTags of the AccessSpecs for the filters, a set has a pattern of every include member
+// and all the exclude patterns, as the TargetTags in a C1G2TagSpec are ANDed and the patterns in a member are ORed,
+// each pattern must be a single mask and the C1G2TagSpec takes two TargetTags at most
+func targetSets(fs *CCFilterSpec, fields *tagmemory.Registry) ([][]llrpclient.TargetTag, error) {
+	ecfs := &ecspec.ECFilterSpec{}
+	if fs != nil {
+		ecfs.FilterList = fs.FilterList
+	}
+	sets := [][]llrpclient.TargetTag{{}}
+	for _, member := range ecfs.IncludeMembers() {
+		next := [][]llrpclient.TargetTag{}
+		for _, pat := range member {
+			tt, err := targetTag(pat, true, fields)
+			if err != nil {
+				return nil, err
+			}
+			for _, set := range sets {
+				set = append(set[:len(set):len(set)], tt...)
+				next = append(next, set)
+			}
+		}
+		if sets = next; len(sets) > maxTargetSets {
+			return nil, fmt.Errorf("the filters make more than %v AccessSpecs", maxTargetSets)
+		}
+	}
+	excludes := []llrpclient.TargetTag{}
+	for _, pat := range ecfs.Excludes() {
+		tt, err := targetTag(pat, false, fields)
+		if err != nil {
+			return nil, err
+		}
+		// an exclude pattern matching any value has no TargetTag to exclude every tag
+		if len(tt) == 0 {
+			return nil, fmt.Errorf("%s excludes all the tags", pat)
+		}
+		excludes = append(excludes, tt...)
+	}
+	for i := range sets {
+		if sets[i] = append(sets[i], excludes...); len(sets[i]) > 2 {
+			return nil, fmt.Errorf("%v filters are ANDed, only two are supported", len(sets[i]))
+		}
+	}
+	return sets, nil
+}
+
+// targetTag returns the TargetTag of the pattern, none if the pattern matches any value
+func targetTag(pat string, match bool, fields *tagmemory.Registry) ([]llrpclient.TargetTag, error) {
+	if !filtering.IsMemoryPattern(pat) {
+		pat = "epc=" + pat
+	}
+	bank, fos, err := filtering.MemoryFilterObjects(pat, fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(fos) == 0 {
+		return nil, nil
+	}
+	if len(fos) > 1 {
+		return nil, fmt.Errorf("%s is not a single mask", pat)
+	}
+	tt := llrpclient.TargetTag{
+		Bank:    byte(bank),
+		Match:   match,
+		Pointer: uint16(fos[0].Offset),
+		Bits:    uint16(fos[0].Size),
+		Mask:    make([]byte, (fos[0].Size+7)/8),
+		Data:    make([]byte, (fos[0].Size+7)/8),
+	}
+	for j, b := range fos[0].String {
+		if b == 'x' {
+			continue
+		}
+		tt.Mask[j/8] |= 0x80 >> uint(j%8)
+		if b == '1' {
+			tt.Data[j/8] |= 0x80 >> uint(j%8)
+		}
+	}
+	return []llrpclient.TargetTag{tt}, nil
+}
+
+// writeData returns the word pointer and the words to write the value to the field,
+// the epc field is written with the PC bits updated for its length
+func writeData(f *tagmemory.Field, value string, c *tdt.Core) (uint16, []byte, error) {
+	var data []byte
+	var err error
+	switch f.Datatype {
+	case tagmemory.EPC:
+		if data, err = encodeEPC(value, c); err != nil {
+			return 0, nil, err
+		}
+		if f.Name == "epc" {
+			// L4-0 is the length in words, UMI=0, XI=0, T=0
+			return 1, append([]byte{uint8(len(data) / 2 << 3), 0}, data...), nil
+		}
+		if f.Length != 0 && f.Length != 8*len(data) {
+			return 0, nil, fmt.Errorf("%s is not %v bits for %s", value, f.Length, f.Name)
+		}
+	case tagmemory.Uint:
+		if data, err = parseUint(value, f.Length); err != nil {
+			return 0, nil, err
+		}
+	default:
+		return 0, nil, fmt.Errorf("%s can't be written to %s", f.Datatype, f.Name)
+	}
+	if f.Offset%16 != 0 || len(data)%2 != 0 || f.Length%16 != 0 {
+		return 0, nil, fmt.Errorf("%s is not aligned to the words", f.Name)
+	}
+	return uint16(f.Offset / 16), data, nil
+}
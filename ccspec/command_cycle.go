@@ -0,0 +1,187 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ccspec
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/iomz/gosstrak/ecspec"
+	"github.com/iomz/gosstrak/llrpclient"
+	"github.com/iomz/gosstrak/reporting"
+	"github.com/iomz/gosstrak/tdt"
+)
+
+// opRef refers to an operation in the commands of a command cycle
+type opRef struct {
+	cmd int
+	op  int
+}
+
+// commandCycle is a run of the commands on the tags with an AccessSpec for each command
+type commandCycle struct {
+	mutex        sync.Mutex
+	name         string
+	spec         *CCSpec
+	cmds         []*command
+	accessSpecID []uint32   // of all the AccessSpecs of the commands
+	opSpecIDs    [][]uint16 // 0 for PASSWORD
+	ops          map[uint16]opRef
+	tdtCore      *tdt.Core
+	seen         []map[string]bool
+	reports      [][]reporting.CCTagReport
+	processed    map[string]bool
+	full         chan struct{}
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+// newCommandCycle returns the pointer to a new commandCycle instance,
+// the AccessSpecIDs and the OpSpecIDs are given by next
+func newCommandCycle(name string, spec *CCSpec, cmds []*command, c *tdt.Core, nextAccessSpecID func() uint32, nextOpSpecID func() uint16) *commandCycle {
+	cc := &commandCycle{
+		name:      name,
+		spec:      spec,
+		cmds:      cmds,
+		ops:       make(map[uint16]opRef),
+		tdtCore:   c,
+		processed: make(map[string]bool),
+		full:      make(chan struct{}),
+		stop:      make(chan struct{}),
+	}
+	for i, cmd := range cmds {
+		for range cmd.targetSets {
+			cc.accessSpecID = append(cc.accessSpecID, nextAccessSpecID())
+		}
+		ids := make([]uint16, len(cmd.opSpecs))
+		for j, build := range cmd.opSpecs {
+			if build != nil {
+				ids[j] = nextOpSpecID()
+				cc.ops[ids[j]] = opRef{i, j}
+			}
+		}
+		cc.opSpecIDs = append(cc.opSpecIDs, ids)
+		cc.seen = append(cc.seen, make(map[string]bool))
+		cc.reports = append(cc.reports, []reporting.CCTagReport{})
+	}
+	return cc
+}
+
+// accessSpecs returns the ADD_ACCESSSPEC message builders of the commands in the order of the AccessSpecIDs,
+// the AccessSpecs of a command share the OpSpecIDs
+func (cc *commandCycle) accessSpecs() []func(messageID uint32) []byte {
+	builders := []func(uint32) []byte{}
+	// Validate keeps the TagsProcessedCount in 16 bits
+	count := uint16(cc.spec.Boundaries.TagsProcessedCount)
+	for i, cmd := range cc.cmds {
+		opSpecs := [][]byte{}
+		for j, build := range cmd.opSpecs {
+			if build != nil {
+				opSpecs = append(opSpecs, build(cc.opSpecIDs[i][j]))
+			}
+		}
+		for _, targets := range cmd.targetSets {
+			accessSpecID, targets := cc.accessSpecID[len(builders)], targets
+			builders = append(builders, func(mid uint32) []byte {
+				return llrpclient.AddOpSpecAccessSpec(mid, accessSpecID, targets, count, opSpecs...)
+			})
+		}
+	}
+	return builders
+}
+
+// report adds the OpSpecResults of the TagReport to the command cycle,
+// returns false if the results are not of the command cycle
+func (cc *commandCycle) report(tr *llrpclient.TagReport) bool {
+	if len(tr.OpSpecResults) == 0 {
+		return false
+	}
+	ref, ok := cc.ops[tr.OpSpecResults[0].OpSpecID]
+	if !ok {
+		return false
+	}
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	key := hex.EncodeToString(tr.ID)
+	cmd := cc.cmds[ref.cmd]
+	// the tags already written in this cycle may be singulated again with the new EPC
+	if cc.seen[ref.cmd][key] || cmd.isWritten(tr.ID) {
+		return true
+	}
+	cc.seen[ref.cmd][key] = true
+	cc.reports[ref.cmd] = append(cc.reports[ref.cmd], reporting.CCTagReport{
+		ID:        cc.tagID(tr),
+		OpReports: cmd.opReports(tr.OpSpecResults, cc.opSpecIDs[ref.cmd]),
+	})
+	cc.processed[key] = true
+	if n := cc.spec.Boundaries.TagsProcessedCount; n != 0 && len(cc.processed) == n {
+		close(cc.full)
+	}
+	return true
+}
+
+// terminate stops the command cycle before its boundary
+func (cc *commandCycle) terminate() {
+	cc.stopOnce.Do(func() { close(cc.stop) })
+}
+
+// wait waits for the end of the command cycle and returns the TerminationCondition
+func (cc *commandCycle) wait() string {
+	timer := time.NewTimer(cc.spec.Boundaries.Duration.Duration())
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return ecspec.TerminatedByDuration
+	case <-cc.full:
+		return TerminatedByCount
+	case <-cc.stop:
+		return ecspec.TerminatedByUndefine
+	}
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// makeReports returns the CCReports of the command cycle
+func (cc *commandCycle) makeReports(start time.Time, termination string) *reporting.CCReports {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	now := time.Now()
+	ccr := &reporting.CCReports{
+		XMLNS:                reporting.ALENamespace,
+		SchemaVersion:        reporting.SchemaVersion,
+		CreationDate:         now,
+		SpecName:             cc.name,
+		Date:                 now,
+		ALEID:                reporting.ALEID,
+		TotalMilliseconds:    int64(now.Sub(start) / time.Millisecond),
+		InitiationCondition:  ecspec.InitiatedByRequest,
+		TerminationCondition: termination,
+		CmdReports:           []reporting.CCCmdReport{},
+	}
+	if cc.spec.IncludeSpecInReports {
+		ccr.CCSpec = cc.spec
+	}
+	for i, cmd := range cc.cmds {
+		if len(cc.reports[i]) == 0 && !cmd.spec.ReportIfEmpty {
+			continue
+		}
+		ccr.CmdReports = append(ccr.CmdReports, reporting.CCCmdReport{
+			CmdSpecName: cmd.spec.Name,
+			TagReports:  cc.reports[i],
+		})
+	}
+	return ccr
+}
+
+// tagID returns the pure identity of the tag, or the raw hex if it's not translated
+func (cc *commandCycle) tagID(tr *llrpclient.TagReport) string {
+	if id, err := cc.tdtCore.Translate(tr.PC, tr.ID); err == nil && len(id) != 0 {
+		return id
+	}
+	return fmt.Sprintf("urn:epc:raw:%d.x%X", 8*len(tr.ID), tr.ID)
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ccspec
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/iomz/gosstrak/ecspec"
+	"github.com/iomz/gosstrak/llrpclient"
+	"github.com/iomz/gosstrak/reporting"
+	"github.com/iomz/gosstrak/tagmemory"
+	"github.com/iomz/gosstrak/tdt"
+)
+
+func Test_writeData(t *testing.T) {
+	tests := []struct {
+		fieldname   string
+		value       string
+		wantPointer uint16
+		wantData    string
+		wantErr     bool
+	}{
+		{"epc", "urn:epc:tag:sgtin-96:3.0614141.812345.6789", 1, "3000" + "3074257bf7194e4000001a85", false},
+		{"epc", "urn:epc:tag:sscc-96:3.0614141.1234567890", 1, "3000" + "3174257bf4499602d2000000", false},
+		{"epc", "urn:epc:tag:sgtin-96:3.0614141.812345", 0, "", true},
+		{"killPwd", "x12345678", 0, "12345678", false},
+		{"accessPwd", "1", 2, "00000001", false},
+		{"accessPwd", "x123456789", 0, "", true},
+		{"userBank", "xABCD", 0, "abcd", false},
+		{"userBank", "123", 0, "", true},
+		{"@3.16.32", "x1200", 2, "1200", false},
+		{"@3.16.8", "x1200", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fieldname+"="+tt.value, func(t *testing.T) {
+			f, err := tagmemory.ParseField(tt.fieldname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pointer, data, err := writeData(f, tt.value, tdt.NewCore())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("writeData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := hex.EncodeToString(data); pointer != tt.wantPointer || got != tt.wantData {
+				t.Errorf("writeData() = (%v, %v), want (%v, %v)", pointer, got, tt.wantPointer, tt.wantData)
+			}
+		})
+	}
+}
+
+func Test_targetSets(t *testing.T) {
+	sgtin := llrpclient.TargetTag{Bank: 1, Match: true, Pointer: 32, Bits: 38, Mask: []byte{0xff, 0xff, 0xff, 0xff, 0xfc}, Data: []byte{0x30, 0x74, 0x25, 0x7b, 0xf4}}
+	sscc := llrpclient.TargetTag{Bank: 1, Match: true, Pointer: 32, Bits: 38, Mask: []byte{0xff, 0xff, 0xff, 0xff, 0xfc}, Data: []byte{0x31, 0x74, 0x25, 0x7b, 0xf4}}
+	tid := llrpclient.TargetTag{Bank: 2, Match: false, Pointer: 0, Bits: 16, Mask: []byte{0xff, 0xff}, Data: []byte{0xe2, 0x80}}
+	user := llrpclient.TargetTag{Bank: 3, Match: true, Pointer: 0, Bits: 8, Mask: []byte{0xff}, Data: []byte{0x12}}
+	include := func(field string, pats ...string) ecspec.ECFilterListMember {
+		return ecspec.ECFilterListMember{IncludeExclude: "INCLUDE", FieldSpec: &ecspec.ECFieldSpec{FieldName: field}, Patterns: pats}
+	}
+	exclude := ecspec.ECFilterListMember{IncludeExclude: "EXCLUDE", FieldSpec: &ecspec.ECFieldSpec{FieldName: "tidBank"}, Patterns: []string{"xE280"}}
+	tests := []struct {
+		name    string
+		filters []ecspec.ECFilterListMember
+		want    [][]llrpclient.TargetTag
+		wantErr bool
+	}{
+		{"no filter", nil, [][]llrpclient.TargetTag{{}}, false},
+		{"include and exclude", []ecspec.ECFilterListMember{include("epc", "urn:epc:pat:sgtin-96:3.0614141.*.*"), exclude},
+			[][]llrpclient.TargetTag{{sgtin, tid}}, false},
+		{"patterns in a member", []ecspec.ECFilterListMember{include("epc", "urn:epc:pat:sgtin-96:3.0614141.*.*", "urn:epc:pat:sscc-96:3.0614141.*"), exclude},
+			[][]llrpclient.TargetTag{{sgtin, tid}, {sscc, tid}}, false},
+		{"include members", []ecspec.ECFilterListMember{include("epc", "urn:epc:pat:sgtin-96:3.0614141.*.*", "urn:epc:pat:sscc-96:3.0614141.*"), include("userBank", "x12")},
+			[][]llrpclient.TargetTag{{sgtin, user}, {sscc, user}}, false},
+		{"exclude any", []ecspec.ECFilterListMember{include("epc", "urn:epc:pat:sgtin-96:3.0614141.*.*"),
+			{IncludeExclude: "EXCLUDE", FieldSpec: &ecspec.ECFieldSpec{FieldName: "epc"}, Patterns: []string{"*"}}}, nil, true},
+		{"three filters", []ecspec.ECFilterListMember{include("epc", "urn:epc:pat:sgtin-96:3.0614141.*.*"), include("userBank", "x12"), exclude}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := targetSets(&CCFilterSpec{FilterList: tt.filters}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("targetSets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("targetSets() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_command_opReports(t *testing.T) {
+	spec := newCCSpec(0, op(OpPassword, "", "x1"), op(OpWrite, "epc", "urn:epc:tag:sgtin-96:3.0614141.812345.6789"), op(OpLock, "epc", Permalock), op(OpKill, "", "x2"))
+	cmds, err := compile(spec, nil, tdt.NewCore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []llrpclient.OpSpecResult{
+		{Kind: llrpclient.OpWrite, OpSpecID: 11, Result: 0, NumWordsWritten: 7},
+		{Kind: llrpclient.OpLock, OpSpecID: 12, Result: 7},
+	}
+	want := []reporting.CCOpReport{
+		{OpStatus: reporting.CCSuccess},
+		{OpStatus: reporting.CCSuccess},
+		{OpStatus: reporting.CCPermissionError},
+		{OpStatus: reporting.CCOpNotPossibleError},
+	}
+	if got := cmds[0].opReports(results, []uint16{0, 11, 12, 13}); !reflect.DeepEqual(got, want) {
+		t.Errorf("command.opReports() = %v, want %v", got, want)
+	}
+}
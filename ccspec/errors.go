@@ -0,0 +1,35 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ccspec
+
+import "fmt"
+
+// DuplicateNameError is returned when the CCSpec name is already defined
+type DuplicateNameError struct {
+	SpecName string
+}
+
+func (e *DuplicateNameError) Error() string {
+	return fmt.Sprintf("duplicate CCSpec name: %s", e.SpecName)
+}
+
+// NoSuchNameError is returned when the CCSpec is not defined
+type NoSuchNameError struct {
+	SpecName string
+}
+
+func (e *NoSuchNameError) Error() string {
+	return fmt.Sprintf("no such CCSpec: %s", e.SpecName)
+}
+
+// ValidationError is returned when the CCSpec is invalid
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Reason
+}
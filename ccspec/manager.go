@@ -0,0 +1,273 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ccspec
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iomz/gosstrak/llrpclient"
+	"github.com/iomz/gosstrak/reporting"
+	"github.com/iomz/gosstrak/tagmemory"
+	"github.com/iomz/gosstrak/tdt"
+)
+
+// the IDs of the AccessSpecs and the OpSpecs in the command cycles,
+// apart from the ones of the ROSpecs reading the memory banks
+const (
+	firstAccessSpecID = 0x80000000
+	firstOpSpecID     = 0x100
+)
+
+// Sender sends the LLRP message built with the next messageID of each physical reader
+// in the logical readers, or in all the readers if no logical reader is given
+type Sender func(logicalReaders []string, message func(messageID uint32) []byte)
+
+// Manager holds the defined CCSpecs and runs their command cycles on request
+type Manager struct {
+	mutex        sync.RWMutex
+	specs        map[string]*CCSpec
+	cycles       map[*commandCycle]bool
+	send         Sender
+	fields       *tagmemory.Registry
+	tdtCore      *tdt.Core
+	accessSpecID uint32
+	opSpecID     uint16
+}
+
+// NewManager returns the pointer to a new Manager instance
+func NewManager() *Manager {
+	return &Manager{
+		specs:        make(map[string]*CCSpec),
+		cycles:       make(map[*commandCycle]bool),
+		tdtCore:      tdt.NewCore(),
+		accessSpecID: firstAccessSpecID,
+		opSpecID:     firstOpSpecID,
+	}
+}
+
+// Define validates the CCSpec and defines it
+func (m *Manager) Define(specName string, spec *CCSpec) error {
+	if err := m.validate(spec); err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.specs[specName]; ok {
+		return &DuplicateNameError{specName}
+	}
+	m.specs[specName] = spec
+	log.Printf("[CCSpecManager] defined %s", specName)
+	return nil
+}
+
+// FieldInUse returns true if the fieldname is in the filters or the operations of any CCSpec
+func (m *Manager) FieldInUse(fieldname string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, spec := range m.specs {
+		for _, cs := range spec.CmdSpecs {
+			if cs.Filter != nil {
+				for _, f := range cs.Filter.FilterList {
+					if f.FieldSpec != nil && f.FieldSpec.FieldName == fieldname {
+						return true
+					}
+				}
+			}
+			for _, op := range cs.OpSpecs {
+				if op.FieldSpec != nil && op.FieldSpec.FieldName == fieldname {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ReaderInUse returns true if the logical reader is in any CCSpec
+func (m *Manager) ReaderInUse(name string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, spec := range m.specs {
+		for _, lr := range spec.LogicalReaders {
+			if lr == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetCCSpec returns the CCSpec of the name
+func (m *Manager) GetCCSpec(specName string) (*CCSpec, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	spec, ok := m.specs[specName]
+	if !ok {
+		return nil, &NoSuchNameError{specName}
+	}
+	return spec, nil
+}
+
+// GetCCSpecNames returns the names of the defined CCSpecs
+func (m *Manager) GetCCSpecNames() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	names := make([]string, 0, len(m.specs))
+	for name := range m.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Immediate validates the unnamed CCSpec, runs a command cycle of it, and returns the CCReports
+func (m *Manager) Immediate(spec *CCSpec) (*reporting.CCReports, error) {
+	if err := m.validate(spec); err != nil {
+		return nil, err
+	}
+	return m.run("", spec)
+}
+
+// Poll runs a command cycle of the CCSpec and returns the CCReports
+func (m *Manager) Poll(specName string) (*reporting.CCReports, error) {
+	spec, err := m.GetCCSpec(specName)
+	if err != nil {
+		return nil, err
+	}
+	return m.run(specName, spec)
+}
+
+// Report adds the OpSpecResults in the TagReport to the running command cycle,
+// returns false if the TagReport is not of any command cycle
+func (m *Manager) Report(tr *llrpclient.TagReport) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for cc := range m.cycles {
+		if cc.report(tr) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetSender sets the Sender to send the AccessSpecs to the readers
+func (m *Manager) SetSender(send Sender) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.send = send
+}
+
+// SetTagMemory sets the tagmemory.Registry to resolve the fieldnames in the CCSpecs
+func (m *Manager) SetTagMemory(fields *tagmemory.Registry) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.fields = fields
+}
+
+// Undefine removes the CCSpec and terminates its running command cycles
+func (m *Manager) Undefine(specName string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.specs[specName]; !ok {
+		return &NoSuchNameError{specName}
+	}
+	delete(m.specs, specName)
+	for cc := range m.cycles {
+		if cc.name == specName {
+			cc.terminate()
+		}
+	}
+	log.Printf("[CCSpecManager] undefined %s", specName)
+	return nil
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// nextAccessSpecID returns the AccessSpecID for the next command, the caller must hold the mutex
+func (m *Manager) nextAccessSpecID() uint32 {
+	id := m.accessSpecID
+	if m.accessSpecID++; m.accessSpecID == 0 {
+		m.accessSpecID = firstAccessSpecID
+	}
+	return id
+}
+
+// nextOpSpecID returns the OpSpecID for the next operation, the caller must hold the mutex
+func (m *Manager) nextOpSpecID() uint16 {
+	id := m.opSpecID
+	if m.opSpecID++; m.opSpecID == 0 {
+		m.opSpecID = firstOpSpecID
+	}
+	return id
+}
+
+// run adds the AccessSpecs of the commands to the readers, collects the results until the boundary,
+// and deletes the AccessSpecs
+func (m *Manager) run(specName string, spec *CCSpec) (*reporting.CCReports, error) {
+	m.mutex.Lock()
+	fields, send := m.fields, m.send
+	m.mutex.Unlock()
+	if send == nil {
+		return nil, errors.New("no reader to run the command cycle")
+	}
+	// the fieldnames may be redefined after the CCSpec
+	cmds, err := compile(spec, fields, m.tdtCore)
+	if err != nil {
+		return nil, &ValidationError{err.Error()}
+	}
+	m.mutex.Lock()
+	cc := newCommandCycle(specName, spec, cmds, m.tdtCore, m.nextAccessSpecID, m.nextOpSpecID)
+	m.cycles[cc] = true
+	m.mutex.Unlock()
+
+	start := time.Now()
+	for i, add := range cc.accessSpecs() {
+		accessSpecID := cc.accessSpecID[i]
+		send(spec.LogicalReaders, add)
+		send(spec.LogicalReaders, func(mid uint32) []byte { return llrpclient.EnableAccessSpec(mid, accessSpecID) })
+	}
+	termination := cc.wait()
+	for _, accessSpecID := range cc.accessSpecID {
+		accessSpecID := accessSpecID
+		send(spec.LogicalReaders, func(mid uint32) []byte { return llrpclient.DeleteAccessSpec(mid, accessSpecID) })
+	}
+	m.mutex.Lock()
+	delete(m.cycles, cc)
+	m.mutex.Unlock()
+
+	ccr := cc.makeReports(start, termination)
+	for _, cr := range ccr.CmdReports {
+		succeeded := 0
+		for i := range cr.TagReports {
+			if cr.TagReports[i].Succeeded() {
+				succeeded++
+			}
+		}
+		log.Printf("[CCSpecManager] %s %s: %v of %v tags succeeded", specName, cr.CmdSpecName, succeeded, len(cr.TagReports))
+	}
+	return ccr, nil
+}
+
+// validate checks the CCSpec and compiles it with the current fieldnames
+func (m *Manager) validate(spec *CCSpec) error {
+	if spec == nil {
+		return &ValidationError{"no CCSpec is given"}
+	}
+	if err := spec.Validate(); err != nil {
+		return &ValidationError{err.Error()}
+	}
+	m.mutex.RLock()
+	fields := m.fields
+	m.mutex.RUnlock()
+	if _, err := compile(spec, fields, m.tdtCore); err != nil {
+		return &ValidationError{err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ccspec
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iomz/go-llrp"
+	"github.com/iomz/gosstrak/ecspec"
+	"github.com/iomz/gosstrak/llrpclient"
+	"github.com/iomz/gosstrak/reporting"
+)
+
+func TestManager_Poll(t *testing.T) {
+	m := NewManager()
+	if _, err := m.Poll("encode"); err == nil {
+		t.Errorf("Manager.Poll() of an undefined CCSpec error = nil")
+	}
+	spec := newCCSpec(10*time.Second,
+		op(OpPassword, "", "x1"),
+		op(OpWrite, "epc", "urn:epc:tag:sgtin-96:3.0614141.812345.6789"),
+		op(OpLock, "epc", Permalock))
+	spec.Boundaries.TagsProcessedCount = 2
+	spec.LogicalReaders = []string{"dock"}
+	if err := m.Define("encode", spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Define("encode", spec); err == nil {
+		t.Errorf("Manager.Define() of a duplicate name error = nil")
+	}
+	if !m.FieldInUse("epc") || m.FieldInUse("userBank") {
+		t.Errorf("Manager.FieldInUse() = %v, %v, want true, false", m.FieldInUse("epc"), m.FieldInUse("userBank"))
+	}
+	if !m.ReaderInUse("dock") || m.ReaderInUse("gate") {
+		t.Errorf("Manager.ReaderInUse() = %v, %v, want true, false", m.ReaderInUse("dock"), m.ReaderInUse("gate"))
+	}
+
+	headers := make(chan uint16, 8)
+	m.SetSender(func(logicalReaders []string, message func(uint32) []byte) {
+		headers <- binary.BigEndian.Uint16(message(1))
+	})
+	go func() {
+		for _, want := range []uint16{llrpclient.AddAccessSpecHeader, llrpclient.EnableAccessSpecHeader} {
+			if h := <-headers; h != want {
+				t.Errorf("sent %v, want %v", llrpclient.MessageName(h), llrpclient.MessageName(want))
+			}
+		}
+		id1, _ := hex.DecodeString("302db319a000004000000001")
+		id2, _ := hex.DecodeString("302db319a000004000000002")
+		written, _ := hex.DecodeString("3074257bf7194e4000001a85")
+		for _, tr := range []*llrpclient.TagReport{
+			{ReadEvent: llrp.ReadEvent{PC: []byte{0x30, 0}, ID: id1}, OpSpecResults: []llrpclient.OpSpecResult{
+				{Kind: llrpclient.OpWrite, OpSpecID: firstOpSpecID, NumWordsWritten: 7},
+				{Kind: llrpclient.OpLock, OpSpecID: firstOpSpecID + 1},
+			}},
+			{ReadEvent: llrp.ReadEvent{PC: []byte{0x30, 0}, ID: written}, OpSpecResults: []llrpclient.OpSpecResult{
+				{Kind: llrpclient.OpWrite, OpSpecID: firstOpSpecID, NumWordsWritten: 7},
+			}},
+			{ReadEvent: llrp.ReadEvent{PC: []byte{0x30, 0}, ID: id2}, OpSpecResults: []llrpclient.OpSpecResult{
+				{Kind: llrpclient.OpWrite, OpSpecID: firstOpSpecID, Result: 2},
+			}},
+		} {
+			if !m.Report(tr) {
+				t.Errorf("Manager.Report(%x) = false", tr.ID)
+			}
+		}
+		if m.Report(&llrpclient.TagReport{ReadEvent: llrp.ReadEvent{ID: id1}}) {
+			t.Errorf("Manager.Report() without OpSpecResults = true")
+		}
+	}()
+	ccr, err := m.Poll("encode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := <-headers; h != llrpclient.DeleteAccessSpecHeader {
+		t.Errorf("sent %v, want DELETE_ACCESSSPEC", llrpclient.MessageName(h))
+	}
+	if ccr.SpecName != "encode" || ccr.TerminationCondition != TerminatedByCount || len(ccr.CmdReports) != 1 {
+		t.Fatalf("Manager.Poll() = %+v", ccr)
+	}
+	var got [][]string
+	for _, tr := range ccr.CmdReports[0].TagReports {
+		statuses := []string{}
+		for _, op := range tr.OpReports {
+			statuses = append(statuses, op.OpStatus)
+		}
+		got = append(got, statuses)
+	}
+	want := [][]string{
+		{reporting.CCSuccess, reporting.CCSuccess, reporting.CCSuccess},
+		{reporting.CCSuccess, reporting.CCPermissionError, reporting.CCOpNotPossibleError},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Manager.Poll() opStatus = %v, want %v", got, want)
+	}
+}
+
+func TestManager_Undefine(t *testing.T) {
+	m := NewManager()
+	m.SetSender(func([]string, func(uint32) []byte) {})
+	if err := m.Define("kill", newCCSpec(time.Hour, op(OpKill, "", "x1"))); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan *reporting.CCReports)
+	go func() {
+		ccr, _ := m.Poll("kill")
+		done <- ccr
+	}()
+	// wait for the command cycle to start
+	for {
+		m.mutex.RLock()
+		n := len(m.cycles)
+		m.mutex.RUnlock()
+		if n != 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := m.Undefine("kill"); err != nil {
+		t.Fatal(err)
+	}
+	if ccr := <-done; ccr.TerminationCondition != ecspec.TerminatedByUndefine {
+		t.Errorf("Manager.Poll() terminated by %v, want %v", ccr.TerminationCondition, ecspec.TerminatedByUndefine)
+	}
+	if err := m.Undefine("kill"); err == nil {
+		t.Errorf("Manager.Undefine() of an undefined CCSpec error = nil")
+	}
+}
@@ -6,19 +6,34 @@
 package main
 
 import (
-	"encoding/binary"
-	"io"
+	"encoding/hex"
+	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"path"
+	"reflect"
 	"runtime"
+	"sort"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/docker/libchan/spdy"
-	"github.com/iomz/go-llrp"
+	"github.com/iomz/gosstrak/ale"
+	"github.com/iomz/gosstrak/ccspec"
+	"github.com/iomz/gosstrak/ecspec"
 	"github.com/iomz/gosstrak/filtering"
+	"github.com/iomz/gosstrak/llrpclient"
+	"github.com/iomz/gosstrak/logicalreader"
+	"github.com/iomz/gosstrak/management"
 	"github.com/iomz/gosstrak/monitoring"
+	"github.com/iomz/gosstrak/reporting"
+	"github.com/iomz/gosstrak/smoothing"
+	"github.com/iomz/gosstrak/tagmemory"
+	"github.com/iomz/gosstrak/tdt"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -54,6 +69,10 @@ var (
 			Short('f').
 			Default("ecspec.csv").
 			String()
+	tdtSchemeDir = app.
+			Flag("tdtSchemeDir", "A directory contains the TDT scheme definitions in XML to translate the tags with.").
+			Default("").
+			String()
 
 	// LLRP related values
 	llrpInitialMessageID = app.
@@ -66,12 +85,114 @@ var (
 			Short('l').
 			Default("127.0.0.1:5084").
 			String()
+	readerFile = app.
+			Flag("readerFile", "A CSV file contains the name and the address of a reader in each line, --ip is used if not specified.").
+			Default("").
+			String()
+	rospecFile = app.
+			Flag("rospecFile", "A JSON file contains the ROSpec for each reader name, or \"default\" for all the readers, to configure the readers.").
+			Default("").
+			String()
+	keepalivePeriod = app.
+			Flag("keepalivePeriod", "The period of KEEP_ALIVE to configure the readers with, 0 not to supervise the keepalives.").
+			Default("10s").
+			Duration()
+	keepaliveMisses = app.
+			Flag("keepaliveMisses", "The number of the missed keepalives to declare a reader dead and reconnect.").
+			Default("3").
+			Int()
+	tmspecFile = app.
+			Flag("tmspecFile", "A JSON file contains the TMSpecs keyed by the spec name to define the fieldnames on startup.").
+			Default("").
+			String()
+	logicalReaderFile = app.
+				Flag("logicalReaderFile", "A JSON file contains the logical reader definitions keyed by the name.").
+				Default("").
+				String()
+	llrpListenAddr = app.
+			Flag("listen", "Accept the reader-initiated LLRP connections on the address (e.g., 0.0.0.0:5084), --ip is not used if specified.").
+			Default("").
+			String()
+	listenReaderFile = app.
+				Flag("listenReaderFile", "A CSV file contains the name and the IP address of an inbound reader in each line, the others are named after their IP addresses.").
+				Default("").
+				String()
+
+	// smoothing related values
+	smoothWindow = app.
+			Flag("smoothWindow", "Pass a read of a present tag to the engines once in the window, 0 to disable the smoothing.").
+			Default("0s").
+			Duration()
+	smoothEntryThreshold = app.
+				Flag("smoothEntryThreshold", "The number of reads in a window for a tag to appear.").
+				Default("1").
+				Int()
+	smoothExitThreshold = app.
+				Flag("smoothExitThreshold", "The number of windows without reads for a tag to disappear.").
+				Default("2").
+				Int()
+	smoothBy = app.
+			Flag("smoothBy", "Smooth the reads of each tag per reader, antenna, or logical reader.").
+			Default("antenna").
+			Enum("reader", "antenna", "logicalReader")
 
 	// ALE related values
 	managementAddr = app.
 			Flag("managementAddr", "Psuedo ALE management endpoint").
 			Default("127.0.0.1:2784").
 			String()
+	restAddr = app.
+			Flag("restAddr", "The address to serve the management REST API.").
+			Default("127.0.0.1:2785").
+			String()
+	aleAddr = app.
+		Flag("aleAddr", "The address to serve the ALE APIs in SOAP at /services/ALEService, ALETMService, and ALECCService (e.g., 0.0.0.0:8080 to accept the remote clients).").
+		Default("127.0.0.1:8080").
+		String()
+
+	// event cycle related values
+	ecDuration = app.
+			Flag("ecDuration", "The duration of the event cycles for the subscriptions in the ecspecfile.").
+			Default("1s").
+			Duration()
+	ecRepeatPeriod = app.
+			Flag("ecRepeatPeriod", "The interval between the starts of the event cycles, 0 to start immediately.").
+			Default("0s").
+			Duration()
+	ecStableSetInterval = app.
+				Flag("ecStableSetInterval", "End the event cycle when no new tag is read in the interval, 0 to disable.").
+				Default("0s").
+				Duration()
+	ecReportSet = app.
+			Flag("ecReportSet", "The set of tags reported at the end of the event cycles.").
+			Default("CURRENT").
+			Enum("CURRENT", "ADDITIONS", "DELETIONS")
+	ecReaderMetadata = app.
+				Flag("ecReaderMetadata", "Include the antenna, RSSI, timestamps and read count of the tags in the reports.").
+				Default("false").
+				Bool()
+	ecOutputFormats = app.
+			Flag("ecOutputFormats", "The representations of the tags in the reports for the subscriptions without their own.").
+			Default("epc").
+			Enums("epc", "tag", "rawHex", "rawDecimal", "binary")
+
+	// reporting related values
+	reportQueueSize = app.
+			Flag("reportQueueSize", "The number of ECReports buffered per report URI.").
+			Default("128").
+			Int()
+	reportRetries = app.
+			Flag("reportRetries", "The number of retries before an ECReport goes to the dead letter file.").
+			Default("3").
+			Int()
+	reportTimeout = app.
+			Flag("reportTimeout", "The timeout for delivering an ECReport.").
+			Default("5s").
+			Duration()
+	deadLetterFile = app.
+			Flag("deadLetterFile", "A file to store undeliverable ECReports.").
+			Default("/var/tmp/gosstrak-fc-cache/deadletter.log").
+			String()
 
 	// stat related values
 	enableStat = app.
@@ -101,9 +222,6 @@ var (
 
 	// start command
 	cmdStart = app.Command("start", "Start the gosstrak-fc.")
-
-	// Current messageID
-	currentMessageID = uint32(*llrpInitialMessageID)
 )
 
 func getPackagePath() string {
@@ -115,6 +233,81 @@ func getPackagePath() string {
 	return path.Dir(filename)
 }
 
+// addSubscription subscribes the pattern for the reportURI and defines or scopes its event cycle,
+// the pattern is unsubscribed again if the event cycle fails
+func addSubscription(ef *filtering.EngineFactory, ecsm *ecspec.Manager, mm *filtering.ManagementMessage) error {
+	// validate the output formats before touching the engines
+	if mm.OutputFormats != nil {
+		if _, err := reporting.ParseOutputFormat(mm.OutputFormats); err != nil {
+			return err
+		}
+	}
+	if err := ef.AddSubscription(mm.ReportURI, mm.Pattern); err != nil {
+		return err
+	}
+	var err error
+	// the first pattern for the reportURI needs an event cycle
+	if spec, e := ecsm.GetECSpec(mm.ReportURI); e != nil {
+		err = defineEventCycle(ecsm, mm.ReportURI, mm.LogicalReaders, mm.OutputFormats)
+	} else if mm.LogicalReaders != nil || mm.OutputFormats != nil {
+		logicalReaders := mm.LogicalReaders
+		if logicalReaders == nil {
+			logicalReaders = spec.LogicalReaders
+		}
+		err = scopeEventCycle(ecsm, mm.ReportURI, logicalReaders, mm.OutputFormats)
+	}
+	if err != nil {
+		// a retry shouldn't fail as already subscribed
+		ef.DeleteSubscription(mm.ReportURI, mm.Pattern)
+	}
+	return err
+}
+
+// defineEventCycle defines an ECSpec from the flags for the reportURI
+// scoped to the logical readers in the output formats and subscribes it
+func defineEventCycle(ecsm *ecspec.Manager, reportURI string, logicalReaders []string, outputFormats []string) error {
+	if outputFormats == nil {
+		outputFormats = *ecOutputFormats
+	}
+	of, err := reporting.ParseOutputFormat(outputFormats)
+	if err != nil {
+		return err
+	}
+	spec := ecspec.NewDefaultECSpec("report", *ecDuration, *ecRepeatPeriod, *ecStableSetInterval, ecspec.ReportSet(*ecReportSet))
+	spec.LogicalReaders = logicalReaders
+	if *ecReaderMetadata || of != reporting.OutputEPC {
+		spec.ReportSpecs[0].Output = ecspec.NewECReportOutputSpec(of, *ecReaderMetadata)
+	}
+	if err = ecsm.Define(reportURI, spec); err != nil {
+		return err
+	}
+	return ecsm.Subscribe(reportURI, reportURI)
+}
+
+// scopeEventCycle redefines the ECSpec for the reportURI if the logical readers or the output formats are changed,
+// the output formats are kept if nil
+func scopeEventCycle(ecsm *ecspec.Manager, reportURI string, logicalReaders []string, outputFormats []string) error {
+	spec, err := ecsm.GetECSpec(reportURI)
+	if err != nil {
+		return err
+	}
+	current := spec.ReportSpecs[0].Output.OutputFormat()
+	of := current
+	if outputFormats != nil {
+		if of, err = reporting.ParseOutputFormat(outputFormats); err != nil {
+			return err
+		}
+	}
+	sameReaders := len(spec.LogicalReaders) == 0 && len(logicalReaders) == 0 || reflect.DeepEqual(spec.LogicalReaders, logicalReaders)
+	if sameReaders && of == current {
+		return nil
+	}
+	if err = ecsm.Undefine(reportURI); err != nil {
+		return err
+	}
+	return defineEventCycle(ecsm, reportURI, logicalReaders, of.Names())
+}
+
 func run() {
 	log.Println("initializing gosstrak-fc for master mode...")
 
@@ -125,10 +318,90 @@ func run() {
 		sm = monitoring.NewStatManager("master", *influxAddr, *influxUser, *influxPass, *influxDB)
 	}
 
+	// load the TDT scheme definitions before the engines
+	if len(*tdtSchemeDir) != 0 {
+		log.Printf("loading TDT scheme definitions from %v", *tdtSchemeDir)
+		if err := tdt.LoadDefaultSchemes(*tdtSchemeDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// load existing subscriptions from file
 	log.Println("loading subscriptions from file")
 	sub := filtering.LoadSubscriptionsFromCSVFile(*ecspecFile)
 
+	// define the fieldnames in the subscriptions with the TMSpecs before the engines
+	fields := tagmemory.NewRegistry()
+	if len(*tmspecFile) != 0 {
+		log.Printf("loading TMSpecs from %v", *tmspecFile)
+		specs, err := tagmemory.LoadSpecsFromJSONFile(*tmspecFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		names := []string{}
+		for name := range specs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err = fields.Define(name, specs[name]); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if err := sub.ValidateMemoryPatterns(fields); err != nil {
+		log.Fatalf("%v, give the TMSpecs of the fieldnames with --tmspecFile", err)
+	}
+
+	// set up a Reporter to deliver ECReports
+	log.Println("setting up a reporter")
+	reporter, err := reporting.NewReporter(reporting.Config{
+		QueueSize:      *reportQueueSize,
+		MaxRetries:     *reportRetries,
+		Timeout:        *reportTimeout,
+		DeadLetterFile: *deadLetterFile,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer reporter.Close()
+
+	// set up the logical readers
+	log.Println("setting up logical readers")
+	registry := logicalreader.NewRegistry()
+	if len(*logicalReaderFile) != 0 {
+		specs, err := logicalreader.LoadSpecsFromJSONFile(*logicalReaderFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		names := []string{}
+		for name := range specs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err = registry.Define(name, specs[name]); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	// set up the event cycles for the subscriptions
+	log.Println("setting up event cycles")
+	ecsm := ecspec.NewManager(func(subscriber string, ecr *reporting.ECReports) {
+		if err := reporter.Report(subscriber, ecr); err != nil {
+			log.Print(err)
+		}
+	})
+	ecsm.SetReaderScope(registry.Contains)
+	// stop the delivery to the reportURIs without any subscription
+	ecsm.SetUnsubscribed(reporter.Remove)
+	for _, reportURI := range sub.Keys() {
+		if err = defineEventCycle(ecsm, reportURI, nil, nil); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// receive the engine instance status
 	log.Println("setting up a management channel")
 	mc := make(chan filtering.ManagementMessage, QueueSize)
@@ -170,12 +443,65 @@ func run() {
 	// set up an EngineFactory with a management channel
 	log.Println("setting up an engine factory")
 	engineFactory := filtering.NewEngineFactory(sub, *statInterval, mc)
+
+	// resolve the fieldnames in the filters and the reports with the TMSpecs
+	engineFactory.SetTagMemory(fields)
+	ecsm.SetTagMemory(fields)
+	// run the command cycles to write to the tags
+	ccsm := ccspec.NewManager()
+	ccsm.SetTagMemory(fields)
+	fields.SetInUse(func(fieldname string) bool {
+		return engineFactory.FieldInUse(fieldname) || ecsm.FieldInUse(fieldname) || ccsm.FieldInUse(fieldname)
+	})
 	go engineFactory.Run()
 	// wait until the first engine becomes available
 	for !engineFactory.IsActive() {
 		time.Sleep(time.Second)
 	}
 
+	// serve the ALE reading API
+	log.Println("setting up an ALE service")
+	aleService := ale.NewService(ecsm, engineFactory)
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/services/ALEService", aleService)
+		mux.Handle("/services/ALETMService", ale.NewTMService(fields))
+		mux.Handle("/services/ALECCService", ale.NewCCService(ccsm))
+		log.Fatal(http.ListenAndServe(*aleAddr, mux))
+	}()
+
+	// apply the ManagementMessage from the management interfaces
+	var applyMutex sync.Mutex
+	apply := func(mm *filtering.ManagementMessage) error {
+		applyMutex.Lock()
+		defer applyMutex.Unlock()
+		for _, lr := range mm.LogicalReaders {
+			if !registry.Exists(lr) {
+				return fmt.Errorf("no such logical reader: %s", lr)
+			}
+		}
+		switch mm.Type {
+		case filtering.AddSubscription:
+			return addSubscription(engineFactory, ecsm, mm)
+		case filtering.DeleteSubscription:
+			if err := engineFactory.DeleteSubscription(mm.ReportURI, mm.Pattern); err != nil {
+				return err
+			}
+			// no more pattern for the reportURI
+			if _, ok := engineFactory.Subscriptions()[mm.ReportURI]; !ok {
+				return ecsm.Undefine(mm.ReportURI)
+			}
+		case filtering.ScopeSubscription:
+			if _, ok := engineFactory.Subscriptions()[mm.ReportURI]; !ok {
+				return fmt.Errorf("no subscription for %s", mm.ReportURI)
+			}
+			return scopeEventCycle(ecsm, mm.ReportURI, mm.LogicalReaders, mm.OutputFormats)
+		default:
+			mc <- *mm
+		}
+		return nil
+	}
+
 	// receive management access
 	log.Println("setting up an management interface")
 	go func() {
@@ -209,14 +535,39 @@ func run() {
 				continue
 			}
 			log.Print(mm)
-			mc <- *mm
+			if err = apply(mm); err != nil {
+				log.Print(err)
+			}
 		}
 		log.Fatalln("managementListener closed in gosstrak-fc")
 	}()
 
+	// suppress the duplicate reads per reader, antenna, or logical reader
+	var smoother *smoothing.Smoother
+	if *smoothWindow > 0 {
+		log.Printf("setting up a smoother by %s", *smoothBy)
+		smoother = smoothing.NewSmoother(smoothing.Config{
+			Window:         *smoothWindow,
+			EntryThreshold: *smoothEntryThreshold,
+			ExitThreshold:  *smoothExitThreshold,
+		}, func(ev smoothing.Event) {
+			if *verbose {
+				log.Printf("[Smoothing] %s %s in %s", ev.Tag, ev.Type, ev.Source)
+			}
+			if sm != nil {
+				sm.StatMessageChannel <- monitoring.StatMessage{
+					Type:  monitoring.TagPresence,
+					Value: []interface{}{ev.Tag, ev.Type.String()},
+					Name:  ev.Source,
+				}
+			}
+		})
+		defer smoother.Close()
+	}
+
 	// receive incoming IDs and translate them in PureIdentity
 	log.Println("setting up an incoming ReadEvent channel")
-	var rq = make(chan []*llrp.ReadEvent)
+	var rq = make(chan readerEvents)
 	go func() {
 		for {
 			res, ok := <-rq
@@ -224,83 +575,195 @@ func run() {
 				break
 			}
 
-			reports := map[string][]string{}
-			for _, re := range res {
-				pureIdentity, reportURIs, err := engineFactory.Search(*re)
+			for _, tr := range res.events {
+				// the results of the command cycles are not reads
+				if ccsm.Report(tr) {
+					continue
+				}
+				// the sources where the read passed the smoothing
+				passed := map[string]bool{}
+				if smoother != nil {
+					id, now := hex.EncodeToString(tr.ID), time.Now()
+					for _, source := range smoothingSources(*smoothBy, registry, res.reader, tr.AntennaID) {
+						if smoother.Observe(source, id, now) {
+							passed[source] = true
+						}
+					}
+					if len(passed) == 0 {
+						continue
+					}
+				}
+				inScope := func(specName string) bool {
+					if !ecsm.InScope(specName, res.reader, tr.AntennaID) {
+						return false
+					}
+					return smoother == nil || *smoothBy != "logicalReader" || smoothedIn(ecsm, specName, res.reader, passed)
+				}
+				pureIdentity, reportURIs, err := engineFactory.SearchTag(tr.ReadEvent, tr.TID, tr.User)
 				if err != nil { // no much or something went wrong
 					continue
 				}
-				for _, dest := range reportURIs {
-					if _, ok := reports[dest]; !ok {
-						reports[dest] = []string{}
+				// accumulate the results in the event cycles
+				md := tagMetadata(tr)
+				reports, others := aleService.MatchedReports(reportURIs)
+				for _, r := range reports {
+					if inScope(r.SpecName) {
+						ecsm.AddToReport(r.SpecName, r.ReportName, pureIdentity, md)
+					}
+				}
+				for _, dest := range others {
+					if inScope(dest) {
+						ecsm.Add(dest, pureIdentity, md)
 					}
-					reports[dest] = append(reports[dest], pureIdentity)
 				}
-			}
-			// do report
-			for _, dest := range reports {
-				_ = dest
 			}
 		}
 		log.Fatalln("ReadEvent listener exited in gosstrak-fc")
 	}()
 
-	// establish a connection to the llrp client
-	log.Println("waiting for the interrogator to becom online...")
-	conn, err := net.Dial("tcp", *llrpAddr)
-	for err != nil {
-		time.Sleep(1 * time.Second)
-		conn, err = net.Dial("tcp", *llrpAddr)
-	}
-	log.Printf("establised an LLRP connection to the interrogator %v", conn.RemoteAddr())
-
-	// prepare LLRP header storage
-	header := make([]byte, 2)
-	length := make([]byte, 4)
-	messageID := make([]byte, 4)
-	for {
-		_, err = io.ReadFull(conn, header)
+	// connect to the readers
+	log.Println("connecting to the readers")
+	rm := newReaderManager(uint32(*llrpInitialMessageID), rq)
+	defer rm.Close()
+	// resolve the logical readers to the known physical readers only,
+	// and keep the ones in the ECSpecs and the CCSpecs
+	registry.SetPhysicalReader(rm.Known)
+	registry.SetInUse(func(name string) bool {
+		return ecsm.ReaderInUse(name) || ccsm.ReaderInUse(name)
+	})
+	aleService.SetLogicalReaders(registry.Exists)
+	rm.SetKeepalive(*keepalivePeriod, *keepaliveMisses)
+	if len(*rospecFile) != 0 {
+		rospecs, err := llrpclient.LoadROSpecsFromJSONFile(*rospecFile)
 		if err != nil {
 			log.Fatal(err)
 		}
-		_, err = io.ReadFull(conn, length)
+		rm.SetROSpecs(rospecs)
+	}
+	readers := []readerConfig{{*llrpAddr, *llrpAddr}}
+	if len(*listenReaderFile) != 0 {
+		inbound, err := loadReadersFromCSVFile(*listenReaderFile)
 		if err != nil {
 			log.Fatal(err)
 		}
-		_, err = io.ReadFull(conn, messageID)
-		if err != nil {
+		names := map[string]string{}
+		for _, rc := range inbound {
+			names[rc.address] = rc.name
+		}
+		rm.SetInboundNames(names)
+	}
+	if len(*llrpListenAddr) != 0 {
+		if err = rm.Listen(*llrpListenAddr); err != nil {
 			log.Fatal(err)
 		}
-		// length containts the size of the entire message in octets
-		// starting from bit offset 0, hence, the message size is
-		// length - 10 bytes
-		var messageValue []byte
-		if messageSize := binary.BigEndian.Uint32(length) - 10; messageSize != 0 {
-			messageValue = make([]byte, binary.BigEndian.Uint32(length)-10)
-			_, err = io.ReadFull(conn, messageValue)
-			if err != nil {
-				log.Fatal(err)
+		readers = []readerConfig{}
+	}
+	if len(*readerFile) != 0 {
+		if readers, err = loadReadersFromCSVFile(*readerFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, rc := range readers {
+		if err = rm.AddReader(rc.name, rc.address); err != nil {
+			log.Fatal(err)
+		}
+	}
+	ccsm.SetSender(func(logicalReaders []string, message func(messageID uint32) []byte) {
+		var names []string
+		for _, lr := range logicalReaders {
+			names = append(names, registry.PhysicalReaders(lr)...)
+		}
+		rm.Send(names, message)
+	})
+	if *enableStat {
+		// publish the reader health
+		go func() {
+			for range time.Tick(time.Duration(*statInterval) * time.Second) {
+				for _, rs := range rm.Readers() {
+					sm.StatMessageChannel <- monitoring.StatMessage{
+						Type:  monitoring.ReaderHealth,
+						Value: []interface{}{rs.Health, rs.MissedKeepalives},
+						Name:  rs.Name,
+					}
+				}
+			}
+		}()
+	}
+
+	// serve the management REST API
+	log.Println("setting up a management REST API")
+	restHandler := management.NewRESTHandler(engineFactory, apply)
+	restHandler.HandleReaders(rm)
+	restHandler.HandleLogicalReaders(registry)
+	go func() {
+		log.Fatal(http.ListenAndServe(*restAddr, restHandler))
+	}()
+
+	// wait for a signal to shut down
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	log.Printf("received %v, shutting down...", <-sig)
+}
+
+// tagMetadata returns the reporting.TagMetadata of the TagReport
+func tagMetadata(tr *llrpclient.TagReport) *reporting.TagMetadata {
+	md := &reporting.TagMetadata{
+		AntennaID: tr.AntennaID,
+		ReadCount: int(tr.SeenCount),
+		ID:        tr.ID,
+		PC:        tr.PC,
+		TID:       tr.TID,
+		User:      tr.User,
+	}
+	if tr.HasPeakRSSI {
+		rssi := tr.PeakRSSI
+		md.PeakRSSI = &rssi
+	}
+	if !tr.FirstSeen.IsZero() {
+		firstSeen := tr.FirstSeen
+		md.FirstSeen = &firstSeen
+	}
+	if !tr.LastSeen.IsZero() {
+		lastSeen := tr.LastSeen
+		md.LastSeen = &lastSeen
+	}
+	return md
+}
+
+// smoothingSources returns the sources to smooth a read from the antenna of the reader in,
+// the reader itself and the logical readers containing the antenna for logicalReader
+func smoothingSources(by string, registry *logicalreader.Registry, reader string, antenna uint16) []string {
+	switch by {
+	case "antenna":
+		return []string{fmt.Sprintf("%s/%d", reader, antenna)}
+	case "logicalReader":
+		sources := []string{reader}
+		for _, name := range registry.Names() {
+			if registry.Contains(name, reader, antenna) {
+				sources = append(sources, name)
 			}
 		}
+		return sources
+	}
+	return []string{reader}
+}
 
-		h := binary.BigEndian.Uint16(header)
-		mid := binary.BigEndian.Uint32(messageID)
-		switch h {
-		case llrp.ReaderEventNotificationHeader:
-			log.Printf("[LLRP] %v >>> READER_EVENT_NOTIFICATION[%v]", conn.RemoteAddr(), mid)
-			conn.Write(llrp.SetReaderConfig(currentMessageID))
-		case llrp.KeepaliveHeader:
-			log.Printf("[LLRP] %v >>> KEEP_ALIVE[%v]", conn.RemoteAddr(), mid)
-			conn.Write(llrp.KeepaliveAck(currentMessageID))
-		case llrp.SetReaderConfigResponseHeader:
-			log.Printf("[LLRP] %v >>> SET_READER_CONFIG_RESPONSE[%v]", conn.RemoteAddr(), mid)
-		case llrp.ROAccessReportHeader:
-			log.Printf("[LLRP] %v >>> RO_ACCESS_REPORT[%v]", conn.RemoteAddr(), mid)
-			rq <- llrp.UnmarshalROAccessReportBody(messageValue)
-		default:
-			log.Fatalf("Unknown LLRP Message Header: %v\n", h)
+// smoothedIn returns true if the read passed the smoothing in any logical reader of the ECSpec,
+// or in the reader for the ECSpec without logical readers
+func smoothedIn(ecsm *ecspec.Manager, specName string, reader string, passed map[string]bool) bool {
+	spec, err := ecsm.GetECSpec(specName)
+	if err != nil {
+		return false
+	}
+	if len(spec.LogicalReaders) == 0 {
+		return passed[reader]
+	}
+	for _, lr := range spec.LogicalReaders {
+		if passed[lr] {
+			return true
 		}
 	}
+	return false
 }
 
 func main() {
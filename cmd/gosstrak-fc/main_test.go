@@ -5,7 +5,16 @@
 
 package main
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iomz/gosstrak/ecspec"
+	"github.com/iomz/gosstrak/filtering"
+	"github.com/iomz/gosstrak/logicalreader"
+	"github.com/iomz/gosstrak/reporting"
+)
 
 func Test_getPackagePath(t *testing.T) {
 	tests := []struct {
@@ -22,3 +31,72 @@ func Test_getPackagePath(t *testing.T) {
 		})
 	}
 }
+
+func Test_smoothingSources(t *testing.T) {
+	registry := logicalreader.NewRegistry()
+	registry.Define("dock", &logicalreader.Spec{PhysicalReader: "r1", Antennas: []uint16{1}})
+	registry.Define("gate", &logicalreader.Spec{PhysicalReader: "r1", Antennas: []uint16{2}})
+	registry.Define("site", &logicalreader.Spec{IsComposite: true, Readers: []string{"dock", "gate"}})
+	tests := []struct {
+		name    string
+		by      string
+		antenna uint16
+		want    []string
+	}{
+		{"reader", "reader", 1, []string{"r1"}},
+		{"antenna", "antenna", 1, []string{"r1/1"}},
+		{"logicalReader", "logicalReader", 1, []string{"r1", "dock", "site"}},
+		{"logicalReader without definitions", "logicalReader", 3, []string{"r1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := smoothingSources(tt.by, registry, "r1", tt.antenna); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("smoothingSources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_addSubscription(t *testing.T) {
+	defer func(d time.Duration, set string) { *ecDuration, *ecReportSet = d, set }(*ecDuration, *ecReportSet)
+	*ecReportSet = "CURRENT"
+	ef := filtering.NewEngineFactory(filtering.Subscriptions{}, 1, make(chan filtering.ManagementMessage, 64))
+	ecsm := ecspec.NewManager(func(string, *reporting.ECReports) {})
+	mm := &filtering.ManagementMessage{
+		Type:          filtering.AddSubscription,
+		ReportURI:     "http://localhost:8888/sgtin",
+		Pattern:       "urn:epc:pat:sgtin-96:3.12345678",
+		OutputFormats: []string{"unknown"},
+	}
+
+	// an unknown output format is rejected before subscribing
+	if err := addSubscription(ef, ecsm, mm); err == nil {
+		t.Errorf("addSubscription() succeeded with an unknown output format")
+	}
+	if got := ef.Subscriptions(); len(got) != 0 {
+		t.Errorf("Subscriptions() = %v after an unknown output format, want none", got)
+	}
+
+	// the pattern is unsubscribed if the event cycle fails
+	mm.OutputFormats = []string{"tag"}
+	*ecDuration = 0
+	if err := addSubscription(ef, ecsm, mm); err == nil {
+		t.Errorf("addSubscription() succeeded without any stopping condition")
+	}
+	if got := ef.Subscriptions(); len(got) != 0 {
+		t.Errorf("Subscriptions() = %v after the event cycle failed, want none", got)
+	}
+
+	// the retry isn't refused as already subscribed
+	*ecDuration = time.Second
+	if err := addSubscription(ef, ecsm, mm); err != nil {
+		t.Fatalf("addSubscription() error = %v", err)
+	}
+	defer ecsm.Undefine(mm.ReportURI)
+	if got, want := ef.Subscriptions(), (filtering.Subscriptions{mm.ReportURI: {mm.Pattern}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Subscriptions() = %v, want %v", got, want)
+	}
+	if _, err := ecsm.GetECSpec(mm.ReportURI); err != nil {
+		t.Errorf("GetECSpec() error = %v", err)
+	}
+}
@@ -0,0 +1,460 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iomz/gosstrak/llrpclient"
+	"github.com/iomz/gosstrak/management"
+)
+
+// Reader states
+const (
+	ReaderConnecting = "connecting"
+	ReaderConnected  = "connected"
+	ReaderStopped    = "stopped"
+)
+
+// backoff for reconnecting to the readers
+var (
+	readerInitialBackoff = time.Second
+	readerMaxBackoff     = time.Minute
+)
+
+// readerEvents is the TagReports reported by a reader
+type readerEvents struct {
+	reader string
+	events []*llrpclient.TagReport
+}
+
+// readerConfig is a reader to connect
+type readerConfig struct {
+	name    string
+	address string
+}
+
+// Reader maintains the LLRP connection to a physical reader
+type Reader struct {
+	Name    string
+	Address string
+	client  *llrpclient.Client
+	rq      chan<- readerEvents
+	mutex   sync.Mutex
+	inbound net.Conn
+	state   string
+	quit    chan struct{}
+	done    chan struct{}
+	// quitOnce guards quit from Stop and the teardown of an inbound reader
+	quitOnce sync.Once
+}
+
+// NewReader returns the pointer to a new Reader instance,
+// the ReadEvents from the reader are sent to rq
+func NewReader(name string, address string, initialMessageID uint32, rq chan<- readerEvents) *Reader {
+	return &Reader{
+		Name:    name,
+		Address: address,
+		client:  llrpclient.NewClient(name, initialMessageID),
+		rq:      rq,
+		state:   ReaderConnecting,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// NewInboundReader returns the pointer to a new Reader instance
+// for the connection initiated by the reader
+func NewInboundReader(name string, conn net.Conn, initialMessageID uint32, rq chan<- readerEvents) *Reader {
+	r := NewReader(name, conn.RemoteAddr().String(), initialMessageID, rq)
+	r.inbound = conn
+	return r
+}
+
+// SetROSpec sets the ROSpec to push to the reader on connection
+func (r *Reader) SetROSpec(rc *llrpclient.ROSpecConfig) {
+	r.client.ROSpec = rc
+}
+
+// SetKeepalive sets the keepalive period to push to the reader
+// and the number of the missed keepalives to reconnect
+func (r *Reader) SetKeepalive(period time.Duration, misses int) {
+	r.client.KeepalivePeriod = period
+	r.client.KeepaliveMisses = misses
+}
+
+// Start starts connecting to the reader
+func (r *Reader) Start() {
+	go r.forward()
+	go r.run()
+}
+
+// State returns the current state of the connection
+func (r *Reader) State() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.state
+}
+
+// Stop deletes the ROSpec, closes the connection and stops reconnecting
+func (r *Reader) Stop() {
+	r.shutdown()
+	<-r.done
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// dial connects to the reader with backoff until it succeeds,
+// returns nil if the Reader is stopped
+func (r *Reader) dial() net.Conn {
+	backoff := readerInitialBackoff
+	for {
+		conn, err := net.Dial("tcp", r.Address)
+		if err == nil {
+			return conn
+		}
+		log.Printf("[Reader] %s: %v, retrying in %v", r.Name, err, backoff)
+		select {
+		case <-r.quit:
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > readerMaxBackoff {
+			backoff = readerMaxBackoff
+		}
+	}
+}
+
+// forward sends the TagReports from the client to rq until the Reader is stopped
+func (r *Reader) forward() {
+	for {
+		select {
+		case events := <-r.client.Events():
+			select {
+			case r.rq <- readerEvents{r.Name, events}:
+			case <-r.quit:
+				return
+			}
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// run keeps the connection to the reader until the Reader is stopped
+func (r *Reader) run() {
+	defer close(r.done)
+	for {
+		conn := r.inbound
+		if conn == nil {
+			r.setState(ReaderConnecting)
+			if conn = r.dial(); conn == nil {
+				r.setState(ReaderStopped)
+				return
+			}
+		}
+		log.Printf("[Reader] %s: established an LLRP connection to %v", r.Name, conn.RemoteAddr())
+		r.setState(ReaderConnected)
+		err := r.client.Serve(conn)
+		select {
+		case <-r.quit:
+			r.setState(ReaderStopped)
+			return
+		default:
+		}
+		log.Printf("[Reader] %s: lost the connection: %v", r.Name, err)
+		if r.inbound != nil {
+			// the reader is responsible for reconnecting, stop forwarding and release the client
+			r.shutdown()
+			r.setState(ReaderStopped)
+			return
+		}
+	}
+}
+
+// shutdown stops forwarding and closes the client once
+func (r *Reader) shutdown() {
+	r.quitOnce.Do(func() {
+		close(r.quit)
+		r.client.Close()
+	})
+}
+
+// setState updates the state
+func (r *Reader) setState(state string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.state = state
+}
+
+// readerManager manages the set of Readers
+type readerManager struct {
+	mutex            sync.Mutex
+	readers          map[string]*Reader
+	rq               chan<- readerEvents
+	initialMessageID uint32
+	listener         net.Listener
+	rospecs          map[string]*llrpclient.ROSpecConfig
+	inboundNames     map[string]string
+	keepalivePeriod  time.Duration
+	keepaliveMisses  int
+}
+
+// newReaderManager returns the pointer to a new readerManager instance
+func newReaderManager(initialMessageID uint32, rq chan<- readerEvents) *readerManager {
+	return &readerManager{
+		readers:          make(map[string]*Reader),
+		rq:               rq,
+		initialMessageID: initialMessageID,
+	}
+}
+
+// AddReader starts connecting to a new reader
+func (rm *readerManager) AddReader(name string, address string) error {
+	if len(name) == 0 || len(address) == 0 {
+		return fmt.Errorf("name and address are required for a reader")
+	}
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	if _, ok := rm.readers[name]; ok {
+		return fmt.Errorf("duplicate reader name: %s", name)
+	}
+	r := NewReader(name, address, rm.initialMessageID, rm.rq)
+	r.SetROSpec(rm.rospecFor(name))
+	r.SetKeepalive(rm.keepalivePeriod, rm.keepaliveMisses)
+	rm.readers[name] = r
+	r.Start()
+	log.Printf("[ReaderManager] added %s at %s", name, address)
+	return nil
+}
+
+// Close stops listening and disconnects all the readers
+func (rm *readerManager) Close() {
+	rm.mutex.Lock()
+	if rm.listener != nil {
+		rm.listener.Close()
+		rm.listener = nil
+	}
+	readers := rm.readers
+	rm.readers = make(map[string]*Reader)
+	rm.mutex.Unlock()
+	for _, r := range readers {
+		r.Stop()
+	}
+}
+
+// DeleteReader disconnects the reader and removes it
+func (rm *readerManager) DeleteReader(name string) error {
+	rm.mutex.Lock()
+	r, ok := rm.readers[name]
+	delete(rm.readers, name)
+	rm.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("no such reader: %s", name)
+	}
+	r.Stop()
+	log.Printf("[ReaderManager] deleted %s", name)
+	return nil
+}
+
+// Known returns true if the name is a reader added, connected, or named for the inbound connections
+func (rm *readerManager) Known(name string) bool {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	if _, ok := rm.readers[name]; ok {
+		return true
+	}
+	for _, n := range rm.inboundNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Listen accepts the reader-initiated LLRP connections on the address
+func (rm *readerManager) Listen(address string) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	rm.mutex.Lock()
+	rm.listener = ln
+	rm.mutex.Unlock()
+	log.Printf("[ReaderManager] listening for the readers on %v", ln.Addr())
+	go rm.accept(ln)
+	return nil
+}
+
+// SetInboundNames sets the reader names keyed by the IP addresses for the inbound readers,
+// the readers not in the names are named after their IP addresses
+func (rm *readerManager) SetInboundNames(names map[string]string) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	rm.inboundNames = names
+}
+
+// SetKeepalive sets the keepalive supervision for the readers to be added
+func (rm *readerManager) SetKeepalive(period time.Duration, misses int) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	rm.keepalivePeriod = period
+	rm.keepaliveMisses = misses
+}
+
+// SetROSpecs sets the ROSpecConfigs keyed by the reader names
+// for the readers to be added
+func (rm *readerManager) SetROSpecs(rospecs map[string]*llrpclient.ROSpecConfig) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	rm.rospecs = rospecs
+}
+
+// Readers returns the status of the readers sorted by their names
+func (rm *readerManager) Readers() []management.ReaderStatus {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	status := []management.ReaderStatus{}
+	for _, r := range rm.readers {
+		rs := management.ReaderStatus{
+			Name:             r.Name,
+			Address:          r.Address,
+			State:            r.State(),
+			Health:           r.client.Health(),
+			MissedKeepalives: r.client.MissedKeepalives(),
+		}
+		if lk := r.client.LastKeepalive(); !lk.IsZero() {
+			rs.LastKeepalive = &lk
+		}
+		status = append(status, rs)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	return status
+}
+
+// Send sends the message built with the next messageID of each reader to the readers of the names,
+// or to all the readers if no name is given
+func (rm *readerManager) Send(names []string, message func(messageID uint32) []byte) {
+	rm.mutex.Lock()
+	readers := []*Reader{}
+	for name, r := range rm.readers {
+		if len(names) == 0 {
+			readers = append(readers, r)
+			continue
+		}
+		for _, n := range names {
+			if n == name {
+				readers = append(readers, r)
+				break
+			}
+		}
+	}
+	rm.mutex.Unlock()
+	for _, r := range readers {
+		if err := r.client.Write(message(r.client.NextMessageID())); err != nil {
+			log.Printf("[ReaderManager] %s: %v", r.Name, err)
+		}
+	}
+}
+
+// accept registers a Reader for each inbound connection until the listener is closed
+func (rm *readerManager) accept(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("[ReaderManager] stopped listening: %v", err)
+			return
+		}
+		rm.mutex.Lock()
+		r := NewInboundReader(rm.inboundName(conn), conn, rm.initialMessageID, rm.rq)
+		old, ok := rm.readers[r.Name]
+		if ok && old.inbound == nil {
+			rm.mutex.Unlock()
+			conn.Close()
+			log.Printf("[ReaderManager] rejected %v: duplicate reader name: %s", conn.RemoteAddr(), r.Name)
+			continue
+		}
+		r.SetROSpec(rm.rospecFor(r.Name))
+		r.SetKeepalive(rm.keepalivePeriod, rm.keepaliveMisses)
+		rm.readers[r.Name] = r
+		rm.mutex.Unlock()
+		if ok {
+			// the reader reconnected, the old connection is stale
+			old.Stop()
+			log.Printf("[ReaderManager] replaced the connection of %s", r.Name)
+		}
+		r.Start()
+		log.Printf("[ReaderManager] accepted %s from %v", r.Name, conn.RemoteAddr())
+		go func() {
+			// forget the reader once it's disconnected
+			<-r.done
+			rm.mutex.Lock()
+			if rm.readers[r.Name] == r {
+				delete(rm.readers, r.Name)
+			}
+			rm.mutex.Unlock()
+		}()
+	}
+}
+
+// inboundName returns the name of the reader for the inbound connection, the caller must hold the mutex
+func (rm *readerManager) inboundName(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	if name, ok := rm.inboundNames[host]; ok {
+		return name
+	}
+	return host
+}
+
+// rospecFor returns the ROSpecConfig for the reader, the caller must hold the mutex
+func (rm *readerManager) rospecFor(name string) *llrpclient.ROSpecConfig {
+	if rc, ok := rm.rospecs[name]; ok {
+		return rc
+	}
+	return rm.rospecs["default"]
+}
+
+// loadReadersFromCSVFile reads the reader name and address in each line of the csv file
+func loadReadersFromCSVFile(f string) ([]readerConfig, error) {
+	fp, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	readers := []readerConfig{}
+	reader := csv.NewReader(fp)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			continue
+		}
+		readers = append(readers, readerConfig{
+			name:    strings.TrimSpace(record[0]),
+			address: strings.TrimSpace(record[1]),
+		})
+	}
+	return readers, nil
+}
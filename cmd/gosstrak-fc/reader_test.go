@@ -0,0 +1,281 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iomz/go-llrp"
+	"github.com/iomz/gosstrak/llrpclient"
+	"github.com/iomz/gosstrak/management"
+)
+
+// readLLRPMessage reads an LLRP message and returns its header and messageID
+func readLLRPMessage(conn net.Conn) (uint16, uint32, error) {
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return 0, 0, err
+	}
+	if size := binary.BigEndian.Uint32(buf[2:6]) - 10; size != 0 {
+		if _, err := io.ReadFull(conn, make([]byte, size)); err != nil {
+			return 0, 0, err
+		}
+	}
+	return binary.BigEndian.Uint16(buf[0:2]), binary.BigEndian.Uint32(buf[6:10]), nil
+}
+
+func TestReader_handle(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	rq := make(chan readerEvents)
+	r := NewReader("reader0", ln.Addr().String(), 1000, rq)
+	r.Start()
+	defer r.Stop()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i, want := range []uint32{1000, 1001, 1002} {
+		conn.Write(llrp.Keepalive(uint32(i)))
+		h, mid, err := readLLRPMessage(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != llrp.KeepaliveAckHeader || mid != want {
+			t.Errorf("KEEP_ALIVE_ACK = (%v, %v), want (%v, %v)", h, mid, llrp.KeepaliveAckHeader, want)
+		}
+	}
+	if got := r.State(); got != ReaderConnected {
+		t.Errorf("Reader.State() = %v, want %v", got, ReaderConnected)
+	}
+}
+
+func TestReader_run(t *testing.T) {
+	defer func(b time.Duration) { readerInitialBackoff = b }(readerInitialBackoff)
+	readerInitialBackoff = 10 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	rq := make(chan readerEvents)
+	r := NewReader("reader0", ln.Addr().String(), 1, rq)
+	r.Start()
+
+	// drop the first connection and wait for the reader to reconnect
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	conn, err = ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write(llrp.Keepalive(1))
+	if h, _, err := readLLRPMessage(conn); err != nil || h != llrp.KeepaliveAckHeader {
+		t.Errorf("KEEP_ALIVE_ACK after reconnecting = (%v, %v)", h, err)
+	}
+
+	r.Stop()
+	if got := r.State(); got != ReaderStopped {
+		t.Errorf("Reader.State() = %v, want %v", got, ReaderStopped)
+	}
+}
+
+func TestReader_runInbound(t *testing.T) {
+	local, remote := net.Pipe()
+	r := NewInboundReader("dock", local, 1, make(chan readerEvents))
+	r.Start()
+
+	// the reader disconnecting tears down the Reader as Stop does
+	remote.Close()
+	select {
+	case <-r.done:
+	case <-time.After(time.Second):
+		t.Fatal("Reader.run() didn't return after the connection was lost")
+	}
+	select {
+	case <-r.quit:
+	default:
+		t.Errorf("Reader.quit is not closed after the connection was lost")
+	}
+	if got := r.State(); got != ReaderStopped {
+		t.Errorf("Reader.State() = %v, want %v", got, ReaderStopped)
+	}
+	// stopping the torn down Reader again is harmless
+	r.Stop()
+}
+
+func Test_readerManager(t *testing.T) {
+	rm := newReaderManager(1, make(chan readerEvents))
+	defer rm.Close()
+
+	if err := rm.AddReader("reader1", "127.0.0.1:1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rm.AddReader("reader0", "127.0.0.1:1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rm.AddReader("reader0", "127.0.0.1:1"); err == nil {
+		t.Errorf("readerManager.AddReader() accepted a duplicate reader")
+	}
+	if err := rm.AddReader("", "127.0.0.1:1"); err == nil {
+		t.Errorf("readerManager.AddReader() accepted an empty name")
+	}
+	readers := rm.Readers()
+	if len(readers) != 2 || readers[0].Name != "reader0" || readers[1].Name != "reader1" {
+		t.Errorf("readerManager.Readers() = %v", readers)
+	}
+	if err := rm.DeleteReader("reader1"); err != nil {
+		t.Error(err)
+	}
+	if err := rm.DeleteReader("reader1"); err == nil {
+		t.Errorf("readerManager.DeleteReader() deleted an unknown reader")
+	}
+	if got := len(rm.Readers()); got != 1 {
+		t.Errorf("len(readerManager.Readers()) = %v, want 1", got)
+	}
+	if !rm.Known("reader0") || rm.Known("reader1") {
+		t.Errorf("readerManager.Known() = %v, %v, want true, false", rm.Known("reader0"), rm.Known("reader1"))
+	}
+}
+
+// readerEventNotification returns a READER_EVENT_NOTIFICATION with ConnectionAttemptEvent
+func readerEventNotification(mid uint32, status uint16) []byte {
+	body := []byte{
+		0, 246, 0, 22, // ReaderEventNotificationData
+		0, 128, 0, 12, 0, 0, 0, 0, 0, 0, 0, 0, // UTCTimestamp
+		1, 0, 0, 6, 0, 0, // ConnectionAttemptEvent
+	}
+	binary.BigEndian.PutUint16(body[20:], status)
+	msg := make([]byte, 10)
+	binary.BigEndian.PutUint16(msg, llrp.ReaderEventNotificationHeader)
+	binary.BigEndian.PutUint32(msg[2:], uint32(10+len(body)))
+	binary.BigEndian.PutUint32(msg[6:], mid)
+	return append(msg, body...)
+}
+
+func Test_readerManager_Listen(t *testing.T) {
+	rm := newReaderManager(1, make(chan readerEvents))
+	defer rm.Close()
+	rm.SetInboundNames(map[string]string{"127.0.0.1": "dock", "127.0.0.2": "gate"})
+	if !rm.Known("dock") {
+		t.Errorf("readerManager.Known() = false for an inbound name")
+	}
+	if err := rm.AddReader("gate", "127.0.0.1:1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rm.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	dial := func(local string) net.Conn {
+		d := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(local)}}
+		conn, err := d.Dial("tcp", rm.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	waitReaders := func(n int) []management.ReaderStatus {
+		for i := 0; len(rm.Readers()) != n && i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return rm.Readers()
+	}
+
+	// a reader connecting successfully gets SET_READER_CONFIG
+	conn := dial("127.0.0.1")
+	defer conn.Close()
+	conn.Write(readerEventNotification(1, llrpclient.ConnectionAttemptSuccess))
+	if h, _, err := readLLRPMessage(conn); err != nil || h != llrp.SetReaderConfigHeader {
+		t.Errorf("response to READER_EVENT_NOTIFICATION = (%v, %v), want SET_READER_CONFIG", h, err)
+	}
+	readers := waitReaders(2)
+	if len(readers) != 2 || readers[0].Name != "dock" || readers[0].State != ReaderConnected {
+		t.Errorf("readerManager.Readers() = %v", readers)
+	}
+	rm.Send([]string{"dock"}, func(mid uint32) []byte { return llrpclient.EnableAccessSpec(mid, 1) })
+	if h, _, err := readLLRPMessage(conn); err != nil || h != llrpclient.EnableAccessSpecHeader {
+		t.Errorf("readerManager.Send() = (%v, %v), want ENABLE_ACCESSSPEC", h, err)
+	}
+
+	// the reader connecting again replaces the previous connection
+	again := dial("127.0.0.1")
+	defer again.Close()
+	again.Write(readerEventNotification(1, llrpclient.ConnectionAttemptSuccess))
+	if h, _, err := readLLRPMessage(again); err != nil || h != llrp.SetReaderConfigHeader {
+		t.Errorf("response to READER_EVENT_NOTIFICATION = (%v, %v), want SET_READER_CONFIG", h, err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := readLLRPMessage(conn); err != io.EOF {
+		t.Errorf("replaced connection got %v, want EOF", err)
+	}
+	if readers := waitReaders(2); len(readers) != 2 || readers[0].Name != "dock" {
+		t.Errorf("readerManager.Readers() = %v", readers)
+	}
+
+	// an inbound reader with the name of a configured reader is rejected
+	rejected := dial("127.0.0.2")
+	defer rejected.Close()
+	if _, _, err := readLLRPMessage(rejected); err != io.EOF {
+		t.Errorf("duplicate reader got %v, want EOF", err)
+	}
+
+	// a failed connection attempt is closed and forgotten
+	failed := dial("127.0.0.3")
+	defer failed.Close()
+	failed.Write(readerEventNotification(1, 1))
+	if _, _, err := readLLRPMessage(failed); err != io.EOF {
+		t.Errorf("failed connection attempt got %v, want EOF", err)
+	}
+	if got := len(waitReaders(2)); got != 2 {
+		t.Errorf("len(readerManager.Readers()) = %v, want 2", got)
+	}
+}
+
+func Test_loadReadersFromCSVFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "readers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# name,address\nreader0,127.0.0.1:5084\n reader1 , 192.168.1.10:5084\ninvalid\n")
+	f.Close()
+
+	want := []readerConfig{
+		{"reader0", "127.0.0.1:5084"},
+		{"reader1", "192.168.1.10:5084"},
+	}
+	got, err := loadReadersFromCSVFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadReadersFromCSVFile() = %v, want %v", got, want)
+	}
+	if _, err := loadReadersFromCSVFile(f.Name() + ".missing"); err == nil {
+		t.Errorf("loadReadersFromCSVFile() succeeded for a missing file")
+	}
+}
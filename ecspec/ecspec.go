@@ -0,0 +1,290 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package ecspec implements the ALE event cycle specified by ECSpec
+package ecspec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iomz/gosstrak/reporting"
+)
+
+// ECSpec is the ALE 1.1 event cycle specification
+type ECSpec struct {
+	IncludeSpecInReports bool           `xml:"includeSpecInReports,attr,omitempty" json:"includeSpecInReports,omitempty"`
+	LogicalReaders       []string       `xml:"logicalReaders>logicalReader" json:"logicalReaders,omitempty"`
+	Boundaries           ECBoundarySpec `xml:"boundarySpec" json:"boundarySpec"`
+	ReportSpecs          []ECReportSpec `xml:"reportSpecs>reportSpec" json:"reportSpecs"`
+}
+
+// ECBoundarySpec specifies the start and the end of event cycles
+type ECBoundarySpec struct {
+	StartTriggers     []string `xml:"startTriggerList>startTrigger" json:"startTriggerList,omitempty"`
+	RepeatPeriod      ECTime   `xml:"repeatPeriod" json:"repeatPeriod"`
+	StopTriggers      []string `xml:"stopTriggerList>stopTrigger" json:"stopTriggerList,omitempty"`
+	Duration          ECTime   `xml:"duration" json:"duration"`
+	StableSetInterval ECTime   `xml:"stableSetInterval" json:"stableSetInterval"`
+}
+
+// ECTime is a time value in ECSpec, only MS is defined as its unit in ALE
+type ECTime struct {
+	Unit  string `xml:"unit,attr" json:"unit"`
+	Value int64  `xml:",chardata" json:"value"`
+}
+
+// ECReportSpec specifies a report in the event cycle
+type ECReportSpec struct {
+	ReportName         string              `xml:"reportName,attr" json:"reportName"`
+	ReportIfEmpty      bool                `xml:"reportIfEmpty,attr,omitempty" json:"reportIfEmpty,omitempty"`
+	ReportOnlyOnChange bool                `xml:"reportOnlyOnChange,attr,omitempty" json:"reportOnlyOnChange,omitempty"`
+	ReportSet          ECReportSetSpec     `xml:"reportSet" json:"reportSet"`
+	Filter             *ECFilterSpec       `xml:"filterSpec,omitempty" json:"filterSpec,omitempty"`
+	Output             *ECReportOutputSpec `xml:"output,omitempty" json:"output,omitempty"`
+}
+
+// ECReportOutputSpec specifies the contents of the members in a report,
+// the pure identity is reported if none of the formats is included
+type ECReportOutputSpec struct {
+	IncludeEPC        bool `xml:"includeEPC,attr,omitempty" json:"includeEPC,omitempty"`
+	IncludeTag        bool `xml:"includeTag,attr,omitempty" json:"includeTag,omitempty"`
+	IncludeRawHex     bool `xml:"includeRawHex,attr,omitempty" json:"includeRawHex,omitempty"`
+	IncludeRawDecimal bool `xml:"includeRawDecimal,attr,omitempty" json:"includeRawDecimal,omitempty"`
+	// IncludeBinary adds the bits of the EPC bank
+	IncludeBinary bool `xml:"extension>includeBinary,omitempty" json:"includeBinary,omitempty"`
+	// IncludeReaderMetadata adds the antenna, RSSI, timestamps and read count as the member extension
+	IncludeReaderMetadata bool `xml:"extension>includeReaderMetadata,omitempty" json:"includeReaderMetadata,omitempty"`
+	// FieldList adds the fields in the tag memory as the member extension
+	FieldList []ECReportOutputFieldSpec `xml:"extension>fieldList>field,omitempty" json:"fieldList,omitempty"`
+}
+
+// ECReportOutputFieldSpec specifies a field reported in the members,
+// the name defaults to the fieldname
+type ECReportOutputFieldSpec struct {
+	FieldSpec                ECFieldSpec `xml:"fieldspec" json:"fieldspec"`
+	Name                     string      `xml:"name,omitempty" json:"name,omitempty"`
+	IncludeFieldSpecInReport bool        `xml:"includeFieldSpecInReport,omitempty" json:"includeFieldSpecInReport,omitempty"`
+}
+
+// NewECReportOutputSpec returns the ECReportOutputSpec including the output formats
+func NewECReportOutputSpec(of reporting.OutputFormat, includeReaderMetadata bool) *ECReportOutputSpec {
+	return &ECReportOutputSpec{
+		IncludeEPC:            of&reporting.OutputEPC != 0,
+		IncludeTag:            of&reporting.OutputTag != 0,
+		IncludeRawHex:         of&reporting.OutputRawHex != 0,
+		IncludeRawDecimal:     of&reporting.OutputRawDecimal != 0,
+		IncludeBinary:         of&reporting.OutputBinary != 0,
+		IncludeReaderMetadata: includeReaderMetadata,
+	}
+}
+
+// OutputFormat returns the output formats included in the ECReportOutputSpec
+func (o *ECReportOutputSpec) OutputFormat() reporting.OutputFormat {
+	if o == nil {
+		return reporting.OutputEPC
+	}
+	var of reporting.OutputFormat
+	for f, included := range map[reporting.OutputFormat]bool{
+		reporting.OutputEPC:        o.IncludeEPC,
+		reporting.OutputTag:        o.IncludeTag,
+		reporting.OutputRawHex:     o.IncludeRawHex,
+		reporting.OutputRawDecimal: o.IncludeRawDecimal,
+		reporting.OutputBinary:     o.IncludeBinary,
+	} {
+		if included {
+			of |= f
+		}
+	}
+	if of == 0 {
+		return reporting.OutputEPC
+	}
+	return of
+}
+
+// ECFilterSpec specifies the tags to be included in a report,
+// both ALE 1.0 includePatterns and ALE 1.1 filterList are accepted
+type ECFilterSpec struct {
+	IncludePatterns []string             `xml:"includePatterns>includePattern,omitempty" json:"includePatterns,omitempty"`
+	ExcludePatterns []string             `xml:"excludePatterns>excludePattern,omitempty" json:"excludePatterns,omitempty"`
+	FilterList      []ECFilterListMember `xml:"extension>filterList>filter,omitempty" json:"filterList,omitempty"`
+}
+
+// ECFilterListMember is a filter in ECFilterSpec,
+// the patterns apply to the epc field unless the fieldspec specifies another
+type ECFilterListMember struct {
+	IncludeExclude string       `xml:"includeExclude" json:"includeExclude"`
+	FieldSpec      *ECFieldSpec `xml:"fieldspec,omitempty" json:"fieldspec,omitempty"`
+	Patterns       []string     `xml:"patList>pat" json:"patList"`
+}
+
+// ECFieldSpec specifies a field of the tag, either epc, epcBank, tidBank, userBank,
+// or @bank.length.offset in the memory
+type ECFieldSpec struct {
+	FieldName string `xml:"fieldname" json:"fieldname"`
+	DataType  string `xml:"datatype,omitempty" json:"datatype,omitempty"`
+	Format    string `xml:"format,omitempty" json:"format,omitempty"`
+}
+
+// Includes returns all the include patterns in the ECFilterSpec
+func (fs *ECFilterSpec) Includes() []string {
+	pats := append([]string{}, fs.IncludePatterns...)
+	for _, f := range fs.FilterList {
+		if f.IncludeExclude == "INCLUDE" {
+			pats = append(pats, f.patterns()...)
+		}
+	}
+	return pats
+}
+
+// IncludeMembers returns the include patterns grouped by the members of the filterList,
+// a tag is included if it matches any pattern of every member, the includePatterns are a member
+func (fs *ECFilterSpec) IncludeMembers() [][]string {
+	members := [][]string{}
+	if len(fs.IncludePatterns) != 0 {
+		members = append(members, fs.IncludePatterns)
+	}
+	for _, f := range fs.FilterList {
+		if f.IncludeExclude == "INCLUDE" && len(f.Patterns) != 0 {
+			members = append(members, f.patterns())
+		}
+	}
+	return members
+}
+
+// Excludes returns all the exclude patterns in the ECFilterSpec
+func (fs *ECFilterSpec) Excludes() []string {
+	pats := append([]string{}, fs.ExcludePatterns...)
+	for _, f := range fs.FilterList {
+		if f.IncludeExclude == "EXCLUDE" {
+			pats = append(pats, f.patterns()...)
+		}
+	}
+	return pats
+}
+
+// patterns returns the patterns of the filter, prefixed with the fieldname
+// for the fields other than epc, e.g., tidBank=xE2801105
+func (f ECFilterListMember) patterns() []string {
+	if f.FieldSpec == nil || len(f.FieldSpec.FieldName) == 0 || f.FieldSpec.FieldName == "epc" {
+		return f.Patterns
+	}
+	pats := make([]string, len(f.Patterns))
+	for i, pat := range f.Patterns {
+		pats[i] = f.FieldSpec.FieldName + "=" + pat
+	}
+	return pats
+}
+
+// ECReportSetSpec specifies the set of tags in a report
+type ECReportSetSpec struct {
+	Set ReportSet `xml:"set,attr" json:"set"`
+}
+
+// ReportSet is one of CURRENT, ADDITIONS, DELETIONS
+type ReportSet string
+
+// Available ReportSet values
+const (
+	Current   ReportSet = "CURRENT"
+	Additions ReportSet = "ADDITIONS"
+	Deletions ReportSet = "DELETIONS"
+)
+
+// InitiationCondition of an event cycle in ECReports
+const (
+	InitiatedByRequest      = "REQUESTED"
+	InitiatedByRepeatPeriod = "REPEAT_PERIOD"
+	InitiatedByTrigger      = "TRIGGER"
+)
+
+// TerminationCondition of an event cycle in ECReports
+const (
+	TerminatedByDuration    = "DURATION"
+	TerminatedByStableSet   = "STABLE_SET"
+	TerminatedByTrigger     = "TRIGGER"
+	TerminatedByUndefine    = "UNDEFINE"
+	TerminatedByUnrequested = "UNREQUESTED"
+)
+
+// NewECTime returns ECTime in MS from time.Duration
+func NewECTime(d time.Duration) ECTime {
+	return ECTime{
+		Unit:  "MS",
+		Value: int64(d / time.Millisecond),
+	}
+}
+
+// Duration returns the ECTime as time.Duration
+func (t ECTime) Duration() time.Duration {
+	return time.Duration(t.Value) * time.Millisecond
+}
+
+// Validate checks the ECSpec as ALE define() does
+func (spec *ECSpec) Validate() error {
+	b := spec.Boundaries
+	for _, t := range []ECTime{b.RepeatPeriod, b.Duration, b.StableSetInterval} {
+		if t.Value < 0 {
+			return fmt.Errorf("negative ECTime: %v", t.Value)
+		}
+		if t.Value != 0 && strings.ToUpper(t.Unit) != "MS" {
+			return fmt.Errorf("unsupported ECTime unit: %s", t.Unit)
+		}
+	}
+	for _, uri := range append(append([]string{}, b.StartTriggers...), b.StopTriggers...) {
+		if _, err := ParseTrigger(uri); err != nil {
+			return err
+		}
+	}
+	if b.Duration.Value == 0 && b.StableSetInterval.Value == 0 && len(b.StopTriggers) == 0 {
+		return errors.New("no stopping condition is specified in boundarySpec")
+	}
+	if len(spec.ReportSpecs) == 0 {
+		return errors.New("no reportSpec is specified")
+	}
+	names := map[string]bool{}
+	for _, rs := range spec.ReportSpecs {
+		if len(rs.ReportName) == 0 {
+			return errors.New("reportName is empty")
+		}
+		if names[rs.ReportName] {
+			return fmt.Errorf("duplicate reportName: %s", rs.ReportName)
+		}
+		names[rs.ReportName] = true
+		switch rs.ReportSet.Set {
+		case Current, Additions, Deletions:
+		default:
+			return fmt.Errorf("invalid reportSet in %s: %s", rs.ReportName, rs.ReportSet.Set)
+		}
+		if rs.Filter != nil {
+			for _, f := range rs.Filter.FilterList {
+				if f.IncludeExclude != "INCLUDE" && f.IncludeExclude != "EXCLUDE" {
+					return fmt.Errorf("invalid includeExclude in %s: %s", rs.ReportName, f.IncludeExclude)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// NewDefaultECSpec returns an ECSpec with a single report of the set
+// and the event cycle repeated with the given duration
+func NewDefaultECSpec(reportName string, duration time.Duration, repeatPeriod time.Duration, stableSetInterval time.Duration, set ReportSet) *ECSpec {
+	return &ECSpec{
+		Boundaries: ECBoundarySpec{
+			RepeatPeriod:      NewECTime(repeatPeriod),
+			Duration:          NewECTime(duration),
+			StableSetInterval: NewECTime(stableSetInterval),
+		},
+		ReportSpecs: []ECReportSpec{
+			{
+				ReportName: reportName,
+				ReportSet:  ECReportSetSpec{Set: set},
+			},
+		},
+	}
+}
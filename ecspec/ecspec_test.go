@@ -0,0 +1,114 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ecspec
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iomz/gosstrak/reporting"
+)
+
+func TestECSpec_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    *ECSpec
+		wantErr bool
+	}{
+		{"default", NewDefaultECSpec("r", time.Second, 0, 0, Current), false},
+		{"stable set only", NewDefaultECSpec("r", 0, 0, time.Second, Additions), false},
+		{"no stopping condition", NewDefaultECSpec("r", 0, time.Second, 0, Current), true},
+		{"invalid set", NewDefaultECSpec("r", time.Second, 0, 0, ReportSet("ALL")), true},
+		{"no reportName", NewDefaultECSpec("", time.Second, 0, 0, Current), true},
+		{
+			"stop trigger",
+			&ECSpec{
+				Boundaries:  ECBoundarySpec{StopTriggers: []string{"urn:epcglobal:ale:trigger:rtc:1000.0"}},
+				ReportSpecs: []ECReportSpec{{ReportName: "r", ReportSet: ECReportSetSpec{Current}}},
+			},
+			false,
+		},
+		{
+			"invalid rtc trigger",
+			&ECSpec{
+				Boundaries:  ECBoundarySpec{StopTriggers: []string{"urn:epcglobal:ale:trigger:rtc:1000.1000"}},
+				ReportSpecs: []ECReportSpec{{ReportName: "r", ReportSet: ECReportSetSpec{Current}}},
+			},
+			true,
+		},
+		{
+			"duplicate reportName",
+			&ECSpec{
+				Boundaries:  ECBoundarySpec{Duration: NewECTime(time.Second)},
+				ReportSpecs: []ECReportSpec{{ReportName: "r", ReportSet: ECReportSetSpec{Current}}, {ReportName: "r", ReportSet: ECReportSetSpec{Additions}}},
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.spec.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ECSpec.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestECSpec_UnmarshalXML(t *testing.T) {
+	in := `<ECSpec includeSpecInReports="false">
+  <logicalReaders><logicalReader>LogicalReader1</logicalReader></logicalReaders>
+  <boundarySpec>
+    <repeatPeriod unit="MS">10000</repeatPeriod>
+    <duration unit="MS">9500</duration>
+    <stableSetInterval unit="MS">0</stableSetInterval>
+  </boundarySpec>
+  <reportSpecs>
+    <reportSpec reportName="additions" reportIfEmpty="true">
+      <reportSet set="ADDITIONS"/>
+      <filterSpec><extension><filterList>
+        <filter><includeExclude>INCLUDE</includeExclude><patList><pat>urn:epc:pat:sgtin-96:3.12345678</pat></patList></filter>
+        <filter><includeExclude>EXCLUDE</includeExclude><fieldspec><fieldname>tidBank</fieldname></fieldspec><patList><pat>xE2801105</pat></patList></filter>
+      </filterList></extension></filterSpec>
+      <output includeTag="true" includeRawHex="true"><extension><includeBinary>true</includeBinary></extension></output>
+    </reportSpec>
+  </reportSpecs>
+</ECSpec>`
+	spec := &ECSpec{}
+	if err := xml.Unmarshal([]byte(in), spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := ECBoundarySpec{
+		RepeatPeriod:      ECTime{"MS", 10000},
+		Duration:          ECTime{"MS", 9500},
+		StableSetInterval: ECTime{"MS", 0},
+	}
+	if !reflect.DeepEqual(spec.Boundaries, want) {
+		t.Errorf("boundarySpec = %v, want %v", spec.Boundaries, want)
+	}
+	if !reflect.DeepEqual(spec.LogicalReaders, []string{"LogicalReader1"}) {
+		t.Errorf("logicalReaders = %v", spec.LogicalReaders)
+	}
+	if rs := spec.ReportSpecs[0]; rs.ReportName != "additions" || !rs.ReportIfEmpty || rs.ReportSet.Set != Additions {
+		t.Errorf("reportSpec = %v", rs)
+	}
+	if got, want := spec.ReportSpecs[0].Filter.Includes(), []string{"urn:epc:pat:sgtin-96:3.12345678"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("includes = %v, want %v", got, want)
+	}
+	if got, want := spec.ReportSpecs[0].Filter.IncludeMembers(), [][]string{{"urn:epc:pat:sgtin-96:3.12345678"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("include members = %v, want %v", got, want)
+	}
+	if got, want := spec.ReportSpecs[0].Filter.Excludes(), []string{"tidBank=xE2801105"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("excludes = %v, want %v", got, want)
+	}
+	if of, want := spec.ReportSpecs[0].Output.OutputFormat(), reporting.OutputTag|reporting.OutputRawHex|reporting.OutputBinary; of != want {
+		t.Errorf("output = %v, want %v", of.Names(), want.Names())
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ecspec
+
+import "fmt"
+
+// DuplicateNameError is returned when the ECSpec name is already defined
+type DuplicateNameError struct {
+	SpecName string
+}
+
+func (e *DuplicateNameError) Error() string {
+	return fmt.Sprintf("duplicate ECSpec name: %s", e.SpecName)
+}
+
+// NoSuchNameError is returned when the ECSpec is not defined
+type NoSuchNameError struct {
+	SpecName string
+}
+
+func (e *NoSuchNameError) Error() string {
+	return fmt.Sprintf("no such ECSpec: %s", e.SpecName)
+}
+
+// ValidationError is returned when the ECSpec is invalid
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Reason
+}
+
+// DuplicateSubscriptionError is returned when the URI is already subscribed to the ECSpec
+type DuplicateSubscriptionError struct {
+	SpecName string
+	URI      string
+}
+
+func (e *DuplicateSubscriptionError) Error() string {
+	return fmt.Sprintf("%s is already subscribed to %s", e.URI, e.SpecName)
+}
+
+// NoSuchSubscriberError is returned when the URI is not subscribed to the ECSpec
+type NoSuchSubscriberError struct {
+	SpecName string
+	URI      string
+}
+
+func (e *NoSuchSubscriberError) Error() string {
+	return fmt.Sprintf("%s is not subscribed to %s", e.URI, e.SpecName)
+}
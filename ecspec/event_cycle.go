@@ -0,0 +1,543 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ecspec
+
+import (
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iomz/gosstrak/reporting"
+	"github.com/iomz/gosstrak/tagmemory"
+	"github.com/iomz/gosstrak/tdt"
+)
+
+// ReportHandler receives the ECReports for a subscriber at the end of an event cycle
+type ReportHandler func(subscriber string, ecr *reporting.ECReports)
+
+// EventCycle runs the event cycles specified by an ECSpec
+type EventCycle struct {
+	Name          string
+	Spec          *ECSpec
+	handler       ReportHandler
+	tdtCore       *tdt.Core
+	startTriggers []*Trigger
+	stopTriggers  []*Trigger
+	mutex         sync.Mutex
+	subscribers   []string
+	pollers       []chan *reporting.ECReports
+	active        bool
+	current       map[string]tagSet        // reportName -> set of tags in this cycle
+	previous      map[string]tagSet        // reportName -> set of tags in the last cycle
+	lastReported  map[string][]string      // reportName -> the last reported tags
+	outputFields  map[string][]outputField // reportName -> the fields in the members
+	changed       chan struct{}
+	added         chan struct{}
+	triggers      chan string
+	quit          chan struct{}
+	done          chan struct{}
+}
+
+// tagSet is the tags with their metadata in an event cycle
+type tagSet map[string]*reporting.TagMetadata
+
+// outputField is a field reported in the members
+type outputField struct {
+	name  string
+	field *tagmemory.Field
+	spec  *ECFieldSpec // nil unless includeFieldSpecInReport
+}
+
+// waitResult indicates why an EventCycle stopped waiting
+type waitResult int
+
+const (
+	proceed waitResult = iota
+	unrequested
+	undefined
+)
+
+// NewEventCycle returns the pointer to a new EventCycle instance,
+// the cycles don't start until Start() is called
+func NewEventCycle(name string, spec *ECSpec, handler ReportHandler) (*EventCycle, error) {
+	return newEventCycle(name, spec, handler, nil)
+}
+
+// newEventCycle is NewEventCycle with the fieldnames in the output resolved by the tagmemory.Registry
+func newEventCycle(name string, spec *ECSpec, handler ReportHandler, fields *tagmemory.Registry) (*EventCycle, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	ec := &EventCycle{
+		Name:         name,
+		Spec:         spec,
+		handler:      handler,
+		tdtCore:      tdt.NewCore(),
+		current:      map[string]tagSet{},
+		previous:     map[string]tagSet{},
+		lastReported: map[string][]string{},
+		outputFields: map[string][]outputField{},
+		changed:      make(chan struct{}, 1),
+		added:        make(chan struct{}, 1),
+		triggers:     make(chan string, 16),
+		quit:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	for _, uri := range spec.Boundaries.StartTriggers {
+		t, _ := ParseTrigger(uri)
+		ec.startTriggers = append(ec.startTriggers, t)
+	}
+	for _, uri := range spec.Boundaries.StopTriggers {
+		t, _ := ParseTrigger(uri)
+		ec.stopTriggers = append(ec.stopTriggers, t)
+	}
+	for _, rs := range spec.ReportSpecs {
+		ec.previous[rs.ReportName] = tagSet{}
+		if rs.Output == nil {
+			continue
+		}
+		for _, ofs := range rs.Output.FieldList {
+			f, err := fields.Field(ofs.FieldSpec.FieldName)
+			if err != nil {
+				return nil, err
+			}
+			if f, err = f.WithFormat(ofs.FieldSpec.DataType, ofs.FieldSpec.Format); err != nil {
+				return nil, err
+			}
+			o := outputField{name: ofs.Name, field: f}
+			if len(o.name) == 0 {
+				o.name = ofs.FieldSpec.FieldName
+			}
+			if ofs.IncludeFieldSpecInReport {
+				fs := ofs.FieldSpec
+				o.spec = &fs
+			}
+			ec.outputFields[rs.ReportName] = append(ec.outputFields[rs.ReportName], o)
+		}
+	}
+	return ec, nil
+}
+
+// Start starts running the event cycles
+func (ec *EventCycle) Start() {
+	go ec.run()
+}
+
+// Stop terminates the current event cycle with UNDEFINE and stops running
+func (ec *EventCycle) Stop() {
+	close(ec.quit)
+	<-ec.done
+}
+
+// Add adds the tag to all the reports in the current event cycle,
+// md is the metadata of the read and can be nil
+func (ec *EventCycle) Add(tag string, md *reporting.TagMetadata) {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	if !ec.active {
+		return
+	}
+	isNew := false
+	for _, set := range ec.current {
+		if set.add(tag, md) {
+			isNew = true
+		}
+	}
+	if isNew {
+		notify(ec.added)
+	}
+}
+
+// AddToReport adds the tag only to the report in the current event cycle,
+// md is the metadata of the read and can be nil
+func (ec *EventCycle) AddToReport(reportName string, tag string, md *reporting.TagMetadata) {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	if !ec.active {
+		return
+	}
+	set, ok := ec.current[reportName]
+	if ok && set.add(tag, md) {
+		notify(ec.added)
+	}
+}
+
+// Poll requests the next event cycle to run and returns a channel to receive the ECReports,
+// the channel is closed without any ECReports if the EventCycle stops before it's delivered
+func (ec *EventCycle) Poll() <-chan *reporting.ECReports {
+	ch := make(chan *reporting.ECReports, 1)
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	ec.pollers = append(ec.pollers, ch)
+	notify(ec.changed)
+	return ch
+}
+
+// Subscribe adds the uri to the subscribers
+func (ec *EventCycle) Subscribe(uri string) bool {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	for _, s := range ec.subscribers {
+		if s == uri {
+			return false
+		}
+	}
+	ec.subscribers = append(ec.subscribers, uri)
+	notify(ec.changed)
+	return true
+}
+
+// Subscribers returns the subscribers of the EventCycle
+func (ec *EventCycle) Subscribers() []string {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	return append([]string{}, ec.subscribers...)
+}
+
+// Trigger fires the trigger if the EventCycle has it as a start or stop trigger
+func (ec *EventCycle) Trigger(uri string) {
+	select {
+	case ec.triggers <- uri:
+	default:
+		log.Printf("[EventCycle] %s dropped trigger %s", ec.Name, uri)
+	}
+}
+
+// Unsubscribe removes the uri from the subscribers
+func (ec *EventCycle) Unsubscribe(uri string) bool {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	for i, s := range ec.subscribers {
+		if s == uri {
+			ec.subscribers = append(ec.subscribers[:i], ec.subscribers[i+1:]...)
+			notify(ec.changed)
+			return true
+		}
+	}
+	return false
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// begin starts accepting tags for a new event cycle
+func (ec *EventCycle) begin() {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	for _, rs := range ec.Spec.ReportSpecs {
+		ec.current[rs.ReportName] = tagSet{}
+	}
+	ec.active = true
+	// discard the notification from the last cycle
+	select {
+	case <-ec.added:
+	default:
+	}
+}
+
+// finish closes the current event cycle and delivers the ECReports to the subscribers
+func (ec *EventCycle) finish(start time.Time, initiation string, termination string) {
+	ec.mutex.Lock()
+	ec.active = false
+	ecr := ec.makeReports(start, initiation, termination)
+	subscribers := append([]string{}, ec.subscribers...)
+	pollers := ec.pollers
+	ec.pollers = nil
+	ec.mutex.Unlock()
+
+	// the pollers receive the ECReports even if it's empty
+	for _, ch := range pollers {
+		ch <- ecr
+		close(ch)
+	}
+	// ECReports without any report is not delivered
+	if len(ecr.Reports) == 0 || ec.handler == nil {
+		return
+	}
+	for _, s := range subscribers {
+		ec.handler(s, ecr)
+	}
+}
+
+// fieldValues returns the fields of the tag in the members, the fields not read have no value
+func (ec *EventCycle) fieldValues(outputs []outputField, md *reporting.TagMetadata) []reporting.ECReportMemberField {
+	banks := tagmemory.Banks(md.PC, md.ID, md.TID, md.User)
+	fields := make([]reporting.ECReportMemberField, len(outputs))
+	for i, o := range outputs {
+		fields[i].Name = o.name
+		fields[i].Value, _ = o.field.Value(banks, ec.tdtCore)
+		if o.spec != nil {
+			fields[i].FieldSpec = o.spec
+		}
+	}
+	return fields
+}
+
+// isRequested returns true if there's any subscriber or poller
+func (ec *EventCycle) isRequested() bool {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	return len(ec.subscribers) != 0 || len(ec.pollers) != 0
+}
+
+// makeReports builds ECReports from the current and previous sets, the caller must hold the mutex
+func (ec *EventCycle) makeReports(start time.Time, initiation string, termination string) *reporting.ECReports {
+	now := time.Now()
+	ecr := &reporting.ECReports{
+		XMLNS:                reporting.ALENamespace,
+		SchemaVersion:        reporting.SchemaVersion,
+		CreationDate:         now,
+		SpecName:             ec.Name,
+		Date:                 now,
+		ALEID:                reporting.ALEID,
+		TotalMilliseconds:    int64(now.Sub(start) / time.Millisecond),
+		InitiationCondition:  initiation,
+		TerminationCondition: termination,
+		Reports:              []reporting.ECReport{},
+	}
+	if ec.Spec.IncludeSpecInReports {
+		ecr.ECSpec = ec.Spec
+	}
+	for _, rs := range ec.Spec.ReportSpecs {
+		current := ec.current[rs.ReportName]
+		previous := ec.previous[rs.ReportName]
+		tags := []string{}
+		set := current
+		switch rs.ReportSet.Set {
+		case Current:
+			tags = difference(current, nil)
+		case Additions:
+			tags = difference(current, previous)
+		case Deletions:
+			tags = difference(previous, current)
+			set = previous
+		}
+		ec.previous[rs.ReportName] = current
+		if len(tags) == 0 && !rs.ReportIfEmpty {
+			continue
+		}
+		if last, ok := ec.lastReported[rs.ReportName]; ok && rs.ReportOnlyOnChange && reflect.DeepEqual(last, tags) {
+			continue
+		}
+		ec.lastReported[rs.ReportName] = tags
+		report := reporting.NewECReport(rs.ReportName, tags)
+		of := rs.Output.OutputFormat()
+		members := report.Groups[0].Members
+		for i, tag := range tags {
+			md := set[tag]
+			if of != reporting.OutputEPC && md != nil {
+				members[i] = reporting.NewECReportGroupListMember(tag, md.ID, of, ec.tdtCore)
+			}
+			includeMetadata := rs.Output != nil && rs.Output.IncludeReaderMetadata && md != nil
+			if outputs := ec.outputFields[rs.ReportName]; len(outputs) != 0 && md != nil {
+				ext := &reporting.ECReportMemberExtension{FieldList: ec.fieldValues(outputs, md)}
+				if includeMetadata {
+					ext.TagMetadata = md
+				}
+				members[i].Extension = ext
+			} else if includeMetadata {
+				members[i].Extension = md
+			}
+		}
+		ecr.Reports = append(ecr.Reports, report)
+	}
+	return ecr
+}
+
+// run repeats the event cycles until the EventCycle stops
+func (ec *EventCycle) run() {
+	defer close(ec.done)
+	defer ec.closePollers()
+	first := true
+	var lastStart time.Time
+	for {
+		if !ec.waitRequested() {
+			return
+		}
+		initiation, res := ec.waitStart(first, lastStart)
+		switch res {
+		case undefined:
+			return
+		case unrequested:
+			first = true
+			continue
+		}
+		first = false
+		lastStart = time.Now()
+		ec.begin()
+		termination := ec.waitStop(lastStart)
+		ec.finish(lastStart, initiation, termination)
+		switch termination {
+		case TerminatedByUndefine:
+			return
+		case TerminatedByUnrequested:
+			first = true
+		}
+	}
+}
+
+// waitRequested blocks until the EventCycle gets any subscriber,
+// returns false if the EventCycle is stopped
+func (ec *EventCycle) waitRequested() bool {
+	for !ec.isRequested() {
+		select {
+		case <-ec.quit:
+			return false
+		case <-ec.changed:
+		}
+	}
+	return true
+}
+
+// waitStart blocks until the next event cycle should start
+func (ec *EventCycle) waitStart(first bool, lastStart time.Time) (string, waitResult) {
+	repeatPeriod := ec.Spec.Boundaries.RepeatPeriod.Duration()
+	if len(ec.startTriggers) == 0 && (first || repeatPeriod == 0) {
+		return InitiatedByRequest, proceed
+	}
+
+	var repeatTimer <-chan time.Time
+	if !first && repeatPeriod != 0 {
+		t := time.NewTimer(time.Until(lastStart.Add(repeatPeriod)))
+		defer t.Stop()
+		repeatTimer = t.C
+	}
+	var rtcTimer <-chan time.Time
+	if next, ok := nextRTC(ec.startTriggers, time.Now()); ok {
+		t := time.NewTimer(time.Until(next))
+		defer t.Stop()
+		rtcTimer = t.C
+	}
+	for {
+		select {
+		case <-ec.quit:
+			return "", undefined
+		case <-ec.changed:
+			if !ec.isRequested() {
+				return "", unrequested
+			}
+		case <-repeatTimer:
+			return InitiatedByRepeatPeriod, proceed
+		case <-rtcTimer:
+			return InitiatedByTrigger, proceed
+		case uri := <-ec.triggers:
+			if hasTrigger(ec.startTriggers, uri) {
+				return InitiatedByTrigger, proceed
+			}
+		}
+	}
+}
+
+// waitStop blocks until the current event cycle should stop
+func (ec *EventCycle) waitStop(start time.Time) string {
+	b := ec.Spec.Boundaries
+	var durationTimer <-chan time.Time
+	if b.Duration.Value != 0 {
+		t := time.NewTimer(time.Until(start.Add(b.Duration.Duration())))
+		defer t.Stop()
+		durationTimer = t.C
+	}
+	var stableSetTimer *time.Timer
+	var stableSetC <-chan time.Time
+	if b.StableSetInterval.Value != 0 {
+		stableSetTimer = time.NewTimer(b.StableSetInterval.Duration())
+		defer stableSetTimer.Stop()
+		stableSetC = stableSetTimer.C
+	}
+	var rtcTimer <-chan time.Time
+	if next, ok := nextRTC(ec.stopTriggers, start); ok {
+		t := time.NewTimer(time.Until(next))
+		defer t.Stop()
+		rtcTimer = t.C
+	}
+	for {
+		select {
+		case <-ec.quit:
+			return TerminatedByUndefine
+		case <-ec.changed:
+			if !ec.isRequested() {
+				return TerminatedByUnrequested
+			}
+		case <-durationTimer:
+			return TerminatedByDuration
+		case <-stableSetC:
+			return TerminatedByStableSet
+		case <-rtcTimer:
+			return TerminatedByTrigger
+		case uri := <-ec.triggers:
+			if hasTrigger(ec.stopTriggers, uri) {
+				return TerminatedByTrigger
+			}
+		case <-ec.added:
+			// the set has changed, restart the stable set interval
+			if stableSetTimer != nil {
+				if !stableSetTimer.Stop() {
+					select {
+					case <-stableSetTimer.C:
+					default:
+					}
+				}
+				stableSetTimer.Reset(b.StableSetInterval.Duration())
+			}
+		}
+	}
+}
+
+// closePollers closes the channels of the pollers waiting for the ECReports
+func (ec *EventCycle) closePollers() {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	for _, ch := range ec.pollers {
+		close(ch)
+	}
+	ec.pollers = nil
+}
+
+// add adds the tag with the metadata, returns true if the tag is new
+func (set tagSet) add(tag string, md *reporting.TagMetadata) bool {
+	if md == nil {
+		md = &reporting.TagMetadata{ReadCount: 1}
+	}
+	if existing, ok := set[tag]; ok {
+		existing.Merge(md)
+		return false
+	}
+	// copy the metadata as it's merged for each report
+	merged := *md
+	set[tag] = &merged
+	return true
+}
+
+// difference returns the sorted tags in a but not in b
+func difference(a tagSet, b tagSet) []string {
+	tags := []string{}
+	for tag := range a {
+		if _, ok := b[tag]; !ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// hasTrigger returns true if the uri is one of the triggers
+func hasTrigger(triggers []*Trigger, uri string) bool {
+	for _, t := range triggers {
+		if t.URI == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// notify sends a signal to the channel without blocking
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ecspec
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iomz/gosstrak/reporting"
+	"github.com/iomz/gosstrak/tagmemory"
+)
+
+// collect returns a ReportHandler sending the ECReports to the channel
+func collect(ch chan *reporting.ECReports) ReportHandler {
+	return func(subscriber string, ecr *reporting.ECReports) {
+		ch <- ecr
+	}
+}
+
+// waitReports receives ECReports from the channel or fails
+func waitReports(t *testing.T, ch chan *reporting.ECReports) *reporting.ECReports {
+	select {
+	case ecr := <-ch:
+		return ecr
+	case <-time.After(5 * time.Second):
+		t.Fatal("no ECReports delivered")
+	}
+	return nil
+}
+
+// epcsOf returns the epcs in the report
+func epcsOf(ecr *reporting.ECReports, reportName string) []string {
+	epcs := []string{}
+	for _, r := range ecr.Reports {
+		if r.ReportName != reportName {
+			continue
+		}
+		for _, m := range r.Groups[0].Members {
+			epcs = append(epcs, m.EPC)
+		}
+	}
+	return epcs
+}
+
+// waitActive waits until the event cycle becomes active or fails
+func waitActive(t *testing.T, ec *EventCycle) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		ec.mutex.Lock()
+		active := ec.active
+		ec.mutex.Unlock()
+		if active {
+			return
+		}
+	}
+	t.Fatal("the event cycle didn't start")
+}
+
+func TestEventCycle_ReportSets(t *testing.T) {
+	spec := &ECSpec{
+		Boundaries: ECBoundarySpec{
+			StartTriggers: []string{"urn:test:start"},
+			StopTriggers:  []string{"urn:test:stop"},
+		},
+		ReportSpecs: []ECReportSpec{
+			{ReportName: "current", ReportSet: ECReportSetSpec{Current}},
+			{ReportName: "additions", ReportSet: ECReportSetSpec{Additions}},
+			{ReportName: "deletions", ReportSet: ECReportSetSpec{Deletions}, ReportIfEmpty: true},
+		},
+	}
+	ch := make(chan *reporting.ECReports, 4)
+	ec, err := NewEventCycle("spec", spec, collect(ch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec.Subscribe("http://localhost/")
+	ec.Start()
+	defer ec.Stop()
+
+	cycles := []struct {
+		tags      []string
+		current   []string
+		additions []string
+		deletions []string
+	}{
+		{[]string{"a", "b", "a"}, []string{"a", "b"}, []string{"a", "b"}, []string{}},
+		{[]string{"b", "c"}, []string{"b", "c"}, []string{"c"}, []string{"a"}},
+	}
+	for i, c := range cycles {
+		ec.Trigger("urn:test:start")
+		waitActive(t, ec)
+		for _, tag := range c.tags {
+			ec.Add(tag, nil)
+		}
+		ec.Trigger("urn:test:stop")
+		ecr := waitReports(t, ch)
+		if ecr.InitiationCondition != InitiatedByTrigger || ecr.TerminationCondition != TerminatedByTrigger {
+			t.Errorf("cycle %v: conditions = %v, %v", i, ecr.InitiationCondition, ecr.TerminationCondition)
+		}
+		if got := epcsOf(ecr, "current"); !reflect.DeepEqual(got, c.current) {
+			t.Errorf("cycle %v: CURRENT = %v, want %v", i, got, c.current)
+		}
+		if got := epcsOf(ecr, "additions"); !reflect.DeepEqual(got, c.additions) {
+			t.Errorf("cycle %v: ADDITIONS = %v, want %v", i, got, c.additions)
+		}
+		if got := epcsOf(ecr, "deletions"); !reflect.DeepEqual(got, c.deletions) {
+			t.Errorf("cycle %v: DELETIONS = %v, want %v", i, got, c.deletions)
+		}
+	}
+}
+
+func TestEventCycle_ReaderMetadata(t *testing.T) {
+	spec := &ECSpec{
+		Boundaries: ECBoundarySpec{
+			StartTriggers: []string{"urn:test:start"},
+			StopTriggers:  []string{"urn:test:stop"},
+		},
+		ReportSpecs: []ECReportSpec{
+			{ReportName: "metadata", ReportSet: ECReportSetSpec{Current}, Output: &ECReportOutputSpec{IncludeReaderMetadata: true}},
+			{ReportName: "plain", ReportSet: ECReportSetSpec{Current}},
+		},
+	}
+	ch := make(chan *reporting.ECReports, 1)
+	ec, err := NewEventCycle("spec", spec, collect(ch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec.Subscribe("http://localhost/")
+	ec.Start()
+	defer ec.Stop()
+
+	weak, strong := int8(-60), int8(-50)
+	first, last := time.Unix(100, 0), time.Unix(200, 0)
+	ec.Trigger("urn:test:start")
+	waitActive(t, ec)
+	ec.Add("a", &reporting.TagMetadata{AntennaID: 1, PeakRSSI: &weak, FirstSeen: &first, LastSeen: &first, ReadCount: 1})
+	ec.Add("a", &reporting.TagMetadata{AntennaID: 2, PeakRSSI: &strong, FirstSeen: &last, LastSeen: &last, ReadCount: 3})
+	ec.Add("b", nil)
+	ec.Trigger("urn:test:stop")
+	ecr := waitReports(t, ch)
+
+	want := map[string]*reporting.TagMetadata{
+		"a": {AntennaID: 2, PeakRSSI: &strong, FirstSeen: &first, LastSeen: &last, ReadCount: 4},
+		"b": {ReadCount: 1},
+	}
+	for _, r := range ecr.Reports {
+		for _, m := range r.Groups[0].Members {
+			switch r.ReportName {
+			case "metadata":
+				if !reflect.DeepEqual(m.Extension, want[m.EPC]) {
+					t.Errorf("%s: extension = %+v, want %+v", m.EPC, m.Extension, want[m.EPC])
+				}
+			case "plain":
+				if m.Extension != nil {
+					t.Errorf("%s: extension = %+v without includeReaderMetadata", m.EPC, m.Extension)
+				}
+			}
+		}
+	}
+}
+
+func TestEventCycle_Duration(t *testing.T) {
+	ch := make(chan *reporting.ECReports, 4)
+	ec, err := NewEventCycle("spec", NewDefaultECSpec("r", 20*time.Millisecond, 0, 0, Current), collect(ch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec.Start()
+	defer ec.Stop()
+
+	// nothing is reported until requested
+	ec.Add("a", nil)
+	ec.Subscribe("http://localhost/")
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		ec.Add("a", nil)
+		select {
+		case ecr := <-ch:
+			if ecr.TerminationCondition != TerminatedByDuration {
+				t.Errorf("terminationCondition = %v, want %v", ecr.TerminationCondition, TerminatedByDuration)
+			}
+			if got := epcsOf(ecr, "r"); !reflect.DeepEqual(got, []string{"a"}) {
+				t.Errorf("CURRENT = %v, want [a]", got)
+			}
+			return
+		default:
+		}
+	}
+	t.Fatal("no ECReports delivered")
+}
+
+func TestEventCycle_StableSet(t *testing.T) {
+	ch := make(chan *reporting.ECReports, 4)
+	ec, err := NewEventCycle("spec", NewDefaultECSpec("r", 0, 0, 30*time.Millisecond, Current), collect(ch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec.Subscribe("http://localhost/")
+	ec.Start()
+	defer ec.Stop()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		ec.Add("a", nil)
+		select {
+		case ecr := <-ch:
+			if ecr.TerminationCondition != TerminatedByStableSet {
+				t.Errorf("terminationCondition = %v, want %v", ecr.TerminationCondition, TerminatedByStableSet)
+			}
+			return
+		default:
+		}
+	}
+	t.Fatal("no ECReports delivered")
+}
+
+func TestEventCycle_OutputFormat(t *testing.T) {
+	spec := &ECSpec{
+		Boundaries: ECBoundarySpec{
+			StartTriggers: []string{"urn:test:start"},
+			StopTriggers:  []string{"urn:test:stop"},
+		},
+		ReportSpecs: []ECReportSpec{
+			{ReportName: "tag", ReportSet: ECReportSetSpec{Current}, Output: &ECReportOutputSpec{IncludeEPC: true, IncludeTag: true, IncludeRawHex: true}},
+			{ReportName: "plain", ReportSet: ECReportSetSpec{Current}, Output: &ECReportOutputSpec{IncludeReaderMetadata: true}},
+		},
+	}
+	ch := make(chan *reporting.ECReports, 1)
+	ec, err := NewEventCycle("spec", spec, collect(ch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec.Subscribe("http://localhost/")
+	ec.Start()
+	defer ec.Stop()
+
+	epc := "urn:epc:id:sgtin:0614141.812345.6789"
+	ec.Trigger("urn:test:start")
+	waitActive(t, ec)
+	ec.Add(epc, &reporting.TagMetadata{ReadCount: 1, ID: []byte{48, 116, 37, 123, 247, 25, 78, 64, 0, 0, 26, 133}})
+	ec.Trigger("urn:test:stop")
+	ecr := waitReports(t, ch)
+
+	want := map[string]reporting.ECReportGroupListMember{
+		"tag": {
+			EPC:    epc,
+			Tag:    "urn:epc:tag:sgtin-96:3.0614141.812345.6789",
+			RawHex: "urn:epc:raw:96.x3074257BF7194E4000001A85",
+		},
+		"plain": {EPC: epc},
+	}
+	for _, r := range ecr.Reports {
+		m := r.Groups[0].Members[0]
+		m.Extension = nil
+		if !reflect.DeepEqual(m, want[r.ReportName]) {
+			t.Errorf("%s: member = %+v, want %+v", r.ReportName, m, want[r.ReportName])
+		}
+	}
+}
+
+func TestEventCycle_OutputFields(t *testing.T) {
+	fields := tagmemory.NewRegistry()
+	if err := fields.Define("tid", &tagmemory.TMFixedFieldListSpec{FixedFields: []tagmemory.TMFixedFieldSpec{{FieldName: "mdid", Bank: 2, Length: 12, Offset: 8}}}); err != nil {
+		t.Fatal(err)
+	}
+	spec := &ECSpec{
+		Boundaries: ECBoundarySpec{
+			StartTriggers: []string{"urn:test:start"},
+			StopTriggers:  []string{"urn:test:stop"},
+		},
+		ReportSpecs: []ECReportSpec{
+			{ReportName: "fields", ReportSet: ECReportSetSpec{Current}, Output: &ECReportOutputSpec{
+				IncludeEPC: true,
+				FieldList: []ECReportOutputFieldSpec{
+					{FieldSpec: ECFieldSpec{FieldName: "mdid", Format: "decimal"}, IncludeFieldSpecInReport: true},
+					{FieldSpec: ECFieldSpec{FieldName: "epc", Format: "epc-hex"}, Name: "rawEPC"},
+					{FieldSpec: ECFieldSpec{FieldName: "userBank"}},
+				},
+			}},
+		},
+	}
+	if _, err := NewEventCycle("spec", spec, nil); err == nil {
+		t.Error("NewEventCycle() resolved a fieldname defined in a TMSpec")
+	}
+	ch := make(chan *reporting.ECReports, 1)
+	ec, err := newEventCycle("spec", spec, collect(ch), fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec.Subscribe("http://localhost/")
+	ec.Start()
+	defer ec.Stop()
+
+	ec.Trigger("urn:test:start")
+	waitActive(t, ec)
+	ec.Add("urn:epc:id:sgtin:0614141.812345.6789", &reporting.TagMetadata{
+		ReadCount: 1,
+		PC:        []byte{48, 0},
+		ID:        []byte{48, 116, 37, 123, 247, 25, 78, 64, 0, 0, 26, 133},
+		TID:       []byte{0xe2, 0x80, 0x11, 0x05},
+	})
+	ec.Trigger("urn:test:stop")
+	ecr := waitReports(t, ch)
+
+	want := &reporting.ECReportMemberExtension{
+		FieldList: []reporting.ECReportMemberField{
+			{Name: "mdid", Value: "2049", FieldSpec: &ECFieldSpec{FieldName: "mdid", Format: "decimal"}},
+			{Name: "rawEPC", Value: "urn:epc:raw:96.x3074257BF7194E4000001A85"},
+			{Name: "userBank"},
+		},
+	}
+	if got := ecr.Reports[0].Groups[0].Members[0].Extension; !reflect.DeepEqual(got, want) {
+		t.Errorf("extension = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ecspec
+
+import (
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/iomz/gosstrak/reporting"
+	"github.com/iomz/gosstrak/tagmemory"
+)
+
+// ReaderScope returns true if a read from the antenna of the physical reader
+// belongs to the logical reader
+type ReaderScope func(logicalReader string, reader string, antenna uint16) bool
+
+// Unsubscribed is called with a notificationURI no longer subscribed to any ECSpec
+type Unsubscribed func(notificationURI string)
+
+// Manager holds the defined ECSpecs and runs their EventCycles
+type Manager struct {
+	mutex   sync.RWMutex
+	cycles  map[string]*EventCycle
+	handler ReportHandler
+	scope   ReaderScope
+	fields  *tagmemory.Registry
+	// unsubscribed is called after Unsubscribe or Undefine
+	unsubscribed Unsubscribed
+}
+
+// NewManager returns the pointer to a new Manager instance
+func NewManager(handler ReportHandler) *Manager {
+	return &Manager{
+		cycles:  make(map[string]*EventCycle),
+		handler: handler,
+	}
+}
+
+// Add adds the tag and its metadata to the current event cycle of the ECSpec
+func (m *Manager) Add(specName string, tag string, md *reporting.TagMetadata) {
+	m.mutex.RLock()
+	ec, ok := m.cycles[specName]
+	m.mutex.RUnlock()
+	if ok {
+		ec.Add(tag, md)
+	}
+}
+
+// AddToReport adds the tag and its metadata to the report in the current event cycle of the ECSpec
+func (m *Manager) AddToReport(specName string, reportName string, tag string, md *reporting.TagMetadata) {
+	m.mutex.RLock()
+	ec, ok := m.cycles[specName]
+	m.mutex.RUnlock()
+	if ok {
+		ec.AddToReport(reportName, tag, md)
+	}
+}
+
+// Define validates the ECSpec and starts its EventCycle
+func (m *Manager) Define(specName string, spec *ECSpec) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.cycles[specName]; ok {
+		return &DuplicateNameError{specName}
+	}
+	ec, err := newEventCycle(specName, spec, m.handler, m.fields)
+	if err != nil {
+		return &ValidationError{err.Error()}
+	}
+	m.cycles[specName] = ec
+	ec.Start()
+	log.Printf("[ECSpecManager] defined %s", specName)
+	return nil
+}
+
+// FieldInUse returns true if the fieldname is reported in any ECSpec
+func (m *Manager) FieldInUse(fieldname string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, ec := range m.cycles {
+		for _, rs := range ec.Spec.ReportSpecs {
+			if rs.Output == nil {
+				continue
+			}
+			for _, ofs := range rs.Output.FieldList {
+				if ofs.FieldSpec.FieldName == fieldname {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ReaderInUse returns true if the logical reader is in any ECSpec
+func (m *Manager) ReaderInUse(name string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, ec := range m.cycles {
+		for _, lr := range ec.Spec.LogicalReaders {
+			if lr == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetECSpec returns the ECSpec of the name
+func (m *Manager) GetECSpec(specName string) (*ECSpec, error) {
+	ec, err := m.get(specName)
+	if err != nil {
+		return nil, err
+	}
+	return ec.Spec, nil
+}
+
+// GetECSpecNames returns the names of the defined ECSpecs
+func (m *Manager) GetECSpecNames() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	names := make([]string, 0, len(m.cycles))
+	for name := range m.cycles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetSubscribers returns the subscribers of the ECSpec
+func (m *Manager) GetSubscribers(specName string) ([]string, error) {
+	ec, err := m.get(specName)
+	if err != nil {
+		return nil, err
+	}
+	return ec.Subscribers(), nil
+}
+
+// InScope returns true if a read from the antenna of the physical reader
+// belongs to the logical readers of the ECSpec, or the ECSpec has no logical readers
+func (m *Manager) InScope(specName string, reader string, antenna uint16) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	ec, ok := m.cycles[specName]
+	if !ok {
+		return false
+	}
+	if len(ec.Spec.LogicalReaders) == 0 {
+		return true
+	}
+	for _, lr := range ec.Spec.LogicalReaders {
+		if m.scope != nil && m.scope(lr, reader, antenna) || m.scope == nil && lr == reader {
+			return true
+		}
+	}
+	return false
+}
+
+// Poll runs the next event cycle of the ECSpec as if it's subscribed and returns the ECReports
+func (m *Manager) Poll(specName string) (*reporting.ECReports, error) {
+	ec, err := m.get(specName)
+	if err != nil {
+		return nil, err
+	}
+	ecr, ok := <-ec.Poll()
+	if !ok {
+		return nil, &NoSuchNameError{specName}
+	}
+	return ecr, nil
+}
+
+// SetReaderScope sets the ReaderScope to resolve the logical readers in the ECSpecs,
+// a logical reader is the physical reader of the same name by default
+func (m *Manager) SetReaderScope(scope ReaderScope) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.scope = scope
+}
+
+// SetUnsubscribed sets the Unsubscribed to release the resources of the notificationURIs, e.g., Reporter.Remove
+func (m *Manager) SetUnsubscribed(unsubscribed Unsubscribed) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.unsubscribed = unsubscribed
+}
+
+// SetTagMemory sets the tagmemory.Registry to resolve the fieldnames in the output of the ECSpecs
+func (m *Manager) SetTagMemory(fields *tagmemory.Registry) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.fields = fields
+}
+
+// Subscribe adds the notificationURI to the subscribers of the ECSpec
+func (m *Manager) Subscribe(specName string, notificationURI string) error {
+	ec, err := m.get(specName)
+	if err != nil {
+		return err
+	}
+	if !ec.Subscribe(notificationURI) {
+		return &DuplicateSubscriptionError{specName, notificationURI}
+	}
+	return nil
+}
+
+// Trigger fires the trigger on all the EventCycles
+func (m *Manager) Trigger(uri string) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, ec := range m.cycles {
+		ec.Trigger(uri)
+	}
+}
+
+// Undefine stops the EventCycle and removes the ECSpec
+func (m *Manager) Undefine(specName string) error {
+	m.mutex.Lock()
+	ec, ok := m.cycles[specName]
+	delete(m.cycles, specName)
+	m.mutex.Unlock()
+	if !ok {
+		return &NoSuchNameError{specName}
+	}
+	ec.Stop()
+	log.Printf("[ECSpecManager] undefined %s", specName)
+	m.release(ec.Subscribers())
+	return nil
+}
+
+// Unsubscribe removes the notificationURI from the subscribers of the ECSpec
+func (m *Manager) Unsubscribe(specName string, notificationURI string) error {
+	ec, err := m.get(specName)
+	if err != nil {
+		return err
+	}
+	if !ec.Unsubscribe(notificationURI) {
+		return &NoSuchSubscriberError{specName, notificationURI}
+	}
+	m.release([]string{notificationURI})
+	return nil
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// get returns the EventCycle of the name
+func (m *Manager) get(specName string) (*EventCycle, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	ec, ok := m.cycles[specName]
+	if !ok {
+		return nil, &NoSuchNameError{specName}
+	}
+	return ec, nil
+}
+
+// release calls the Unsubscribed with the notificationURIs not subscribed to any ECSpec
+func (m *Manager) release(notificationURIs []string) {
+	m.mutex.RLock()
+	unsubscribed := m.unsubscribed
+	subscribed := map[string]bool{}
+	for _, ec := range m.cycles {
+		for _, uri := range ec.Subscribers() {
+			subscribed[uri] = true
+		}
+	}
+	m.mutex.RUnlock()
+	if unsubscribed == nil {
+		return
+	}
+	for _, uri := range notificationURIs {
+		if !subscribed[uri] {
+			unsubscribed(uri)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ecspec
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/iomz/gosstrak/reporting"
+)
+
+func TestManager_InScope(t *testing.T) {
+	m := NewManager(func(string, *reporting.ECReports) {})
+	for name, lrs := range map[string][]string{
+		"all":  nil,
+		"dock": {"dock-door-3"},
+		"in":   {"door-3-in"},
+	} {
+		spec := NewDefaultECSpec("report", time.Hour, 0, 0, Current)
+		spec.LogicalReaders = lrs
+		if err := m.Define(name, spec); err != nil {
+			t.Fatal(err)
+		}
+		defer m.Undefine(name)
+	}
+	if !m.ReaderInUse("door-3-in") || m.ReaderInUse("door-3-out") {
+		t.Errorf("Manager.ReaderInUse() = %v, %v, want true, false", m.ReaderInUse("door-3-in"), m.ReaderInUse("door-3-out"))
+	}
+	tests := []struct {
+		specName string
+		reader   string
+		antenna  uint16
+		want     bool
+	}{
+		{"all", "reader-1", 1, true},
+		{"dock", "dock-door-3", 1, true},
+		{"dock", "reader-1", 1, false},
+		{"none", "dock-door-3", 1, false},
+	}
+	for _, tt := range tests {
+		if got := m.InScope(tt.specName, tt.reader, tt.antenna); got != tt.want {
+			t.Errorf("Manager.InScope(%v, %v, %v) = %v, want %v", tt.specName, tt.reader, tt.antenna, got, tt.want)
+		}
+	}
+
+	// door-3-in is the antenna 1 and 2 of reader-1
+	m.SetReaderScope(func(lr string, reader string, antenna uint16) bool {
+		return lr == "door-3-in" && reader == "reader-1" && antenna <= 2
+	})
+	tests = []struct {
+		specName string
+		reader   string
+		antenna  uint16
+		want     bool
+	}{
+		{"in", "reader-1", 2, true},
+		{"in", "reader-1", 3, false},
+		{"dock", "dock-door-3", 1, false},
+		{"all", "reader-2", 3, true},
+	}
+	for _, tt := range tests {
+		if got := m.InScope(tt.specName, tt.reader, tt.antenna); got != tt.want {
+			t.Errorf("Manager.InScope(%v, %v, %v) = %v, want %v", tt.specName, tt.reader, tt.antenna, got, tt.want)
+		}
+	}
+}
+
+func TestManager_SetUnsubscribed(t *testing.T) {
+	m := NewManager(func(string, *reporting.ECReports) {})
+	released := []string{}
+	m.SetUnsubscribed(func(uri string) { released = append(released, uri) })
+	for _, name := range []string{"a", "b"} {
+		if err := m.Define(name, NewDefaultECSpec("report", time.Hour, 0, 0, Current)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Subscribe("a", "http://localhost:8888/shared")
+	m.Subscribe("b", "http://localhost:8888/shared")
+	m.Subscribe("b", "http://localhost:8888/b")
+	if err := m.Unsubscribe("a", "http://localhost:8888/shared"); err != nil || len(released) != 0 {
+		t.Errorf("Manager.Unsubscribe() released %v, %v", released, err)
+	}
+	if err := m.Undefine("a"); err != nil || len(released) != 0 {
+		t.Errorf("Manager.Undefine() released %v, %v", released, err)
+	}
+	m.Undefine("b")
+	sort.Strings(released)
+	if want := []string{"http://localhost:8888/b", "http://localhost:8888/shared"}; !reflect.DeepEqual(released, want) {
+		t.Errorf("Manager.Undefine() released %v, want %v", released, want)
+	}
+}
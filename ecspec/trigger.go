@@ -0,0 +1,104 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ecspec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RTCTriggerPrefix is the prefix of the ALE real-time clock trigger URI
+const RTCTriggerPrefix = "urn:epcglobal:ale:trigger:rtc:"
+
+// Trigger is a start/stop trigger in ECBoundarySpec
+type Trigger struct {
+	URI      string
+	isRTC    bool
+	period   time.Duration
+	offset   time.Duration
+	location *time.Location
+}
+
+// ParseTrigger parses the trigger URI, any URI is accepted as a trigger fired externally
+// except the real-time clock trigger: urn:epcglobal:ale:trigger:rtc:<period>.<offset>[.<timezone>]
+func ParseTrigger(uri string) (*Trigger, error) {
+	if len(uri) == 0 {
+		return nil, fmt.Errorf("empty trigger URI")
+	}
+	t := &Trigger{URI: uri}
+	if !strings.HasPrefix(uri, RTCTriggerPrefix) {
+		return t, nil
+	}
+	fields := strings.SplitN(strings.TrimPrefix(uri, RTCTriggerPrefix), ".", 3)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid rtc trigger: %s", uri)
+	}
+	period, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || period <= 0 || period > 24*60*60*1000 {
+		return nil, fmt.Errorf("invalid period in rtc trigger: %s", uri)
+	}
+	offset, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || offset < 0 || offset >= period {
+		return nil, fmt.Errorf("invalid offset in rtc trigger: %s", uri)
+	}
+	t.isRTC = true
+	t.period = time.Duration(period) * time.Millisecond
+	t.offset = time.Duration(offset) * time.Millisecond
+	t.location = time.UTC
+	if len(fields) == 3 && fields[2] != "Z" {
+		tz, err := time.Parse("-07:00", fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone in rtc trigger: %s", uri)
+		}
+		_, sec := tz.Zone()
+		t.location = time.FixedZone(fields[2], sec)
+	}
+	return t, nil
+}
+
+// IsRTC returns true if the trigger is a real-time clock trigger
+func (t *Trigger) IsRTC() bool {
+	return t.isRTC
+}
+
+// Next returns the next time the real-time clock trigger fires after the given time
+func (t *Trigger) Next(after time.Time) time.Time {
+	if !t.isRTC {
+		return time.Time{}
+	}
+	local := after.In(t.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, t.location)
+	elapsed := local.Sub(midnight) - t.offset
+	n := elapsed / t.period
+	if elapsed >= 0 {
+		n++
+	}
+	next := midnight.Add(t.offset + n*t.period)
+	// the period restarts at every midnight
+	tomorrow := midnight.AddDate(0, 0, 1)
+	if !next.Before(tomorrow) {
+		next = tomorrow.Add(t.offset)
+	}
+	return next
+}
+
+// nextRTC returns the earliest next fire time among the real-time clock triggers
+func nextRTC(triggers []*Trigger, after time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+	for _, t := range triggers {
+		if !t.isRTC {
+			continue
+		}
+		if n := t.Next(after); !found || n.Before(next) {
+			next = n
+			found = true
+		}
+	}
+	return next, found
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package ecspec
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrigger_Next(t *testing.T) {
+	base := time.Date(2018, 4, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		uri     string
+		after   time.Time
+		want    time.Time
+		wantErr bool
+	}{
+		{"every 10s", "urn:epcglobal:ale:trigger:rtc:10000.0", base.Add(3 * time.Second), base.Add(10 * time.Second), false},
+		{"on the edge", "urn:epcglobal:ale:trigger:rtc:10000.0", base, base.Add(10 * time.Second), false},
+		{"with offset", "urn:epcglobal:ale:trigger:rtc:60000.5000", base, base.Add(5 * time.Second), false},
+		{"with timezone", "urn:epcglobal:ale:trigger:rtc:86400000.0.+09:00", base, time.Date(2018, 4, 1, 15, 0, 0, 0, time.UTC), false},
+		{"restart at midnight", "urn:epcglobal:ale:trigger:rtc:25000000.0.Z", base.Add(11 * time.Hour), time.Date(2018, 4, 2, 0, 0, 0, 0, time.UTC), false},
+		{"invalid period", "urn:epcglobal:ale:trigger:rtc:x.0", base, time.Time{}, true},
+		{"invalid timezone", "urn:epcglobal:ale:trigger:rtc:1000.0.JST", base, time.Time{}, true},
+		{"external", "urn:example:trigger:gpi:1", base, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := ParseTrigger(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseTrigger() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got := tr.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Trigger.Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,30 +6,143 @@
 package filtering
 
 import (
+	"fmt"
 	"log"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 	"unsafe"
 
 	"github.com/iomz/go-llrp"
+	"github.com/iomz/gosstrak/tagmemory"
+	"github.com/iomz/gosstrak/tdt"
 )
 
 // EngineFactory manages the FC's subscriptions and engine instances
 type EngineFactory struct {
 	mainChannel          chan ManagementMessage
 	generatorChannels    []chan ManagementMessage
+	mutex                sync.RWMutex
 	currentSubscriptions Subscriptions
 	productionSystem     map[string]*EngineGenerator
 	deploymentPriority   map[string]uint8
 	enginePerformance    sync.Map
 	currentEngineName    string
 	statInterval         int
+	memory               memoryFilters
+	fields               *tagmemory.Registry
+	tdtCore              *tdt.Core
+}
+
+// AddSubscription adds the pattern for the reportURI and updates all the engines
+func (ef *EngineFactory) AddSubscription(reportURI string, pattern string) error {
+	ef.mutex.Lock()
+	if err := validatePattern(pattern, ef.fields); err != nil {
+		ef.mutex.Unlock()
+		return err
+	}
+	for _, pat := range ef.currentSubscriptions[reportURI] {
+		if pat == pattern {
+			ef.mutex.Unlock()
+			return fmt.Errorf("%s is already subscribed for %s", pattern, reportURI)
+		}
+	}
+	ef.currentSubscriptions[reportURI] = append(ef.currentSubscriptions[reportURI], pattern)
+	ef.memory = newMemoryFilters(ef.currentSubscriptions, ef.fields)
+	ef.mutex.Unlock()
+	// the engines don't hold the memory patterns
+	if IsMemoryPattern(pattern) {
+		return nil
+	}
+
+	ef.update(&ManagementMessage{
+		Type:      AddSubscription,
+		Pattern:   pattern,
+		ReportURI: reportURI,
+	})
+	return nil
+}
+
+// DeleteSubscription deletes the pattern for the reportURI and updates all the engines
+func (ef *EngineFactory) DeleteSubscription(reportURI string, pattern string) error {
+	ef.mutex.Lock()
+	found := false
+	patterns := ef.currentSubscriptions[reportURI]
+	for i, pat := range patterns {
+		if pat == pattern {
+			ef.currentSubscriptions[reportURI] = append(patterns[:i:i], patterns[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if found && len(ef.currentSubscriptions[reportURI]) == 0 {
+		delete(ef.currentSubscriptions, reportURI)
+	}
+	ef.memory = newMemoryFilters(ef.currentSubscriptions, ef.fields)
+	ef.mutex.Unlock()
+	if !found {
+		return fmt.Errorf("%s is not subscribed for %s", pattern, reportURI)
+	}
+	if IsMemoryPattern(pattern) {
+		return nil
+	}
+
+	ef.update(&ManagementMessage{
+		Type:      DeleteSubscription,
+		Pattern:   pattern,
+		ReportURI: reportURI,
+	})
+	return nil
+}
+
+// CurrentEngineName returns the name of the engine currently used for Search
+func (ef *EngineFactory) CurrentEngineName() string {
+	ef.mutex.RLock()
+	defer ef.mutex.RUnlock()
+	return ef.currentEngineName
+}
+
+// Dump returns a string representation of the engine
+func (ef *EngineFactory) Dump(engineName string) (string, error) {
+	eg, ok := ef.productionSystem[engineName]
+	if !ok {
+		return "", fmt.Errorf("no such engine: %s", engineName)
+	}
+	return eg.Dump()
+}
+
+// EngineGenerators returns the EngineGenerators sorted by their names
+func (ef *EngineFactory) EngineGenerators() []*EngineGenerator {
+	names := []string{}
+	for name := range ef.productionSystem {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	egs := make([]*EngineGenerator, len(names))
+	for i, name := range names {
+		egs[i] = ef.productionSystem[name]
+	}
+	return egs
+}
+
+// FieldInUse returns true if the fieldname is used in any memory pattern
+func (ef *EngineFactory) FieldInUse(fieldname string) bool {
+	ef.mutex.RLock()
+	defer ef.mutex.RUnlock()
+	for _, patterns := range ef.currentSubscriptions {
+		for _, pat := range patterns {
+			if IsMemoryPattern(pat) && memoryFieldName(pat) == fieldname {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // IsActive returns false if no engine is available
 func (ef *EngineFactory) IsActive() bool {
-	if len(ef.currentEngineName) == 0 {
+	if len(ef.CurrentEngineName()) == 0 {
 		return false
 	}
 	return true
@@ -37,12 +150,52 @@ func (ef *EngineFactory) IsActive() bool {
 
 // Search is a wrapper for Search() with the current EngineGenerator
 func (ef *EngineFactory) Search(re llrp.ReadEvent) (string, []string, error) {
+	current := ef.CurrentEngineName()
 	for name, eg := range ef.productionSystem {
-		if name != ef.currentEngineName && eg.FSM.Is("ready") {
+		if name != current && eg.FSM.Is("ready") {
 			_, _, _ = eg.Search(re)
 		}
 	}
-	return ef.productionSystem[ef.currentEngineName].Search(re)
+	return ef.productionSystem[current].Search(re)
+}
+
+// SearchTag is Search with the memory patterns applied to the EPC bank, the TID and the user memory of the tag,
+// tid and user are nil if not read
+func (ef *EngineFactory) SearchTag(re llrp.ReadEvent, tid []byte, user []byte) (string, []string, error) {
+	pureIdentity, reportURIs, err := ef.Search(re)
+	ef.mutex.RLock()
+	memory := ef.memory
+	ef.mutex.RUnlock()
+	if memory.isEmpty() {
+		return pureIdentity, reportURIs, err
+	}
+	if err != nil {
+		reportURIs = nil
+	}
+	reportURIs = memory.apply(tagmemory.Banks(re.PC, re.ID, tid, user), reportURIs)
+	if len(reportURIs) == 0 {
+		return "", reportURIs, fmt.Errorf("no match found for %v", re.ID)
+	}
+	if len(pureIdentity) == 0 {
+		pureIdentity, err = ef.tdtCore.Translate(re.PC, re.ID)
+		return pureIdentity, reportURIs, err
+	}
+	return pureIdentity, reportURIs, nil
+}
+
+// SetTagMemory sets the tagmemory.Registry to resolve the fieldnames in the memory patterns
+func (ef *EngineFactory) SetTagMemory(fields *tagmemory.Registry) {
+	ef.mutex.Lock()
+	defer ef.mutex.Unlock()
+	ef.fields = fields
+	ef.memory = newMemoryFilters(ef.currentSubscriptions, fields)
+}
+
+// Subscriptions returns a copy of the current subscriptions
+func (ef *EngineFactory) Subscriptions() Subscriptions {
+	ef.mutex.RLock()
+	defer ef.mutex.RUnlock()
+	return ef.currentSubscriptions.Clone()
 }
 
 // NewEngineFactory returns the pointer to a new EngineFactory instance
@@ -53,7 +206,9 @@ func NewEngineFactory(sub Subscriptions, statInterval int, mc chan ManagementMes
 	}
 
 	// Load saved subscriptions?
-	ef.currentSubscriptions = sub
+	ef.currentSubscriptions = sub.Clone()
+	ef.memory = newMemoryFilters(sub, nil)
+	ef.tdtCore = tdt.NewCore()
 
 	// Load all the possible engines
 	ef.productionSystem = make(map[string]*EngineGenerator)
@@ -103,13 +258,13 @@ func (ef *EngineFactory) Run() {
 					}
 					return true
 				})
-				if ef.currentEngineName != ename && len(ename) != 0 {
-					log.Printf("[EngineFactory] %s replaces the currentEngine %s due to performance", ename, ef.currentEngineName)
-					ef.currentEngineName = ename
+				if ef.CurrentEngineName() != ename && len(ename) != 0 {
+					log.Printf("[EngineFactory] %s replaces the currentEngine %s due to performance", ename, ef.CurrentEngineName())
+					ef.setCurrentEngineName(ename)
 				}
 				ef.mainChannel <- ManagementMessage{
 					Type:       SelectedEngine,
-					EngineName: ef.currentEngineName,
+					EngineName: ef.CurrentEngineName(),
 				}
 			}
 		}
@@ -136,53 +291,34 @@ func (ef *EngineFactory) Run() {
 			}
 			switch msg.Type {
 			case AddSubscription:
-				/*
-					if _, ok := ef.currentByteSubscriptions[msg.FilterString]; !ok {
-						ef.currentByteSubscriptions[msg.FilterString] = &PartialSubscription{
-							Offset:    0,
-							ReportURI: msg.ReportURI,
-						}
-						for _, eg := range ef.productionSystem {
-							err := eg.FSM.Event("update", &msg)
-							if err != nil {
-								log.Println(err)
-							}
-						}
-					}
-				*/
+				if err := ef.AddSubscription(msg.ReportURI, msg.Pattern); err != nil {
+					log.Printf("[EngineFactory] %v", err)
+				}
 			case DeleteSubscription:
-				/*
-					if _, ok := ef.currentByteSubscriptions[msg.FilterString]; ok {
-						delete(ef.currentByteSubscriptions, msg.FilterString)
-						for _, eg := range ef.productionSystem {
-							err := eg.FSM.Event("update", &msg)
-							if err != nil {
-								log.Println(err)
-							}
-						}
-					}
-				*/
+				if err := ef.DeleteSubscription(msg.ReportURI, msg.Pattern); err != nil {
+					log.Printf("[EngineFactory] %v", err)
+				}
 			case OnEngineGenerated:
 				log.Printf("[EngineFactory] received OnEngineGenerated from %s", msg.EngineGeneratorInstance.Engine.Name())
-				if len(ef.currentEngineName) == 0 {
+				if len(ef.CurrentEngineName()) == 0 {
 					log.Printf("[EngineFactory] set %s as an initial engine", msg.EngineGeneratorInstance.Name)
-					ef.currentEngineName = msg.EngineGeneratorInstance.Name
+					ef.setCurrentEngineName(msg.EngineGeneratorInstance.Name)
 					ef.mainChannel <- ManagementMessage{
 						Type:       SelectedEngine,
-						EngineName: ef.currentEngineName,
+						EngineName: ef.CurrentEngineName(),
 					}
 					continue
 				}
-				if ef.deploymentPriority[ef.currentEngineName] < ef.deploymentPriority[msg.EngineGeneratorInstance.Name] {
-					log.Printf("[EngineFactory] %s replaces the currentEngine %s", msg.EngineGeneratorInstance.Name, ef.currentEngineName)
-					ef.currentEngineName = msg.EngineGeneratorInstance.Name
+				if ef.deploymentPriority[ef.CurrentEngineName()] < ef.deploymentPriority[msg.EngineGeneratorInstance.Name] {
+					log.Printf("[EngineFactory] %s replaces the currentEngine %s", msg.EngineGeneratorInstance.Name, ef.CurrentEngineName())
+					ef.setCurrentEngineName(msg.EngineGeneratorInstance.Name)
 					ef.mainChannel <- ManagementMessage{
 						Type:       SelectedEngine,
-						EngineName: ef.currentEngineName,
+						EngineName: ef.CurrentEngineName(),
 					}
 					continue
 				}
-				log.Printf("[EngineFactory] %s didn't replace the currentEngine %s", msg.EngineGeneratorInstance.Name, ef.currentEngineName)
+				log.Printf("[EngineFactory] %s didn't replace the currentEngine %s", msg.EngineGeneratorInstance.Name, ef.CurrentEngineName())
 			case TrafficStatus:
 				ef.mainChannel <- msg // bypass the status message from generators to main
 			case EngineStatus:
@@ -196,7 +332,24 @@ func (ef *EngineFactory) Run() {
 	// initialize the engines
 	log.Println("[EngineFactory] initializing engines")
 	for _, eg := range ef.productionSystem {
-		// pass the cloned subscriptions
-		eg.FSM.Event("init", ef.currentSubscriptions)
+		// pass the cloned subscriptions without the memory patterns
+		eg.FSM.Event("init", ef.Subscriptions().withoutMemoryPatterns())
+	}
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// setCurrentEngineName switches the engine used for Search
+func (ef *EngineFactory) setCurrentEngineName(name string) {
+	ef.mutex.Lock()
+	defer ef.mutex.Unlock()
+	ef.currentEngineName = name
+}
+
+// update requests all the EngineGenerators to apply the change in the subscriptions
+func (ef *EngineFactory) update(msg *ManagementMessage) {
+	log.Printf("[EngineFactory] updating engines for %s: %s", msg.ReportURI, msg.Pattern)
+	for _, eg := range ef.productionSystem {
+		eg.Update(msg)
 	}
 }
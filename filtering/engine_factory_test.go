@@ -0,0 +1,75 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package filtering
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iomz/go-llrp"
+)
+
+func TestEngineFactory_AddSubscription(t *testing.T) {
+	mc := make(chan ManagementMessage, 64)
+	ef := NewEngineFactory(Subscriptions{}, 1, mc)
+	go ef.Run()
+	for start := time.Now(); !ef.IsActive(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("no engine became active")
+		}
+	}
+
+	re := llrp.ReadEvent{
+		PC: []byte{48, 0},
+		ID: []byte{48, 112, 94, 48, 167, 0, 0, 64, 0, 0, 0, 1}, // urn:epc:id:sgtin:12345678.00001.1
+	}
+	reportURI := "http://localhost:8888/sgtin"
+	pattern := "urn:epc:pat:sgtin-96:3.12345678"
+
+	// waitUntil waits until all the engines return the reportURIs for the ReadEvent
+	waitUntil := func(want []string) {
+		for name, eg := range ef.productionSystem {
+			var got []string
+			for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+				if !eg.FSM.Is("ready") {
+					continue
+				}
+				if _, got, _ = eg.Search(re); reflect.DeepEqual(got, want) || (len(got) == 0 && len(want) == 0) {
+					break
+				}
+			}
+			if !reflect.DeepEqual(got, want) && !(len(got) == 0 && len(want) == 0) {
+				t.Errorf("%s.Search() = %v, want %v", name, got, want)
+			}
+		}
+	}
+
+	if err := ef.AddSubscription(reportURI, pattern); err != nil {
+		t.Fatal(err)
+	}
+	if err := ef.AddSubscription(reportURI, pattern); err == nil {
+		t.Error("EngineFactory.AddSubscription() accepted a duplicate pattern")
+	}
+	if err := ef.AddSubscription(reportURI, "urn:epc:pat:unknown:1"); err == nil {
+		t.Error("EngineFactory.AddSubscription() accepted an invalid pattern")
+	}
+	if got, want := ef.Subscriptions(), (Subscriptions{reportURI: {pattern}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("EngineFactory.Subscriptions() = %v, want %v", got, want)
+	}
+	waitUntil([]string{reportURI})
+
+	if err := ef.DeleteSubscription(reportURI, pattern); err != nil {
+		t.Fatal(err)
+	}
+	if err := ef.DeleteSubscription(reportURI, pattern); err == nil {
+		t.Error("EngineFactory.DeleteSubscription() accepted a missing pattern")
+	}
+	if got := ef.Subscriptions(); len(got) != 0 {
+		t.Errorf("EngineFactory.Subscriptions() = %v, want empty", got)
+	}
+	waitUntil(nil)
+}
@@ -6,8 +6,11 @@
 package filtering
 
 import (
+	"fmt"
 	"log"
 	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 	//"reflect"
 
@@ -20,10 +23,14 @@ type EngineGenerator struct {
 	FSM                 *fsm.FSM
 	Name                string
 	Engine              Engine
+	engineMutex         sync.RWMutex
+	pendingUpdates      []*ManagementMessage
+	updateMutex         sync.Mutex
 	managementChannel   chan ManagementMessage
 	timePerEventChannel chan time.Duration
 	totalTime           int64
-	CurrentThroughput   float64
+	currentThroughput   float64
+	throughputMutex     sync.RWMutex
 	EventCount          int64
 	MatchedCount        int64
 	statInterval        int
@@ -35,7 +42,6 @@ func NewEngineGenerator(name string, ec EngineConstructor, statInterval int, mc
 		Name:              name,
 		managementChannel: mc,
 		totalTime:         0,
-		CurrentThroughput: 0,
 		EventCount:        0,
 		MatchedCount:      0,
 		statInterval:      statInterval,
@@ -81,19 +87,20 @@ func NewEngineGenerator(name string, ec EngineConstructor, statInterval int, mc
 					Type:         TrafficStatus,
 					EngineName:   eg.Name,
 					EventCount:   eg.EventCount,
-					MatchedCount: eg.MatchedCount,
+					MatchedCount: atomic.SwapInt64(&eg.MatchedCount, 0),
 				}
 				throughput := float64(eg.EventCount) / float64(eg.totalTime)
 				if throughput != 0 && !math.IsNaN(throughput) {
-					eg.CurrentThroughput = throughput
+					eg.throughputMutex.Lock()
+					eg.currentThroughput = throughput
+					eg.throughputMutex.Unlock()
 					eg.managementChannel <- ManagementMessage{
 						Type:              EngineStatus,
 						EngineName:        eg.Name,
-						CurrentThroughput: eg.CurrentThroughput,
+						CurrentThroughput: throughput,
 					}
 				}
 				eg.EventCount = 0
-				eg.MatchedCount = 0
 				eg.totalTime = 0
 			}
 		}
@@ -102,16 +109,45 @@ func NewEngineGenerator(name string, ec EngineConstructor, statInterval int, mc
 	return eg
 }
 
+// CurrentThroughput returns the events per microsecond in the last stat interval
+func (eg *EngineGenerator) CurrentThroughput() float64 {
+	eg.throughputMutex.RLock()
+	defer eg.throughputMutex.RUnlock()
+	return eg.currentThroughput
+}
+
+// Dump returns a string representation of the generated engine
+func (eg *EngineGenerator) Dump() (string, error) {
+	eg.engineMutex.RLock()
+	defer eg.engineMutex.RUnlock()
+	if eg.Engine == nil {
+		return "", fmt.Errorf("%s engine is not generated yet", eg.Name)
+	}
+	return eg.Engine.Dump(), nil
+}
+
 // Search do search in the generated engine
 func (eg *EngineGenerator) Search(re llrp.ReadEvent) (string, []string, error) {
 	defer timeTrack(time.Now(), eg.timePerEventChannel)
+	eg.engineMutex.RLock()
 	pureIdentity, reportURIs, err := eg.Engine.Search(re)
+	eg.engineMutex.RUnlock()
 	if len(reportURIs) != 0 {
-		eg.MatchedCount++
+		atomic.AddInt64(&eg.MatchedCount, 1)
 	}
 	return pureIdentity, reportURIs, err
 }
 
+// Update queues the change in the subscriptions and rebuilds the engine when it's ready
+func (eg *EngineGenerator) Update(msg *ManagementMessage) {
+	eg.updateMutex.Lock()
+	eg.pendingUpdates = append(eg.pendingUpdates, msg)
+	eg.updateMutex.Unlock()
+	if eg.FSM.Is("ready") {
+		go eg.FSM.Event("update")
+	}
+}
+
 func (eg *EngineGenerator) enterState(e *fsm.Event) {
 	log.Printf("[EngineGenerator] %s event, %s entering %s", e.Event, eg.Name, e.Dst)
 }
@@ -120,45 +156,57 @@ func (eg *EngineGenerator) enterGenerating(e *fsm.Event) {
 	go func() {
 		//log.Printf("[EngineGenerator] start generating %s engine", eg.Name)
 		sub := e.Args[0].(Subscriptions)
-		eg.Engine = AvailableEngines[eg.Name](sub)
+		engine := AvailableEngines[eg.Name](sub)
+		eg.engineMutex.Lock()
+		eg.Engine = engine
+		eg.engineMutex.Unlock()
 		eg.FSM.Event("deploy")
 	}()
 }
 
 func (eg *EngineGenerator) enterRebuilding(e *fsm.Event) {
-	msg := e.Args[0].(*ManagementMessage)
-	switch msg.Type {
-	case AddSubscription:
-		/*
-			eg.Engine.AddSubscription(ByteSubscriptions{
-				msg.FilterString: &Info{
-					Offset:          0,
-					ReportURI: msg.ReportURI,
-				},
-			})
-		*/
-	case DeleteSubscription:
-		/*
-			eg.Engine.DeleteSubscription(ByteSubscriptions{
-				msg.FilterString: &Info{
-					Offset:          0,
-					ReportURI: msg.ReportURI,
-				},
-			})
-		*/
-	}
-	eg.FSM.Event("deploy")
+	go func() {
+		eg.updateMutex.Lock()
+		updates := eg.pendingUpdates
+		eg.pendingUpdates = nil
+		eg.updateMutex.Unlock()
+
+		// apply all the pending updates at once so that Search sees them atomically
+		eg.engineMutex.Lock()
+		for _, msg := range updates {
+			sub := Subscriptions{msg.ReportURI: []string{msg.Pattern}}
+			switch msg.Type {
+			case AddSubscription:
+				eg.Engine.AddSubscription(sub)
+			case DeleteSubscription:
+				eg.Engine.DeleteSubscription(sub)
+			}
+		}
+		eg.engineMutex.Unlock()
+		eg.FSM.Event("deploy")
+	}()
 }
 
 func (eg *EngineGenerator) enterReady(e *fsm.Event) {
-	log.Printf("[EngineGenerator] finished gererating %s engine", eg.Name)
-	eg.managementChannel <- ManagementMessage{
-		Type: OnEngineGenerated,
-		EngineGeneratorInstance: eg,
+	if e.Src == "generating" {
+		log.Printf("[EngineGenerator] finished gererating %s engine", eg.Name)
+		eg.managementChannel <- ManagementMessage{
+			Type:                    OnEngineGenerated,
+			EngineGeneratorInstance: eg,
+		}
+	} else {
+		log.Printf("[EngineGenerator] finished rebuilding %s engine", eg.Name)
+	}
+	// handle the updates queued while the engine was unavailable
+	eg.updateMutex.Lock()
+	hasUpdates := len(eg.pendingUpdates) != 0
+	eg.updateMutex.Unlock()
+	if hasUpdates {
+		go eg.FSM.Event("update")
 	}
 }
 
 func (eg *EngineGenerator) enterPending(e *fsm.Event) {
 	// Wait until the engine finishes the current execution
-	eg.FSM.Event("rebuild", e.Args[0].(*ManagementMessage))
+	go eg.FSM.Event("rebuild")
 }
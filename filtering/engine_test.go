@@ -10,9 +10,92 @@ import (
 	"encoding/gob"
 	"fmt"
 	"os"
+	"reflect"
+	"sort"
 	"testing"
+
+	"github.com/iomz/go-llrp"
+	"github.com/iomz/gosstrak/scheme"
 )
 
+func TestEngine_sharedPattern(t *testing.T) {
+	company := "urn:epc:pat:sgtin-96:3.12345678"
+	uriA, uriB, uriC := "http://localhost:8888/a", "http://localhost:8888/b", "http://localhost:8888/c"
+	search := func(engine Engine, re llrp.ReadEvent) []string {
+		_, got, _ := engine.Search(re)
+		sort.Strings(got)
+		return got
+	}
+	for name, constructor := range AvailableEngines {
+		// init with two reportURIs sharing the pattern
+		engine := constructor(Subscriptions{
+			uriA: {company},
+			uriB: {company},
+			uriC: {"urn:epc:pat:sgtin-96:3.12345678.00001"},
+		})
+		if got, want := search(engine, sgtinItem1), []string{uriA, uriB, uriC}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s.Search() = %v after init, want %v", name, got, want)
+		}
+		if got, want := search(engine, sgtinItem2), []string{uriA, uriB}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s.Search() = %v after init, want %v", name, got, want)
+		}
+		engine.DeleteSubscription(Subscriptions{uriA: {company}})
+		if got, want := search(engine, sgtinItem2), []string{uriB}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s.Search() = %v after deleting %s, want %v", name, got, uriA, want)
+		}
+
+		// add the reportURIs one by one
+		engine = constructor(Subscriptions{uriC: {"urn:epc:pat:sgtin-96:3.12345678.00001"}})
+		engine.AddSubscription(Subscriptions{uriA: {company}})
+		engine.AddSubscription(Subscriptions{uriB: {company}})
+		if got, want := search(engine, sgtinItem1), []string{uriA, uriB, uriC}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s.Search() = %v after adding, want %v", name, got, want)
+		}
+		engine.DeleteSubscription(Subscriptions{uriB: {company}})
+		if got, want := search(engine, sgtinItem2), []string{uriA}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s.Search() = %v after deleting %s, want %v", name, got, uriB, want)
+		}
+		engine.DeleteSubscription(Subscriptions{uriA: {company}})
+		if got := search(engine, sgtinItem2); len(got) != 0 {
+			t.Errorf("%s.Search() = %v after deleting both, want none", name, got)
+		}
+		if got, want := search(engine, sgtinItem1), []string{uriC}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s.Search() = %v after deleting both, want %v", name, got, want)
+		}
+	}
+}
+
+func TestEngine_isoStandards(t *testing.T) {
+	// the same UII of 25S in the standards told apart only by the AFI
+	id, length, _, _, err := scheme.MakeISO17365(false, "25S", "UN", "123456789", "0THANK0YOU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := Subscriptions{
+		"http://localhost:8888/17365":  {"urn:epc:pat:iso17365:25S.UN.123456789"},
+		"http://localhost:8888/17365h": {"urn:epc:pat:iso17365h:25S.UN.123456789"},
+		"http://localhost:8888/17366":  {"urn:epc:pat:iso17366:25S.UN.123456789"},
+	}
+	tests := []struct {
+		afi  string
+		want []string
+	}{
+		{"a2", []string{"http://localhost:8888/17365"}},
+		{"a7", []string{"http://localhost:8888/17365h"}},
+		{"a5", []string{"http://localhost:8888/17366"}},
+		{"a1", nil},
+	}
+	for name, constructor := range AvailableEngines {
+		engine := constructor(sub)
+		for _, tt := range tests {
+			re := llrp.ReadEvent{PC: scheme.MakeISOPC(length, tt.afi), ID: id}
+			if _, got, _ := engine.Search(re); (len(got) != 0 || len(tt.want) != 0) && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s.Search() = %v with the AFI %s, want %v", name, got, tt.afi, tt.want)
+			}
+		}
+	}
+}
+
 func benchmarkEngineGenerationFromNSubs(nSubs int, constructor EngineConstructor, b *testing.B) {
 	var engine Engine
 	for i := 0; i < b.N; i++ {
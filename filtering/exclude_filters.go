@@ -0,0 +1,69 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package filtering
+
+import (
+	"log"
+	"strings"
+)
+
+// ExcludePrefix marks an exclude pattern in Subscriptions,
+// e.g., "!urn:epc:pat:sgtin-96:3.12345678.0012345" excludes the item reference
+// from the other patterns for the same reportURI
+const ExcludePrefix = "!"
+
+// IsExcludePattern returns true if the pattern is an exclude pattern
+func IsExcludePattern(pat string) bool {
+	return strings.HasPrefix(pat, ExcludePrefix)
+}
+
+// excludeFilters holds the exclude patterns,
+// the binary engines apply them to the reportURIs found by the include patterns
+type excludeFilters struct {
+	patternFilters
+}
+
+// newExcludeFilters returns the excludeFilters of the exclude patterns in the subscriptions
+func newExcludeFilters(sub Subscriptions) excludeFilters {
+	xf := excludeFilters{}
+	xf.add(sub)
+	return xf
+}
+
+// add adds the exclude patterns in the subscriptions
+func (xf *excludeFilters) add(sub Subscriptions) {
+	for reportURI, patterns := range sub {
+		for _, pat := range patterns {
+			if !IsExcludePattern(pat) {
+				continue
+			}
+			fss, err := makeFilterStrings(strings.TrimPrefix(pat, ExcludePrefix))
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			filters := make([]*FilterObject, len(fss))
+			for i, fs := range fss {
+				filters[i] = NewFilter(fs, 0)
+			}
+			xf.set(reportURI, pat, filters)
+		}
+	}
+}
+
+// apply returns the reportURIs without the ones excluding the id
+func (xf excludeFilters) apply(id []byte, reportURIs []string) []string {
+	if len(xf.patternFilters) == 0 {
+		return reportURIs
+	}
+	included := reportURIs[:0:0]
+	for _, reportURI := range reportURIs {
+		if !xf.match(reportURI, id) {
+			included = append(included, reportURI)
+		}
+	}
+	return included
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package filtering
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/iomz/go-llrp"
+)
+
+var (
+	// urn:epc:id:sgtin:12345678.00001.1
+	sgtinItem1 = llrp.ReadEvent{PC: []byte{48, 0}, ID: []byte{48, 112, 94, 48, 167, 0, 0, 64, 0, 0, 0, 1}}
+	// urn:epc:id:sgtin:12345678.00002.1
+	sgtinItem2 = llrp.ReadEvent{PC: []byte{48, 0}, ID: []byte{48, 112, 94, 48, 167, 0, 0, 128, 0, 0, 0, 1}}
+)
+
+func TestEngine_excludePatterns(t *testing.T) {
+	sub := Subscriptions{
+		"http://localhost:8888/company": {"urn:epc:pat:sgtin-96:3.12345678", ExcludePrefix + "urn:epc:pat:sgtin-96:3.12345678.00001"},
+		"http://localhost:8888/item-1":  {"urn:epc:pat:sgtin-96:3.12345678.00001"},
+		"http://localhost:8888/item-2":  {"urn:epc:pat:sgtin-96:3.12345678.00002", ExcludePrefix + "urn:epc:pat:sgtin-96:3.12345678.00001"},
+	}
+	tests := []struct {
+		name string
+		re   llrp.ReadEvent
+		want []string
+	}{
+		{"Item1", sgtinItem1, []string{"http://localhost:8888/item-1"}},
+		{"Item2", sgtinItem2, []string{"http://localhost:8888/company", "http://localhost:8888/item-2"}},
+	}
+	for name, constructor := range AvailableEngines {
+		engine := constructor(sub)
+		for _, tt := range tests {
+			_, got, err := engine.Search(tt.re)
+			if err != nil {
+				t.Errorf("%s.Search() error = %v", name, err)
+				continue
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s.Search() %s = %v, want %v", name, tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestEngine_AddSubscription_exclude(t *testing.T) {
+	reportURI := "http://localhost:8888/company"
+	exclude := Subscriptions{reportURI: {ExcludePrefix + "urn:epc:pat:sgtin-96:3.12345678.00001"}}
+	for name, constructor := range AvailableEngines {
+		engine := constructor(Subscriptions{reportURI: {"urn:epc:pat:sgtin-96:3.12345678"}})
+		engine.AddSubscription(exclude)
+		if _, got, _ := engine.Search(sgtinItem1); len(got) != 0 {
+			t.Errorf("%s.Search() = %v after adding the exclude pattern, want none", name, got)
+		}
+		if _, got, _ := engine.Search(sgtinItem2); !reflect.DeepEqual(got, []string{reportURI}) {
+			t.Errorf("%s.Search() = %v after adding the exclude pattern, want %v", name, got, []string{reportURI})
+		}
+		if name != "LegacyEngine" && !strings.Contains(engine.Dump(), ExcludePrefix+"urn:epc:pat:sgtin-96:3.12345678.00001") {
+			t.Errorf("%s.Dump() doesn't contain the exclude pattern:\n%s", name, engine.Dump())
+		}
+		engine.DeleteSubscription(exclude)
+		if _, got, _ := engine.Search(sgtinItem1); !reflect.DeepEqual(got, []string{reportURI}) {
+			t.Errorf("%s.Search() = %v after deleting the exclude pattern, want %v", name, got, []string{reportURI})
+		}
+	}
+}
+
+func TestEngine_MarshalBinary_exclude(t *testing.T) {
+	sub := Subscriptions{
+		"http://localhost:8888/company": {"urn:epc:pat:sgtin-96:3.12345678", ExcludePrefix + "urn:epc:pat:sgtin-96:3.12345678.00001"},
+	}
+	engines := map[string]Engine{
+		"List":         &List{},
+		"PatriciaTrie": &PatriciaTrie{},
+		"SplayTree":    &SplayTree{},
+	}
+	for name, decoded := range engines {
+		data, err := AvailableEngines[name](sub).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s.UnmarshalBinary() error = %v", name, err)
+		}
+		if _, got, _ := decoded.Search(sgtinItem1); len(got) != 0 {
+			t.Errorf("%s.Search() = %v after UnmarshalBinary, want none", name, got)
+		}
+		if _, got, _ := decoded.Search(sgtinItem2); len(got) != 1 {
+			t.Errorf("%s.Search() = %v after UnmarshalBinary, want 1 reportURI", name, got)
+		}
+	}
+}
+
+func TestValidatePattern_exclude(t *testing.T) {
+	for pat, valid := range map[string]bool{
+		"!urn:epc:pat:sgtin-96:3.12345678":  true,
+		"!urn:epc:pat:unknown:1":            false,
+		"!!urn:epc:pat:sgtin-96:3.12345678": false,
+	} {
+		if err := validatePattern(pat, nil); (err == nil) != valid {
+			t.Errorf("validatePattern(%v) error = %v, want valid %v", pat, err, valid)
+		}
+	}
+}
@@ -94,40 +94,21 @@ func (le *LegacyEngine) Search(re llrp.ReadEvent) (pureIdentity string, reportUR
 		return
 	}
 
+	id := strings.TrimPrefix(pureIdentity, "urn:epc:id:")
 	for reportURI, patterns := range le.filters {
+		included, excluded := false, false
 		for _, pattern := range patterns {
-			seq := strings.Split(pattern, ":")
-			if len(seq) != 5 {
+			if !legacyMatch(strings.TrimPrefix(pattern, ExcludePrefix), id) {
 				continue
 			}
-			patternType := seq[3]
-			pattern := seq[4]
-
-			switch patternType {
-			case "giai-96":
-				fields := strings.Split(seq[4], ".")
-				// remove filter value in tag uri to match with the received PureIdentity
-				pattern = "giai:" + strings.Join(fields[1:], ".")
-			case "grai-96":
-				fields := strings.Split(seq[4], ".")
-				// remove filter value in tag uri to match with the received PureIdentity
-				pattern = "grai:" + strings.Join(fields[1:], ".")
-			case "sgtin-96":
-				fields := strings.Split(seq[4], ".")
-				// remove filter value in tag uri to match with the received PureIdentity
-				pattern = "sgtin:" + strings.Join(fields[1:], ".")
-			case "sscc-96":
-				fields := strings.Split(seq[4], ".")
-				// remove filter value in tag uri to match with the received PureIdentity
-				pattern = "sscc:" + strings.Join(fields[1:], ".")
-			case "iso17363":
-				pattern = patternType + ":" + strings.Replace(pattern, ".", "", -1)
-			case "iso17365":
-				pattern = patternType + ":" + strings.Replace(pattern, ".", "", -1)
-			}
-			if strings.HasPrefix(strings.TrimPrefix(pureIdentity, "urn:epc:id:"), pattern) {
-				reportURIs = append(reportURIs, reportURI)
+			if IsExcludePattern(pattern) {
+				excluded = true
+				break
 			}
+			included = true
+		}
+		if included && !excluded {
+			reportURIs = append(reportURIs, reportURI)
 		}
 	}
 	if len(reportURIs) == 0 {
@@ -193,6 +174,61 @@ func NewLegacyEngine(sub Subscriptions) Engine {
 
 // Internal helper methods -----------------------------------------------------
 
+// legacyMatch returns true if the PureIdentity without urn:epc:id: matches the urn:epc:pat pattern,
+// the EPC fields are compared one by one for the wildcard and range fields
+func legacyMatch(pattern string, id string) bool {
+	seq := strings.Split(pattern, ":")
+	if len(seq) != 5 {
+		return false
+	}
+	if !strings.HasPrefix(seq[3], "iso") {
+		scheme := strings.Split(seq[3], "-")[0] + ":"
+		if !strings.HasPrefix(id, scheme) {
+			return false
+		}
+		fields := strings.Split(seq[4], ".")
+		// remove filter value in tag uri to match with the received PureIdentity
+		if scheme != "gid:" {
+			fields = fields[1:]
+		}
+		return tdt.MatchPatternFields(fields, strings.Split(strings.TrimPrefix(id, scheme), "."))
+	}
+	prefix, ok := legacyPrefix(pattern)
+	return ok && strings.HasPrefix(id, prefix)
+}
+
+// legacyPrefix converts the urn:epc:pat pattern to the prefix of the PureIdentity without urn:epc:id:
+func legacyPrefix(pattern string) (string, bool) {
+	seq := strings.Split(pattern, ":")
+	if len(seq) != 5 {
+		return "", false
+	}
+	patternType := seq[3]
+	prefix := seq[4]
+
+	switch patternType {
+	case "giai-96":
+		fields := strings.Split(seq[4], ".")
+		// remove filter value in tag uri to match with the received PureIdentity
+		prefix = "giai:" + strings.Join(fields[1:], ".")
+	case "grai-96":
+		fields := strings.Split(seq[4], ".")
+		// remove filter value in tag uri to match with the received PureIdentity
+		prefix = "grai:" + strings.Join(fields[1:], ".")
+	case "sgtin-96":
+		fields := strings.Split(seq[4], ".")
+		// remove filter value in tag uri to match with the received PureIdentity
+		prefix = "sgtin:" + strings.Join(fields[1:], ".")
+	case "sscc-96":
+		fields := strings.Split(seq[4], ".")
+		// remove filter value in tag uri to match with the received PureIdentity
+		prefix = "sscc:" + strings.Join(fields[1:], ".")
+	case "iso17363", "iso17363h", "iso17364", "iso17364h", "iso17365", "iso17365h", "iso17366", "iso17366h", "iso17367", "iso17367h":
+		prefix = patternType + ":" + prefix
+	}
+	return prefix, true
+}
+
 // check if string is in a slice
 func stringIndexInSlice(a string, list []string) int {
 	for i, b := range list {
@@ -323,10 +323,8 @@ func benchmarkFilterLegacyNTagsNSubs(nTags int, nSubs int, b *testing.B) {
 						fields := strings.Split(seq[4], ".")
 						// remove filter value in tag uri to match with the received PureIdentity
 						pattern = "sscc:" + strings.Join(fields[1:], ".")
-					case "iso17363":
-						pattern = patternType + ":" + strings.Replace(pattern, ".", "", -1)
-					case "iso17365":
-						pattern = patternType + ":" + strings.Replace(pattern, ".", "", -1)
+					case "iso17363", "iso17363h", "iso17364", "iso17364h", "iso17365", "iso17365h", "iso17366", "iso17366h", "iso17367", "iso17367h":
+						pattern = patternType + ":" + pattern
 					}
 					if strings.HasPrefix(strings.TrimPrefix(pureIdentity, "urn:epc:id:"), pattern) {
 						reportURIs = append(reportURIs, reportURI)
@@ -10,6 +10,7 @@ import (
 	"encoding/gob"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/iomz/go-llrp"
 	"github.com/iomz/gosstrak/tdt"
@@ -17,8 +18,10 @@ import (
 
 // List is a slice of pointers to ExactMatch
 type List struct {
-	filters ListFilters
-	tdtCore *tdt.Core
+	filters  ListFilters
+	tdtCore  *tdt.Core
+	excludes excludeFilters
+	masks    maskFilters
 }
 
 // ListFilters contains pointers to ExactMatch
@@ -26,35 +29,43 @@ type ListFilters []*ExactMatch
 
 // ExactMatch is a raw filter directly taken from ByteSubscriptions
 type ExactMatch struct {
-	filter    *FilterObject
-	reportURI string
+	filter     *FilterObject
+	reportURIs []string
 }
 
 // AddSubscription adds a set of subscriptions if not exists yet
 func (list *List) AddSubscription(sub Subscriptions) {
+	list.excludes.add(sub)
+	list.masks.add(sub)
 	bsub := sub.ToByteSubscriptions()
 	// store ExactMatch in sorted order from sub
 	for _, fs := range bsub.Keys() {
 		em := &ExactMatch{
-			filter:    NewFilter(fs, bsub[fs].Offset),
-			reportURI: bsub[fs].ReportURI,
+			filter:     NewFilter(fs, bsub[fs].Offset),
+			reportURIs: bsub[fs].ReportURIs,
 		}
-		if list.filters.IndexOf(em) < 0 {
-			list.filters = append(list.filters, em)
+		// the reportURIs of the same filter are merged
+		if i := list.filters.indexOfFilter(em.filter); i > -1 {
+			list.filters[i].reportURIs = mergeReportURIs(list.filters[i].reportURIs, em.reportURIs)
+			continue
 		}
+		list.filters = append(list.filters, em)
 	}
 }
 
 // DeleteSubscription deletes a set of subscriptions if already exist
 func (list *List) DeleteSubscription(sub Subscriptions) {
+	list.excludes.delete(sub)
+	list.masks.delete(sub)
 	bsub := sub.ToByteSubscriptions()
-	// store ExactMatch in sorted order from sub
 	for _, fs := range bsub.Keys() {
-		em := &ExactMatch{
-			filter:    NewFilter(fs, bsub[fs].Offset),
-			reportURI: bsub[fs].ReportURI,
+		i := list.filters.indexOfFilter(NewFilter(fs, bsub[fs].Offset))
+		if i < 0 {
+			continue
 		}
-		if i := list.filters.IndexOf(em); i > -1 {
+		// the filter is kept while any other reportURI remains
+		list.filters[i].reportURIs = removeReportURIs(list.filters[i].reportURIs, bsub[fs].ReportURIs)
+		if len(list.filters[i].reportURIs) == 0 {
 			list.filters = append(list.filters[:i], list.filters[i+1:]...)
 		}
 	}
@@ -75,8 +86,10 @@ func (lf ListFilters) IndexOf(em *ExactMatch) int {
 func (list *List) Dump() string {
 	writer := &bytes.Buffer{}
 	for _, em := range list.filters {
-		fmt.Fprintf(writer, "--%s %s\n", em.filter.ToString(), em.reportURI)
+		fmt.Fprintf(writer, "--%s %s\n", em.filter.ToString(), strings.Join(em.reportURIs, " "))
 	}
+	list.masks.dump(writer)
+	list.excludes.dump(writer)
 	return writer.String()
 }
 
@@ -92,11 +105,16 @@ func (list *List) MarshalBinary() (_ []byte, err error) {
 	enc.Encode(len(list.filters))
 	for _, em := range list.filters {
 		// Notify
-		enc.Encode(em.reportURI)
+		enc.Encode(em.reportURIs)
 		// Filter
 		err = enc.Encode(em.filter)
 	}
 
+	// Exclude and mask patterns
+	if err == nil {
+		err = encodePatternFilters(enc, list.excludes.patternFilters, list.masks.patternFilters)
+	}
+
 	return buf.Bytes(), err
 }
 
@@ -107,11 +125,14 @@ func (list *List) Name() string {
 
 // Search returns a pureIdentity of the llrp.ReadEvent if found any subscription without err
 func (list *List) Search(re llrp.ReadEvent) (pureIdentity string, reportURIs []string, err error) {
+	id := tdt.FilterID(re.PC, re.ID)
 	for _, em := range list.filters {
-		if em.filter.Match(re.ID) {
-			reportURIs = append(reportURIs, em.reportURI)
+		if em.filter.Match(id) {
+			reportURIs = append(reportURIs, em.reportURIs...)
 		}
 	}
+	reportURIs = list.masks.search(id, reportURIs)
+	reportURIs = list.excludes.apply(id, reportURIs)
 	if len(reportURIs) == 0 {
 		return pureIdentity, reportURIs, fmt.Errorf("no match found for %v", re.ID)
 	}
@@ -138,7 +159,7 @@ func (list *List) UnmarshalBinary(data []byte) (err error) {
 	for i := 0; i < listSize; i++ {
 		em := ExactMatch{}
 		// Notify
-		if err = dec.Decode(&em.reportURI); err != nil {
+		if err = dec.Decode(&em.reportURIs); err != nil {
 			return
 		}
 		// Filter
@@ -146,6 +167,14 @@ func (list *List) UnmarshalBinary(data []byte) (err error) {
 		list.filters = append(list.filters, &em)
 	}
 
+	// Exclude and mask patterns
+	if err == nil {
+		var sub Subscriptions
+		sub, err = decodePatternFilters(dec)
+		list.excludes = newExcludeFilters(sub)
+		list.masks = newMaskFilters(sub)
+	}
+
 	// tdt.Core
 	list.tdtCore = tdt.NewCore()
 
@@ -163,12 +192,29 @@ func NewList(sub Subscriptions) Engine {
 	// store ExactMatch in sorted order from sub
 	for _, fs := range bsub.Keys() {
 		list.filters = append(list.filters, &ExactMatch{
-			filter:    NewFilter(fs, 0),
-			reportURI: bsub[fs].ReportURI,
+			filter:     NewFilter(fs, 0),
+			reportURIs: bsub[fs].ReportURIs,
 		})
 	}
 
+	// the mask and exclude patterns are applied after the search
+	list.masks = newMaskFilters(sub)
+	list.excludes = newExcludeFilters(sub)
+
 	// initialize the tdt.Core
 	list.tdtCore = tdt.NewCore()
 	return list
 }
+
+// Internal helper methods -----------------------------------------------------
+
+// indexOfFilter returns the index of the ExactMatch with the filter
+// returns -1 if not exist
+func (lf ListFilters) indexOfFilter(filter *FilterObject) int {
+	for i, em := range lf {
+		if reflect.DeepEqual(em.filter, filter) {
+			return i
+		}
+	}
+	return -1
+}
@@ -17,6 +17,7 @@ const (
 	TrafficStatus
 	EngineStatus
 	SelectedEngine
+	ScopeSubscription
 )
 
 // ManagementMessage holds management action for the EngineFactory
@@ -24,6 +25,8 @@ type ManagementMessage struct {
 	Type                    ManagementMessageType
 	Pattern                 string
 	ReportURI               string
+	LogicalReaders          []string
+	OutputFormats           []string
 	EngineGeneratorInstance *EngineGenerator
 	CurrentThroughput       float64
 	EventCount              int64
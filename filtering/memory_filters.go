@@ -0,0 +1,281 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package filtering
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/iomz/gosstrak/tagmemory"
+)
+
+// IsMemoryPattern returns true if the pattern matches a field in the memory banks by its fieldname,
+// e.g., "tidBank=xE2801105", "@3.16.0=&xFF00=x1200", or a fieldname defined in a TMSpec
+func IsMemoryPattern(pat string) bool {
+	pat = strings.TrimPrefix(pat, ExcludePrefix)
+	return !strings.HasPrefix(strings.ToLower(pat), "urn:epc:pat:") && strings.Contains(pat, "=")
+}
+
+// MemoryFilterObjects returns the memory bank and the FilterObjects of the memory pattern
+// with the offsets in the bank, none of the FilterObjects matches any value
+func MemoryFilterObjects(pat string, fields *tagmemory.Registry) (int, []*FilterObject, error) {
+	mf, err := newMemoryFilter(pat, fields)
+	if err != nil {
+		return 0, nil, err
+	}
+	if mf.variable != nil {
+		return 0, nil, fmt.Errorf("%s is a variable field without the offset: %s", mf.variable.Name, pat)
+	}
+	return mf.bank, mf.filters, nil
+}
+
+// memoryFilter is a pattern for a field in a memory bank
+type memoryFilter struct {
+	bank    int
+	filters []*FilterObject // none matches any value
+	// variable is the field of an iso-15962-string matched by the value decoded from the data sets
+	variable *tagmemory.Field
+	value    string
+}
+
+// memoryFilters holds the memory patterns by reportURI and pattern,
+// the EngineFactory applies them to the reportURIs found by the engines
+type memoryFilters struct {
+	includes map[string]map[string]*memoryFilter
+	excludes map[string]map[string]*memoryFilter
+	// memoryOnly is the reportURIs without any EPC include pattern
+	memoryOnly []string
+}
+
+// newMemoryFilters returns the memoryFilters of the memory patterns in the subscriptions,
+// the fieldnames are resolved with the tagmemory.Registry
+func newMemoryFilters(sub Subscriptions, fields *tagmemory.Registry) memoryFilters {
+	mf := memoryFilters{
+		includes: map[string]map[string]*memoryFilter{},
+		excludes: map[string]map[string]*memoryFilter{},
+	}
+	for _, reportURI := range sub.Keys() {
+		hasEPCPattern := false
+		epcExcludes := []string{}
+		for _, pat := range sub[reportURI] {
+			if !IsMemoryPattern(pat) {
+				if IsExcludePattern(pat) {
+					epcExcludes = append(epcExcludes, pat)
+				} else {
+					hasEPCPattern = true
+				}
+				continue
+			}
+			mf.add(reportURI, pat, pat, fields)
+		}
+		if _, ok := mf.includes[reportURI]; ok && !hasEPCPattern {
+			mf.memoryOnly = append(mf.memoryOnly, reportURI)
+			// the engines don't apply the EPC exclude patterns to the reportURIs not found by them
+			for _, pat := range epcExcludes {
+				mf.add(reportURI, pat, ExcludePrefix+"epc="+strings.TrimPrefix(pat, ExcludePrefix), fields)
+			}
+		}
+	}
+	return mf
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// add compiles the memory pattern mpat and adds it for the reportURI by the pattern in the subscriptions
+func (mf memoryFilters) add(reportURI string, pat string, mpat string, fields *tagmemory.Registry) {
+	f, err := newMemoryFilter(mpat, fields)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	filters := mf.includes
+	if IsExcludePattern(pat) {
+		filters = mf.excludes
+	}
+	if _, ok := filters[reportURI]; !ok {
+		filters[reportURI] = map[string]*memoryFilter{}
+	}
+	filters[reportURI][pat] = f
+}
+
+// newMemoryFilter compiles the memory pattern, the value is either *, a decimal, a hex with x,
+// or &mask=value for the uint fields, an urn:epc:pat pattern for the epc fields, and the string for the variable fields
+func newMemoryFilter(pat string, fields *tagmemory.Registry) (*memoryFilter, error) {
+	fv := strings.SplitN(strings.TrimPrefix(pat, ExcludePrefix), "=", 2)
+	if len(fv) != 2 {
+		return nil, fmt.Errorf("invalid memory pattern: %s", pat)
+	}
+	field, err := fields.Field(fv[0])
+	if err != nil {
+		return nil, err
+	}
+	value := fv[1]
+	mf := &memoryFilter{bank: field.Bank}
+	if field.Datatype == tagmemory.ISO15962String {
+		mf.variable, mf.value = field, value
+		return mf, nil
+	}
+	if value == "*" {
+		return mf, nil
+	}
+	if strings.HasPrefix(strings.ToLower(value), "urn:epc:pat:") {
+		if field.Datatype != tagmemory.EPC {
+			return nil, fmt.Errorf("%s is not an epc field: %s", field.Name, pat)
+		}
+		fss, err := makeFilterStrings(value)
+		if err != nil {
+			return nil, err
+		}
+		offset := field.Offset
+		// the ISO filters start with the AFI at the end of the PC before the UII
+		if strings.HasPrefix(strings.ToLower(value), "urn:epc:pat:iso") {
+			if field.Bank != 1 || field.Offset != 32 {
+				return nil, fmt.Errorf("%s has no AFI before the UII: %s", field.Name, pat)
+			}
+			offset -= 8
+		}
+		for _, fs := range fss {
+			mf.filters = append(mf.filters, NewFilter(fs, offset))
+		}
+		return mf, nil
+	}
+	if field.Datatype != tagmemory.Uint {
+		return nil, fmt.Errorf("%s is not a uint field: %s", field.Name, pat)
+	}
+	mask := ""
+	if strings.HasPrefix(value, "&") {
+		mv := strings.SplitN(value[1:], "=", 2)
+		if len(mv) != 2 {
+			return nil, fmt.Errorf("invalid memory pattern: %s", pat)
+		}
+		mask, value = mv[0], mv[1]
+	}
+	v, bits, err := parseFieldValue(value)
+	if err != nil {
+		return nil, err
+	}
+	// the length of the whole bank fields is the bits of the value
+	length := field.Length
+	if length == 0 {
+		if bits == 0 {
+			return nil, fmt.Errorf("%s needs the value in hex: %s", field.Name, pat)
+		}
+		length = bits
+	}
+	bs, err := fieldBits(v, length)
+	if err != nil {
+		return nil, err
+	}
+	if len(mask) != 0 {
+		m, _, err := parseFieldValue(mask)
+		if err != nil {
+			return nil, err
+		}
+		ms, err := fieldBits(m, length)
+		if err != nil {
+			return nil, err
+		}
+		for i := range ms {
+			if ms[i] == '0' {
+				bs[i] = 'x'
+			}
+		}
+	}
+	mf.filters = []*FilterObject{NewFilter(string(bs), field.Offset)}
+	return mf, nil
+}
+
+// apply returns the reportURIs passing the memory patterns among the reportURIs found by the engines
+// and the reportURIs without any EPC include pattern, the banks are indexed by the bank number
+func (mf memoryFilters) apply(banks [][]byte, reportURIs []string) []string {
+	candidates := append(reportURIs[:0:0], reportURIs...)
+	for _, reportURI := range mf.memoryOnly {
+		if stringIndexInSlice(reportURI, candidates) < 0 {
+			candidates = append(candidates, reportURI)
+		}
+	}
+	passed := candidates[:0]
+	for _, reportURI := range candidates {
+		if includes, ok := mf.includes[reportURI]; ok && !matchMemory(includes, banks) {
+			continue
+		}
+		if matchMemory(mf.excludes[reportURI], banks) {
+			continue
+		}
+		passed = append(passed, reportURI)
+	}
+	return passed
+}
+
+// isEmpty returns true if there's no memory pattern
+func (mf memoryFilters) isEmpty() bool {
+	return len(mf.includes) == 0 && len(mf.excludes) == 0
+}
+
+// match returns true if the field in the banks matches the memoryFilter,
+// a bank not read or a variable field not in it doesn't match
+func (f *memoryFilter) match(banks [][]byte) bool {
+	if f.bank >= len(banks) || banks[f.bank] == nil {
+		return false
+	}
+	if f.variable != nil {
+		v, err := f.variable.Value(banks, nil)
+		return err == nil && (f.value == "*" || v == f.value)
+	}
+	data := banks[f.bank]
+	if len(f.filters) == 0 {
+		return true
+	}
+	for _, fo := range f.filters {
+		if len(data) >= fo.ByteOffset+fo.ByteSize && fo.Match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMemory returns true if any of the memoryFilters matches the banks
+func matchMemory(filters map[string]*memoryFilter, banks [][]byte) bool {
+	for _, f := range filters {
+		if f.match(banks) {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryFieldName returns the fieldname of the memory pattern
+func memoryFieldName(pat string) string {
+	return strings.SplitN(strings.TrimPrefix(pat, ExcludePrefix), "=", 2)[0]
+}
+
+// fieldBits returns the value in the bits of the length
+func fieldBits(v *big.Int, length int) ([]byte, error) {
+	s := v.Text(2)
+	if len(s) > length {
+		return nil, fmt.Errorf("%v exceeds %v bits", v, length)
+	}
+	return []byte(strings.Repeat("0", length-len(s)) + s), nil
+}
+
+// parseFieldValue parses the value in decimal or in hex with x,
+// returns the value and the bits of the hex digits
+func parseFieldValue(s string) (*big.Int, int, error) {
+	base, digits := 10, s
+	if strings.HasPrefix(s, "x") {
+		base, digits = 16, s[1:]
+	}
+	v, ok := new(big.Int).SetString(digits, base)
+	if !ok || v.Sign() < 0 || strings.HasPrefix(digits, "+") {
+		return nil, 0, fmt.Errorf("invalid value in memory pattern: %s", s)
+	}
+	if base == 16 {
+		return v, 4 * len(digits), nil
+	}
+	return v, 0, nil
+}
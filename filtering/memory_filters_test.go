@@ -0,0 +1,156 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package filtering
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/iomz/gosstrak/tagmemory"
+)
+
+func TestIsMemoryPattern(t *testing.T) {
+	tests := []struct {
+		pat  string
+		want bool
+	}{
+		{"tidBank=xE280", true},
+		{ExcludePrefix + "userBank=*", true},
+		{"@3.16.0=x1200", true},
+		{"urn:epc:pat:sgtin-96:3.12345678", false},
+		{ExcludePrefix + "urn:epc:pat:sgtin-96:3.12345678", false},
+	}
+	for _, tt := range tests {
+		if got := IsMemoryPattern(tt.pat); got != tt.want {
+			t.Errorf("IsMemoryPattern(%v) = %v, want %v", tt.pat, got, tt.want)
+		}
+	}
+}
+
+func Test_validatePattern_memory(t *testing.T) {
+	tests := []struct {
+		pat     string
+		wantErr bool
+	}{
+		{"tidBank=xE2801105", false},
+		{"userBank=*", false},
+		{"@2.12.20=x105", false},
+		{"@3.16.0=&xFF00=x1200", false},
+		{"@1.8.32=48", false},
+		{"@3.urn:oid:1.0.15961.10.2=ABC", false},
+		{"tidBank=123", true},   // the whole bank needs the hex digits
+		{"@4.16.0=x1200", true}, // no such bank
+		{"@3.16=x1200", true},
+		{"@3.8.0=x1200", true}, // exceeds the length
+		{"@3.16.0=&xFF00", true},
+		{"@3.16.0=xZZ", true},
+		{"tidBank", true},
+	}
+	for _, tt := range tests {
+		if err := validatePattern(tt.pat, nil); (err != nil) != tt.wantErr {
+			t.Errorf("validatePattern(%v) error = %v, wantErr %v", tt.pat, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMemoryFilters_apply(t *testing.T) {
+	sub := Subscriptions{
+		"http://localhost:8888/impinj":     {"tidBank=xE2801105"},
+		"http://localhost:8888/not-impinj": {"tidBank=*", ExcludePrefix + "@2.12.8=x801"},
+		"http://localhost:8888/company":    {"urn:epc:pat:sgtin-96:3.12345678", ExcludePrefix + "@3.16.0=&xFF00=x1200"},
+		"http://localhost:8888/user":       {"userBank=*"},
+		"http://localhost:8888/epc":        {"urn:epc:pat:sgtin-96:3.12345678"},
+		"http://localhost:8888/tid-not-1":  {"tidBank=*", ExcludePrefix + "urn:epc:pat:sgtin-96:3.12345678.00001"},
+		"http://localhost:8888/tid-not-2":  {"tidBank=*", ExcludePrefix + "urn:epc:pat:sgtin-96:3.12345678.00002"},
+	}
+	epcBank := append([]byte{0, 0, 48, 0}, sgtinItem1.ID...)
+	impinj := []byte{0xe2, 0x80, 0x11, 0x05, 0x20, 0x00}
+	alien := []byte{0xe2, 0x00, 0x34, 0x12}
+	tests := []struct {
+		name       string
+		tid        []byte
+		user       []byte
+		reportURIs []string
+		want       []string
+	}{
+		{"NoMemory", nil, nil, []string{"http://localhost:8888/company", "http://localhost:8888/epc"},
+			[]string{"http://localhost:8888/company", "http://localhost:8888/epc"}},
+		{"Impinj", impinj, nil, nil, []string{"http://localhost:8888/impinj", "http://localhost:8888/tid-not-2"}},
+		{"Alien", alien, nil, nil, []string{"http://localhost:8888/not-impinj", "http://localhost:8888/tid-not-2"}},
+		{"UserExcluded", nil, []byte{0x12, 0x34}, []string{"http://localhost:8888/company", "http://localhost:8888/epc"},
+			[]string{"http://localhost:8888/epc", "http://localhost:8888/user"}},
+		{"UserIncluded", nil, []byte{0x13, 0x34}, []string{"http://localhost:8888/company"},
+			[]string{"http://localhost:8888/company", "http://localhost:8888/user"}},
+	}
+	mf := newMemoryFilters(sub, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mf.apply([][]byte{nil, epcBank, tt.tid, tt.user}, tt.reportURIs)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) && !(len(got) == 0 && len(tt.want) == 0) {
+				t.Errorf("memoryFilters.apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got, want := sub.withoutMemoryPatterns(), (Subscriptions{
+		"http://localhost:8888/company":   {"urn:epc:pat:sgtin-96:3.12345678"},
+		"http://localhost:8888/epc":       {"urn:epc:pat:sgtin-96:3.12345678"},
+		"http://localhost:8888/tid-not-1": {ExcludePrefix + "urn:epc:pat:sgtin-96:3.12345678.00001"},
+		"http://localhost:8888/tid-not-2": {ExcludePrefix + "urn:epc:pat:sgtin-96:3.12345678.00002"},
+	}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Subscriptions.withoutMemoryPatterns() = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryFilters_apply_tagMemory(t *testing.T) {
+	fields := tagmemory.NewRegistry()
+	if err := fields.Define("fields", &tagmemory.TMFixedFieldListSpec{
+		FixedFields: []tagmemory.TMFixedFieldSpec{
+			{FieldName: "mdid", Bank: 2, Length: 12, Offset: 8},
+			{FieldName: "itemEPC", Bank: 3, Length: 96, Offset: 16, DefaultDatatype: tagmemory.EPC},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validatePattern("mdid=x801", nil); err == nil {
+		t.Error("validatePattern() accepted an undefined fieldname")
+	}
+	if err := validatePattern("mdid=urn:epc:pat:sgtin-96:3.12345678", fields); err == nil {
+		t.Error("validatePattern() accepted an EPC pattern for a uint field")
+	}
+	sub := Subscriptions{
+		"http://localhost:8888/impinj": {"mdid=x801"},
+		"http://localhost:8888/item":   {"itemEPC=urn:epc:pat:sgtin-96:3.12345678"},
+		"http://localhost:8888/epc":    {"epc=urn:epc:pat:sgtin-96:3.12345678.00002"},
+	}
+	user := append([]byte{0xff, 0xff}, sgtinItem1.ID...)
+	got := newMemoryFilters(sub, fields).apply(tagmemory.Banks([]byte{48, 0}, sgtinItem2.ID, []byte{0xe2, 0x80, 0x11, 0x05}, user), nil)
+	sort.Strings(got)
+	if want := []string{"http://localhost:8888/epc", "http://localhost:8888/impinj", "http://localhost:8888/item"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("memoryFilters.apply() = %v, want %v", got, want)
+	}
+	got = newMemoryFilters(sub, fields).apply(tagmemory.Banks([]byte{48, 0}, sgtinItem1.ID, nil, nil), nil)
+	if len(got) != 0 {
+		t.Errorf("memoryFilters.apply() = %v, want none", got)
+	}
+	// 6-bit ABC of urn:oid:1.0.15961.10.2
+	dataSets := []byte{0x0a, 0x42, 0x03, 0x04, 0x20, 0xe0, 0x00}
+	sub = Subscriptions{
+		"http://localhost:8888/abc": {"@3.urn:oid:1.0.15961.10.2=ABC"},
+		"http://localhost:8888/any": {"@3.urn:oid:1.0.15961.10.2=*"},
+		"http://localhost:8888/xyz": {"@3.urn:oid:1.0.15961.10.2=XYZ"},
+		"http://localhost:8888/lot": {"@3.urn:oid:1.0.15961.10.3=*"},
+	}
+	got = newMemoryFilters(sub, fields).apply(tagmemory.Banks([]byte{48, 0}, sgtinItem1.ID, nil, dataSets), nil)
+	sort.Strings(got)
+	if want := []string{"http://localhost:8888/abc", "http://localhost:8888/any"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("memoryFilters.apply() = %v, want %v", got, want)
+	}
+	if _, _, err := MemoryFilterObjects("@3.urn:oid:1.0.15961.10.2=ABC", fields); err == nil {
+		t.Error("MemoryFilterObjects() accepted a variable field")
+	}
+}
@@ -20,13 +20,15 @@ import (
 
 // PatriciaTrie struct
 type PatriciaTrie struct {
-	root    *PatriciaTrieNode
-	tdtCore *tdt.Core
+	root     *PatriciaTrieNode
+	tdtCore  *tdt.Core
+	excludes excludeFilters
+	masks    maskFilters
 }
 
 // PatriciaTrieNode is a node for PatriciaTrie
 type PatriciaTrieNode struct {
-	reportURI    string
+	reportURIs   []string
 	filterObject *FilterObject
 	one          *PatriciaTrieNode
 	zero         *PatriciaTrieNode
@@ -34,17 +36,21 @@ type PatriciaTrieNode struct {
 
 // AddSubscription adds a set of subscriptions if not exists yet
 func (pt *PatriciaTrie) AddSubscription(sub Subscriptions) {
+	pt.excludes.add(sub)
+	pt.masks.add(sub)
 	bsub := sub.ToByteSubscriptions()
 	for _, fs := range bsub.Keys() {
-		pt.root.add(fs, bsub[fs].ReportURI)
+		pt.root.add(fs, bsub[fs].ReportURIs)
 	}
 }
 
 // DeleteSubscription deletes a set of subscriptions if already exist
 func (pt *PatriciaTrie) DeleteSubscription(sub Subscriptions) {
+	pt.excludes.delete(sub)
+	pt.masks.delete(sub)
 	bsub := sub.ToByteSubscriptions()
 	for _, fs := range bsub.Keys() {
-		pt.root.delete(fs, bsub[fs].ReportURI)
+		pt.root.delete(fs, bsub[fs].ReportURIs)
 	}
 }
 
@@ -52,6 +58,8 @@ func (pt *PatriciaTrie) DeleteSubscription(sub Subscriptions) {
 func (pt *PatriciaTrie) Dump() string {
 	writer := &bytes.Buffer{}
 	pt.root.print(writer, 0)
+	pt.masks.dump(writer)
+	pt.excludes.dump(writer)
 	return writer.String()
 }
 
@@ -66,6 +74,9 @@ func (pt *PatriciaTrie) MarshalBinary() (_ []byte, err error) {
 	// Encode PatriciaTrieNode
 	enc.Encode(pt.root)
 
+	// Exclude and mask patterns
+	err = encodePatternFilters(enc, pt.excludes.patternFilters, pt.masks.patternFilters)
+
 	return buf.Bytes(), err
 }
 
@@ -76,7 +87,10 @@ func (pt *PatriciaTrie) Name() string {
 
 // Search returns a pureIdentity of the llrp.ReadEvent if found any subscription without err
 func (pt *PatriciaTrie) Search(re llrp.ReadEvent) (pureIdentity string, reportURIs []string, err error) {
-	reportURIs = pt.root.search(re.ID)
+	id := tdt.FilterID(re.PC, re.ID)
+	reportURIs = pt.root.search(id)
+	reportURIs = pt.masks.search(id, reportURIs)
+	reportURIs = pt.excludes.apply(id, reportURIs)
 	if len(reportURIs) == 0 {
 		return pureIdentity, reportURIs, fmt.Errorf("no match found for %v", re.ID)
 	}
@@ -95,7 +109,14 @@ func (pt *PatriciaTrie) UnmarshalBinary(data []byte) (err error) {
 	}
 
 	// Decode PatriciaTrieNode
-	err = dec.Decode(&pt.root)
+	if err = dec.Decode(&pt.root); err != nil {
+		return
+	}
+
+	// Exclude and mask patterns
+	sub, err := decodePatternFilters(dec)
+	pt.excludes = newExcludeFilters(sub)
+	pt.masks = newMaskFilters(sub)
 
 	// tdt.Core
 	pt.tdtCore = tdt.NewCore()
@@ -108,8 +129,8 @@ func (ptn *PatriciaTrieNode) MarshalBinary() (_ []byte, err error) {
 	var buf bytes.Buffer
 	enc := gob.NewEncoder(&buf)
 
-	// reportURI
-	enc.Encode(ptn.reportURI)
+	// reportURIs
+	enc.Encode(ptn.reportURIs)
 
 	// Filter
 	hasFilter := ptn.filterObject != nil
@@ -140,7 +161,7 @@ func (ptn *PatriciaTrieNode) UnmarshalBinary(data []byte) (err error) {
 	dec := gob.NewDecoder(bytes.NewReader(data))
 
 	// reportURIs
-	if err = dec.Decode(&ptn.reportURI); err != nil {
+	if err = dec.Decode(&ptn.reportURIs); err != nil {
 		return
 	}
 
@@ -183,13 +204,11 @@ func (ptn *PatriciaTrieNode) UnmarshalBinary(data []byte) (err error) {
 // Internal helper methods -----------------------------------------------------
 
 // add a subscription if not exist yet
-func (ptn *PatriciaTrieNode) add(fs string, reportURI string) {
+func (ptn *PatriciaTrieNode) add(fs string, reportURIs []string) {
 	if strings.HasPrefix(fs, ptn.filterObject.String) { // fs \in pt.FilterObject.String
 		if fs == ptn.filterObject.String { // the identical filter
-			// if the reportURI is different, update it
-			if ptn.reportURI != reportURI {
-				ptn.reportURI = reportURI
-			}
+			// merge the reportURIs sharing the filter
+			ptn.reportURIs = mergeReportURIs(ptn.reportURIs, reportURIs)
 			return //end
 		}
 		//} else if len(fs) < pt.filterObject.Size { // Needs a reconstruction
@@ -200,24 +219,29 @@ func (ptn *PatriciaTrieNode) add(fs string, reportURI string) {
 		newNode.filterObject = NewFilter(ptn.filterObject.String[ncpLength:], ptn.filterObject.Offset+ncpLength)
 		newNode.one = ptn.one
 		newNode.zero = ptn.zero
-		newNode.reportURI = ptn.reportURI
-		ptn.reportURI = ""
+		newNode.reportURIs = ptn.reportURIs
+		ptn.reportURIs = nil
 		currentOffset := ptn.filterObject.Offset
 		ptn.filterObject = NewFilter(newCommonPrefix, currentOffset)
-		if ncpLength >= len(fs) {
+		// the current node continues in the branch of its next bit
+		ptn.one, ptn.zero = nil, nil
+		if newNode.filterObject.String[0] == '1' {
+			ptn.one = newNode
+		} else {
+			ptn.zero = newNode
+		}
+		if ncpLength >= len(fs) { // fs is the common prefix itself
+			ptn.reportURIs = mergeReportURIs(nil, reportURIs)
 			return
 		}
+		leaf := &PatriciaTrieNode{}
+		leaf.filterObject = NewFilter(fs[ncpLength:], currentOffset+ncpLength)
+		leaf.reportURIs = mergeReportURIs(nil, reportURIs)
 		switch fs[ncpLength] {
 		case '1':
-			ptn.zero = newNode
-			ptn.one = &PatriciaTrieNode{}
-			ptn.one.filterObject = NewFilter(fs[ncpLength:], currentOffset+ncpLength)
-			ptn.one.reportURI = reportURI
+			ptn.one = leaf
 		case '0':
-			ptn.one = newNode
-			ptn.zero = &PatriciaTrieNode{}
-			ptn.zero.filterObject = NewFilter(fs[ncpLength:], currentOffset+ncpLength)
-			ptn.zero.reportURI = reportURI
+			ptn.zero = leaf
 		}
 		return //end
 	}
@@ -229,18 +253,18 @@ func (ptn *PatriciaTrieNode) add(fs string, reportURI string) {
 			if ptn.one == nil {
 				ptn.one = &PatriciaTrieNode{}
 				ptn.one.filterObject = NewFilter(fs[ptn.filterObject.Size:], ptn.filterObject.Offset+ptn.filterObject.Size)
-				ptn.one.reportURI = reportURI
+				ptn.one.reportURIs = mergeReportURIs(nil, reportURIs)
 				return //end
 			}
-			ptn.one.add(fs[ptn.filterObject.Size:], reportURI)
+			ptn.one.add(fs[ptn.filterObject.Size:], reportURIs)
 		case '0':
 			if ptn.zero == nil {
 				ptn.zero = &PatriciaTrieNode{}
 				ptn.zero.filterObject = NewFilter(fs[ptn.filterObject.Size:], ptn.filterObject.Offset+ptn.filterObject.Size)
-				ptn.zero.reportURI = reportURI
+				ptn.zero.reportURIs = mergeReportURIs(nil, reportURIs)
 				return //end
 			}
-			ptn.zero.add(fs[ptn.filterObject.Size:], reportURI)
+			ptn.zero.add(fs[ptn.filterObject.Size:], reportURIs)
 		}
 	}
 }
@@ -288,7 +312,7 @@ func (ptn *PatriciaTrieNode) build(prefix string, bsub ByteSubscriptions) {
 		cumulativePrefix = prefix + onePrefixBranch
 		// check if the prefix matches whole filter
 		if _, ok := bsub[cumulativePrefix]; ok {
-			ptn.one.reportURI = bsub[cumulativePrefix].ReportURI
+			ptn.one.reportURIs = bsub[cumulativePrefix].ReportURIs
 		}
 		ptn.one.build(cumulativePrefix, bsub)
 	}
@@ -299,14 +323,14 @@ func (ptn *PatriciaTrieNode) build(prefix string, bsub ByteSubscriptions) {
 		cumulativePrefix = prefix + zeroPrefixBranch
 		// check if the prefix matches whole filter
 		if _, ok := bsub[cumulativePrefix]; ok {
-			ptn.zero.reportURI = bsub[cumulativePrefix].ReportURI
+			ptn.zero.reportURIs = bsub[cumulativePrefix].ReportURIs
 		}
 		ptn.zero.build(cumulativePrefix, bsub)
 	}
 }
 
 // delete a subscription if already exists
-func (ptn *PatriciaTrieNode) delete(fs string, reportURI string) {
+func (ptn *PatriciaTrieNode) delete(fs string, reportURIs []string) {
 	// No such filter exist in the trie
 	if !strings.HasPrefix(fs, ptn.filterObject.String) {
 		return
@@ -314,43 +338,46 @@ func (ptn *PatriciaTrieNode) delete(fs string, reportURI string) {
 
 	// This is the filter to delete
 	if fs == ptn.filterObject.String {
+		// the node is kept while any other reportURI remains
+		ptn.reportURIs = removeReportURIs(ptn.reportURIs, reportURIs)
+		if len(ptn.reportURIs) != 0 {
+			return //end
+		}
 		if ptn.one != nil && ptn.zero != nil { // node in the middle
-			ptn.reportURI = ""
+			ptn.reportURIs = nil
 		} else if ptn.one != nil { // has only one node
 			newFilter := NewFilter(ptn.filterObject.String+ptn.one.filterObject.String, ptn.filterObject.Offset)
 			ptn.filterObject = newFilter
-			ptn.reportURI = ptn.one.reportURI
+			ptn.reportURIs = ptn.one.reportURIs
 			ptn.zero = ptn.one.zero
 			ptn.one = ptn.one.one
 		} else if ptn.zero != nil { // has only zero node
 			newFilter := NewFilter(ptn.filterObject.String+ptn.zero.filterObject.String, ptn.filterObject.Offset)
 			ptn.filterObject = newFilter
-			ptn.reportURI = ptn.zero.reportURI
+			ptn.reportURIs = ptn.zero.reportURIs
 			ptn.one = ptn.zero.one
 			ptn.zero = ptn.zero.zero
+		} else { // a leaf without parent
+			ptn.reportURIs = nil
 		}
 		return //end
 	}
 
-	// If there's remainder
+	// If there's remainder, prune the child left without any reportURI
 	if len(fs) > ptn.filterObject.Size {
 		switch fs[ptn.filterObject.Size] {
 		case '1':
 			if ptn.one != nil {
-				if fs[ptn.filterObject.Size:] == ptn.one.filterObject.String &&
-					ptn.one.one == nil && ptn.one.zero == nil {
+				ptn.one.delete(fs[ptn.filterObject.Size:], reportURIs)
+				if ptn.one.isEmpty() {
 					ptn.one = nil
-				} else {
-					ptn.one.delete(fs[ptn.filterObject.Size:], reportURI)
 				}
 			}
 		case '0':
 			if ptn.zero != nil {
-				if fs[ptn.filterObject.Size:] == ptn.zero.filterObject.String &&
-					ptn.zero.one == nil && ptn.zero.zero == nil {
+				ptn.zero.delete(fs[ptn.filterObject.Size:], reportURIs)
+				if ptn.zero.isEmpty() {
 					ptn.zero = nil
-				} else {
-					ptn.zero.delete(fs[ptn.filterObject.Size:], reportURI)
 				}
 			}
 		}
@@ -359,7 +386,7 @@ func (ptn *PatriciaTrieNode) delete(fs string, reportURI string) {
 }
 
 func (ptn *PatriciaTrieNode) equal(want *PatriciaTrieNode) (ok bool, got *PatriciaTrieNode, wanted *PatriciaTrieNode) {
-	if ptn.reportURI != want.reportURI ||
+	if !reflect.DeepEqual(ptn.reportURIs, want.reportURIs) ||
 		!reflect.DeepEqual(ptn.filterObject, want.filterObject) {
 		return false, ptn, want
 	}
@@ -384,10 +411,15 @@ func (ptn *PatriciaTrieNode) equal(want *PatriciaTrieNode) (ok bool, got *Patric
 	return true, nil, nil
 }
 
+// isEmpty returns true if the node has neither reportURI nor child
+func (ptn *PatriciaTrieNode) isEmpty() bool {
+	return len(ptn.reportURIs) == 0 && ptn.one == nil && ptn.zero == nil
+}
+
 func (ptn *PatriciaTrieNode) print(writer io.Writer, indent int) {
 	var n string
-	if len(ptn.reportURI) != 0 {
-		n = "-> " + ptn.reportURI
+	if len(ptn.reportURIs) != 0 {
+		n = "-> " + strings.Join(ptn.reportURIs, " ")
 	}
 	fmt.Fprintf(writer, "%s--%s %s\n", strings.Repeat(" ", indent), ptn.filterObject.ToString(), n)
 	if ptn.one != nil {
@@ -404,10 +436,8 @@ func (ptn *PatriciaTrieNode) search(id []byte) (reportURIs []string) {
 		return
 	}
 
-	// if the id matched with this node, return reportURI
-	if len(ptn.reportURI) != 0 {
-		reportURIs = append(reportURIs, ptn.reportURI)
-	}
+	// if the id matched with this node, return the reportURIs
+	reportURIs = append(reportURIs, ptn.reportURIs...)
 
 	// Determine next filter
 	nextBitOffset := ptn.filterObject.Offset + ptn.filterObject.Size
@@ -438,8 +468,16 @@ func NewPatriciaTrie(sub Subscriptions) Engine {
 	}
 	pt.root = &PatriciaTrieNode{}
 	pt.root.filterObject = NewFilter(p1, 0)
+	if psub, ok := bsub[p1]; ok {
+		// the common prefix itself is a subscription
+		pt.root.reportURIs = psub.ReportURIs
+	}
 	pt.root.build(p1, bsub)
 
+	// the mask and exclude patterns are applied after the search
+	pt.masks = newMaskFilters(sub)
+	pt.excludes = newExcludeFilters(sub)
+
 	// initialize the tdt.Core
 	pt.tdtCore = tdt.NewCore()
 
@@ -0,0 +1,164 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package filtering
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+)
+
+// patternFilters holds the FilterObjects compiled from the patterns by reportURI and pattern,
+// the binary engines match them one by one besides their own structures
+type patternFilters map[string]map[string][]*FilterObject
+
+// maskFilters holds the include patterns with the wildcard bits in the middle,
+// which can't be a node in the prefix-based structures
+type maskFilters struct {
+	patternFilters
+}
+
+// newMaskFilters returns the maskFilters of the include patterns in the subscriptions
+func newMaskFilters(sub Subscriptions) maskFilters {
+	mf := maskFilters{}
+	mf.add(sub)
+	return mf
+}
+
+// add adds the include patterns in the subscriptions if they have any mask filter
+func (mf *maskFilters) add(sub Subscriptions) {
+	for reportURI, patterns := range sub {
+		for _, pat := range patterns {
+			if IsExcludePattern(pat) {
+				continue
+			}
+			fss, err := makeFilterStrings(pat)
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			filters := []*FilterObject{}
+			for _, fs := range fss {
+				if !isPrefixFilter(fs) {
+					filters = append(filters, NewFilter(fs, 0))
+				}
+			}
+			if len(filters) != 0 {
+				mf.set(reportURI, pat, filters)
+			}
+		}
+	}
+}
+
+// search appends the reportURIs matching the id to the reportURIs found by the prefix filters
+func (mf maskFilters) search(id []byte, reportURIs []string) []string {
+	for _, reportURI := range mf.reportURIs() {
+		if stringIndexInSlice(reportURI, reportURIs) < 0 && mf.match(reportURI, id) {
+			reportURIs = append(reportURIs, reportURI)
+		}
+	}
+	return reportURIs
+}
+
+// decodePatternFilters reads the patterns written by encodePatternFilters if any
+func decodePatternFilters(dec *gob.Decoder) (Subscriptions, error) {
+	sub := Subscriptions{}
+	if err := dec.Decode(&sub); err != nil && err != io.EOF {
+		return sub, err
+	}
+	return sub, nil
+}
+
+// encodePatternFilters writes the patterns of the filters in a Subscriptions if any
+func encodePatternFilters(enc *gob.Encoder, filters ...patternFilters) error {
+	sub := Subscriptions{}
+	for _, pf := range filters {
+		for reportURI, patterns := range pf.subscriptions() {
+			sub[reportURI] = append(sub[reportURI], patterns...)
+		}
+	}
+	if len(sub) == 0 {
+		return nil
+	}
+	return enc.Encode(sub)
+}
+
+// isPrefixFilter returns true if the filter string has no wildcard bits
+func isPrefixFilter(fs string) bool {
+	return !strings.Contains(fs, "x")
+}
+
+// delete deletes the patterns in the subscriptions
+func (pf patternFilters) delete(sub Subscriptions) {
+	for reportURI, patterns := range sub {
+		for _, pat := range patterns {
+			delete(pf[reportURI], pat)
+		}
+		if len(pf[reportURI]) == 0 {
+			delete(pf, reportURI)
+		}
+	}
+}
+
+// dump writes a string representation of the patternFilters
+func (pf patternFilters) dump(writer io.Writer) {
+	sub := pf.subscriptions()
+	for _, reportURI := range sub.Keys() {
+		for _, pat := range sub[reportURI] {
+			for _, f := range pf[reportURI][pat] {
+				fmt.Fprintf(writer, "--%s %s %s\n", pat, f.ToString(), reportURI)
+			}
+		}
+	}
+}
+
+// match returns true if any filter of the reportURI matches the id
+func (pf patternFilters) match(reportURI string, id []byte) bool {
+	for _, filters := range pf[reportURI] {
+		for _, f := range filters {
+			if len(id) >= f.ByteOffset+f.ByteSize && f.Match(id) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reportURIs returns the reportURIs in the patternFilters
+func (pf patternFilters) reportURIs() []string {
+	reportURIs := make([]string, 0, len(pf))
+	for reportURI := range pf {
+		reportURIs = append(reportURIs, reportURI)
+	}
+	sort.Strings(reportURIs)
+	return reportURIs
+}
+
+// set sets the filters for the pattern
+func (pf *patternFilters) set(reportURI string, pat string, filters []*FilterObject) {
+	if *pf == nil {
+		*pf = patternFilters{}
+	}
+	if _, ok := (*pf)[reportURI]; !ok {
+		(*pf)[reportURI] = map[string][]*FilterObject{}
+	}
+	(*pf)[reportURI][pat] = filters
+}
+
+// subscriptions returns the patterns in Subscriptions
+func (pf patternFilters) subscriptions() Subscriptions {
+	sub := Subscriptions{}
+	for reportURI, filters := range pf {
+		for pat := range filters {
+			sub[reportURI] = append(sub[reportURI], pat)
+		}
+		sort.Strings(sub[reportURI])
+	}
+	return sub
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package filtering
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/iomz/go-llrp"
+	"github.com/iomz/gosstrak/scheme"
+)
+
+func TestEngine_wildcardPatterns(t *testing.T) {
+	sub := Subscriptions{
+		"http://localhost:8888/any-company": {"urn:epc:pat:sgtin-96:3.*.00002.*"},
+		"http://localhost:8888/serial":      {"urn:epc:pat:sgtin-96:3.12345678.00001.[0-9]"},
+		"http://localhost:8888/exclude":     {"urn:epc:pat:sgtin-96:3.12345678", ExcludePrefix + "urn:epc:pat:sgtin-96:3.12345678.[1-1].*"},
+		"http://localhost:8888/none":        {"urn:epc:pat:sgtin-96:3.12345678.0000X.[2-100]"},
+	}
+	tests := []struct {
+		name string
+		re   llrp.ReadEvent
+		want []string
+	}{
+		{"Item1", sgtinItem1, []string{"http://localhost:8888/serial"}},
+		{"Item2", sgtinItem2, []string{"http://localhost:8888/any-company", "http://localhost:8888/exclude"}},
+	}
+	for name, constructor := range AvailableEngines {
+		engine := constructor(sub)
+		for _, tt := range tests {
+			_, got, err := engine.Search(tt.re)
+			if err != nil {
+				t.Errorf("%s.Search() error = %v", name, err)
+				continue
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s.Search() %s = %v, want %v", name, tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestEngine_AddSubscription_wildcard(t *testing.T) {
+	reportURI := "http://localhost:8888/any-company"
+	wildcard := Subscriptions{reportURI: {"urn:epc:pat:sgtin-96:3.*.00002.*"}}
+	for name, constructor := range AvailableEngines {
+		engine := constructor(Subscriptions{"http://localhost:8888/item-1": {"urn:epc:pat:sgtin-96:3.12345678.00001"}})
+		engine.AddSubscription(wildcard)
+		if _, got, _ := engine.Search(sgtinItem2); !reflect.DeepEqual(got, []string{reportURI}) {
+			t.Errorf("%s.Search() = %v after adding the wildcard pattern, want %v", name, got, []string{reportURI})
+		}
+		if name != "LegacyEngine" && !strings.Contains(engine.Dump(), "urn:epc:pat:sgtin-96:3.*.00002.*") {
+			t.Errorf("%s.Dump() doesn't contain the wildcard pattern:\n%s", name, engine.Dump())
+		}
+		engine.DeleteSubscription(wildcard)
+		if _, got, _ := engine.Search(sgtinItem2); len(got) != 0 {
+			t.Errorf("%s.Search() = %v after deleting the wildcard pattern, want none", name, got)
+		}
+	}
+}
+
+func TestEngine_MarshalBinary_wildcard(t *testing.T) {
+	sub := Subscriptions{
+		"http://localhost:8888/any-company": {"urn:epc:pat:sgtin-96:3.*.00002.*"},
+		"http://localhost:8888/company":     {"urn:epc:pat:sgtin-96:3.12345678", ExcludePrefix + "urn:epc:pat:sgtin-96:3.12345678.00001"},
+	}
+	engines := map[string]Engine{
+		"List":         &List{},
+		"PatriciaTrie": &PatriciaTrie{},
+		"SplayTree":    &SplayTree{},
+	}
+	for name, decoded := range engines {
+		data, err := AvailableEngines[name](sub).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s.UnmarshalBinary() error = %v", name, err)
+		}
+		if _, got, _ := decoded.Search(sgtinItem1); len(got) != 0 {
+			t.Errorf("%s.Search() = %v after UnmarshalBinary, want none", name, got)
+		}
+		want := []string{"http://localhost:8888/any-company", "http://localhost:8888/company"}
+		_, got, _ := decoded.Search(sgtinItem2)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s.Search() = %v after UnmarshalBinary, want %v", name, got, want)
+		}
+	}
+}
+
+func TestEngine_otherSchemes(t *testing.T) {
+	sgln, _, _, _ := scheme.MakeSGLN96(false, "3", "0614141", "12345", "5678")
+	gid, _, _, _ := scheme.MakeGID96(false, "95100000", "12345", "400")
+	sgtin, _, _, _ := scheme.MakeSGTIN198(false, "3", "0614141", "812345", "abc/XYZ")
+	sub := Subscriptions{
+		"http://localhost:8888/sgln":  {"urn:epc:pat:sgln-96:3.0614141.12345"},
+		"http://localhost:8888/gid":   {"urn:epc:pat:gid-96:95100000.12345"},
+		"http://localhost:8888/sgtin": {"urn:epc:pat:sgtin-198:3.0614141.812345.abc%2FXYZ"},
+		"http://localhost:8888/upper": {"urn:epc:pat:sgtin-198:3.0614141.812345.ABC%2FXYZ"},
+	}
+	tests := []struct {
+		name string
+		re   llrp.ReadEvent
+		want []string
+	}{
+		{"SGLN-96", llrp.ReadEvent{PC: []byte{48, 0}, ID: sgln}, []string{"http://localhost:8888/sgln"}},
+		{"GID-96", llrp.ReadEvent{PC: []byte{48, 0}, ID: gid}, []string{"http://localhost:8888/gid"}},
+		{"SGTIN-198", llrp.ReadEvent{PC: []byte{104, 0}, ID: sgtin}, []string{"http://localhost:8888/sgtin"}},
+	}
+	for name, constructor := range AvailableEngines {
+		engine := constructor(sub)
+		for _, tt := range tests {
+			_, got, err := engine.Search(tt.re)
+			if err != nil {
+				t.Errorf("%s.Search() error = %v", name, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s.Search() %s = %v, want %v", name, tt.name, got, tt.want)
+			}
+		}
+	}
+}
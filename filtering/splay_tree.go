@@ -13,6 +13,7 @@ import (
 	"io"
 	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/iomz/go-llrp"
 	"github.com/iomz/gosstrak/tdt"
@@ -20,13 +21,17 @@ import (
 
 // SplayTree struct
 type SplayTree struct {
-	root    *SplayTreeNode
-	tdtCore *tdt.Core
+	root     *SplayTreeNode
+	tdtCore  *tdt.Core
+	excludes excludeFilters
+	masks    maskFilters
+	// mutex serializes the access to the tree since the search splays the nodes
+	mutex sync.Mutex
 }
 
 // SplayTreeNode is a node for SplayTree
 type SplayTreeNode struct {
-	reportURI    string
+	reportURIs   []string
 	filterObject *FilterObject
 	matchNext    *SplayTreeNode
 	mismatchNext *SplayTreeNode
@@ -34,29 +39,56 @@ type SplayTreeNode struct {
 
 // AddSubscription adds a set of subscriptions if not exists yet
 func (st *SplayTree) AddSubscription(sub Subscriptions) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.excludes.add(sub)
+	st.masks.add(sub)
 	bsub := sub.ToByteSubscriptions()
 	for _, fs := range bsub.Keys() {
-		st.root.add(fs, bsub[fs].ReportURI)
+		// the first subscription in an empty tree becomes the root
+		if st.root.filterObject == nil {
+			st.root.filterObject = NewFilter(fs, 0)
+			st.root.reportURIs = bsub[fs].ReportURIs
+			continue
+		}
+		st.root.add(fs, bsub[fs].ReportURIs)
 	}
 }
 
 // DeleteSubscription deletes a set of subscriptions if already exist
 func (st *SplayTree) DeleteSubscription(sub Subscriptions) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.excludes.delete(sub)
+	st.masks.delete(sub)
 	bsub := sub.ToByteSubscriptions()
 	for _, fs := range bsub.Keys() {
-		st.root.delete(fs, bsub[fs].ReportURI)
+		if st.root.filterObject == nil {
+			return
+		}
+		st.root.delete(fs, bsub[fs].ReportURIs)
+		// deleting the last subscription leaves an empty tree
+		if st.root.isEmpty() {
+			st.root = &SplayTreeNode{}
+		}
 	}
 }
 
 // Dump returs a string representation of the PatriciaTrie
 func (st *SplayTree) Dump() string {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
 	writer := &bytes.Buffer{}
 	st.root.print(writer, 0)
+	st.masks.dump(writer)
+	st.excludes.dump(writer)
 	return writer.String()
 }
 
 // MarshalBinary overwrites the marshaller in gob encoding *SplayTree
 func (st *SplayTree) MarshalBinary() (_ []byte, err error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
 	var buf bytes.Buffer
 	enc := gob.NewEncoder(&buf)
 
@@ -66,6 +98,9 @@ func (st *SplayTree) MarshalBinary() (_ []byte, err error) {
 	// Encode SplayTreeNode
 	enc.Encode(st.root)
 
+	// Exclude and mask patterns
+	err = encodePatternFilters(enc, st.excludes.patternFilters, st.masks.patternFilters)
+
 	return buf.Bytes(), err
 }
 
@@ -76,7 +111,14 @@ func (st *SplayTree) Name() string {
 
 // Search returns a pureIdentity of the llrp.ReadEvent if found any subscription without err
 func (st *SplayTree) Search(re llrp.ReadEvent) (pureIdentity string, reportURIs []string, err error) {
-	reportURIs = st.root.splaySearch(st, nil, re.ID)
+	id := tdt.FilterID(re.PC, re.ID)
+	st.mutex.Lock()
+	if st.root.filterObject != nil {
+		reportURIs = st.root.splaySearch(st, nil, id)
+	}
+	st.mutex.Unlock()
+	reportURIs = st.masks.search(id, reportURIs)
+	reportURIs = st.excludes.apply(id, reportURIs)
 	if len(reportURIs) == 0 {
 		return pureIdentity, reportURIs, fmt.Errorf("no match found for %v", re.ID)
 	}
@@ -95,7 +137,14 @@ func (st *SplayTree) UnmarshalBinary(data []byte) (err error) {
 	}
 
 	// Decode SplayTreeNode
-	err = dec.Decode(&st.root)
+	if err = dec.Decode(&st.root); err != nil {
+		return
+	}
+
+	// Exclude and mask patterns
+	sub, err := decodePatternFilters(dec)
+	st.excludes = newExcludeFilters(sub)
+	st.masks = newMaskFilters(sub)
 
 	// tdt.Core
 	st.tdtCore = tdt.NewCore()
@@ -108,8 +157,8 @@ func (stn *SplayTreeNode) MarshalBinary() (_ []byte, err error) {
 	var buf bytes.Buffer
 	enc := gob.NewEncoder(&buf)
 
-	// ReportURI
-	enc.Encode(stn.reportURI)
+	// ReportURIs
+	enc.Encode(stn.reportURIs)
 
 	// Filter
 	hasFilter := stn.filterObject != nil
@@ -139,8 +188,8 @@ func (stn *SplayTreeNode) MarshalBinary() (_ []byte, err error) {
 func (stn *SplayTreeNode) UnmarshalBinary(data []byte) (err error) {
 	dec := gob.NewDecoder(bytes.NewReader(data))
 
-	// reportURI
-	if err = dec.Decode(&stn.reportURI); err != nil {
+	// reportURIs
+	if err = dec.Decode(&stn.reportURIs); err != nil {
 		return
 	}
 
@@ -181,29 +230,50 @@ func (stn *SplayTreeNode) UnmarshalBinary(data []byte) (err error) {
 // Internal helper methods -----------------------------------------------------
 
 // add a set of subscriptions if not exists yet
-func (stn *SplayTreeNode) add(fs string, reportURI string) {
+func (stn *SplayTreeNode) add(fs string, reportURIs []string) {
 	if strings.HasPrefix(fs, stn.filterObject.String) { // fs \in stn.FilterObject.String
 		if fs == stn.filterObject.String { // the identical filter
-			// if the reportURI is different, update it
-			if stn.reportURI != reportURI {
-				stn.reportURI = reportURI
-			}
+			// merge the reportURIs sharing the filter
+			stn.reportURIs = mergeReportURIs(stn.reportURIs, reportURIs)
 		} else { // it's a subset (matching branch) of the current node, and there's no matchNext node
 			if stn.matchNext == nil {
 				stn.matchNext = &SplayTreeNode{}
 				stn.matchNext.filterObject = NewFilter(fs[stn.filterObject.Size:], stn.filterObject.Offset+stn.filterObject.Size)
-				stn.matchNext.reportURI = reportURI
+				stn.matchNext.reportURIs = mergeReportURIs(nil, reportURIs)
 			} else { // if there's already matchNext node
-				stn.matchNext.add(fs[stn.filterObject.Size:], reportURI)
+				stn.matchNext.add(fs[stn.filterObject.Size:], reportURIs)
 			}
 		}
+	} else if strings.HasPrefix(stn.filterObject.String, fs) { // the current node is a subset of fs
+		// the current node and the following ones under fs become the subsets of fs
+		subset := &SplayTreeNode{}
+		*subset = *stn
+		subset.mismatchNext = nil
+		tail := subset
+		prev := stn
+		for next := stn.mismatchNext; next != nil; next = prev.mismatchNext {
+			if !strings.HasPrefix(next.filterObject.String, fs) {
+				prev = next
+				continue
+			}
+			prev.mismatchNext = next.mismatchNext
+			next.mismatchNext = nil
+			tail.mismatchNext = next
+			tail = next
+		}
+		for node := subset; node != nil; node = node.mismatchNext {
+			node.filterObject = NewFilter(node.filterObject.String[len(fs):], node.filterObject.Offset+len(fs))
+		}
+		stn.filterObject = NewFilter(fs, stn.filterObject.Offset)
+		stn.reportURIs = mergeReportURIs(nil, reportURIs)
+		stn.matchNext = subset
 	} else { // doesn't match with the current node, traverse the mismatchNext node
 		if stn.mismatchNext == nil { // there's no mismatchNext node
 			stn.mismatchNext = &SplayTreeNode{}
 			stn.mismatchNext.filterObject = NewFilter(fs, stn.filterObject.Offset)
-			stn.mismatchNext.reportURI = reportURI
+			stn.mismatchNext.reportURIs = mergeReportURIs(nil, reportURIs)
 		} else { // if there's already mismatchNext node
-			stn.mismatchNext.add(fs, reportURI)
+			stn.mismatchNext.add(fs, reportURIs)
 		}
 	}
 	return
@@ -214,7 +284,7 @@ func (stn *SplayTreeNode) build(sub ByteSubscriptions) *SplayTreeNode {
 	subscriptionSize := len(sub.Keys())
 	for i, fs := range sub.Keys() {
 		current.filterObject = NewFilter(fs, sub[fs].Offset)
-		current.reportURI = sub[fs].ReportURI
+		current.reportURIs = sub[fs].ReportURIs
 		// if this node has subset
 		if len(sub[fs].Subset) != 0 {
 			matchNext := &SplayTreeNode{}
@@ -233,41 +303,42 @@ func (stn *SplayTreeNode) build(sub ByteSubscriptions) *SplayTreeNode {
 }
 
 // delete a set of subscriptions if not exists yet
-func (stn *SplayTreeNode) delete(fs string, reportURI string) {
+func (stn *SplayTreeNode) delete(fs string, reportURIs []string) {
 	if strings.HasPrefix(fs, stn.filterObject.String) { // fs \in stn.FilterObject.String
 		if fs == stn.filterObject.String { // this node is to delete
-			if stn.matchNext == nil && stn.mismatchNext == nil { // something wrong
+			// the node is kept while any other reportURI remains
+			stn.reportURIs = removeReportURIs(stn.reportURIs, reportURIs)
+			if len(stn.reportURIs) != 0 {
+				return
+			}
+			if stn.matchNext == nil && stn.mismatchNext == nil { // a leaf, pruned by the parent
 			} else if stn.matchNext != nil { // if there is subset, keep the node as an aggregation node
 				if stn.matchNext.mismatchNext != nil {
-					stn.reportURI = ""
+					stn.reportURIs = nil
 				} else { // if none other mismatch branch, concatenate the matchNext with to-be-deleted node
 					stn.filterObject = NewFilter(fs+stn.matchNext.filterObject.String, stn.filterObject.Offset)
-					stn.reportURI = stn.matchNext.reportURI
+					stn.reportURIs = stn.matchNext.reportURIs
 					stn.matchNext = stn.matchNext.matchNext
 				}
 			} else if stn.mismatchNext != nil { // replace this node with mismatchNext
 				stn.filterObject = stn.mismatchNext.filterObject
-				stn.reportURI = stn.mismatchNext.reportURI
+				stn.reportURIs = stn.mismatchNext.reportURIs
 				stn.matchNext = stn.mismatchNext.matchNext
 				stn.mismatchNext = stn.mismatchNext.mismatchNext
 			}
-		} else { // it's a subset (matching branch) of the current node, and there's no matchNext node
+		} else { // it's a subset (matching branch) of the current node
 			if stn.matchNext != nil { // if there's a matchNext node
-				if fs[stn.filterObject.Size:] == stn.matchNext.filterObject.String &&
-					stn.matchNext.matchNext == nil && stn.matchNext.mismatchNext == nil { // the matchNext is to delete
+				stn.matchNext.delete(fs[stn.filterObject.Size:], reportURIs)
+				if stn.matchNext.isEmpty() { // the matchNext is deleted
 					stn.matchNext = nil
-				} else {
-					stn.matchNext.delete(fs[stn.filterObject.Size:], reportURI)
 				}
 			}
 		}
 	} else { // doesn't match with the current node, traverse the mismatchNext node
 		if stn.mismatchNext != nil { // there's a mismatchNext node
-			if fs == stn.mismatchNext.filterObject.String &&
-				stn.mismatchNext.matchNext == nil && stn.mismatchNext.mismatchNext == nil {
+			stn.mismatchNext.delete(fs, reportURIs)
+			if stn.mismatchNext.isEmpty() { // the mismatchNext is deleted
 				stn.mismatchNext = nil
-			} else {
-				stn.mismatchNext.delete(fs, reportURI)
 			}
 		}
 	}
@@ -275,7 +346,7 @@ func (stn *SplayTreeNode) delete(fs string, reportURI string) {
 }
 
 func (stn *SplayTreeNode) equal(want *SplayTreeNode) (ok bool, got *SplayTreeNode, wanted *SplayTreeNode) {
-	if stn.reportURI != want.reportURI ||
+	if !reflect.DeepEqual(stn.reportURIs, want.reportURIs) ||
 		!reflect.DeepEqual(stn.filterObject, want.filterObject) {
 		return false, stn, want
 	}
@@ -300,10 +371,15 @@ func (stn *SplayTreeNode) equal(want *SplayTreeNode) (ok bool, got *SplayTreeNod
 	return true, nil, nil
 }
 
+// isEmpty returns true if the node has neither reportURI nor next node
+func (stn *SplayTreeNode) isEmpty() bool {
+	return len(stn.reportURIs) == 0 && stn.matchNext == nil && stn.mismatchNext == nil
+}
+
 func (stn *SplayTreeNode) print(writer io.Writer, indent int) {
 	var n string
-	if len(stn.reportURI) != 0 {
-		n = "-> " + stn.reportURI
+	if len(stn.reportURIs) != 0 {
+		n = "-> " + strings.Join(stn.reportURIs, " ")
 	}
 	fmt.Fprintf(writer, "--%s %s\n", stn.filterObject.ToString(), n)
 	if stn.matchNext != nil {
@@ -319,7 +395,7 @@ func (stn *SplayTreeNode) print(writer io.Writer, indent int) {
 func (stn *SplayTreeNode) splaySearch(st *SplayTree, parent *SplayTreeNode, id []byte) []string {
 	matches := []string{}
 	if stn.filterObject.Match(id) {
-		matches = append(matches, stn.reportURI)
+		matches = append(matches, stn.reportURIs...)
 		if stn.matchNext != nil {
 			// Do Search & Splay in the subsets
 			matches = append(matches, stn.matchNext.splaySearch(st, nil, id)...)
@@ -355,6 +431,10 @@ func NewSplayTree(sub Subscriptions) Engine {
 	st.root = &SplayTreeNode{}
 	st.root = st.root.build(bsub)
 
+	// the mask and exclude patterns are applied after the search
+	st.masks = newMaskFilters(sub)
+	st.excludes = newExcludeFilters(sub)
+
 	// initialize the tdt.Core
 	st.tdtCore = tdt.NewCore()
 
@@ -17,20 +17,23 @@ import (
 	//"strconv"
 	"strings"
 
+	"github.com/iomz/gosstrak/tagmemory"
 	"github.com/iomz/gosstrak/tdt"
 )
 
 // ByteSubscriptions contains filter string as key and PartialSubscription as value
 type ByteSubscriptions map[string]*PartialSubscription
 
-// PartialSubscription contains reportURI and pValue for a filter
+// PartialSubscription contains the reportURIs and pValue for a filter,
+// the reportURIs are shared by the patterns with the same filter
 type PartialSubscription struct {
-	Offset    int
-	ReportURI string
-	Subset    ByteSubscriptions
+	Offset     int
+	ReportURIs []string
+	Subset     ByteSubscriptions
 }
 
-// Subscriptions contains a slice of urn:epc:pat as values and a URI to report events as keys
+// Subscriptions contains a slice of urn:epc:pat as values and a URI to report events as keys,
+// the patterns with ExcludePrefix exclude the tags from the other patterns
 type Subscriptions map[string][]string
 
 // Clone retuns a new copy of subscriptions
@@ -57,6 +60,22 @@ func (sub Subscriptions) Keys() []string {
 	return ks
 }
 
+// ValidateMemoryPatterns returns an error if a memory pattern can't be used as a filter,
+// the fieldnames are resolved with the tagmemory.Registry
+func (sub Subscriptions) ValidateMemoryPatterns(fields *tagmemory.Registry) error {
+	for _, reportURI := range sub.Keys() {
+		for _, pat := range sub[reportURI] {
+			if !IsMemoryPattern(pat) {
+				continue
+			}
+			if err := validatePattern(pat, fields); err != nil {
+				return fmt.Errorf("%s: %v", reportURI, err)
+			}
+		}
+	}
+	return nil
+}
+
 // MarshalBinary overwrites the marshaller in gob encoding *Subscription
 func (sub Subscriptions) MarshalBinary() (_ []byte, err error) {
 	var buf bytes.Buffer
@@ -116,24 +135,33 @@ func (sub Subscriptions) UnmarshalBinary(data []byte) (err error) {
 	return
 }
 
-// ToByteSubscriptions preprocess the subscription and convert them in bytes
+// ToByteSubscriptions preprocess the include patterns in the subscription and convert the prefix filters in bytes
 func (sub Subscriptions) ToByteSubscriptions() ByteSubscriptions {
 	bsub := ByteSubscriptions{}
 	for reportURI, patterns := range sub {
 		for _, pat := range patterns {
-			tf := strings.Split(strings.TrimPrefix(pat, "urn:epc:pat:"), ":")
-			if len(tf) != 2 { // should only containts a type and fields
+			if IsExcludePattern(pat) {
 				continue
 			}
-			fields := strings.Split(strings.ToUpper(tf[1]), ".")
-			pfs, err := tdt.MakePrefixFilterString(tf[0], fields)
+			fss, err := makeFilterStrings(pat)
 			if err != nil {
 				log.Print(err)
+				continue
 			}
-			bsub[pfs] = &PartialSubscription{
-				Offset:    0,
-				ReportURI: reportURI,
-				Subset:    ByteSubscriptions{},
+			for _, fs := range fss {
+				// the mask filters are held separately by the engines
+				if !isPrefixFilter(fs) {
+					continue
+				}
+				if psub, ok := bsub[fs]; ok {
+					psub.ReportURIs = mergeReportURIs(psub.ReportURIs, []string{reportURI})
+					continue
+				}
+				bsub[fs] = &PartialSubscription{
+					Offset:     0,
+					ReportURIs: []string{reportURI},
+					Subset:     ByteSubscriptions{},
+				}
 			}
 		}
 	}
@@ -167,7 +195,7 @@ func LoadSubscriptionsFromCSVFile(f string) Subscriptions {
 		}
 		for i := 1; i < len(record); i++ {
 			pat := record[i]
-			if strings.HasPrefix(strings.ToLower(pat), "urn:epc:pat:") {
+			if strings.HasPrefix(strings.ToLower(strings.TrimPrefix(pat, ExcludePrefix)), "urn:epc:pat:") || IsMemoryPattern(pat) {
 				if _, ok := sub[reportURI]; !ok {
 					sub[reportURI] = []string{}
 				}
@@ -188,8 +216,8 @@ func (psub *PartialSubscription) MarshalBinary() (_ []byte, err error) {
 	// Offset
 	enc.Encode(psub.Offset)
 
-	// ReportURI
-	enc.Encode(psub.ReportURI)
+	// ReportURIs
+	enc.Encode(psub.ReportURIs)
 
 	// Subset
 	enc.Encode(psub.Subset)
@@ -207,8 +235,8 @@ func (psub *PartialSubscription) UnmarshalBinary(data []byte) (err error) {
 		return
 	}
 
-	// ReportURI
-	if err = dec.Decode(&psub.ReportURI); err != nil {
+	// ReportURIs
+	if err = dec.Decode(&psub.ReportURIs); err != nil {
 		return
 	}
 
@@ -242,17 +270,17 @@ func (bsub ByteSubscriptions) Keys() []string {
 // linkSubset finds subsets and nest them under the parents
 func (bsub ByteSubscriptions) linkSubset() {
 	type element struct {
-		filter    string
-		offset    int
-		reportURI string
+		filter     string
+		offset     int
+		reportURIs []string
 	}
 
 	var elements []*element
 	for _, fs := range bsub.Keys() {
 		elements = append(elements, &element{
-			filter:    fs,
-			offset:    bsub[fs].Offset,
-			reportURI: bsub[fs].ReportURI,
+			filter:     fs,
+			offset:     bsub[fs].Offset,
+			reportURIs: bsub[fs].ReportURIs,
 		})
 	}
 
@@ -267,13 +295,13 @@ func (bsub ByteSubscriptions) linkSubset() {
 				if len(bsub[linkCandidate].Subset) == 0 {
 					bsub[linkCandidate].Subset = ByteSubscriptions{}
 					bsub[linkCandidate].Subset[fs[len(linkCandidate):]] = &PartialSubscription{
-						Offset:    psub.Offset + len(linkCandidate),
-						ReportURI: psub.ReportURI,
+						Offset:     psub.Offset + len(linkCandidate),
+						ReportURIs: psub.ReportURIs,
 					}
 				} else {
 					bsub[linkCandidate].Subset[fs[len(linkCandidate):]] = &PartialSubscription{
-						Offset:    psub.Offset + len(linkCandidate),
-						ReportURI: psub.ReportURI,
+						Offset:     psub.Offset + len(linkCandidate),
+						ReportURIs: psub.ReportURIs,
 					}
 				}
 				// recursively link the subset
@@ -317,9 +345,9 @@ func (bsub ByteSubscriptions) makePatriciaSubset() {
 				// if the commonPrefix itself is a subscription
 				// make this a superset of subscirptions with current commonPrefix
 				superset = &PartialSubscription{
-					Offset:    currentOffset,
-					ReportURI: bsub[fs].ReportURI,
-					Subset:    bsub[fs].Subset,
+					Offset:     currentOffset,
+					ReportURIs: bsub[fs].ReportURIs,
+					Subset:     bsub[fs].Subset,
 				}
 				// delete the superset
 				delete(bsub, fs)
@@ -327,9 +355,9 @@ func (bsub ByteSubscriptions) makePatriciaSubset() {
 				// if this is PartialSubscription is a subset of this commonPrefix
 				// check if this is not a superset?
 				(*sbsub)[fs[len(commonPrefix):]] = &PartialSubscription{
-					Offset:    currentOffset + len(commonPrefix),
-					ReportURI: bsub[fs].ReportURI,
-					Subset:    bsub[fs].Subset,
+					Offset:     currentOffset + len(commonPrefix),
+					ReportURIs: bsub[fs].ReportURIs,
+					Subset:     bsub[fs].Subset,
 				}
 				// delete the subset
 				delete(bsub, fs)
@@ -359,10 +387,75 @@ func (bsub ByteSubscriptions) makePatriciaSubset() {
 // print used for Dump()
 func (bsub ByteSubscriptions) print(writer io.Writer, indent int) {
 	for _, fs := range bsub.Keys() {
-		fmt.Fprintf(writer, "%s--%s %v %s\n", strings.Repeat(" ", indent), fs, bsub[fs].Offset, bsub[fs].ReportURI)
+		fmt.Fprintf(writer, "%s--%s %v %s\n", strings.Repeat(" ", indent), fs, bsub[fs].Offset, strings.Join(bsub[fs].ReportURIs, " "))
 		ss := bsub[fs].Subset
 		if len(ss) != 0 {
 			ss.print(writer, indent+2)
 		}
 	}
 }
+
+// mergeReportURIs returns the sorted union of the reportURIs and the others
+func mergeReportURIs(reportURIs []string, others []string) []string {
+	merged := append([]string{}, reportURIs...)
+	for _, reportURI := range others {
+		if stringIndexInSlice(reportURI, merged) < 0 {
+			merged = append(merged, reportURI)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// removeReportURIs returns the reportURIs without the others
+func removeReportURIs(reportURIs []string, others []string) []string {
+	var remained []string
+	for _, reportURI := range reportURIs {
+		if stringIndexInSlice(reportURI, others) < 0 {
+			remained = append(remained, reportURI)
+		}
+	}
+	return remained
+}
+
+// makeFilterStrings converts the urn:epc:pat pattern to the filter strings,
+// the wildcard and range fields make the filters with 'x' bits
+func makeFilterStrings(pat string) ([]string, error) {
+	tf := strings.Split(strings.TrimPrefix(pat, "urn:epc:pat:"), ":")
+	if len(tf) != 2 { // should only containts a type and fields
+		return nil, fmt.Errorf("invalid pattern: %s", pat)
+	}
+	// the ISO fields are in uppercase, while the EPC fields may have the case-sensitive strings
+	if strings.HasPrefix(tf[0], "iso") {
+		tf[1] = strings.ToUpper(tf[1])
+	}
+	return tdt.MakeFilterStrings(tf[0], strings.Split(tf[1], "."))
+}
+
+// validatePattern returns an error if the pattern can't be used as a filter,
+// the fieldnames in the memory patterns are resolved with the tagmemory.Registry
+func validatePattern(pat string, fields *tagmemory.Registry) error {
+	if IsMemoryPattern(pat) {
+		_, err := newMemoryFilter(pat, fields)
+		return err
+	}
+	pat = strings.TrimPrefix(pat, ExcludePrefix)
+	if !strings.HasPrefix(strings.ToLower(pat), "urn:epc:pat:") {
+		return fmt.Errorf("invalid pattern: %s", pat)
+	}
+	_, err := makeFilterStrings(pat)
+	return err
+}
+
+// withoutMemoryPatterns returns a copy of subscriptions only with the EPC patterns for the engines
+func (sub Subscriptions) withoutMemoryPatterns() Subscriptions {
+	epcSub := Subscriptions{}
+	for _, reportURI := range sub.Keys() {
+		for _, pat := range sub[reportURI] {
+			if !IsMemoryPattern(pat) {
+				epcSub[reportURI] = append(epcSub[reportURI], pat)
+			}
+		}
+	}
+	return epcSub
+}
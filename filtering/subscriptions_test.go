@@ -12,6 +12,8 @@ import (
 	"os"
 	"reflect"
 	"testing"
+
+	"github.com/iomz/gosstrak/tagmemory"
 )
 
 func TestByteSubscriptions_keys(t *testing.T) {
@@ -23,8 +25,8 @@ func TestByteSubscriptions_keys(t *testing.T) {
 		{
 			"0,8",
 			ByteSubscriptions{
-				"0000": &PartialSubscription{0, "0", ByteSubscriptions{}},
-				"1000": &PartialSubscription{0, "8", ByteSubscriptions{}},
+				"0000": &PartialSubscription{0, []string{"0"}, ByteSubscriptions{}},
+				"1000": &PartialSubscription{0, []string{"8"}, ByteSubscriptions{}},
 			},
 			[]string{"0000", "1000"},
 		},
@@ -47,11 +49,11 @@ func TestByteSubscriptions_Dump(t *testing.T) {
 		{
 			"Test Dump ByteSubscriptions",
 			ByteSubscriptions{
-				"0011":         &PartialSubscription{0, "3", ByteSubscriptions{}},
-				"00110011":     &PartialSubscription{0, "3-3", ByteSubscriptions{}},
-				"1111":         &PartialSubscription{0, "15", ByteSubscriptions{}},
-				"00110000":     &PartialSubscription{0, "3-0", ByteSubscriptions{}},
-				"001100110000": &PartialSubscription{0, "3-3-0", ByteSubscriptions{}},
+				"0011":         &PartialSubscription{0, []string{"3"}, ByteSubscriptions{}},
+				"00110011":     &PartialSubscription{0, []string{"3-3"}, ByteSubscriptions{}},
+				"1111":         &PartialSubscription{0, []string{"15"}, ByteSubscriptions{}},
+				"00110000":     &PartialSubscription{0, []string{"3-0"}, ByteSubscriptions{}},
+				"001100110000": &PartialSubscription{0, []string{"3-3-0"}, ByteSubscriptions{}},
 			},
 			"--0011 0 3\n" +
 				"--00110000 0 3-0\n" +
@@ -78,20 +80,20 @@ func TestByteSubscriptions_linkSubset(t *testing.T) {
 		{
 			"Subset linking test for ByteSubscriptions",
 			ByteSubscriptions{
-				"0011":         &PartialSubscription{0, "3", ByteSubscriptions{}},
-				"00110011":     &PartialSubscription{0, "3-3", ByteSubscriptions{}},
-				"1111":         &PartialSubscription{0, "15", ByteSubscriptions{}},
-				"00110000":     &PartialSubscription{0, "3-0", ByteSubscriptions{}},
-				"001100110000": &PartialSubscription{0, "3-3-0", ByteSubscriptions{}},
+				"0011":         &PartialSubscription{0, []string{"3"}, ByteSubscriptions{}},
+				"00110011":     &PartialSubscription{0, []string{"3-3"}, ByteSubscriptions{}},
+				"1111":         &PartialSubscription{0, []string{"15"}, ByteSubscriptions{}},
+				"00110000":     &PartialSubscription{0, []string{"3-0"}, ByteSubscriptions{}},
+				"001100110000": &PartialSubscription{0, []string{"3-3-0"}, ByteSubscriptions{}},
 			},
 			ByteSubscriptions{
-				"0011": &PartialSubscription{0, "3", ByteSubscriptions{
-					"0000": &PartialSubscription{4, "3-0", ByteSubscriptions{}},
-					"0011": &PartialSubscription{4, "3-3", ByteSubscriptions{
-						"0000": &PartialSubscription{8, "3-3-0", ByteSubscriptions{}},
+				"0011": &PartialSubscription{0, []string{"3"}, ByteSubscriptions{
+					"0000": &PartialSubscription{4, []string{"3-0"}, ByteSubscriptions{}},
+					"0011": &PartialSubscription{4, []string{"3-3"}, ByteSubscriptions{
+						"0000": &PartialSubscription{8, []string{"3-3-0"}, ByteSubscriptions{}},
 					}},
 				}},
-				"1111": &PartialSubscription{0, "15", ByteSubscriptions{}},
+				"1111": &PartialSubscription{0, []string{"15"}, ByteSubscriptions{}},
 			},
 		},
 	}
@@ -122,12 +124,12 @@ func TestSubscriptions_ToByteSubscriptions(t *testing.T) {
 				"http://localhost:8888/sscc":  []string{"urn:epc:pat:sscc-96:3.00039579721"},
 			},
 			ByteSubscriptions{
-				"0011000001111011110011111100100011011101100101111000101011":                                                                                                                                                               &PartialSubscription{Offset: 0, ReportURI: "http://localhost:8888/sgtin"},
-				"001100010110010000000000010010110111111000001001001":                                                                                                                                                                      &PartialSubscription{Offset: 0, ReportURI: "http://localhost:8888/sscc"},
-				"001100110111100001111000100100000000000000000000000000000100000000000000000000000000000000000001":                                                                                                                         &PartialSubscription{Offset: 0, ReportURI: "http://localhost:8888/grai"},
-				"0011010001100100000100010000010000111100011000100001010010011100100011110001110010001011000011011":                                                                                                                        &PartialSubscription{Offset: 0, ReportURI: "http://localhost:8888/giai"},
-				"110010110101010011010101001110000001000010000011110000010100001000000001001110001011110000011001001111010101110000000110001111010010110000010010000101000001000100001001001110000111110000010100001000001001010011110001": &PartialSubscription{Offset: 0, ReportURI: "http://localhost:8888/17365"},
-				"110111000010001101010100010010": &PartialSubscription{Offset: 0, ReportURI: "http://localhost:8888/17363"},
+				"0011000001111011110011111100100011011101100101111000101011":                                                                                                                                                               &PartialSubscription{Offset: 0, ReportURIs: []string{"http://localhost:8888/sgtin"}},
+				"001100010110010000000000010010110111111000001001001":                                                                                                                                                                      &PartialSubscription{Offset: 0, ReportURIs: []string{"http://localhost:8888/sscc"}},
+				"001100110111100001111000100100000000000000000000000000000100000000000000000000000000000000000001":                                                                                                                         &PartialSubscription{Offset: 0, ReportURIs: []string{"http://localhost:8888/grai"}},
+				"0011010001100100000100010000010000111100011000100001010010011100100011110001110010001011000011011":                                                                                                                        &PartialSubscription{Offset: 0, ReportURIs: []string{"http://localhost:8888/giai"}},
+				"10100010110010110101010011010101001110000001000010000011110000010100001000000001001110001011110000011001001111010101110000000110001111010010110000010010000101000001000100001001001110000111110000010100001000001001010011110001": &PartialSubscription{Offset: 0, ReportURIs: []string{"http://localhost:8888/17365"}},
+				"10101001110111000010001101010100010010": &PartialSubscription{Offset: 0, ReportURIs: []string{"http://localhost:8888/17363"}},
 			},
 		},
 	}
@@ -139,7 +141,7 @@ func TestSubscriptions_ToByteSubscriptions(t *testing.T) {
 					t.Errorf("Subscriptions.ToByteSubscriptions() =  want %v", pfs)
 				} else if gotPsub.Offset != psub.Offset {
 					t.Errorf("Subscriptions.ToByteSubscriptions() = %q, want %q", gotPsub, psub)
-				} else if gotPsub.ReportURI != psub.ReportURI {
+				} else if !reflect.DeepEqual(gotPsub.ReportURIs, psub.ReportURIs) {
 					t.Errorf("Subscriptions.ToByteSubscriptions() = %q, want %q", gotPsub, psub)
 				}
 			}
@@ -210,3 +212,29 @@ func BenchmarkEngineGenLegacy700Subs(b *testing.B)  { benchmarkLoadNSubs(700, b)
 func BenchmarkEngineGenLegacy800Subs(b *testing.B)  { benchmarkLoadNSubs(800, b) }
 func BenchmarkEngineGenLegacy900Subs(b *testing.B)  { benchmarkLoadNSubs(900, b) }
 func BenchmarkEngineGenLegacy1000Subs(b *testing.B) { benchmarkLoadNSubs(1000, b) }
+
+func TestSubscriptions_ValidateMemoryPatterns(t *testing.T) {
+	fields := tagmemory.NewRegistry()
+	if err := fields.Define("items", &tagmemory.TMFixedFieldListSpec{
+		FixedFields: []tagmemory.TMFixedFieldSpec{{FieldName: "itemEPC", Bank: 3, Length: 96, Offset: 16, DefaultDatatype: tagmemory.EPC}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		sub     Subscriptions
+		wantErr bool
+	}{
+		{"epc", Subscriptions{"http://localhost:8888/sgtin": {"urn:epc:pat:sgtin-96:3.999203.7757355"}}, false},
+		{"predefined", Subscriptions{"http://localhost:8888/tid": {"tidBank=xE280"}}, false},
+		{"defined", Subscriptions{"http://localhost:8888/item": {"itemEPC=urn:epc:pat:sgtin-96:3.999203.7757355"}}, false},
+		{"undefined", Subscriptions{"http://localhost:8888/lot": {"tidBank=xE280", "!lot=x01"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sub.ValidateMemoryPatterns(fields); (err != nil) != tt.wantErr {
+				t.Errorf("Subscriptions.ValidateMemoryPatterns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
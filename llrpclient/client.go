@@ -0,0 +1,398 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package llrpclient implements the client side of LLRP to receive the ReadEvents from a reader
+package llrpclient
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iomz/go-llrp"
+)
+
+// LLRP parameter types and ConnectionAttemptEvent status for the handshake
+const (
+	readerEventNotificationDataType = 246
+	connectionAttemptEventType      = 256
+	ConnectionAttemptSuccess        = 0
+)
+
+// StopTimeout is the time to wait for DELETE_ROSPEC_RESPONSE on Close
+var StopTimeout = time.Second
+
+// Errors returned by the Client
+var (
+	ErrClosed            = errors.New("llrpclient: client closed")
+	ErrAlreadyConnected  = errors.New("llrpclient: already connected")
+	ErrConnectionAttempt = errors.New("llrpclient: connection attempt failed")
+)
+
+// Client maintains an LLRP connection to a reader
+type Client struct {
+	Name string
+	// ROSpec is pushed to the reader on connection if not nil
+	ROSpec *ROSpecConfig
+	// KeepalivePeriod is pushed to the reader and supervised if positive
+	KeepalivePeriod time.Duration
+	// KeepaliveMisses is the number of the missed keepalives to drop the connection
+	KeepaliveMisses int
+	messageID       uint32
+	events          chan []*TagReport
+	mutex           sync.Mutex
+	conn            net.Conn
+	handlers        map[uint16]MessageHandler
+	lastKeepalive   time.Time
+	health          string
+	closeOnce       sync.Once
+	closed          chan struct{}
+	deleted         chan struct{}
+}
+
+// NewClient returns the pointer to a new Client instance,
+// name is used for logging
+func NewClient(name string, initialMessageID uint32) *Client {
+	return &Client{
+		Name:      name,
+		messageID: initialMessageID,
+		events:    make(chan []*TagReport),
+		handlers:  make(map[uint16]MessageHandler),
+		health:    HealthUnknown,
+		closed:    make(chan struct{}),
+		deleted:   make(chan struct{}, 1),
+	}
+}
+
+// Close deletes the ROSpec, closes the connection and stops the Client
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	c.mutex.Lock()
+	conn := c.conn
+	c.mutex.Unlock()
+	if conn == nil {
+		return nil
+	}
+	c.deleteROSpec(conn)
+	return conn.Close()
+}
+
+// Connect dials the reader and serves the connection until it's lost
+func (c *Client) Connect(address string) error {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return err
+	}
+	return c.Serve(conn)
+}
+
+// Events returns the channel of the TagReports in RO_ACCESS_REPORTs,
+// the channel is never closed
+func (c *Client) Events() <-chan []*TagReport {
+	return c.events
+}
+
+// Handle registers the MessageHandler for the header on the next connections,
+// replacing the default one
+func (c *Client) Handle(header uint16, handler MessageHandler) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.handlers[header] = handler
+}
+
+// LastKeepalive returns the time of the last KEEP_ALIVE from the reader
+func (c *Client) LastKeepalive() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lastKeepalive
+}
+
+// NextMessageID returns the messageID for the next message to the reader
+func (c *Client) NextMessageID() uint32 {
+	return atomic.AddUint32(&c.messageID, 1) - 1
+}
+
+// Serve handles the LLRP messages from the connection until it's lost,
+// returns nil if the Client is closed
+func (c *Client) Serve(conn net.Conn) error {
+	c.mutex.Lock()
+	select {
+	case <-c.closed:
+		c.mutex.Unlock()
+		conn.Close()
+		return ErrClosed
+	default:
+	}
+	if c.conn != nil {
+		c.mutex.Unlock()
+		return ErrAlreadyConnected
+	}
+	c.conn = conn
+	c.lastKeepalive = time.Now()
+	c.health = HealthUnknown
+	if c.KeepalivePeriod > 0 {
+		c.health = HealthHealthy
+	}
+	d := c.dispatcher(conn)
+	c.mutex.Unlock()
+	stop := make(chan struct{})
+	if c.KeepalivePeriod > 0 {
+		go c.watchdog(conn, stop)
+	}
+
+	err := c.read(conn, d)
+	close(stop)
+	conn.Close()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.conn = nil
+	select {
+	case <-c.closed:
+		c.health = HealthUnknown
+		return nil
+	default:
+	}
+	if c.health == HealthDead {
+		return ErrKeepaliveTimeout
+	}
+	c.health = HealthUnknown
+	return err
+}
+
+// Write sends the message to the reader
+func (c *Client) Write(message []byte) error {
+	c.mutex.Lock()
+	conn := c.conn
+	c.mutex.Unlock()
+	if conn == nil {
+		return fmt.Errorf("llrpclient: %s is not connected", c.Name)
+	}
+	_, err := conn.Write(message)
+	return err
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// deleteROSpec deletes the ROSpec from the reader and waits for the response
+func (c *Client) deleteROSpec(conn net.Conn) {
+	if c.ROSpec == nil {
+		return
+	}
+	select {
+	case <-c.deleted:
+	default:
+	}
+	conn.SetWriteDeadline(time.Now().Add(StopTimeout))
+	if c.ROSpec.readsMemory() {
+		conn.Write(DeleteAccessSpec(c.NextMessageID(), c.ROSpec.ROSpecID))
+	}
+	if _, err := conn.Write(DeleteROSpec(c.NextMessageID(), c.ROSpec.ROSpecID)); err != nil {
+		return
+	}
+	select {
+	case <-c.deleted:
+	case <-time.After(StopTimeout):
+		log.Printf("[LLRPClient] %s: no response to DELETE_ROSPEC", c.Name)
+	}
+}
+
+// dispatcher returns a Dispatcher to handle the messages from the connection,
+// the caller must hold the mutex
+func (c *Client) dispatcher(conn net.Conn) *Dispatcher {
+	d := NewDispatcher(c.Name)
+	configured := false
+	d.Handle(llrp.ReaderEventNotificationHeader, func(mid uint32, body []byte) error {
+		if status, ok := connectionAttemptStatus(body); ok && status != ConnectionAttemptSuccess {
+			return fmt.Errorf("%v with status %v", ErrConnectionAttempt, status)
+		}
+		if configured {
+			return nil
+		}
+		configured = true
+		if c.KeepalivePeriod > 0 {
+			conn.Write(SetReaderConfig(c.NextMessageID(), c.KeepalivePeriod))
+		} else {
+			conn.Write(llrp.SetReaderConfig(c.NextMessageID()))
+		}
+		if c.ROSpec != nil {
+			// remove the stale ROSpec and AccessSpec before adding them
+			conn.Write(DeleteROSpec(c.NextMessageID(), c.ROSpec.ROSpecID))
+			if c.ROSpec.readsMemory() {
+				conn.Write(DeleteAccessSpec(c.NextMessageID(), c.ROSpec.ROSpecID))
+			}
+			conn.Write(AddROSpec(c.NextMessageID(), c.ROSpec))
+		}
+		return nil
+	})
+	d.Handle(llrp.KeepaliveHeader, func(mid uint32, body []byte) error {
+		c.mutex.Lock()
+		c.lastKeepalive = time.Now()
+		if c.health == HealthLate {
+			c.health = HealthHealthy
+		}
+		c.mutex.Unlock()
+		_, err := conn.Write(llrp.KeepaliveAck(c.NextMessageID()))
+		return err
+	})
+	d.Handle(llrp.SetReaderConfigResponseHeader, func(mid uint32, body []byte) error {
+		if err := UnmarshalLLRPStatus(body); err != nil {
+			log.Printf("[LLRPClient] %s: SET_READER_CONFIG: %v", c.Name, err)
+		}
+		return nil
+	})
+	d.Handle(DeleteROSpecResponseHeader, func(mid uint32, body []byte) error {
+		if err := UnmarshalLLRPStatus(body); err != nil {
+			log.Printf("[LLRPClient] %s: DELETE_ROSPEC: %v", c.Name, err)
+		}
+		select {
+		case c.deleted <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	// the AccessSpecs added by the others, e.g., to write to the tags, are only logged on error
+	var addAccessSpecID, enableAccessSpecID uint32
+	d.Handle(DeleteAccessSpecResponseHeader, func(mid uint32, body []byte) error {
+		if err := UnmarshalLLRPStatus(body); err != nil {
+			log.Printf("[LLRPClient] %s: DELETE_ACCESSSPEC: %v", c.Name, err)
+		}
+		return nil
+	})
+	d.Handle(AddAccessSpecResponseHeader, func(mid uint32, body []byte) error {
+		err := UnmarshalLLRPStatus(body)
+		if c.ROSpec == nil || mid != addAccessSpecID {
+			if err != nil {
+				log.Printf("[LLRPClient] %s: ADD_ACCESSSPEC: %v", c.Name, err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("ADD_ACCESSSPEC: %v", err)
+		}
+		enableAccessSpecID = c.NextMessageID()
+		_, err = conn.Write(EnableAccessSpec(enableAccessSpecID, c.ROSpec.ROSpecID))
+		return err
+	})
+	d.Handle(EnableAccessSpecResponseHeader, func(mid uint32, body []byte) error {
+		err := UnmarshalLLRPStatus(body)
+		if c.ROSpec == nil || mid != enableAccessSpecID {
+			if err != nil {
+				log.Printf("[LLRPClient] %s: ENABLE_ACCESSSPEC: %v", c.Name, err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("ENABLE_ACCESSSPEC: %v", err)
+		}
+		_, err = conn.Write(EnableROSpec(c.NextMessageID(), c.ROSpec.ROSpecID))
+		return err
+	})
+	if c.ROSpec != nil {
+		d.Handle(AddROSpecResponseHeader, func(mid uint32, body []byte) error {
+			if err := UnmarshalLLRPStatus(body); err != nil {
+				return fmt.Errorf("ADD_ROSPEC: %v", err)
+			}
+			if c.ROSpec.readsMemory() {
+				addAccessSpecID = c.NextMessageID()
+				_, err := conn.Write(AddAccessSpec(addAccessSpecID, c.ROSpec))
+				return err
+			}
+			_, err := conn.Write(EnableROSpec(c.NextMessageID(), c.ROSpec.ROSpecID))
+			return err
+		})
+		d.Handle(EnableROSpecResponseHeader, func(mid uint32, body []byte) error {
+			if err := UnmarshalLLRPStatus(body); err != nil {
+				return fmt.Errorf("ENABLE_ROSPEC: %v", err)
+			}
+			_, err := conn.Write(StartROSpec(c.NextMessageID(), c.ROSpec.ROSpecID))
+			return err
+		})
+		d.Handle(StartROSpecResponseHeader, func(mid uint32, body []byte) error {
+			if err := UnmarshalLLRPStatus(body); err != nil {
+				return fmt.Errorf("START_ROSPEC: %v", err)
+			}
+			log.Printf("[LLRPClient] %s: started ROSpec %v", c.Name, c.ROSpec.ROSpecID)
+			return nil
+		})
+	}
+	d.Handle(llrp.ROAccessReportHeader, func(mid uint32, body []byte) error {
+		select {
+		case c.events <- UnmarshalROAccessReport(body):
+		case <-c.closed:
+			return errStopDispatching
+		}
+		return nil
+	})
+	for header, handler := range c.handlers {
+		d.Handle(header, handler)
+	}
+	return d
+}
+
+// read reads the LLRP messages from the connection until it fails
+func (c *Client) read(conn net.Conn, d *Dispatcher) error {
+	// prepare LLRP header storage
+	header := make([]byte, 2)
+	length := make([]byte, 4)
+	messageID := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, messageID); err != nil {
+			return err
+		}
+		// length containts the size of the entire message in octets
+		// starting from bit offset 0, hence, the message size is
+		// length - 10 bytes
+		var messageValue []byte
+		if messageSize := binary.BigEndian.Uint32(length) - 10; messageSize != 0 {
+			messageValue = make([]byte, messageSize)
+			if _, err := io.ReadFull(conn, messageValue); err != nil {
+				return err
+			}
+		}
+
+		err := d.Dispatch(binary.BigEndian.Uint16(header), binary.BigEndian.Uint32(messageID), messageValue)
+		if err == errStopDispatching {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// connectionAttemptStatus returns the status of ConnectionAttemptEvent
+// in the READER_EVENT_NOTIFICATION body if any
+func connectionAttemptStatus(body []byte) (uint16, bool) {
+	for len(body) >= 4 {
+		t := binary.BigEndian.Uint16(body) & 0x3ff
+		l := int(binary.BigEndian.Uint16(body[2:]))
+		if l < 4 || l > len(body) {
+			return 0, false
+		}
+		switch t {
+		case readerEventNotificationDataType:
+			// search in the parameters of ReaderEventNotificationData
+			return connectionAttemptStatus(body[4:l])
+		case connectionAttemptEventType:
+			if l < 6 {
+				return 0, false
+			}
+			return binary.BigEndian.Uint16(body[4:]), true
+		}
+		body = body[l:]
+	}
+	return 0, false
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package llrpclient
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/iomz/go-llrp"
+)
+
+// readMessage reads an LLRP message and returns its header and messageID
+func readMessage(conn net.Conn) (uint16, uint32, error) {
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return 0, 0, err
+	}
+	if size := binary.BigEndian.Uint32(buf[2:6]) - 10; size != 0 {
+		if _, err := io.ReadFull(conn, make([]byte, size)); err != nil {
+			return 0, 0, err
+		}
+	}
+	return binary.BigEndian.Uint16(buf[0:2]), binary.BigEndian.Uint32(buf[6:10]), nil
+}
+
+// readerEventNotification returns a READER_EVENT_NOTIFICATION with ConnectionAttemptEvent
+func readerEventNotification(mid uint32, status uint16) []byte {
+	return message(llrp.ReaderEventNotificationHeader, mid,
+		parameter(readerEventNotificationDataType,
+			parameter(128, make([]byte, 8)), // UTCTimestamp
+			parameter(connectionAttemptEventType, uint16Bytes(status))))
+}
+
+// response returns a response message with LLRPStatus
+func response(h uint16, mid uint32, status uint16) []byte {
+	return message(h, mid, parameter(llrpStatusType, uint16Bytes(status), uint16Bytes(0)))
+}
+
+// serve starts serving one end of a net.Pipe and returns the other end as the reader
+func serve(c *Client) (net.Conn, <-chan error) {
+	reader, conn := net.Pipe()
+	errc := make(chan error, 1)
+	go func() { errc <- c.Serve(conn) }()
+	return reader, errc
+}
+
+// writer queues the messages to the reader end of net.Pipe,
+// the client may be writing at the same time
+func writer(reader net.Conn) chan<- []byte {
+	send := make(chan []byte, 16)
+	go func() {
+		for msg := range send {
+			reader.Write(msg)
+		}
+	}()
+	return send
+}
+
+func TestClient_Serve(t *testing.T) {
+	c := NewClient("reader0", 1000)
+	reader, errc := serve(c)
+	defer reader.Close()
+
+	// the unsupported and error messages are skipped
+	reader.Write(message(1024+999, 1, []byte{1, 2, 3}))
+	reader.Write(message(ErrorMessageHeader, 2, parameter(llrpStatusType, uint16Bytes(109), uint16Bytes(0))))
+
+	for i, want := range []uint32{1000, 1001, 1002} {
+		reader.Write(llrp.Keepalive(uint32(i)))
+		h, mid, err := readMessage(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != llrp.KeepaliveAckHeader || mid != want {
+			t.Errorf("KEEP_ALIVE_ACK = (%v, %v), want (%v, %v)", h, mid, llrp.KeepaliveAckHeader, want)
+		}
+	}
+	if time.Since(c.LastKeepalive()) > time.Second {
+		t.Errorf("Client.LastKeepalive() = %v", c.LastKeepalive())
+	}
+
+	// the ReadEvents are sent to Events
+	reader.Write(message(llrp.ROAccessReportHeader, 3))
+	select {
+	case <-c.Events():
+	case <-time.After(time.Second):
+		t.Errorf("no ReadEvents for RO_ACCESS_REPORT")
+	}
+
+	// the connection is lost
+	reader.Close()
+	if err := <-errc; err == nil {
+		t.Errorf("Client.Serve() returned nil for the lost connection")
+	}
+}
+
+func TestClient_ROSpec(t *testing.T) {
+	c := NewClient("reader0", 1)
+	c.ROSpec = &ROSpecConfig{ROSpecID: 1}
+	reader, errc := serve(c)
+	defer reader.Close()
+	send := writer(reader)
+	defer close(send)
+
+	// expect the request and send the response
+	steps := []struct {
+		request  uint16
+		response uint16
+	}{
+		{llrp.SetReaderConfigHeader, llrp.SetReaderConfigResponseHeader},
+		{DeleteROSpecHeader, DeleteROSpecResponseHeader},
+		{AddROSpecHeader, AddROSpecResponseHeader},
+		{EnableROSpecHeader, EnableROSpecResponseHeader},
+		{StartROSpecHeader, StartROSpecResponseHeader},
+	}
+	send <- readerEventNotification(1, ConnectionAttemptSuccess)
+	for _, step := range steps {
+		h, mid, err := readMessage(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != step.request {
+			t.Fatalf("got %v, want %v", MessageName(h), step.request)
+		}
+		send <- response(step.response, mid, statusSuccess)
+	}
+
+	// the ROSpec is deleted on Close
+	closed := make(chan error)
+	go func() { closed <- c.Close() }()
+	h, mid, err := readMessage(reader)
+	if err != nil || h != DeleteROSpecHeader {
+		t.Fatalf("got (%v, %v), want DELETE_ROSPEC", h, err)
+	}
+	send <- response(DeleteROSpecResponseHeader, mid, statusSuccess)
+	<-closed
+	if err := <-errc; err != nil {
+		t.Errorf("Client.Serve() = %v after Close", err)
+	}
+	if err := c.Serve(reader); err != ErrClosed {
+		t.Errorf("Client.Serve() = %v after Close, want %v", err, ErrClosed)
+	}
+}
+
+func TestClient_AccessSpec(t *testing.T) {
+	c := NewClient("reader0", 1)
+	c.ROSpec = &ROSpecConfig{ROSpecID: 1, TIDWords: 2}
+	reader, _ := serve(c)
+	defer reader.Close()
+	send := writer(reader)
+	defer close(send)
+
+	steps := []struct {
+		request  uint16
+		response uint16
+	}{
+		{llrp.SetReaderConfigHeader, llrp.SetReaderConfigResponseHeader},
+		{DeleteROSpecHeader, DeleteROSpecResponseHeader},
+		{DeleteAccessSpecHeader, DeleteAccessSpecResponseHeader},
+		{AddROSpecHeader, AddROSpecResponseHeader},
+		{AddAccessSpecHeader, AddAccessSpecResponseHeader},
+		{EnableAccessSpecHeader, EnableAccessSpecResponseHeader},
+		{EnableROSpecHeader, EnableROSpecResponseHeader},
+		{StartROSpecHeader, StartROSpecResponseHeader},
+	}
+	send <- readerEventNotification(1, ConnectionAttemptSuccess)
+	for _, step := range steps {
+		h, mid, err := readMessage(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != step.request {
+			t.Fatalf("got %v, want %v", MessageName(h), step.request)
+		}
+		send <- response(step.response, mid, statusSuccess)
+	}
+	// the responses to the other AccessSpecs don't enable the ROSpec again
+	send <- response(AddAccessSpecResponseHeader, 999, statusSuccess)
+	send <- response(EnableAccessSpecResponseHeader, 1000, statusSuccess)
+	send <- llrp.Keepalive(1001)
+	if h, _, err := readMessage(reader); err != nil || h != llrp.KeepaliveAckHeader {
+		t.Errorf("got %v, want KEEP_ALIVE_ACK", MessageName(h))
+	}
+}
+
+func TestClient_ROSpecError(t *testing.T) {
+	c := NewClient("reader0", 1)
+	c.ROSpec = &ROSpecConfig{ROSpecID: 1}
+	reader, errc := serve(c)
+	defer reader.Close()
+	send := writer(reader)
+	defer close(send)
+
+	send <- readerEventNotification(1, ConnectionAttemptSuccess)
+	for {
+		h, mid, err := readMessage(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h == AddROSpecHeader {
+			send <- response(AddROSpecResponseHeader, mid, 100)
+			break
+		}
+	}
+	// the client drops the connection on the error
+	if err := <-errc; err == nil {
+		t.Errorf("Client.Serve() returned nil after ADD_ROSPEC failed")
+	}
+}
+
+func TestClient_ConnectionAttemptFailed(t *testing.T) {
+	c := NewClient("reader0", 1)
+	reader, errc := serve(c)
+	defer reader.Close()
+
+	reader.Write(readerEventNotification(1, 1))
+	if err := <-errc; err == nil {
+		t.Errorf("Client.Serve() returned nil for the failed connection attempt")
+	}
+}
+
+func TestClient_Handle(t *testing.T) {
+	c := NewClient("reader0", 1)
+	custom := make(chan []byte, 1)
+	c.Handle(CustomMessageHeader, func(mid uint32, body []byte) error {
+		custom <- body
+		return nil
+	})
+	reader, _ := serve(c)
+	defer reader.Close()
+
+	reader.Write(message(CustomMessageHeader, 1, []byte{0, 0, 0x6a, 0xd7, 1}))
+	select {
+	case body := <-custom:
+		if len(body) != 5 {
+			t.Errorf("CUSTOM_MESSAGE body = %v", body)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the registered handler is not called")
+	}
+	if err := c.Serve(reader); err != ErrAlreadyConnected {
+		t.Errorf("Client.Serve() = %v while connected, want %v", err, ErrAlreadyConnected)
+	}
+	go readMessage(reader)
+	if err := c.Write(llrp.KeepaliveAck(c.NextMessageID())); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_connectionAttemptStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   []byte
+		want   uint16
+		wantOk bool
+	}{
+		{"Success", readerEventNotification(1, 0)[10:], 0, true},
+		{"Failed", readerEventNotification(1, 3)[10:], 3, true},
+		{"NoConnectionAttemptEvent", []byte{0, 246, 0, 16, 0, 128, 0, 12, 0, 0, 0, 0, 0, 0, 0, 0}, 0, false},
+		{"Truncated", []byte{0, 246, 0, 22, 1, 0}, 0, false},
+		{"Empty", nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := connectionAttemptStatus(tt.body)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("connectionAttemptStatus() = (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
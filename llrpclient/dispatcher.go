@@ -0,0 +1,115 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package llrpclient
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+
+	"github.com/iomz/go-llrp"
+)
+
+// LLRP message headers handled without go-llrp
+const (
+	GetReaderCapabilitiesResponseHeader = 1035
+	ErrorMessageHeader                  = 1124
+	CustomMessageHeader                 = 2047
+)
+
+// messageNames is used for logging the LLRP messages
+var messageNames = map[uint16]string{
+	GetReaderCapabilitiesResponseHeader: "GET_READER_CAPABILITIES_RESPONSE",
+	llrp.SetReaderConfigResponseHeader:  "SET_READER_CONFIG_RESPONSE",
+	AddROSpecResponseHeader:             "ADD_ROSPEC_RESPONSE",
+	DeleteROSpecResponseHeader:          "DELETE_ROSPEC_RESPONSE",
+	StartROSpecResponseHeader:           "START_ROSPEC_RESPONSE",
+	EnableROSpecResponseHeader:          "ENABLE_ROSPEC_RESPONSE",
+	AddAccessSpecResponseHeader:         "ADD_ACCESSSPEC_RESPONSE",
+	DeleteAccessSpecResponseHeader:      "DELETE_ACCESSSPEC_RESPONSE",
+	EnableAccessSpecResponseHeader:      "ENABLE_ACCESSSPEC_RESPONSE",
+	llrp.ROAccessReportHeader:           "RO_ACCESS_REPORT",
+	llrp.KeepaliveHeader:                "KEEP_ALIVE",
+	llrp.ReaderEventNotificationHeader:  "READER_EVENT_NOTIFICATION",
+	ErrorMessageHeader:                  "ERROR_MESSAGE",
+	CustomMessageHeader:                 "CUSTOM_MESSAGE",
+}
+
+// errStopDispatching stops reading the messages without an error
+var errStopDispatching = errors.New("stop dispatching")
+
+// MessageHandler handles the body of an LLRP message,
+// returning an error drops the connection
+type MessageHandler func(messageID uint32, body []byte) error
+
+// Dispatcher routes the LLRP messages to the registered MessageHandlers
+type Dispatcher struct {
+	name     string
+	handlers map[uint16]MessageHandler
+}
+
+// NewDispatcher returns the pointer to a new Dispatcher instance
+// with the default handlers for ERROR_MESSAGE and CUSTOM_MESSAGE,
+// name is used for logging
+func NewDispatcher(name string) *Dispatcher {
+	d := &Dispatcher{
+		name:     name,
+		handlers: make(map[uint16]MessageHandler),
+	}
+	d.Handle(ErrorMessageHeader, d.handleErrorMessage)
+	d.Handle(CustomMessageHeader, d.handleCustomMessage)
+	d.Handle(GetReaderCapabilitiesResponseHeader, d.handleResponse)
+	return d
+}
+
+// Dispatch calls the MessageHandler for the header,
+// the unsupported messages are logged and skipped
+func (d *Dispatcher) Dispatch(header uint16, messageID uint32, body []byte) error {
+	handler, ok := d.handlers[header]
+	if !ok {
+		log.Printf("[LLRP] %s >>> unsupported message type %v[%v], skipping", d.name, header&0x3ff, messageID)
+		return nil
+	}
+	log.Printf("[LLRP] %s >>> %s[%v]", d.name, MessageName(header), messageID)
+	return handler(messageID, body)
+}
+
+// Handle registers the MessageHandler for the header, replacing the existing one
+func (d *Dispatcher) Handle(header uint16, handler MessageHandler) {
+	d.handlers[header] = handler
+}
+
+// MessageName returns the name of the LLRP message type
+func MessageName(header uint16) string {
+	if name, ok := messageNames[header]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// handleCustomMessage logs the vendor of the CUSTOM_MESSAGE
+func (d *Dispatcher) handleCustomMessage(messageID uint32, body []byte) error {
+	if len(body) >= 5 {
+		log.Printf("[LLRP] %s: skipping CUSTOM_MESSAGE from vendor %v, subtype %v", d.name, binary.BigEndian.Uint32(body), body[4])
+	}
+	return nil
+}
+
+// handleErrorMessage logs the LLRPStatus in the ERROR_MESSAGE
+func (d *Dispatcher) handleErrorMessage(messageID uint32, body []byte) error {
+	log.Printf("[LLRP] %s: the reader reported an error: %v", d.name, UnmarshalLLRPStatus(body))
+	return nil
+}
+
+// handleResponse logs the LLRPStatus of the unsuccessful response
+func (d *Dispatcher) handleResponse(messageID uint32, body []byte) error {
+	if err := UnmarshalLLRPStatus(body); err != nil {
+		log.Printf("[LLRP] %s: %v", d.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package llrpclient
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	errHandler := errors.New("handler")
+	d := NewDispatcher("reader0")
+	d.Handle(AddROSpecResponseHeader, func(mid uint32, body []byte) error {
+		return errHandler
+	})
+
+	tests := []struct {
+		name    string
+		header  uint16
+		body    []byte
+		wantErr error
+	}{
+		{"Registered", AddROSpecResponseHeader, nil, errHandler},
+		{"ErrorMessage", ErrorMessageHeader, parameter(llrpStatusType, uint16Bytes(109), uint16Bytes(0)), nil},
+		{"MalformedErrorMessage", ErrorMessageHeader, nil, nil},
+		{"CustomMessage", CustomMessageHeader, []byte{0, 0, 0x6a, 0xd7, 1}, nil},
+		{"GetReaderCapabilitiesResponse", GetReaderCapabilitiesResponseHeader, parameter(llrpStatusType, uint16Bytes(0), uint16Bytes(0)), nil},
+		{"Unsupported", 1024 + 999, []byte{1, 2, 3}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := d.Dispatch(tt.header, 1, tt.body); err != tt.wantErr {
+				t.Errorf("Dispatcher.Dispatch() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMessageName(t *testing.T) {
+	tests := []struct {
+		header uint16
+		want   string
+	}{
+		{ErrorMessageHeader, "ERROR_MESSAGE"},
+		{AddROSpecResponseHeader, "ADD_ROSPEC_RESPONSE"},
+		{1024 + 999, "UNKNOWN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := MessageName(tt.header); got != tt.want {
+				t.Errorf("MessageName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
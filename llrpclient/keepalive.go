@@ -0,0 +1,110 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package llrpclient
+
+import (
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/iomz/go-llrp"
+)
+
+// Health of the reader supervised by the keepalives
+const (
+	// HealthUnknown is when the keepalives are not supervised
+	HealthUnknown = "unknown"
+	// HealthHealthy is when the keepalives arrive in time
+	HealthHealthy = "healthy"
+	// HealthLate is when some keepalives are missing
+	HealthLate = "late"
+	// HealthDead is when the connection is dropped by the watchdog
+	HealthDead = "dead"
+)
+
+// DefaultKeepaliveMisses is used when KeepaliveMisses is not positive
+const DefaultKeepaliveMisses = 3
+
+// LLRP parameter type and field value for KeepaliveSpec
+const (
+	keepaliveSpecType          = 220
+	keepaliveTriggerPeriodic   = 1
+	setReaderConfigDefaultsOff = 0
+)
+
+// ErrKeepaliveTimeout is returned by Serve when the watchdog drops the connection
+var ErrKeepaliveTimeout = errors.New("llrpclient: keepalive timeout")
+
+// SetReaderConfig returns a SET_READER_CONFIG message with KeepaliveSpec,
+// the reader sends KEEP_ALIVE every period
+func SetReaderConfig(messageID uint32, period time.Duration) []byte {
+	return message(llrp.SetReaderConfigHeader, messageID,
+		[]byte{setReaderConfigDefaultsOff},
+		parameter(keepaliveSpecType,
+			[]byte{keepaliveTriggerPeriodic},
+			uint32Bytes(uint32(period/time.Millisecond))))
+}
+
+// Health returns the health of the reader
+func (c *Client) Health() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.health
+}
+
+// MissedKeepalives returns the number of the keepalive periods passed
+// since the last KEEP_ALIVE, 0 if the keepalives are not supervised
+func (c *Client) MissedKeepalives() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.missedKeepalives()
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// missedKeepalives returns the number of the missed keepalives,
+// the caller must hold the mutex
+func (c *Client) missedKeepalives() int {
+	if c.KeepalivePeriod <= 0 || c.conn == nil {
+		return 0
+	}
+	return int(time.Since(c.lastKeepalive) / c.KeepalivePeriod)
+}
+
+// watchdog drops the connection when the keepalives are missing
+// for KeepaliveMisses periods, until stop is closed
+func (c *Client) watchdog(conn net.Conn, stop <-chan struct{}) {
+	misses := c.KeepaliveMisses
+	if misses <= 0 {
+		misses = DefaultKeepaliveMisses
+	}
+	ticker := time.NewTicker(c.KeepalivePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		c.mutex.Lock()
+		missed := c.missedKeepalives()
+		switch {
+		case missed >= misses:
+			c.health = HealthDead
+		case missed > 0:
+			c.health = HealthLate
+		default:
+			c.health = HealthHealthy
+		}
+		c.mutex.Unlock()
+		if missed >= misses {
+			log.Printf("[LLRPClient] %s: missed %v keepalives, dropping the connection", c.Name, missed)
+			conn.Close()
+			return
+		}
+	}
+}
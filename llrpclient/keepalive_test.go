@@ -0,0 +1,67 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package llrpclient
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/iomz/go-llrp"
+)
+
+func TestSetReaderConfig(t *testing.T) {
+	want := "0403000000140000000100" + "00dc00090100002710"
+	if got := hex.EncodeToString(SetReaderConfig(1, 10*time.Second)); got != want {
+		t.Errorf("SetReaderConfig() = %v, want %v", got, want)
+	}
+}
+
+func TestClient_watchdog(t *testing.T) {
+	c := NewClient("reader0", 1)
+	c.KeepalivePeriod = 20 * time.Millisecond
+	c.KeepaliveMisses = 3
+	if got := c.Health(); got != HealthUnknown {
+		t.Errorf("Client.Health() = %v before connecting, want %v", got, HealthUnknown)
+	}
+	reader, errc := serve(c)
+	defer reader.Close()
+
+	// the keepalive period is pushed to the reader
+	reader.Write(readerEventNotification(1, ConnectionAttemptSuccess))
+	h, _, err := readMessage(reader)
+	if err != nil || h != llrp.SetReaderConfigHeader {
+		t.Fatalf("got (%v, %v), want SET_READER_CONFIG", h, err)
+	}
+
+	// the connection stays while the keepalives arrive
+	for i := 0; i < 10; i++ {
+		reader.Write(llrp.Keepalive(uint32(i)))
+		if _, _, err := readMessage(reader); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := c.Health(); got != HealthHealthy {
+		t.Errorf("Client.Health() = %v while receiving keepalives, want %v", got, HealthHealthy)
+	}
+
+	// the connection is dropped when the keepalives stop
+	select {
+	case err := <-errc:
+		if err != ErrKeepaliveTimeout {
+			t.Errorf("Client.Serve() = %v, want %v", err, ErrKeepaliveTimeout)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the watchdog didn't drop the connection")
+	}
+	if got := c.Health(); got != HealthDead {
+		t.Errorf("Client.Health() = %v after the timeout, want %v", got, HealthDead)
+	}
+	if got := c.MissedKeepalives(); got != 0 {
+		t.Errorf("Client.MissedKeepalives() = %v after disconnected, want 0", got)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package llrpclient
+
+// LLRP parameter types for the OpSpecs writing to the tags
+const (
+	c1g2WriteType       = 342
+	c1g2KillType        = 343
+	c1g2LockType        = 344
+	c1g2LockPayloadType = 345
+)
+
+// LLRP field values for the AccessSpecs of the OpSpecs
+const (
+	accessSpecStopTriggerOperationCount = 1
+	// the access results are reported at the end of the AccessSpec
+	accessReportTriggerEndOfAccessSpec = 1
+)
+
+// Privileges of C1G2LockPayload
+const (
+	LockReadWrite   = 0
+	LockPermalock   = 1
+	LockPermaunlock = 2
+	LockUnlock      = 3
+)
+
+// DataFields of C1G2LockPayload
+const (
+	LockKillPassword   = 0
+	LockAccessPassword = 1
+	LockEPC            = 2
+	LockTID            = 3
+	LockUser           = 4
+)
+
+// TargetTag selects the tags by the bits in a memory bank for the AccessSpec
+type TargetTag struct {
+	Bank byte
+	// Match selects the tags matching the bits, or the tags not matching them if false
+	Match bool
+	// Pointer is the first bit in the bank to compare
+	Pointer uint16
+	// Bits is the number of the bits in Mask and Data, aligned to the left of the bytes
+	Bits uint16
+	Mask []byte
+	Data []byte
+}
+
+// AddOpSpecAccessSpec returns an ADD_ACCESSSPEC message to execute the OpSpecs on the tags matching
+// all the TargetTags, or any tag if none is given, inventoried by any ROSpec on any antenna,
+// the AccessSpec stops after operationCount tags if not 0 and reports at the end of the AccessSpec
+func AddOpSpecAccessSpec(messageID uint32, accessSpecID uint32, targets []TargetTag, operationCount uint16, opSpecs ...[]byte) []byte {
+	stopTrigger := parameter(accessSpecStopTriggerType, []byte{accessSpecStopTriggerNull}, uint16Bytes(0))
+	if operationCount != 0 {
+		stopTrigger = parameter(accessSpecStopTriggerType, []byte{accessSpecStopTriggerOperationCount}, uint16Bytes(operationCount))
+	}
+	return message(AddAccessSpecHeader, messageID, parameter(accessSpecType,
+		uint32Bytes(accessSpecID),
+		uint16Bytes(0),                         // all the antennas
+		[]byte{protocolEPCGlobalClass1Gen2, 0}, // CurrentState: Disabled
+		uint32Bytes(0),                         // any ROSpec
+		stopTrigger,
+		parameter(accessCommandType, append([][]byte{c1g2TagSpec(targets)}, opSpecs...)...),
+		parameter(accessReportSpecType, []byte{accessReportTriggerEndOfAccessSpec})))
+}
+
+// C1G2Write returns a C1G2Write OpSpec writing the data from the word in the bank,
+// the data is padded with zero to the words
+func C1G2Write(opSpecID uint16, accessPassword uint32, bank byte, wordPointer uint16, data []byte) []byte {
+	if len(data)%2 != 0 {
+		data = append(append([]byte{}, data...), 0)
+	}
+	return parameter(c1g2WriteType,
+		uint16Bytes(opSpecID),
+		uint32Bytes(accessPassword),
+		[]byte{bank << 6},
+		uint16Bytes(wordPointer),
+		uint16Bytes(uint16(len(data)/2)),
+		data)
+}
+
+// C1G2Kill returns a C1G2Kill OpSpec with the kill password
+func C1G2Kill(opSpecID uint16, killPassword uint32) []byte {
+	return parameter(c1g2KillType,
+		uint16Bytes(opSpecID),
+		uint32Bytes(killPassword))
+}
+
+// C1G2Lock returns a C1G2Lock OpSpec applying the privilege to the data field
+func C1G2Lock(opSpecID uint16, accessPassword uint32, privilege byte, dataField byte) []byte {
+	return parameter(c1g2LockType,
+		uint16Bytes(opSpecID),
+		uint32Bytes(accessPassword),
+		parameter(c1g2LockPayloadType, []byte{privilege, dataField}))
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// c1g2TagSpec returns a C1G2TagSpec with the TargetTags,
+// a TargetTag without mask and data in the EPC bank matches any tag
+func c1g2TagSpec(targets []TargetTag) []byte {
+	if len(targets) == 0 {
+		targets = []TargetTag{{Bank: epcBank, Match: true}}
+	}
+	params := [][]byte{}
+	for _, tt := range targets {
+		mbm := tt.Bank << 6
+		if tt.Match {
+			mbm |= 0x20
+		}
+		params = append(params, parameter(c1g2TargetTagType,
+			[]byte{mbm},
+			uint16Bytes(tt.Pointer),
+			uint16Bytes(tt.Bits), tt.Mask,
+			uint16Bytes(tt.Bits), tt.Data))
+	}
+	return parameter(c1g2TagSpecType, params...)
+}
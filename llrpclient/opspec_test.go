@@ -0,0 +1,47 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package llrpclient
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestAddOpSpecAccessSpec(t *testing.T) {
+	targets := []TargetTag{{Bank: 1, Match: true, Pointer: 32, Bits: 8, Mask: []byte{0xff}, Data: []byte{0x30}}}
+	got := hex.EncodeToString(AddOpSpecAccessSpec(10, 0x80000001, targets, 1,
+		C1G2Write(1, 0, 1, 2, []byte{0x30, 0x74}),
+		C1G2Kill(2, 0x12345678)))
+	want := "042800000056" + "0000000a" + // ADD_ACCESSSPEC
+		"00cf004c" + "80000001" + "0000" + "01" + "00" + "00000000" + // AccessSpec
+		"00d00007" + "01" + "0001" + // AccessSpecStopTrigger
+		"00d10030" + "01520011" + "0153000d" + "60" + "0020" + "0008" + "ff" + "0008" + "30" + // AccessCommand, C1G2TagSpec
+		"01560011" + "0001" + "00000000" + "40" + "0002" + "0001" + "3074" + // C1G2Write
+		"0157000a" + "0002" + "12345678" + // C1G2Kill
+		"00ef000501" // AccessReportSpec
+	if got != want {
+		t.Errorf("AddOpSpecAccessSpec() = %v, want %v", got, want)
+	}
+}
+
+func TestOpSpecs(t *testing.T) {
+	tests := []struct {
+		name   string
+		opSpec []byte
+		want   string
+	}{
+		{"WritePadded", C1G2Write(4, 0, 3, 0, []byte{0xab}), "01560011" + "0004" + "00000000" + "c0" + "0000" + "0001" + "ab00"},
+		{"Kill", C1G2Kill(5, 1), "0157000a" + "0005" + "00000001"},
+		{"Lock", C1G2Lock(3, 0xaabbccdd, LockPermalock, LockEPC), "01580010" + "0003" + "aabbccdd" + "01590006" + "0102"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(tt.opSpec); got != tt.want {
+				t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,454 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package llrpclient
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// LLRP message headers for the ROSpec lifecycle
+const (
+	AddROSpecHeader            = 1044
+	DeleteROSpecHeader         = 1045
+	StartROSpecHeader          = 1046
+	EnableROSpecHeader         = 1048
+	AddROSpecResponseHeader    = 1054
+	DeleteROSpecResponseHeader = 1055
+	StartROSpecResponseHeader  = 1056
+	EnableROSpecResponseHeader = 1058
+)
+
+// LLRP message headers for the AccessSpec lifecycle
+const (
+	AddAccessSpecHeader            = 1064
+	DeleteAccessSpecHeader         = 1065
+	EnableAccessSpecHeader         = 1066
+	AddAccessSpecResponseHeader    = 1074
+	DeleteAccessSpecResponseHeader = 1075
+	EnableAccessSpecResponseHeader = 1076
+)
+
+// LLRP parameter types for the ROSpec
+const (
+	rospecType                   = 177
+	roBoundarySpecType           = 178
+	rospecStartTriggerType       = 179
+	periodicTriggerValueType     = 180
+	rospecStopTriggerType        = 182
+	aiSpecType                   = 183
+	aiSpecStopTriggerType        = 184
+	inventoryParameterSpecType   = 186
+	accessSpecType               = 207
+	accessSpecStopTriggerType    = 208
+	accessCommandType            = 209
+	roReportSpecType             = 237
+	tagReportContentSelectorType = 238
+	accessReportSpecType         = 239
+	llrpStatusType               = 287
+	fieldErrorType               = 288
+	parameterErrorType           = 289
+	c1g2TagSpecType              = 338
+	c1g2TargetTagType            = 339
+	c1g2ReadType                 = 341
+	c1g2EPCMemorySelectorType    = 348
+)
+
+// LLRP field values for the ROSpec
+const (
+	rospecStartTriggerNull      = 0
+	rospecStartTriggerPeriodic  = 2
+	rospecStopTriggerNull       = 0
+	rospecStopTriggerDuration   = 1
+	aiSpecStopTriggerNull       = 0
+	protocolEPCGlobalClass1Gen2 = 1
+	// upon N TagReportData parameters or end of ROSpec
+	roReportTriggerNOrEndOfROSpec = 2
+	statusSuccess                 = 0
+	accessSpecStopTriggerNull     = 0
+	// the access results are reported with the tags in the ROReport
+	accessReportTriggerROReport = 0
+	// the memory banks of C1G2
+	epcBank  = 1
+	tidBank  = 2
+	userBank = 3
+	// the OpSpecIDs of the C1G2Read in the AccessSpec
+	tidOpSpecID  = 1
+	userOpSpecID = 2
+)
+
+// ROSpecConfig is the declarative configuration of the ROSpec for a reader
+type ROSpecConfig struct {
+	// ROSpecID must not be 0
+	ROSpecID uint32 `json:"rospecID"`
+	Priority uint8  `json:"priority"`
+	// Antennas to inventory, all the antennas if empty
+	Antennas []uint16 `json:"antennas"`
+	// PeriodMs restarts the ROSpec periodically if not 0
+	PeriodMs uint32 `json:"periodMs"`
+	// DurationMs stops the ROSpec after the duration if not 0
+	DurationMs uint32 `json:"durationMs"`
+	// ReportEveryNTags reports every N tags, at the end of the ROSpec if 0 with DurationMs
+	ReportEveryNTags uint16           `json:"reportEveryNTags"`
+	ReportContent    TagReportContent `json:"reportContent"`
+	// TIDWords and UserWords read the words from the beginning of the banks with an AccessSpec if not 0
+	TIDWords  uint16 `json:"tidWords"`
+	UserWords uint16 `json:"userWords"`
+}
+
+// TagReportContent selects the fields in TagReportData
+type TagReportContent struct {
+	ROSpecID                 bool `json:"rospecID"`
+	SpecIndex                bool `json:"specIndex"`
+	InventoryParameterSpecID bool `json:"inventoryParameterSpecID"`
+	AntennaID                bool `json:"antennaID"`
+	ChannelIndex             bool `json:"channelIndex"`
+	PeakRSSI                 bool `json:"peakRSSI"`
+	FirstSeenTimestamp       bool `json:"firstSeenTimestamp"`
+	LastSeenTimestamp        bool `json:"lastSeenTimestamp"`
+	TagSeenCount             bool `json:"tagSeenCount"`
+	AccessSpecID             bool `json:"accessSpecID"`
+}
+
+// Validate checks the ROSpecConfig, and sets ReportEveryNTags to 1
+// if the ROSpec has no duration to report at the end
+func (rc *ROSpecConfig) Validate() error {
+	if rc.ROSpecID == 0 {
+		return fmt.Errorf("rospecID must not be 0")
+	}
+	for _, a := range rc.Antennas {
+		if a == 0 {
+			return fmt.Errorf("antenna ID must not be 0, leave antennas empty for all the antennas")
+		}
+	}
+	if rc.DurationMs == 0 && rc.ReportEveryNTags == 0 {
+		rc.ReportEveryNTags = 1
+	}
+	return nil
+}
+
+// statusNames is used for logging the LLRPStatus codes
+var statusNames = map[uint16]string{
+	0:   "M_Success",
+	100: "M_ParameterError",
+	101: "M_FieldError",
+	102: "M_UnexpectedParameter",
+	103: "M_MissingParameter",
+	104: "M_DuplicateParameter",
+	105: "M_OverflowParameter",
+	106: "M_OverflowField",
+	107: "M_UnknownParameter",
+	108: "M_UnknownField",
+	109: "M_UnsupportedMessage",
+	110: "M_UnsupportedVersion",
+	111: "M_UnsupportedParameter",
+	200: "P_ParameterError",
+	201: "P_FieldError",
+	202: "P_UnexpectedParameter",
+	203: "P_MissingParameter",
+	204: "P_DuplicateParameter",
+	205: "P_OverflowParameter",
+	206: "P_OverflowField",
+	207: "P_UnknownParameter",
+	208: "P_UnknownField",
+	209: "P_UnsupportedParameter",
+	300: "A_Invalid",
+	301: "A_OutOfRange",
+	401: "R_DeviceError",
+}
+
+// LLRPStatusError is the LLRPStatus of an unsuccessful response
+type LLRPStatusError struct {
+	StatusCode       uint16
+	ErrorDescription string
+	FieldError       *FieldError
+	ParameterError   *ParameterError
+}
+
+func (e *LLRPStatusError) Error() string {
+	msg := "LLRPStatus " + statusName(e.StatusCode)
+	if len(e.ErrorDescription) != 0 {
+		msg += ": " + e.ErrorDescription
+	}
+	if e.FieldError != nil {
+		msg += fmt.Sprintf(" (%v)", e.FieldError)
+	}
+	if e.ParameterError != nil {
+		msg += fmt.Sprintf(" (%v)", e.ParameterError)
+	}
+	return msg
+}
+
+// FieldError locates the erroneous field in the message or the parameter
+type FieldError struct {
+	FieldNum  uint16
+	ErrorCode uint16
+}
+
+func (e *FieldError) String() string {
+	return fmt.Sprintf("field %v: %s", e.FieldNum, statusName(e.ErrorCode))
+}
+
+// ParameterError locates the erroneous parameter in the message or the parameter
+type ParameterError struct {
+	ParameterType  uint16
+	ErrorCode      uint16
+	FieldError     *FieldError
+	ParameterError *ParameterError
+}
+
+func (e *ParameterError) String() string {
+	msg := fmt.Sprintf("parameter %v: %s", e.ParameterType, statusName(e.ErrorCode))
+	if e.FieldError != nil {
+		msg += fmt.Sprintf(", %v", e.FieldError)
+	}
+	if e.ParameterError != nil {
+		msg += fmt.Sprintf(", %v", e.ParameterError)
+	}
+	return msg
+}
+
+// AddROSpec returns an ADD_ROSPEC message for the ROSpecConfig
+func AddROSpec(messageID uint32, rc *ROSpecConfig) []byte {
+	// ROSpecStartTrigger
+	startTrigger := parameter(rospecStartTriggerType, []byte{rospecStartTriggerNull})
+	if rc.PeriodMs != 0 {
+		startTrigger = parameter(rospecStartTriggerType, []byte{rospecStartTriggerPeriodic},
+			parameter(periodicTriggerValueType, uint32Bytes(0), uint32Bytes(rc.PeriodMs)))
+	}
+	// ROSpecStopTrigger
+	stopTrigger := parameter(rospecStopTriggerType, []byte{rospecStopTriggerNull}, uint32Bytes(0))
+	if rc.DurationMs != 0 {
+		stopTrigger = parameter(rospecStopTriggerType, []byte{rospecStopTriggerDuration}, uint32Bytes(rc.DurationMs))
+	}
+	// AISpec
+	antennas := rc.Antennas
+	if len(antennas) == 0 {
+		antennas = []uint16{0}
+	}
+	antennaIDs := uint16Bytes(uint16(len(antennas)))
+	for _, a := range antennas {
+		antennaIDs = append(antennaIDs, uint16Bytes(a)...)
+	}
+	aiSpec := parameter(aiSpecType,
+		antennaIDs,
+		parameter(aiSpecStopTriggerType, []byte{aiSpecStopTriggerNull}, uint32Bytes(0)),
+		parameter(inventoryParameterSpecType, uint16Bytes(1), []byte{protocolEPCGlobalClass1Gen2}))
+	// ROReportSpec
+	roReportSpec := parameter(roReportSpecType,
+		[]byte{roReportTriggerNOrEndOfROSpec},
+		uint16Bytes(rc.ReportEveryNTags),
+		parameter(tagReportContentSelectorType,
+			uint16Bytes(rc.ReportContent.bits()),
+			// PC bits are required for filtering
+			parameter(c1g2EPCMemorySelectorType, []byte{0x40})))
+
+	return message(AddROSpecHeader, messageID, parameter(rospecType,
+		uint32Bytes(rc.ROSpecID),
+		[]byte{rc.Priority, 0}, // CurrentState: Disabled
+		parameter(roBoundarySpecType, startTrigger, stopTrigger),
+		aiSpec,
+		roReportSpec))
+}
+
+// AddAccessSpec returns an ADD_ACCESSSPEC message to read the TID and the user memory
+// of all the tags inventoried by the ROSpec, the AccessSpecID is the same as the ROSpecID
+func AddAccessSpec(messageID uint32, rc *ROSpecConfig) []byte {
+	// C1G2TagSpec matching any tag
+	accessCommand := [][]byte{c1g2TagSpec(nil)}
+	if rc.TIDWords != 0 {
+		accessCommand = append(accessCommand, c1g2Read(tidOpSpecID, tidBank, rc.TIDWords))
+	}
+	if rc.UserWords != 0 {
+		accessCommand = append(accessCommand, c1g2Read(userOpSpecID, userBank, rc.UserWords))
+	}
+
+	return message(AddAccessSpecHeader, messageID, parameter(accessSpecType,
+		uint32Bytes(rc.ROSpecID),
+		uint16Bytes(0),                         // all the antennas
+		[]byte{protocolEPCGlobalClass1Gen2, 0}, // CurrentState: Disabled
+		uint32Bytes(rc.ROSpecID),
+		parameter(accessSpecStopTriggerType, []byte{accessSpecStopTriggerNull}, uint16Bytes(0)),
+		parameter(accessCommandType, accessCommand...),
+		parameter(accessReportSpecType, []byte{accessReportTriggerROReport})))
+}
+
+// DeleteAccessSpec returns a DELETE_ACCESSSPEC message, 0 deletes all the AccessSpecs
+func DeleteAccessSpec(messageID uint32, accessSpecID uint32) []byte {
+	return message(DeleteAccessSpecHeader, messageID, uint32Bytes(accessSpecID))
+}
+
+// EnableAccessSpec returns an ENABLE_ACCESSSPEC message
+func EnableAccessSpec(messageID uint32, accessSpecID uint32) []byte {
+	return message(EnableAccessSpecHeader, messageID, uint32Bytes(accessSpecID))
+}
+
+// DeleteROSpec returns a DELETE_ROSPEC message, 0 deletes all the ROSpecs
+func DeleteROSpec(messageID uint32, rospecID uint32) []byte {
+	return message(DeleteROSpecHeader, messageID, uint32Bytes(rospecID))
+}
+
+// EnableROSpec returns an ENABLE_ROSPEC message
+func EnableROSpec(messageID uint32, rospecID uint32) []byte {
+	return message(EnableROSpecHeader, messageID, uint32Bytes(rospecID))
+}
+
+// StartROSpec returns a START_ROSPEC message
+func StartROSpec(messageID uint32, rospecID uint32) []byte {
+	return message(StartROSpecHeader, messageID, uint32Bytes(rospecID))
+}
+
+// UnmarshalLLRPStatus returns the LLRPStatusError in the response body,
+// nil if the status is success
+func UnmarshalLLRPStatus(body []byte) error {
+	if len(body) < 8 || binary.BigEndian.Uint16(body)&0x3ff != llrpStatusType {
+		return fmt.Errorf("no LLRPStatus in the response")
+	}
+	l := int(binary.BigEndian.Uint16(body[2:]))
+	if l < 8 || l > len(body) {
+		return fmt.Errorf("malformed LLRPStatus in the response")
+	}
+	code := binary.BigEndian.Uint16(body[4:])
+	if code == statusSuccess {
+		return nil
+	}
+	se := &LLRPStatusError{StatusCode: code}
+	dl := int(binary.BigEndian.Uint16(body[6:]))
+	if 8+dl > l {
+		return se
+	}
+	se.ErrorDescription = string(body[8 : 8+dl])
+	se.FieldError, se.ParameterError = unmarshalErrorParameters(body[8+dl : l])
+	return se
+}
+
+// LoadROSpecsFromJSONFile reads the ROSpecConfigs keyed by the reader names,
+// the ROSpecConfig for "default" is used for the other readers
+func LoadROSpecsFromJSONFile(f string) (map[string]*ROSpecConfig, error) {
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	rospecs := make(map[string]*ROSpecConfig)
+	if err := json.Unmarshal(data, &rospecs); err != nil {
+		return nil, err
+	}
+	for name, rc := range rospecs {
+		if err := rc.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid ROSpec for %s: %v", name, err)
+		}
+	}
+	return rospecs, nil
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// readsMemory returns true if the ROSpecConfig needs an AccessSpec to read the memory banks
+func (rc *ROSpecConfig) readsMemory() bool {
+	return rc.TIDWords != 0 || rc.UserWords != 0
+}
+
+// bits returns the TagReportContentSelector flags
+func (trc TagReportContent) bits() uint16 {
+	var b uint16
+	for i, enabled := range []bool{
+		trc.ROSpecID,
+		trc.SpecIndex,
+		trc.InventoryParameterSpecID,
+		trc.AntennaID,
+		trc.ChannelIndex,
+		trc.PeakRSSI,
+		trc.FirstSeenTimestamp,
+		trc.LastSeenTimestamp,
+		trc.TagSeenCount,
+		trc.AccessSpecID,
+	} {
+		if enabled {
+			b |= 1 << uint(15-i)
+		}
+	}
+	return b
+}
+
+// statusName returns the name of the LLRPStatus code
+func statusName(code uint16) string {
+	if name, ok := statusNames[code]; ok {
+		return fmt.Sprintf("%s(%v)", name, code)
+	}
+	return fmt.Sprintf("%v", code)
+}
+
+// unmarshalErrorParameters returns the FieldError and the ParameterError in b
+func unmarshalErrorParameters(b []byte) (fe *FieldError, pe *ParameterError) {
+	for len(b) >= 8 {
+		t := binary.BigEndian.Uint16(b) & 0x3ff
+		l := int(binary.BigEndian.Uint16(b[2:]))
+		if l < 8 || l > len(b) {
+			return
+		}
+		switch t {
+		case fieldErrorType:
+			fe = &FieldError{binary.BigEndian.Uint16(b[4:]), binary.BigEndian.Uint16(b[6:])}
+		case parameterErrorType:
+			pe = &ParameterError{
+				ParameterType: binary.BigEndian.Uint16(b[4:]),
+				ErrorCode:     binary.BigEndian.Uint16(b[6:]),
+			}
+			pe.FieldError, pe.ParameterError = unmarshalErrorParameters(b[8:l])
+		}
+		b = b[l:]
+	}
+	return
+}
+
+// c1g2Read returns a C1G2Read OpSpec reading the words from the beginning of the bank
+func c1g2Read(opSpecID uint16, bank byte, words uint16) []byte {
+	return parameter(c1g2ReadType,
+		uint16Bytes(opSpecID),
+		uint32Bytes(0), // AccessPassword
+		[]byte{bank << 6},
+		uint16Bytes(0), // WordPointer
+		uint16Bytes(words))
+}
+
+// message returns an LLRP message with the body
+func message(header uint16, messageID uint32, body ...[]byte) []byte {
+	b := make([]byte, 10)
+	for _, v := range body {
+		b = append(b, v...)
+	}
+	binary.BigEndian.PutUint16(b, header)
+	binary.BigEndian.PutUint32(b[2:], uint32(len(b)))
+	binary.BigEndian.PutUint32(b[6:], messageID)
+	return b
+}
+
+// parameter returns a TLV parameter with the fields
+func parameter(t uint16, fields ...[]byte) []byte {
+	b := make([]byte, 4)
+	for _, v := range fields {
+		b = append(b, v...)
+	}
+	binary.BigEndian.PutUint16(b, t)
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+	return b
+}
+
+// uint16Bytes returns v in big endian
+func uint16Bytes(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+// uint32Bytes returns v in big endian
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
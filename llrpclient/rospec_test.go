@@ -0,0 +1,179 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package llrpclient
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestAddROSpec(t *testing.T) {
+	tests := []struct {
+		name string
+		rc   *ROSpecConfig
+		want string
+	}{
+		{
+			"AntennasDurationReportContent",
+			&ROSpecConfig{
+				ROSpecID:         1,
+				Antennas:         []uint16{1, 2},
+				DurationMs:       500,
+				ReportEveryNTags: 1,
+				ReportContent:    TagReportContent{AntennaID: true, PeakRSSI: true},
+			},
+			"0414000000520000000a" + // ADD_ROSPEC
+				"00b100480000000100" + "00" + // ROSpec
+				"00b20012" + "00b3000500" + "00b6000901000001f4" + // ROBoundarySpec
+				"00b7001a" + "000200010002" + "00b8000900" + "00000000" + "00ba0007000101" + // AISpec
+				"00ed0012" + "02" + "0001" + "00ee000b" + "1400" + "015c000540", // ROReportSpec
+		},
+		{
+			"Periodic",
+			&ROSpecConfig{ROSpecID: 2, Priority: 1, PeriodMs: 1000},
+			"04140000005c0000000a" +
+				"00b100520000000201" + "00" +
+				"00b2001e" + "00b3001102" + "00b4000c00000000000003e8" + "00b6000900" + "00000000" +
+				"00b70018" + "00010000" + "00b8000900" + "00000000" + "00ba0007000101" +
+				"00ed0012" + "02" + "0000" + "00ee000b" + "0000" + "015c000540",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(AddROSpec(10, tt.rc)); got != tt.want {
+				t.Errorf("AddROSpec() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddAccessSpec(t *testing.T) {
+	tests := []struct {
+		name string
+		rc   *ROSpecConfig
+		want string
+	}{
+		{
+			"TIDAndUser",
+			&ROSpecConfig{ROSpecID: 1, TIDWords: 6, UserWords: 4},
+			"042800000057" + "0000000a" + // ADD_ACCESSSPEC
+				"00cf004d" + "00000001" + "0000" + "01" + "00" + "00000001" + // AccessSpec
+				"00d00007" + "00" + "0000" + // AccessSpecStopTrigger
+				"00d10031" + "0152000f" + "0153000b" + "60" + "0000" + "0000" + "0000" + // AccessCommand, C1G2TagSpec
+				"0155000f" + "0001" + "00000000" + "80" + "0000" + "0006" + // C1G2Read TID
+				"0155000f" + "0002" + "00000000" + "c0" + "0000" + "0004" + // C1G2Read User
+				"00ef000500", // AccessReportSpec
+		},
+		{
+			"TIDOnly",
+			&ROSpecConfig{ROSpecID: 2, TIDWords: 2},
+			"042800000048" + "0000000a" +
+				"00cf003e" + "00000002" + "0000" + "01" + "00" + "00000002" +
+				"00d00007" + "00" + "0000" +
+				"00d10022" + "0152000f" + "0153000b" + "60" + "0000" + "0000" + "0000" +
+				"0155000f" + "0001" + "00000000" + "80" + "0000" + "0002" +
+				"00ef000500",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(AddAccessSpec(10, tt.rc)); got != tt.want {
+				t.Errorf("AddAccessSpec() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalLLRPStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantErr  bool
+		wantCode uint16
+	}{
+		{"Success", "011f000800000000", false, 0},
+		{"Error", "011f000b00640003666f6f", true, 100},
+		{"NoLLRPStatus", "00b3000500", true, 0},
+		{"Malformed", "011f00ff00000000", true, 0},
+		{"Empty", "", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := hex.DecodeString(tt.body)
+			err := UnmarshalLLRPStatus(body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalLLRPStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if se, ok := err.(*LLRPStatusError); ok {
+				if se.StatusCode != tt.wantCode || se.ErrorDescription != "foo" {
+					t.Errorf("UnmarshalLLRPStatus() = %#v", se)
+				}
+			} else if tt.wantCode != 0 {
+				t.Errorf("UnmarshalLLRPStatus() = %v, want LLRPStatusError", err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalLLRPStatus_errorParameters(t *testing.T) {
+	// M_ParameterError in ROSpec (177) with A_OutOfRange in its field 1
+	body, _ := hex.DecodeString("011f0018" + "0064" + "0000" + "0121001000b10064" + "012000080001012d")
+	err := UnmarshalLLRPStatus(body)
+	want := "LLRPStatus M_ParameterError(100) (parameter 177: M_ParameterError(100), field 1: A_OutOfRange(301))"
+	if err == nil || err.Error() != want {
+		t.Errorf("UnmarshalLLRPStatus() = %v, want %v", err, want)
+	}
+}
+
+func Test_LoadROSpecsFromJSONFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    map[string]*ROSpecConfig
+		wantErr bool
+	}{
+		{
+			"Valid",
+			`{"default": {"rospecID": 1}, "dock-door-1": {"rospecID": 2, "antennas": [1], "reportContent": {"antennaID": true}}}`,
+			map[string]*ROSpecConfig{
+				"default":     {ROSpecID: 1, ReportEveryNTags: 1},
+				"dock-door-1": {ROSpecID: 2, Antennas: []uint16{1}, ReportEveryNTags: 1, ReportContent: TagReportContent{AntennaID: true}},
+			},
+			false,
+		},
+		{
+			"ReportAtEnd",
+			`{"default": {"rospecID": 1, "periodMs": 1000, "durationMs": 500}}`,
+			map[string]*ROSpecConfig{"default": {ROSpecID: 1, PeriodMs: 1000, DurationMs: 500}},
+			false,
+		},
+		{"ZeroROSpecID", `{"default": {"antennas": [1]}}`, nil, true},
+		{"ZeroAntenna", `{"default": {"rospecID": 1, "antennas": [0]}}`, nil, true},
+		{"InvalidJSON", `{"default": `, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "rospecs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			f.WriteString(tt.json)
+			f.Close()
+
+			got, err := LoadROSpecsFromJSONFile(f.Name())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadROSpecsFromJSONFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadROSpecsFromJSONFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
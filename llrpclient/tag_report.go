@@ -0,0 +1,212 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package llrpclient
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/iomz/go-llrp"
+)
+
+// LLRP parameter types in TagReportData
+const (
+	tagReportDataType         = 240
+	epcDataType               = 241
+	c1g2ReadOpSpecResultType  = 349
+	c1g2WriteOpSpecResultType = 350
+	c1g2KillOpSpecResultType  = 351
+	c1g2LockOpSpecResultType  = 352
+	c1g2ReadOpSpecResultOK    = 0
+	// TV parameters
+	antennaIDType             = 1
+	firstSeenTimestampUTCType = 2
+	lastSeenTimestampUTCType  = 4
+	peakRSSIType              = 6
+	tagSeenCountType          = 8
+	c1g2PCType                = 12
+	epc96Type                 = 13
+	accessSpecIDType          = 16
+)
+
+// Kinds of the OpSpecs in OpSpecResult
+const (
+	OpWrite = "write"
+	OpKill  = "kill"
+	OpLock  = "lock"
+)
+
+// tvLengths is the length of the TV parameters including the type octet
+var tvLengths = map[byte]int{
+	1:  3,  // AntennaID
+	2:  9,  // FirstSeenTimestampUTC
+	3:  9,  // FirstSeenTimestampUptime
+	4:  9,  // LastSeenTimestampUTC
+	5:  9,  // LastSeenTimestampUptime
+	6:  2,  // PeakRSSI
+	7:  3,  // ChannelIndex
+	8:  3,  // TagSeenCount
+	9:  5,  // ROSpecID
+	10: 3,  // InventoryParameterSpecID
+	11: 3,  // C1G2-CRC
+	12: 3,  // C1G2-PC
+	13: 13, // EPC-96
+	14: 3,  // SpecIndex
+	15: 3,  // ClientRequestOpSpecResult
+	16: 5,  // AccessSpecID
+	17: 3,  // OpSpecID
+	18: 5,  // C1G2SingulationDetails
+	19: 3,  // C1G2-XPCW1
+	20: 3,  // C1G2-XPCW2
+}
+
+// TagReport is a ReadEvent with the metadata in TagReportData,
+// the metadata not selected in the ROSpec are left zero
+type TagReport struct {
+	llrp.ReadEvent
+	AntennaID   uint16
+	PeakRSSI    int8
+	HasPeakRSSI bool
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	// SeenCount is 1 if TagSeenCount is not reported
+	SeenCount uint16
+	// TID and User are the words read by the AccessSpec from the beginning of the banks, nil if not read
+	TID  []byte
+	User []byte
+	// AccessSpecID is 0 if not reported
+	AccessSpecID uint32
+	// OpSpecResults are the results of the C1G2Write, C1G2Kill, and C1G2Lock OpSpecs on the tag
+	OpSpecResults []OpSpecResult
+}
+
+// OpSpecResult is the result of an OpSpec writing to a tag
+type OpSpecResult struct {
+	Kind     string
+	OpSpecID uint16
+	// Result is the LLRP result code of the kind, 0 for success
+	Result uint8
+	// NumWordsWritten is only reported for the writes
+	NumWordsWritten uint16
+}
+
+// UnmarshalROAccessReport returns the TagReports in the RO_ACCESS_REPORT body
+func UnmarshalROAccessReport(body []byte) []*TagReport {
+	reports := []*TagReport{}
+	for len(body) >= 4 {
+		t := binary.BigEndian.Uint16(body) & 0x3ff
+		l := int(binary.BigEndian.Uint16(body[2:]))
+		if body[0]&0x80 != 0 || l < 4 || l > len(body) {
+			break
+		}
+		if t == tagReportDataType {
+			if tr := unmarshalTagReportData(body[4:l]); tr != nil {
+				reports = append(reports, tr)
+			}
+		}
+		body = body[l:]
+	}
+	return reports
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// unmarshalTagReportData returns the TagReport in the TagReportData parameters,
+// nil if it has no EPC
+func unmarshalTagReportData(b []byte) *TagReport {
+	tr := &TagReport{SeenCount: 1}
+	for len(b) > 0 {
+		if b[0]&0x80 != 0 {
+			// TV parameter
+			t := b[0] & 0x7f
+			l, ok := tvLengths[t]
+			if !ok || l > len(b) {
+				break
+			}
+			v := b[1:l]
+			switch t {
+			case antennaIDType:
+				tr.AntennaID = binary.BigEndian.Uint16(v)
+			case firstSeenTimestampUTCType:
+				tr.FirstSeen = microseconds(binary.BigEndian.Uint64(v))
+			case lastSeenTimestampUTCType:
+				tr.LastSeen = microseconds(binary.BigEndian.Uint64(v))
+			case peakRSSIType:
+				tr.PeakRSSI = int8(v[0])
+				tr.HasPeakRSSI = true
+			case tagSeenCountType:
+				tr.SeenCount = binary.BigEndian.Uint16(v)
+			case c1g2PCType:
+				tr.PC = append([]byte{}, v...)
+			case epc96Type:
+				tr.ID = append([]byte{}, v...)
+			case accessSpecIDType:
+				tr.AccessSpecID = binary.BigEndian.Uint32(v)
+			}
+			b = b[l:]
+			continue
+		}
+		// TLV parameter
+		if len(b) < 4 {
+			break
+		}
+		t := binary.BigEndian.Uint16(b) & 0x3ff
+		l := int(binary.BigEndian.Uint16(b[2:]))
+		if l < 4 || l > len(b) {
+			break
+		}
+		switch {
+		case t == epcDataType && l >= 6:
+			bits := int(binary.BigEndian.Uint16(b[4:]))
+			if n := (bits + 7) / 8; 6+n <= l {
+				tr.ID = append([]byte{}, b[6:6+n]...)
+			}
+		case t == c1g2ReadOpSpecResultType && l >= 9 && b[4] == c1g2ReadOpSpecResultOK:
+			opSpecID := binary.BigEndian.Uint16(b[5:])
+			n := 2 * int(binary.BigEndian.Uint16(b[7:]))
+			if 9+n > l {
+				break
+			}
+			switch opSpecID {
+			case tidOpSpecID:
+				tr.TID = append([]byte{}, b[9:9+n]...)
+			case userOpSpecID:
+				tr.User = append([]byte{}, b[9:9+n]...)
+			}
+		case t == c1g2WriteOpSpecResultType && l >= 9:
+			tr.OpSpecResults = append(tr.OpSpecResults, OpSpecResult{
+				Kind:            OpWrite,
+				OpSpecID:        binary.BigEndian.Uint16(b[5:]),
+				Result:          b[4],
+				NumWordsWritten: binary.BigEndian.Uint16(b[7:]),
+			})
+		case (t == c1g2KillOpSpecResultType || t == c1g2LockOpSpecResultType) && l >= 7:
+			kind := OpKill
+			if t == c1g2LockOpSpecResultType {
+				kind = OpLock
+			}
+			tr.OpSpecResults = append(tr.OpSpecResults, OpSpecResult{
+				Kind:     kind,
+				OpSpecID: binary.BigEndian.Uint16(b[5:]),
+				Result:   b[4],
+			})
+		}
+		b = b[l:]
+	}
+	if len(tr.ID) == 0 {
+		return nil
+	}
+	if len(tr.PC) == 0 {
+		// the EPC length in words if the PC bits are not reported
+		tr.PC = []byte{byte(len(tr.ID) / 2 << 3), 0}
+	}
+	return tr
+}
+
+// microseconds returns the time of the LLRP UTC timestamp
+func microseconds(us uint64) time.Time {
+	return time.Unix(int64(us/1e6), int64(us%1e6)*1e3)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package llrpclient
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iomz/go-llrp"
+)
+
+func TestUnmarshalROAccessReport(t *testing.T) {
+	epc96 := "302db319a000004000000001"
+	epc, _ := hex.DecodeString(epc96)
+	tests := []struct {
+		name string
+		body string
+		want []*TagReport
+	}{
+		{
+			"EPC96WithMetadata",
+			"00f0002e" + // TagReportData
+				"8d" + epc96 + // EPC-96
+				"810002" + // AntennaID
+				"86c9" + // PeakRSSI
+				"82" + "0000000005f5e100" + // FirstSeenTimestampUTC
+				"84" + "000000000bebc200" + // LastSeenTimestampUTC
+				"880005" + // TagSeenCount
+				"8c3000", // C1G2-PC
+			[]*TagReport{{
+				ReadEvent:   llrp.ReadEvent{PC: []byte{0x30, 0}, ID: epc},
+				AntennaID:   2,
+				PeakRSSI:    -55,
+				HasPeakRSSI: true,
+				FirstSeen:   time.Unix(100, 0),
+				LastSeen:    time.Unix(200, 0),
+				SeenCount:   5,
+			}},
+		},
+		{
+			"SingulationDetailsBeforeEPC",
+			"00f00019" +
+				"9200010002" + // C1G2SingulationDetails
+				"8d" + epc96 + // EPC-96
+				"810002", // AntennaID
+			[]*TagReport{{ReadEvent: llrp.ReadEvent{PC: []byte{0x30, 0}, ID: epc}, AntennaID: 2, SeenCount: 1}},
+		},
+		{
+			"EPCDataWithoutPC",
+			"00f00016" + "00f10012" + "0060" + epc96,
+			[]*TagReport{{ReadEvent: llrp.ReadEvent{PC: []byte{0x30, 0}, ID: epc}, SeenCount: 1}},
+		},
+		{
+			"MultipleTags",
+			"00f00011" + "8d" + epc96 + "00f00011" + "8d" + epc96,
+			[]*TagReport{
+				{ReadEvent: llrp.ReadEvent{PC: []byte{0x30, 0}, ID: epc}, SeenCount: 1},
+				{ReadEvent: llrp.ReadEvent{PC: []byte{0x30, 0}, ID: epc}, SeenCount: 1},
+			},
+		},
+		{
+			"ReadOpSpecResults",
+			"00f00032" + "8d" + epc96 +
+				"015d000d" + "00" + "0001" + "0002" + "e2801105" + // C1G2ReadOpSpecResult TID
+				"015d000b" + "00" + "0002" + "0001" + "abcd" + // C1G2ReadOpSpecResult User
+				"015d0009" + "01" + "0001" + "0000", // failed
+			[]*TagReport{{
+				ReadEvent: llrp.ReadEvent{PC: []byte{0x30, 0}, ID: epc},
+				SeenCount: 1,
+				TID:       []byte{0xe2, 0x80, 0x11, 0x05},
+				User:      []byte{0xab, 0xcd},
+			}},
+		},
+		{
+			"WriteOpSpecResults",
+			"00f0002d" + "8d" + epc96 +
+				"9000000080" + // AccessSpecID
+				"015e0009" + "00" + "0101" + "0006" + // C1G2WriteOpSpecResult
+				"015f0007" + "03" + "0102" + // C1G2KillOpSpecResult
+				"01600007" + "00" + "0103", // C1G2LockOpSpecResult
+			[]*TagReport{{
+				ReadEvent:    llrp.ReadEvent{PC: []byte{0x30, 0}, ID: epc},
+				SeenCount:    1,
+				AccessSpecID: 128,
+				OpSpecResults: []OpSpecResult{
+					{Kind: OpWrite, OpSpecID: 257, Result: 0, NumWordsWritten: 6},
+					{Kind: OpKill, OpSpecID: 258, Result: 3},
+					{Kind: OpLock, OpSpecID: 259, Result: 0},
+				},
+			}},
+		},
+		{"NoEPC", "00f00007" + "810001", []*TagReport{}},
+		{"Truncated", "00f00020" + "8d" + epc96, []*TagReport{}},
+		{"Empty", "", []*TagReport{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := hex.DecodeString(tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := UnmarshalROAccessReport(body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnmarshalROAccessReport() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
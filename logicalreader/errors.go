@@ -0,0 +1,45 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package logicalreader
+
+import "fmt"
+
+// DuplicateNameError is returned when the logical reader is already defined
+type DuplicateNameError struct {
+	Name string
+}
+
+func (e *DuplicateNameError) Error() string {
+	return fmt.Sprintf("duplicate logical reader name: %s", e.Name)
+}
+
+// NoSuchNameError is returned when the logical reader is not defined
+type NoSuchNameError struct {
+	Name string
+}
+
+func (e *NoSuchNameError) Error() string {
+	return fmt.Sprintf("no such logical reader: %s", e.Name)
+}
+
+// InUseError is returned when the logical reader is in a composite reader or used in the specs
+type InUseError struct {
+	Name string
+	User string
+}
+
+func (e *InUseError) Error() string {
+	return fmt.Sprintf("%s is in use by %s", e.Name, e.User)
+}
+
+// ValidationError is returned when the Spec is invalid
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Reason
+}
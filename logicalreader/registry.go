@@ -0,0 +1,301 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package logicalreader defines the logical readers made from the physical readers and antennas
+package logicalreader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"sort"
+	"sync"
+)
+
+// Spec specifies a logical reader, either a composite of the other logical readers
+// or a base reader made from the antennas of a physical reader
+type Spec struct {
+	IsComposite bool `json:"isComposite"`
+	// Readers are the logical readers in a composite reader
+	Readers []string `json:"readers,omitempty"`
+	// PhysicalReader is the name of the LLRP reader of a base reader
+	PhysicalReader string `json:"physicalReader,omitempty"`
+	// Antennas are the antenna IDs of a base reader, all the antennas if empty
+	Antennas []uint16 `json:"antennas,omitempty"`
+}
+
+// InUse returns true if the logical reader is used in any spec
+type InUse func(name string) bool
+
+// PhysicalReader returns true if the name is a physical reader
+type PhysicalReader func(name string) bool
+
+// Registry holds the logical reader definitions,
+// a name not defined refers to the physical reader of the name
+type Registry struct {
+	mutex    sync.RWMutex
+	specs    map[string]*Spec
+	inUse    InUse
+	physical PhysicalReader
+}
+
+// NewRegistry returns the pointer to a new Registry instance
+func NewRegistry() *Registry {
+	return &Registry{
+		specs: make(map[string]*Spec),
+	}
+}
+
+// LoadSpecsFromJSONFile takes a JSON file name and returns the Specs keyed by the logical reader name
+func LoadSpecsFromJSONFile(f string) (map[string]*Spec, error) {
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	specs := map[string]*Spec{}
+	if err = json.Unmarshal(data, &specs); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// Contains returns true if a read from the antenna of the physical reader
+// belongs to the logical reader
+func (r *Registry) Contains(name string, reader string, antenna uint16) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.contains(name, reader, antenna, map[string]bool{})
+}
+
+// Define validates the Spec and defines the logical reader
+func (r *Registry) Define(name string, spec *Spec) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.specs[name]; ok {
+		return &DuplicateNameError{name}
+	}
+	if err := r.validate(name, spec); err != nil {
+		return err
+	}
+	r.specs[name] = spec
+	log.Printf("[LogicalReader] defined %s", name)
+	return nil
+}
+
+// Exists returns true if the name is a defined logical reader or a physical reader
+func (r *Registry) Exists(name string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if _, ok := r.specs[name]; ok {
+		return true
+	}
+	return r.isPhysical(name)
+}
+
+// Get returns the Spec of the logical reader
+func (r *Registry) Get(name string) (*Spec, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	spec, ok := r.specs[name]
+	if !ok {
+		return nil, &NoSuchNameError{name}
+	}
+	return spec, nil
+}
+
+// Names returns the names of the defined logical readers
+func (r *Registry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	names := make([]string, 0, len(r.specs))
+	for name := range r.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PhysicalReaders returns the names of the physical readers in the logical reader
+func (r *Registry) PhysicalReaders(name string) []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	found := map[string]bool{}
+	r.physicalReaders(name, found, map[string]bool{})
+	readers := make([]string, 0, len(found))
+	for reader := range found {
+		readers = append(readers, reader)
+	}
+	sort.Strings(readers)
+	return readers
+}
+
+// SetInUse sets the InUse to keep the logical readers in use from being undefined
+func (r *Registry) SetInUse(inUse InUse) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.inUse = inUse
+}
+
+// SetPhysicalReader sets the PhysicalReader to resolve the names not defined,
+// any name not defined refers to the physical reader of the name if not set
+func (r *Registry) SetPhysicalReader(physical PhysicalReader) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.physical = physical
+}
+
+// Undefine removes the logical reader unless it's in a composite reader or in use,
+// the InUse is called without the lock so that it can resolve the logical readers
+func (r *Registry) Undefine(name string) error {
+	r.mutex.RLock()
+	inUse := r.inUse
+	r.mutex.RUnlock()
+	if inUse != nil && inUse(name) {
+		return &InUseError{name, "the specs"}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.specs[name]; !ok {
+		return &NoSuchNameError{name}
+	}
+	for composite, spec := range r.specs {
+		for _, member := range spec.Readers {
+			if member == name {
+				return &InUseError{name, composite}
+			}
+		}
+	}
+	delete(r.specs, name)
+	log.Printf("[LogicalReader] undefined %s", name)
+	return nil
+}
+
+// Update validates the Spec and replaces the definition of the logical reader
+func (r *Registry) Update(name string, spec *Spec) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.specs[name]; !ok {
+		return &NoSuchNameError{name}
+	}
+	if err := r.validate(name, spec); err != nil {
+		return err
+	}
+	r.specs[name] = spec
+	log.Printf("[LogicalReader] updated %s", name)
+	return nil
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// contains returns true if the read belongs to the logical reader,
+// the visited readers are skipped, the caller must hold the mutex
+func (r *Registry) contains(name string, reader string, antenna uint16, visited map[string]bool) bool {
+	if visited[name] {
+		return false
+	}
+	visited[name] = true
+	spec, ok := r.specs[name]
+	if !ok {
+		return name == reader && r.isPhysical(name)
+	}
+	if spec.IsComposite {
+		for _, member := range spec.Readers {
+			if r.contains(member, reader, antenna, visited) {
+				return true
+			}
+		}
+		return false
+	}
+	if spec.PhysicalReader != reader {
+		return false
+	}
+	if len(spec.Antennas) == 0 {
+		return true
+	}
+	for _, id := range spec.Antennas {
+		if id == antenna {
+			return true
+		}
+	}
+	return false
+}
+
+// isPhysical returns true if the name not defined refers to a physical reader, the caller must hold the mutex
+func (r *Registry) isPhysical(name string) bool {
+	return r.physical == nil || r.physical(name)
+}
+
+// physicalReaders adds the physical readers in the logical reader to found,
+// the visited readers are skipped, the caller must hold the mutex
+func (r *Registry) physicalReaders(name string, found map[string]bool, visited map[string]bool) {
+	if visited[name] {
+		return
+	}
+	visited[name] = true
+	spec, ok := r.specs[name]
+	switch {
+	case !ok:
+		found[name] = true
+	case spec.IsComposite:
+		for _, member := range spec.Readers {
+			r.physicalReaders(member, found, visited)
+		}
+	default:
+		found[spec.PhysicalReader] = true
+	}
+}
+
+// refers returns true if the logical reader refers to the target through the composite readers,
+// the caller must hold the mutex
+func (r *Registry) refers(name string, target string, visited map[string]bool) bool {
+	if name == target {
+		return true
+	}
+	if visited[name] {
+		return false
+	}
+	visited[name] = true
+	spec, ok := r.specs[name]
+	if !ok {
+		return false
+	}
+	for _, member := range spec.Readers {
+		if r.refers(member, target, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the Spec for the logical reader, the caller must hold the mutex
+func (r *Registry) validate(name string, spec *Spec) error {
+	if len(name) == 0 {
+		return &ValidationError{"the logical reader name is empty"}
+	}
+	if spec == nil {
+		return &ValidationError{"no spec for " + name}
+	}
+	if !spec.IsComposite {
+		if len(spec.PhysicalReader) == 0 {
+			return &ValidationError{"no physicalReader in " + name}
+		}
+		if len(spec.Readers) != 0 {
+			return &ValidationError{"readers in the non-composite reader " + name}
+		}
+		return nil
+	}
+	if len(spec.Readers) == 0 {
+		return &ValidationError{"no readers in the composite reader " + name}
+	}
+	if len(spec.PhysicalReader) != 0 || len(spec.Antennas) != 0 {
+		return &ValidationError{"physicalReader in the composite reader " + name}
+	}
+	for _, member := range spec.Readers {
+		if r.refers(member, name, map[string]bool{}) {
+			return &ValidationError{"circular reference to " + name}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package logicalreader
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func newTestRegistry(t *testing.T) *Registry {
+	r := NewRegistry()
+	for _, lr := range []struct {
+		name string
+		spec *Spec
+	}{
+		{"door-3-in", &Spec{PhysicalReader: "reader-1", Antennas: []uint16{1, 2}}},
+		{"door-3-out", &Spec{PhysicalReader: "reader-1", Antennas: []uint16{3}}},
+		{"dock-door-3", &Spec{IsComposite: true, Readers: []string{"door-3-in", "door-3-out"}}},
+		{"dock", &Spec{IsComposite: true, Readers: []string{"dock-door-3", "reader-2"}}},
+	} {
+		if err := r.Define(lr.name, lr.spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func TestRegistry_Contains(t *testing.T) {
+	r := newTestRegistry(t)
+	tests := []struct {
+		name    string
+		reader  string
+		antenna uint16
+		want    bool
+	}{
+		{"door-3-in", "reader-1", 1, true},
+		{"door-3-in", "reader-1", 3, false},
+		{"door-3-in", "reader-2", 1, false},
+		{"door-3-out", "reader-1", 3, true},
+		{"dock-door-3", "reader-1", 2, true},
+		{"dock-door-3", "reader-1", 3, true},
+		{"dock-door-3", "reader-1", 4, false},
+		{"dock", "reader-1", 1, true},
+		{"dock", "reader-2", 4, true},
+		{"dock", "reader-3", 1, false},
+		{"reader-3", "reader-3", 1, true},
+		{"reader-3", "reader-1", 1, false},
+	}
+	for _, tt := range tests {
+		if got := r.Contains(tt.name, tt.reader, tt.antenna); got != tt.want {
+			t.Errorf("Registry.Contains(%v, %v, %v) = %v, want %v", tt.name, tt.reader, tt.antenna, got, tt.want)
+		}
+	}
+}
+
+func TestRegistry_Exists(t *testing.T) {
+	r := newTestRegistry(t)
+	if !r.Exists("dock") || !r.Exists("reader-3") {
+		t.Errorf("Registry.Exists() = false without PhysicalReader, want true")
+	}
+	r.SetPhysicalReader(func(name string) bool { return name == "reader-1" || name == "reader-2" })
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"dock", true},
+		{"reader-2", true},
+		{"reader-3", false},
+		{"dokc", false},
+	}
+	for _, tt := range tests {
+		if got := r.Exists(tt.name); got != tt.want {
+			t.Errorf("Registry.Exists(%v) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	// the misspelled names don't fall back to the physical readers
+	if !r.Contains("reader-2", "reader-2", 1) || r.Contains("reader-3", "reader-3", 1) {
+		t.Errorf("Registry.Contains() falls back to an unknown physical reader")
+	}
+}
+
+func TestRegistry_PhysicalReaders(t *testing.T) {
+	r := newTestRegistry(t)
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"door-3-in", []string{"reader-1"}},
+		{"dock-door-3", []string{"reader-1"}},
+		{"dock", []string{"reader-1", "reader-2"}},
+		{"reader-3", []string{"reader-3"}},
+	}
+	for _, tt := range tests {
+		if got := r.PhysicalReaders(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Registry.PhysicalReaders(%v) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRegistry_Define(t *testing.T) {
+	r := newTestRegistry(t)
+	tests := []struct {
+		name    string
+		spec    *Spec
+		wantErr interface{}
+	}{
+		{"door-3-in", &Spec{PhysicalReader: "reader-1"}, &DuplicateNameError{}},
+		{"", &Spec{PhysicalReader: "reader-1"}, &ValidationError{}},
+		{"door-4", nil, &ValidationError{}},
+		{"door-4", &Spec{}, &ValidationError{}},
+		{"door-4", &Spec{PhysicalReader: "reader-1", Readers: []string{"door-3-in"}}, &ValidationError{}},
+		{"door-4", &Spec{IsComposite: true}, &ValidationError{}},
+		{"door-4", &Spec{IsComposite: true, Readers: []string{"door-3-in"}, Antennas: []uint16{1}}, &ValidationError{}},
+		{"door-4", &Spec{IsComposite: true, Readers: []string{"door-4"}}, &ValidationError{}},
+		{"door-4", &Spec{IsComposite: true, Readers: []string{"dock", "reader-4"}}, nil},
+	}
+	for _, tt := range tests {
+		err := r.Define(tt.name, tt.spec)
+		if tt.wantErr == nil && err != nil || tt.wantErr != nil && reflect.TypeOf(err) != reflect.TypeOf(tt.wantErr) {
+			t.Errorf("Registry.Define(%v, %+v) error = %v, want %T", tt.name, tt.spec, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRegistry_Update(t *testing.T) {
+	r := newTestRegistry(t)
+	if err := r.Update("door-5", &Spec{PhysicalReader: "reader-1"}); reflect.TypeOf(err) != reflect.TypeOf(&NoSuchNameError{}) {
+		t.Errorf("Registry.Update() error = %v, want NoSuchNameError", err)
+	}
+	// dock-door-3 is in dock
+	if err := r.Update("dock-door-3", &Spec{IsComposite: true, Readers: []string{"dock"}}); reflect.TypeOf(err) != reflect.TypeOf(&ValidationError{}) {
+		t.Errorf("Registry.Update() error = %v, want ValidationError", err)
+	}
+	if err := r.Update("door-3-out", &Spec{PhysicalReader: "reader-1", Antennas: []uint16{4}}); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Contains("dock", "reader-1", 4) || r.Contains("dock", "reader-1", 3) {
+		t.Errorf("Registry.Update() is not applied to the composite reader")
+	}
+}
+
+func TestRegistry_Undefine(t *testing.T) {
+	r := newTestRegistry(t)
+	if err := r.Undefine("dock-door-3"); reflect.TypeOf(err) != reflect.TypeOf(&InUseError{}) {
+		t.Errorf("Registry.Undefine() error = %v, want InUseError", err)
+	}
+	r.SetInUse(func(name string) bool { return name == "door-3-in" })
+	if err := r.Undefine("door-3-in"); reflect.TypeOf(err) != reflect.TypeOf(&InUseError{}) {
+		t.Errorf("Registry.Undefine() error = %v, want InUseError", err)
+	}
+	for _, name := range []string{"dock", "dock-door-3"} {
+		if err := r.Undefine(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Undefine("dock"); reflect.TypeOf(err) != reflect.TypeOf(&NoSuchNameError{}) {
+		t.Errorf("Registry.Undefine() error = %v, want NoSuchNameError", err)
+	}
+	if want := []string{"door-3-in", "door-3-out"}; !reflect.DeepEqual(r.Names(), want) {
+		t.Errorf("Registry.Names() = %v, want %v", r.Names(), want)
+	}
+}
+
+func TestLoadSpecsFromJSONFile(t *testing.T) {
+	fp, err := ioutil.TempFile("", "logicalreaders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fp.Name())
+	fp.WriteString(`{
+  "dock-door-3": {"physicalReader": "reader-1", "antennas": [1, 2]},
+  "dock": {"isComposite": true, "readers": ["dock-door-3", "reader-2"]}
+}`)
+	fp.Close()
+
+	want := map[string]*Spec{
+		"dock-door-3": {PhysicalReader: "reader-1", Antennas: []uint16{1, 2}},
+		"dock":        {IsComposite: true, Readers: []string{"dock-door-3", "reader-2"}},
+	}
+	got, err := LoadSpecsFromJSONFile(fp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadSpecsFromJSONFile() = %v, want %v", got, want)
+	}
+	if _, err = LoadSpecsFromJSONFile(fp.Name() + ".none"); err == nil {
+		t.Errorf("LoadSpecsFromJSONFile() error = nil for a missing file")
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package management provides the REST API to manage the subscriptions and the engines
+package management
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iomz/gosstrak/filtering"
+	"github.com/iomz/gosstrak/logicalreader"
+)
+
+// ApplyFunc applies the ManagementMessage in the same way as the SPDY management channel
+type ApplyFunc func(*filtering.ManagementMessage) error
+
+// Subscription is a pattern for a reportURI in the REST API,
+// the events are reported only from the LogicalReaders if any, in the OutputFormats if given
+type Subscription struct {
+	ReportURI      string   `json:"reportURI"`
+	Pattern        string   `json:"pattern,omitempty"`
+	LogicalReaders []string `json:"logicalReaders,omitempty"`
+	OutputFormats  []string `json:"outputFormats,omitempty"`
+}
+
+// LogicalReader is a logical reader definition in the REST API
+type LogicalReader struct {
+	Name string `json:"name"`
+	logicalreader.Spec
+}
+
+// EngineStatus is the status of an EngineGenerator
+type EngineStatus struct {
+	Name              string  `json:"name"`
+	State             string  `json:"state"`
+	CurrentThroughput float64 `json:"currentThroughput"`
+}
+
+// EnginesStatus is the status of the EngineFactory
+type EnginesStatus struct {
+	CurrentEngine string         `json:"currentEngine"`
+	Engines       []EngineStatus `json:"engines"`
+}
+
+// ReaderStatus is the status of an LLRP reader
+type ReaderStatus struct {
+	Name             string     `json:"name"`
+	Address          string     `json:"address"`
+	State            string     `json:"state"`
+	Health           string     `json:"health,omitempty"`
+	LastKeepalive    *time.Time `json:"lastKeepalive,omitempty"`
+	MissedKeepalives int        `json:"missedKeepalives"`
+}
+
+// ReaderManager manages the LLRP readers
+type ReaderManager interface {
+	AddReader(name string, address string) error
+	DeleteReader(name string) error
+	Readers() []ReaderStatus
+}
+
+// LogicalReaderRegistry manages the logical readers
+type LogicalReaderRegistry interface {
+	Define(name string, spec *logicalreader.Spec) error
+	Get(name string) (*logicalreader.Spec, error)
+	Names() []string
+	Undefine(name string) error
+	Update(name string, spec *logicalreader.Spec) error
+}
+
+// RESTHandler serves the management REST API
+type RESTHandler struct {
+	factory        *filtering.EngineFactory
+	apply          ApplyFunc
+	readers        ReaderManager
+	logicalReaders LogicalReaderRegistry
+	mux            *http.ServeMux
+}
+
+// NewRESTHandler returns the pointer to a new RESTHandler instance,
+// the changes in the subscriptions are applied with the ApplyFunc
+func NewRESTHandler(factory *filtering.EngineFactory, apply ApplyFunc) *RESTHandler {
+	h := &RESTHandler{
+		factory: factory,
+		apply:   apply,
+		mux:     http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/subscriptions", h.handleSubscriptions)
+	h.mux.HandleFunc("/engines", h.handleEngines)
+	h.mux.HandleFunc("/engines/", h.handleEngineDump)
+	return h
+}
+
+// HandleReaders serves the readers managed by the ReaderManager at /readers
+func (h *RESTHandler) HandleReaders(rm ReaderManager) {
+	h.readers = rm
+	h.mux.HandleFunc("/readers", h.handleReaders)
+	h.mux.HandleFunc("/readers/", h.handleReader)
+}
+
+// HandleLogicalReaders serves the logical readers in the LogicalReaderRegistry at /logicalreaders
+func (h *RESTHandler) HandleLogicalReaders(registry LogicalReaderRegistry) {
+	h.logicalReaders = registry
+	h.mux.HandleFunc("/logicalreaders", h.handleLogicalReaders)
+	h.mux.HandleFunc("/logicalreaders/", h.handleLogicalReader)
+}
+
+// ServeHTTP dispatches the request to the handlers
+func (h *RESTHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("[REST] %s %s", r.Method, r.URL)
+	h.mux.ServeHTTP(w, r)
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// handleSubscriptions lists the subscriptions with GET, adds one with POST {"reportURI", "pattern"},
+// scopes one with PUT {"reportURI", "logicalReaders", "outputFormats"}, or deletes one with DELETE ?reportURI=...&pattern=...
+func (h *RESTHandler) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.factory.Subscriptions())
+	case http.MethodPost:
+		s := &Subscription{}
+		if err := json.NewDecoder(r.Body).Decode(s); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.applySubscription(w, filtering.AddSubscription, s, http.StatusCreated)
+	case http.MethodPut:
+		s := &Subscription{}
+		if err := json.NewDecoder(r.Body).Decode(s); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.applySubscription(w, filtering.ScopeSubscription, s, http.StatusOK)
+	case http.MethodDelete:
+		s := &Subscription{
+			ReportURI: r.URL.Query().Get("reportURI"),
+			Pattern:   r.URL.Query().Get("pattern"),
+		}
+		h.applySubscription(w, filtering.DeleteSubscription, s, http.StatusOK)
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleEngines shows the current engine and the status of the EngineGenerators
+func (h *RESTHandler) handleEngines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	status := &EnginesStatus{
+		CurrentEngine: h.factory.CurrentEngineName(),
+		Engines:       []EngineStatus{},
+	}
+	for _, eg := range h.factory.EngineGenerators() {
+		status.Engines = append(status.Engines, EngineStatus{
+			Name:              eg.Name,
+			State:             eg.FSM.Current(),
+			CurrentThroughput: eg.CurrentThroughput(),
+		})
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleEngineDump returns the Dump() of the engine in text at /engines/<name>/dump
+func (h *RESTHandler) handleEngineDump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/engines/"), "/")
+	if len(path) != 2 || path[1] != "dump" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	dump, err := h.factory.Dump(path[0])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(dump))
+}
+
+// handleReaders lists the readers with GET or adds one with POST {"name", "address"}
+func (h *RESTHandler) handleReaders(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.readers.Readers())
+	case http.MethodPost:
+		rs := &ReaderStatus{}
+		if err := json.NewDecoder(r.Body).Decode(rs); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := h.readers.AddReader(rs.Name, rs.Address); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, rs)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleReader shows the reader at /readers/<name> with GET or deletes it with DELETE
+func (h *RESTHandler) handleReader(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/readers/")
+	switch r.Method {
+	case http.MethodGet:
+		for _, rs := range h.readers.Readers() {
+			if rs.Name == name {
+				writeJSON(w, http.StatusOK, rs)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "no such reader: "+name)
+	case http.MethodDelete:
+		if err := h.readers.DeleteReader(name); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleLogicalReaders lists the logical readers with GET or defines one with POST {"name", ...}
+func (h *RESTHandler) handleLogicalReaders(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		lrs := []LogicalReader{}
+		for _, name := range h.logicalReaders.Names() {
+			if spec, err := h.logicalReaders.Get(name); err == nil {
+				lrs = append(lrs, LogicalReader{name, *spec})
+			}
+		}
+		writeJSON(w, http.StatusOK, lrs)
+	case http.MethodPost:
+		lr := &LogicalReader{}
+		if err := json.NewDecoder(r.Body).Decode(lr); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		spec := lr.Spec
+		if err := h.logicalReaders.Define(lr.Name, &spec); err != nil {
+			writeLogicalReaderError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, lr)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleLogicalReader shows the logical reader at /logicalreaders/<name> with GET,
+// updates it with PUT, or undefines it with DELETE
+func (h *RESTHandler) handleLogicalReader(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/logicalreaders/")
+	switch r.Method {
+	case http.MethodGet:
+		spec, err := h.logicalReaders.Get(name)
+		if err != nil {
+			writeLogicalReaderError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, LogicalReader{name, *spec})
+	case http.MethodPut:
+		lr := &LogicalReader{}
+		if err := json.NewDecoder(r.Body).Decode(lr); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		lr.Name = name
+		spec := lr.Spec
+		if err := h.logicalReaders.Update(name, &spec); err != nil {
+			writeLogicalReaderError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, lr)
+	case http.MethodDelete:
+		if err := h.logicalReaders.Undefine(name); err != nil {
+			writeLogicalReaderError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// applySubscription applies the change in the subscription with the ApplyFunc
+func (h *RESTHandler) applySubscription(w http.ResponseWriter, t filtering.ManagementMessageType, s *Subscription, status int) {
+	if len(s.ReportURI) == 0 || (len(s.Pattern) == 0 && t != filtering.ScopeSubscription) {
+		writeError(w, http.StatusBadRequest, "reportURI and pattern are required")
+		return
+	}
+	err := h.apply(&filtering.ManagementMessage{
+		Type:           t,
+		Pattern:        s.Pattern,
+		ReportURI:      s.ReportURI,
+		LogicalReaders: s.LogicalReaders,
+		OutputFormats:  s.OutputFormats,
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, status, s)
+}
+
+// writeError writes the error message in JSON
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeLogicalReaderError writes the error from the LogicalReaderRegistry with its status
+func writeLogicalReaderError(w http.ResponseWriter, err error) {
+	switch err.(type) {
+	case *logicalreader.NoSuchNameError:
+		writeError(w, http.StatusNotFound, err.Error())
+	case *logicalreader.DuplicateNameError, *logicalreader.InUseError:
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+// writeJSON writes the value in JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package management
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iomz/go-llrp"
+	"github.com/iomz/gosstrak/filtering"
+	"github.com/iomz/gosstrak/logicalreader"
+)
+
+func TestRESTHandler(t *testing.T) {
+	mc := make(chan filtering.ManagementMessage, 64)
+	ef := filtering.NewEngineFactory(filtering.Subscriptions{}, 1, mc)
+	go ef.Run()
+	for start := time.Now(); !ef.IsActive(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("no engine became active")
+		}
+	}
+	applied := []filtering.ManagementMessage{}
+	ts := httptest.NewServer(NewRESTHandler(ef, func(mm *filtering.ManagementMessage) error {
+		applied = append(applied, *mm)
+		switch mm.Type {
+		case filtering.AddSubscription:
+			if err := ef.AddSubscription(mm.ReportURI, mm.Pattern); err != nil {
+				return err
+			}
+			// wait until the engine is rebuilt
+			for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+				if dump, _ := ef.Dump("LegacyEngine"); strings.Contains(dump, mm.Pattern) {
+					break
+				}
+			}
+		case filtering.DeleteSubscription:
+			return ef.DeleteSubscription(mm.ReportURI, mm.Pattern)
+		}
+		return nil
+	}))
+	defer ts.Close()
+
+	reportURI := "http://localhost:8888/sgtin"
+	pattern := "urn:epc:pat:sgtin-96:3.12345678"
+	query := "?" + url.Values{"reportURI": {reportURI}, "pattern": {pattern}}.Encode()
+	body := `{"reportURI": "` + reportURI + `", "pattern": "` + pattern + `"}`
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"add", http.MethodPost, "/subscriptions", body, http.StatusCreated, `"pattern":"` + pattern + `"`},
+		{"add duplicate", http.MethodPost, "/subscriptions", body, http.StatusBadRequest, `"error"`},
+		{"add without pattern", http.MethodPost, "/subscriptions", `{"reportURI": "` + reportURI + `"}`, http.StatusBadRequest, `"error"`},
+		{"list", http.MethodGet, "/subscriptions", "", http.StatusOK, `{"` + reportURI + `":["` + pattern + `"]}`},
+		{"scope", http.MethodPut, "/subscriptions", `{"reportURI": "` + reportURI + `", "logicalReaders": ["dock-door-3"]}`, http.StatusOK, `"logicalReaders":["dock-door-3"]`},
+		{"scope without reportURI", http.MethodPut, "/subscriptions", `{"logicalReaders": ["dock-door-3"]}`, http.StatusBadRequest, `"error"`},
+		{"engines", http.MethodGet, "/engines", "", http.StatusOK, `"name":"PatriciaTrie"`},
+		{"dump", http.MethodGet, "/engines/LegacyEngine/dump", "", http.StatusOK, pattern},
+		{"dump unknown engine", http.MethodGet, "/engines/NoEngine/dump", "", http.StatusNotFound, `"error"`},
+		{"delete", http.MethodDelete, "/subscriptions" + query, "", http.StatusOK, `"reportURI":"` + reportURI + `"`},
+		{"delete twice", http.MethodDelete, "/subscriptions" + query, "", http.StatusBadRequest, `"error"`},
+		{"method not allowed", http.MethodPatch, "/subscriptions", body, http.StatusMethodNotAllowed, `"error"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			got, _ := ioutil.ReadAll(res.Body)
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status = %v, want %v", res.StatusCode, tt.wantStatus)
+			}
+			if !strings.Contains(string(got), tt.wantBody) {
+				t.Errorf("body = %s, want %v", got, tt.wantBody)
+			}
+		})
+	}
+	if len(applied) != 5 {
+		t.Errorf("applied %v ManagementMessages, want 5", len(applied))
+	}
+
+	status := &EnginesStatus{}
+	res, err := http.Get(ts.URL + "/engines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if err = json.NewDecoder(res.Body).Decode(status); err != nil {
+		t.Fatal(err)
+	}
+	if status.CurrentEngine != ef.CurrentEngineName() || len(status.Engines) != len(filtering.AvailableEngines) {
+		t.Errorf("EnginesStatus = %+v", status)
+	}
+}
+
+func TestRESTHandler_dumpWhileSearching(t *testing.T) {
+	mc := make(chan filtering.ManagementMessage, 64)
+	ef := filtering.NewEngineFactory(filtering.Subscriptions{
+		"http://localhost:8888/item-1": {"urn:epc:pat:sgtin-96:3.12345678.00001"},
+		"http://localhost:8888/item-2": {"urn:epc:pat:sgtin-96:3.12345678.00002"},
+	}, 1, mc)
+	go ef.Run()
+	go func() {
+		for range mc {
+		}
+	}()
+	// the SplayTree splays the nodes on every search
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := ef.Dump("SplayTree"); err == nil && ef.IsActive() {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the SplayTree engine was not generated")
+		}
+	}
+	ts := httptest.NewServer(NewRESTHandler(ef, nil))
+	defer ts.Close()
+
+	// urn:epc:id:sgtin:12345678.00001.1 and urn:epc:id:sgtin:12345678.00002.1
+	items := []llrp.ReadEvent{
+		{PC: []byte{48, 0}, ID: []byte{48, 112, 94, 48, 167, 0, 0, 64, 0, 0, 0, 1}},
+		{PC: []byte{48, 0}, ID: []byte{48, 112, 94, 48, 167, 0, 0, 128, 0, 0, 0, 1}},
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, re := range items {
+		wg.Add(1)
+		go func(re llrp.ReadEvent) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					ef.Search(re)
+				}
+			}
+		}(re)
+	}
+	for i := 0; i < 20; i++ {
+		res, err := http.Get(ts.URL + "/engines/SplayTree/dump")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || !strings.Contains(string(got), "http://localhost:8888/item-1") {
+			t.Errorf("dump = %v %s", res.StatusCode, got)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+// fakeReaders is a ReaderManager without any connection
+type fakeReaders map[string]string
+
+func (fr fakeReaders) AddReader(name string, address string) error {
+	if _, ok := fr[name]; ok {
+		return fmt.Errorf("duplicate reader name: %s", name)
+	}
+	fr[name] = address
+	return nil
+}
+
+func (fr fakeReaders) DeleteReader(name string) error {
+	if _, ok := fr[name]; !ok {
+		return fmt.Errorf("no such reader: %s", name)
+	}
+	delete(fr, name)
+	return nil
+}
+
+func (fr fakeReaders) Readers() []ReaderStatus {
+	status := []ReaderStatus{}
+	for name, address := range fr {
+		status = append(status, ReaderStatus{Name: name, Address: address, State: "connected"})
+	}
+	return status
+}
+
+func TestRESTHandler_HandleReaders(t *testing.T) {
+	h := NewRESTHandler(nil, nil)
+	h.HandleReaders(fakeReaders{})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	body := `{"name": "dock-door-3", "address": "192.168.1.3:5084"}`
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"add", http.MethodPost, "/readers", body, http.StatusCreated, `"name":"dock-door-3"`},
+		{"add duplicate", http.MethodPost, "/readers", body, http.StatusBadRequest, `"error"`},
+		{"list", http.MethodGet, "/readers", "", http.StatusOK, `[{"name":"dock-door-3","address":"192.168.1.3:5084","state":"connected","missedKeepalives":0}]`},
+		{"get", http.MethodGet, "/readers/dock-door-3", "", http.StatusOK, `"state":"connected"`},
+		{"get unknown", http.MethodGet, "/readers/dock-door-4", "", http.StatusNotFound, `"error"`},
+		{"delete", http.MethodDelete, "/readers/dock-door-3", "", http.StatusNoContent, ""},
+		{"delete twice", http.MethodDelete, "/readers/dock-door-3", "", http.StatusNotFound, `"error"`},
+		{"method not allowed", http.MethodPut, "/readers/dock-door-3", "", http.StatusMethodNotAllowed, `"error"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			got, _ := ioutil.ReadAll(res.Body)
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status = %v, want %v", res.StatusCode, tt.wantStatus)
+			}
+			if !strings.Contains(string(got), tt.wantBody) {
+				t.Errorf("body = %s, want %v", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRESTHandler_HandleLogicalReaders(t *testing.T) {
+	h := NewRESTHandler(nil, nil)
+	h.HandleLogicalReaders(logicalreader.NewRegistry())
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	base := `{"name": "dock-door-3", "physicalReader": "reader-1", "antennas": [1, 2]}`
+	composite := `{"name": "dock", "isComposite": true, "readers": ["dock-door-3"]}`
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"define", http.MethodPost, "/logicalreaders", base, http.StatusCreated, `"name":"dock-door-3"`},
+		{"define duplicate", http.MethodPost, "/logicalreaders", base, http.StatusConflict, `"error"`},
+		{"define invalid", http.MethodPost, "/logicalreaders", `{"name": "dock-door-4"}`, http.StatusBadRequest, `"error"`},
+		{"define composite", http.MethodPost, "/logicalreaders", composite, http.StatusCreated, `"isComposite":true`},
+		{"list", http.MethodGet, "/logicalreaders", "", http.StatusOK, `[{"name":"dock","isComposite":true,"readers":["dock-door-3"]},{"name":"dock-door-3","isComposite":false,"physicalReader":"reader-1","antennas":[1,2]}]`},
+		{"update", http.MethodPut, "/logicalreaders/dock-door-3", `{"physicalReader": "reader-2"}`, http.StatusOK, `"physicalReader":"reader-2"`},
+		{"get", http.MethodGet, "/logicalreaders/dock-door-3", "", http.StatusOK, `{"name":"dock-door-3","isComposite":false,"physicalReader":"reader-2"}`},
+		{"get unknown", http.MethodGet, "/logicalreaders/dock-door-4", "", http.StatusNotFound, `"error"`},
+		{"update unknown", http.MethodPut, "/logicalreaders/dock-door-4", `{"physicalReader": "reader-2"}`, http.StatusNotFound, `"error"`},
+		{"delete in use", http.MethodDelete, "/logicalreaders/dock-door-3", "", http.StatusConflict, `"error"`},
+		{"delete composite", http.MethodDelete, "/logicalreaders/dock", "", http.StatusNoContent, ""},
+		{"delete", http.MethodDelete, "/logicalreaders/dock-door-3", "", http.StatusNoContent, ""},
+		{"delete twice", http.MethodDelete, "/logicalreaders/dock-door-3", "", http.StatusNotFound, `"error"`},
+		{"method not allowed", http.MethodPatch, "/logicalreaders", "", http.StatusMethodNotAllowed, `"error"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			got, _ := ioutil.ReadAll(res.Body)
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status = %v, want %v", res.StatusCode, tt.wantStatus)
+			}
+			if !strings.Contains(string(got), tt.wantBody) {
+				t.Errorf("body = %s, want %v", got, tt.wantBody)
+			}
+		})
+	}
+}
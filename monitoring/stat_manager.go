@@ -90,6 +90,32 @@ func NewStatManager(mode string, addr string, user string, pass string, db strin
 				}
 				fields["selected"] = engineType
 				measurement = "engine"
+			case ReaderHealth:
+				health, ok := msg.Value[0].(string)
+				if !ok {
+					continue
+				}
+				fields["health"] = health
+				missed, ok := msg.Value[1].(int)
+				if !ok {
+					continue
+				}
+				fields["missed_keepalives"] = missed
+				tags["reader"] = msg.Name
+				measurement = "reader"
+			case TagPresence:
+				tag, ok := msg.Value[0].(string)
+				if !ok {
+					continue
+				}
+				event, ok := msg.Value[1].(string)
+				if !ok {
+					continue
+				}
+				fields["event"] = event
+				tags["tag"] = tag
+				tags["source"] = msg.Name
+				measurement = "presence"
 			}
 			pt, err := client.NewPoint(measurement, tags, fields, time.Now())
 			if err != nil {
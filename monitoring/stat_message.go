@@ -15,6 +15,10 @@ const (
 	EngineThroughput
 	// SelectedEngine message
 	SelectedEngine
+	// ReaderHealth message
+	ReaderHealth
+	// TagPresence message
+	TagPresence
 )
 
 // StatMessage carries stat
@@ -0,0 +1,66 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package reporting
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// CCStatus values of the operations in CCOpReport
+const (
+	CCSuccess             = "SUCCESS"
+	CCMiscErrorTotal      = "MISC_ERROR_TOTAL"
+	CCPermissionError     = "PERMISSION_ERROR"
+	CCPasswordError       = "PASSWORD_ERROR"
+	CCOpNotPossibleError  = "OP_NOT_POSSIBLE_ERROR"
+	CCMemoryOverflowError = "MEMORY_OVERFLOW_ERROR"
+)
+
+// CCReports is the ALE CCReports document of a command cycle
+type CCReports struct {
+	XMLName              xml.Name      `xml:"ale:CCReports" json:"-"`
+	XMLNS                string        `xml:"xmlns:ale,attr" json:"-"`
+	SchemaVersion        string        `xml:"schemaVersion,attr" json:"schemaVersion"`
+	CreationDate         time.Time     `xml:"creationDate,attr" json:"creationDate"`
+	SpecName             string        `xml:"specName,attr" json:"specName"`
+	Date                 time.Time     `xml:"date,attr" json:"date"`
+	ALEID                string        `xml:"ALEID,attr" json:"ALEID"`
+	TotalMilliseconds    int64         `xml:"totalMilliseconds,attr" json:"totalMilliseconds"`
+	InitiationCondition  string        `xml:"initiationCondition,attr" json:"initiationCondition"`
+	TerminationCondition string        `xml:"terminationCondition,attr" json:"terminationCondition"`
+	CCSpec               interface{}   `xml:"CCSpec,omitempty" json:"CCSpec,omitempty"`
+	CmdReports           []CCCmdReport `xml:"cmdReports>cmdReport" json:"cmdReports"`
+}
+
+// CCCmdReport is the report of a command in CCReports
+type CCCmdReport struct {
+	CmdSpecName string        `xml:"cmdSpecName,attr" json:"cmdSpecName"`
+	TagReports  []CCTagReport `xml:"tagReports>tagReport" json:"tagReports"`
+}
+
+// CCTagReport is the results of the operations on a tag
+type CCTagReport struct {
+	ID        string       `xml:"id,attr" json:"id"`
+	OpReports []CCOpReport `xml:"opReports>opReport" json:"opReports"`
+}
+
+// CCOpReport is the result of an operation on a tag
+type CCOpReport struct {
+	Data     string `xml:"data,omitempty" json:"data,omitempty"`
+	OpStatus string `xml:"opStatus" json:"opStatus"`
+	OpName   string `xml:"opName,omitempty" json:"opName,omitempty"`
+}
+
+// Succeeded returns true if all the operations on the tag succeeded
+func (tr *CCTagReport) Succeeded() bool {
+	for _, op := range tr.OpReports {
+		if op.OpStatus != CCSuccess {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package reporting delivers ALE ECReports to the subscribers
+package reporting
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iomz/gosstrak/tdt"
+)
+
+// ALE related constants
+const (
+	// ALENamespace is the XML namespace of ALE 1.1 documents
+	ALENamespace = "urn:epcglobal:ale:xsd:1"
+	// SchemaVersion is the ALE schema version of the reports
+	SchemaVersion = "1.1"
+	// ALEID identifies this ALE implementation in ECReports
+	ALEID = "gosstrak-fc"
+)
+
+// Format is the encoding of ECReports on the wire
+type Format int
+
+// Available report formats
+const (
+	XML Format = iota
+	JSON
+)
+
+// OutputFormat is a set of the representations of the tags in ECReportGroupListMember
+type OutputFormat int
+
+// Available output formats
+const (
+	OutputEPC OutputFormat = 1 << iota
+	OutputTag
+	OutputRawHex
+	OutputRawDecimal
+	OutputBinary
+)
+
+// outputFormatNames are the names of the output formats in the order of the bits
+var outputFormatNames = []string{"epc", "tag", "rawHex", "rawDecimal", "binary"}
+
+// ParseOutputFormat returns the OutputFormat of the names, e.g., epc, tag, rawHex, rawDecimal, and binary
+func ParseOutputFormat(names []string) (OutputFormat, error) {
+	var of OutputFormat
+	for _, name := range names {
+		found := false
+		for i, n := range outputFormatNames {
+			if strings.EqualFold(name, n) {
+				of |= 1 << uint(i)
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown output format: %v", name)
+		}
+	}
+	return of, nil
+}
+
+// Names returns the names of the output formats in the OutputFormat
+func (of OutputFormat) Names() []string {
+	names := []string{}
+	for i, n := range outputFormatNames {
+		if of&(1<<uint(i)) != 0 {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// ContentType returns the MIME type for the Format
+func (f Format) ContentType() string {
+	switch f {
+	case JSON:
+		return "application/json"
+	}
+	return "application/xml"
+}
+
+// ECReports is the ALE ECReports document delivered to the subscribers
+type ECReports struct {
+	XMLName              xml.Name    `xml:"ale:ECReports" json:"-"`
+	XMLNS                string      `xml:"xmlns:ale,attr" json:"-"`
+	SchemaVersion        string      `xml:"schemaVersion,attr" json:"schemaVersion"`
+	CreationDate         time.Time   `xml:"creationDate,attr" json:"creationDate"`
+	SpecName             string      `xml:"specName,attr" json:"specName"`
+	Date                 time.Time   `xml:"date,attr" json:"date"`
+	ALEID                string      `xml:"ALEID,attr" json:"ALEID"`
+	TotalMilliseconds    int64       `xml:"totalMilliseconds,attr" json:"totalMilliseconds"`
+	InitiationCondition  string      `xml:"initiationCondition,attr" json:"initiationCondition"`
+	TerminationCondition string      `xml:"terminationCondition,attr" json:"terminationCondition"`
+	ECSpec               interface{} `xml:"ECSpec,omitempty" json:"ECSpec,omitempty"`
+	Reports              []ECReport  `xml:"reports>report" json:"reports"`
+}
+
+// ECReport is a single report in ECReports
+type ECReport struct {
+	ReportName string          `xml:"reportName,attr" json:"reportName"`
+	Groups     []ECReportGroup `xml:"group" json:"groups"`
+}
+
+// ECReportGroup contains the members of a group in ECReport
+type ECReportGroup struct {
+	GroupName string                    `xml:"groupName,attr,omitempty" json:"groupName,omitempty"`
+	Members   []ECReportGroupListMember `xml:"groupList>member" json:"groupList"`
+	Count     *ECReportGroupCount       `xml:"groupCount,omitempty" json:"groupCount,omitempty"`
+}
+
+// ECReportGroupCount is the number of the members in ECReportGroup
+type ECReportGroupCount struct {
+	Count int `xml:"count" json:"count"`
+}
+
+// ECReportGroupListMember is an identity reported in ECReportGroup
+type ECReportGroupListMember struct {
+	EPC        string `xml:"epc,omitempty" json:"epc,omitempty"`
+	Tag        string `xml:"tag,omitempty" json:"tag,omitempty"`
+	RawHex     string `xml:"rawHex,omitempty" json:"rawHex,omitempty"`
+	RawDecimal string `xml:"rawDecimal,omitempty" json:"rawDecimal,omitempty"`
+	// Binary is not defined in ALE, the bits of the EPC bank
+	Binary string `xml:"binary,omitempty" json:"binary,omitempty"`
+	// Extension is either the TagMetadata or the ECReportMemberExtension with the fields
+	Extension interface{} `xml:"extension,omitempty" json:"extension,omitempty"`
+}
+
+// ECReportMemberExtension is the extension of ECReportGroupListMember with the fields of the tag,
+// the TagMetadata is included if requested
+type ECReportMemberExtension struct {
+	*TagMetadata
+	FieldList []ECReportMemberField `xml:"fieldList>field" json:"fieldList"`
+}
+
+// ECReportMemberField is the value of a field in the tag memory,
+// the value is omitted if the field is not read
+type ECReportMemberField struct {
+	Name      string      `xml:"name,attr" json:"name"`
+	Value     string      `xml:"value,omitempty" json:"value,omitempty"`
+	FieldSpec interface{} `xml:"fieldspec,omitempty" json:"fieldspec,omitempty"`
+}
+
+// NewECReportGroupListMember returns the ECReportGroupListMember of the tag in the output formats,
+// the id is translated to the tag URI with the tdt.Core, or the raw URI if it's not decodable
+func NewECReportGroupListMember(pureIdentity string, id []byte, of OutputFormat, c *tdt.Core) ECReportGroupListMember {
+	m := ECReportGroupListMember{}
+	if of&OutputEPC != 0 {
+		m.EPC = pureIdentity
+	}
+	if len(id) == 0 {
+		return m
+	}
+	length := len(id) * 8
+	rawHex := fmt.Sprintf("urn:epc:raw:%d.x%X", length, id)
+	if of&OutputTag != 0 {
+		var err error
+		if m.Tag, err = c.TagURI(id); err != nil {
+			m.Tag = rawHex
+		}
+	}
+	if of&OutputRawHex != 0 {
+		m.RawHex = rawHex
+	}
+	if of&OutputRawDecimal != 0 {
+		m.RawDecimal = fmt.Sprintf("urn:epc:raw:%d.%s", length, new(big.Int).SetBytes(id))
+	}
+	if of&OutputBinary != 0 {
+		w := &strings.Builder{}
+		for _, b := range id {
+			fmt.Fprintf(w, "%08b", b)
+		}
+		m.Binary = w.String()
+	}
+	return m
+}
+
+// TagMetadata is what the readers reported about a tag in an event cycle
+type TagMetadata struct {
+	AntennaID uint16     `xml:"antennaID,omitempty" json:"antennaID,omitempty"`
+	PeakRSSI  *int8      `xml:"peakRSSI,omitempty" json:"peakRSSI,omitempty"`
+	FirstSeen *time.Time `xml:"firstSeenTimestamp,omitempty" json:"firstSeenTimestamp,omitempty"`
+	LastSeen  *time.Time `xml:"lastSeenTimestamp,omitempty" json:"lastSeenTimestamp,omitempty"`
+	ReadCount int        `xml:"readCount" json:"readCount"`
+	// ID is the EPC of the tag for the output formats other than the pure identity
+	ID []byte `xml:"-" json:"-"`
+	// PC, TID and User are the memory of the tag for the fields in the reports
+	PC   []byte `xml:"-" json:"-"`
+	TID  []byte `xml:"-" json:"-"`
+	User []byte `xml:"-" json:"-"`
+}
+
+// Merge accumulates the metadata of another read of the tag,
+// the antenna which reported the peak RSSI is kept
+func (md *TagMetadata) Merge(other *TagMetadata) {
+	if other.PeakRSSI != nil && (md.PeakRSSI == nil || *other.PeakRSSI > *md.PeakRSSI) {
+		md.PeakRSSI = other.PeakRSSI
+		md.AntennaID = other.AntennaID
+	} else if md.PeakRSSI == nil && other.AntennaID != 0 {
+		md.AntennaID = other.AntennaID
+	}
+	if other.FirstSeen != nil && (md.FirstSeen == nil || other.FirstSeen.Before(*md.FirstSeen)) {
+		md.FirstSeen = other.FirstSeen
+	}
+	if other.LastSeen != nil && (md.LastSeen == nil || other.LastSeen.After(*md.LastSeen)) {
+		md.LastSeen = other.LastSeen
+	}
+	md.ReadCount += other.ReadCount
+	if md.ID == nil {
+		md.ID = other.ID
+	}
+	if md.PC == nil {
+		md.PC = other.PC
+	}
+	if md.TID == nil {
+		md.TID = other.TID
+	}
+	if md.User == nil {
+		md.User = other.User
+	}
+}
+
+// NewECReport returns an ECReport with a single group containing the pureIdentities
+func NewECReport(reportName string, pureIdentities []string) ECReport {
+	members := make([]ECReportGroupListMember, len(pureIdentities))
+	for i, pureIdentity := range pureIdentities {
+		members[i] = ECReportGroupListMember{EPC: pureIdentity}
+	}
+	return ECReport{
+		ReportName: reportName,
+		Groups: []ECReportGroup{
+			{
+				Members: members,
+				Count:   &ECReportGroupCount{Count: len(members)},
+			},
+		},
+	}
+}
+
+// NewECReports returns ECReports with one report containing the pureIdentities
+func NewECReports(specName string, reportName string, pureIdentities []string) *ECReports {
+	now := time.Now()
+	return &ECReports{
+		XMLNS:                ALENamespace,
+		SchemaVersion:        SchemaVersion,
+		CreationDate:         now,
+		SpecName:             specName,
+		Date:                 now,
+		ALEID:                ALEID,
+		InitiationCondition:  "REQUESTED",
+		TerminationCondition: "UNREQUESTED",
+		Reports:              []ECReport{NewECReport(reportName, pureIdentities)},
+	}
+}
+
+// Encode returns the ECReports in the given Format
+func (ecr *ECReports) Encode(f Format) ([]byte, error) {
+	switch f {
+	case XML:
+		out, err := xml.Marshal(ecr)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		buf.WriteString(xml.Header)
+		buf.Write(out)
+		return buf.Bytes(), nil
+	case JSON:
+		return json.Marshal(ecr)
+	}
+	return nil, fmt.Errorf("unknown report format: %v", f)
+}
+
+// FormatOf determines the report Format for the reportURI,
+// JSON is used when the reportURI has format=json in its query
+func FormatOf(reportURI string) (Format, error) {
+	u, err := url.Parse(reportURI)
+	if err != nil {
+		return XML, err
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+	default:
+		return XML, fmt.Errorf("unsupported reportURI scheme: %v", reportURI)
+	}
+	if strings.ToLower(u.Query().Get("format")) == "json" {
+		return JSON, nil
+	}
+	return XML, nil
+}
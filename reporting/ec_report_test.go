@@ -0,0 +1,134 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package reporting
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iomz/gosstrak/tdt"
+)
+
+func TestTagMetadata_Merge(t *testing.T) {
+	weak, strong := int8(-60), int8(-50)
+	t1, t2 := time.Unix(100, 0), time.Unix(200, 0)
+	tests := []struct {
+		name  string
+		md    TagMetadata
+		other TagMetadata
+		want  TagMetadata
+	}{
+		{
+			"StrongerRead",
+			TagMetadata{AntennaID: 1, PeakRSSI: &weak, FirstSeen: &t1, LastSeen: &t1, ReadCount: 1},
+			TagMetadata{AntennaID: 2, PeakRSSI: &strong, FirstSeen: &t2, LastSeen: &t2, ReadCount: 2},
+			TagMetadata{AntennaID: 2, PeakRSSI: &strong, FirstSeen: &t1, LastSeen: &t2, ReadCount: 3},
+		},
+		{
+			"WeakerRead",
+			TagMetadata{AntennaID: 2, PeakRSSI: &strong, FirstSeen: &t2, LastSeen: &t2, ReadCount: 1},
+			TagMetadata{AntennaID: 1, PeakRSSI: &weak, FirstSeen: &t1, LastSeen: &t1, ReadCount: 1},
+			TagMetadata{AntennaID: 2, PeakRSSI: &strong, FirstSeen: &t1, LastSeen: &t2, ReadCount: 2},
+		},
+		{
+			"NoRSSI",
+			TagMetadata{AntennaID: 1, ReadCount: 1},
+			TagMetadata{AntennaID: 3, ReadCount: 1},
+			TagMetadata{AntennaID: 3, ReadCount: 2},
+		},
+		{
+			"NoMetadata",
+			TagMetadata{ReadCount: 1},
+			TagMetadata{ReadCount: 1},
+			TagMetadata{ReadCount: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.md.Merge(&tt.other)
+			if !reflect.DeepEqual(tt.md, tt.want) {
+				t.Errorf("TagMetadata.Merge() = %+v, want %+v", tt.md, tt.want)
+			}
+		})
+	}
+}
+
+func TestECReportGroupListMember_extension(t *testing.T) {
+	rssi := int8(-55)
+	m := ECReportGroupListMember{
+		EPC:       "urn:epc:id:sgtin:12345678.00001.1",
+		Extension: &TagMetadata{AntennaID: 1, PeakRSSI: &rssi, ReadCount: 2},
+	}
+	out, err := xml.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<extension><antennaID>1</antennaID><peakRSSI>-55</peakRSSI><readCount>2</readCount></extension>"
+	if !strings.Contains(string(out), want) {
+		t.Errorf("xml.Marshal() = %s, want %s", out, want)
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	tests := []struct {
+		names   []string
+		want    OutputFormat
+		wantErr bool
+	}{
+		{[]string{"epc"}, OutputEPC, false},
+		{[]string{"tag", "rawhex", "rawDecimal"}, OutputTag | OutputRawHex | OutputRawDecimal, false},
+		{[]string{"binary"}, OutputBinary, false},
+		{[]string{"epc", "unknown"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.names, ","), func(t *testing.T) {
+			got, err := ParseOutputFormat(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseOutputFormat() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseOutputFormat() = %v, want %v", got, tt.want)
+			}
+			if back, _ := ParseOutputFormat(got.Names()); back != got {
+				t.Errorf("ParseOutputFormat(%v) = %v, want %v", got.Names(), back, got)
+			}
+		})
+	}
+}
+
+func TestNewECReportGroupListMember(t *testing.T) {
+	c := tdt.NewCore()
+	// urn:epc:tag:sgtin-96:3.0614141.812345.6789
+	id := []byte{48, 116, 37, 123, 247, 25, 78, 64, 0, 0, 26, 133}
+	pureIdentity := "urn:epc:id:sgtin:0614141.812345.6789"
+	tests := []struct {
+		name string
+		id   []byte
+		of   OutputFormat
+		want ECReportGroupListMember
+	}{
+		{"EPC", id, OutputEPC, ECReportGroupListMember{EPC: pureIdentity}},
+		{"Tag", id, OutputTag, ECReportGroupListMember{Tag: "urn:epc:tag:sgtin-96:3.0614141.812345.6789"}},
+		{"Raw", id, OutputRawHex | OutputRawDecimal, ECReportGroupListMember{
+			RawHex:     "urn:epc:raw:96.x3074257BF7194E4000001A85",
+			RawDecimal: "urn:epc:raw:96.14995692880814596164774009477",
+		}},
+		{"Binary", id, OutputBinary, ECReportGroupListMember{Binary: "001100000111010000100101011110111111011100011001010011100100000000000000000000000001101010000101"}},
+		{"UnknownTag", []byte{0xff, 0, 0, 1}, OutputTag, ECReportGroupListMember{Tag: "urn:epc:raw:32.xFF000001"}},
+		{"NoID", nil, OutputEPC | OutputTag | OutputRawHex, ECReportGroupListMember{EPC: pureIdentity}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewECReportGroupListMember(pureIdentity, tt.id, tt.of, c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewECReportGroupListMember() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
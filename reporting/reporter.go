@@ -0,0 +1,245 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package reporting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config holds the delivery parameters for Reporter
+type Config struct {
+	QueueSize      int           // the number of reports buffered per destination
+	MaxRetries     int           // the number of retries before giving up a report
+	InitialBackoff time.Duration // the wait before the first retry
+	MaxBackoff     time.Duration // the upper bound of the wait between retries
+	Timeout        time.Duration // the timeout for each HTTP request
+	DeadLetterFile string        // the file to store undeliverable reports, disabled if empty
+}
+
+// DefaultConfig is used for the non-positive values in Config,
+// except a zero MaxRetries which disables the retries
+var DefaultConfig = Config{
+	QueueSize:      128,
+	MaxRetries:     3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Timeout:        5 * time.Second,
+}
+
+// DeadLetter is a report failed to be delivered
+type DeadLetter struct {
+	Time      time.Time `json:"time"`
+	ReportURI string    `json:"reportURI"`
+	Error     string    `json:"error"`
+	Payload   string    `json:"payload"`
+}
+
+// Reporter delivers ECReports to the report URIs
+// with a worker goroutine per destination
+type Reporter struct {
+	config     Config
+	client     *http.Client
+	workers    map[string]*worker
+	closed     bool
+	mutex      sync.Mutex
+	deadLetter io.Writer
+	dlMutex    sync.Mutex
+	wg         sync.WaitGroup
+}
+
+// worker delivers the queued reports to a single destination
+type worker struct {
+	reportURI string
+	format    Format
+	queue     chan *ECReports
+}
+
+// NewReporter returns the pointer to a new Reporter instance
+func NewReporter(config Config) (*Reporter, error) {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultConfig.QueueSize
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = DefaultConfig.MaxRetries
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = DefaultConfig.InitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultConfig.MaxBackoff
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultConfig.Timeout
+	}
+	r := &Reporter{
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		workers: make(map[string]*worker),
+	}
+	if len(config.DeadLetterFile) != 0 {
+		fp, err := os.OpenFile(config.DeadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		r.deadLetter = fp
+	}
+	return r, nil
+}
+
+// Report enqueues the ECReports for the reportURI without blocking,
+// the report goes to the dead letter file when the queue is full
+func (r *Reporter) Report(reportURI string, ecr *ECReports) error {
+	// hold the lock while enqueueing so that Close won't close the queue meanwhile
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	w, err := r.getWorker(reportURI)
+	if err != nil {
+		r.writeDeadLetter(reportURI, ecr, XML, err)
+		return err
+	}
+	select {
+	case w.queue <- ecr:
+		return nil
+	default:
+		err = fmt.Errorf("report queue for %s is full", reportURI)
+		r.writeDeadLetter(reportURI, ecr, w.format, err)
+		return err
+	}
+}
+
+// Remove stops the worker for the reportURI after it delivers the queued reports,
+// a later report to the reportURI starts a new one
+func (r *Reporter) Remove(reportURI string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if w, ok := r.workers[reportURI]; ok {
+		close(w.queue)
+		delete(r.workers, reportURI)
+		log.Printf("[Reporter] stopped the worker for %s", reportURI)
+	}
+}
+
+// Close stops accepting reports and waits for the workers to drain their queues
+func (r *Reporter) Close() {
+	r.mutex.Lock()
+	r.closed = true
+	for reportURI, w := range r.workers {
+		close(w.queue)
+		delete(r.workers, reportURI)
+	}
+	r.mutex.Unlock()
+	r.wg.Wait()
+	if c, ok := r.deadLetter.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// getWorker returns the worker for the reportURI, starts one if not exists yet
+// the caller must hold r.mutex
+func (r *Reporter) getWorker(reportURI string) (*worker, error) {
+	if r.closed {
+		return nil, errors.New("reporter is already closed")
+	}
+	if w, ok := r.workers[reportURI]; ok {
+		return w, nil
+	}
+	format, err := FormatOf(reportURI)
+	if err != nil {
+		return nil, err
+	}
+	w := &worker{
+		reportURI: reportURI,
+		format:    format,
+		queue:     make(chan *ECReports, r.config.QueueSize),
+	}
+	r.workers[reportURI] = w
+	r.wg.Add(1)
+	go r.run(w)
+	log.Printf("[Reporter] started a worker for %s", reportURI)
+	return w, nil
+}
+
+// run delivers the reports in the worker's queue until it gets closed
+func (r *Reporter) run(w *worker) {
+	defer r.wg.Done()
+	for ecr := range w.queue {
+		payload, err := ecr.Encode(w.format)
+		if err != nil {
+			r.writeDeadLetter(w.reportURI, ecr, w.format, err)
+			continue
+		}
+		backoff := r.config.InitialBackoff
+		for attempt := 0; ; attempt++ {
+			err = r.post(w.reportURI, w.format, payload)
+			if err == nil {
+				break
+			}
+			if attempt >= r.config.MaxRetries {
+				log.Printf("[Reporter] giving up a report to %s: %v", w.reportURI, err)
+				r.writeDeadLetter(w.reportURI, ecr, w.format, err)
+				break
+			}
+			log.Printf("[Reporter] retrying a report to %s in %v: %v", w.reportURI, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > r.config.MaxBackoff {
+				backoff = r.config.MaxBackoff
+			}
+		}
+	}
+}
+
+// post sends the payload to the reportURI
+func (r *Reporter) post(reportURI string, format Format, payload []byte) error {
+	resp, err := r.client.Post(reportURI, format.ContentType(), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// writeDeadLetter appends the undeliverable report to the dead letter file
+func (r *Reporter) writeDeadLetter(reportURI string, ecr *ECReports, format Format, cause error) {
+	if r.deadLetter == nil {
+		return
+	}
+	payload, err := ecr.Encode(format)
+	if err != nil {
+		payload = []byte{}
+	}
+	line, err := json.Marshal(&DeadLetter{
+		Time:      time.Now(),
+		ReportURI: reportURI,
+		Error:     cause.Error(),
+		Payload:   string(payload),
+	})
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	r.dlMutex.Lock()
+	defer r.dlMutex.Unlock()
+	if _, err = r.deadLetter.Write(append(line, '\n')); err != nil {
+		log.Print(err)
+	}
+}
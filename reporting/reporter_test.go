@@ -0,0 +1,202 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package reporting
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		name      string
+		reportURI string
+		want      Format
+		wantErr   bool
+	}{
+		{"http", "http://localhost:8888/reports", XML, false},
+		{"https json", "https://localhost:8888/reports?format=json", JSON, false},
+		{"tcp", "tcp://localhost:8888", XML, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatOf(tt.reportURI)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FormatOf() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("FormatOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestECReports_Encode(t *testing.T) {
+	epcs := []string{"urn:epc:id:sgtin:0614141.812345.6789", "urn:epc:id:sscc:0614141.1234567890"}
+	ecr := NewECReports("spec", "report", epcs)
+
+	// XML
+	out, err := ecr.Encode(XML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := &struct {
+		XMLName  xml.Name
+		SpecName string   `xml:"specName,attr"`
+		EPCs     []string `xml:"reports>report>group>groupList>member>epc"`
+	}{}
+	if err = xml.Unmarshal(out, x); err != nil {
+		t.Fatal(err)
+	}
+	if x.XMLName.Space != ALENamespace || x.SpecName != "spec" || !reflect.DeepEqual(x.EPCs, epcs) {
+		t.Errorf("ECReports.Encode(XML) = %s", out)
+	}
+
+	// JSON
+	out, err = ecr.Encode(JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := &ECReports{}
+	if err = json.Unmarshal(out, j); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, m := range j.Reports[0].Groups[0].Members {
+		got = append(got, m.EPC)
+	}
+	if !reflect.DeepEqual(got, epcs) {
+		t.Errorf("ECReports.Encode(JSON) members = %v, want %v", got, epcs)
+	}
+}
+
+func TestReporter_Report(t *testing.T) {
+	var mutex sync.Mutex
+	var attempts int
+	received := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		attempts++
+		n := attempts
+		mutex.Unlock()
+		// fail the first attempt to exercise the retry
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r.Header.Get("Content-Type") + " " + string(body[:5])
+	}))
+	defer ts.Close()
+
+	r, err := NewReporter(Config{InitialBackoff: time.Millisecond, MaxRetries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err = r.Report(ts.URL+"?format=json", NewECReports("spec", "report", []string{"urn:epc:id:sgtin:0614141.812345.6789"})); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if want := "application/json {\"sch"; got != want {
+			t.Errorf("Reporter.Report() delivered %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reporter.Report() didn't deliver the report")
+	}
+}
+
+func TestReporter_DeadLetter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "reporting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dlf := filepath.Join(dir, "deadletter.log")
+
+	r, err := NewReporter(Config{InitialBackoff: time.Millisecond, MaxRetries: 1, DeadLetterFile: dlf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Report(ts.URL, NewECReports("spec", "report", []string{}))
+	r.Report("ftp://localhost/", NewECReports("spec", "report", []string{}))
+	r.Close()
+
+	fp, err := os.Open(dlf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	got := []string{}
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		dl := &DeadLetter{}
+		if err := json.Unmarshal(scanner.Bytes(), dl); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, dl.ReportURI)
+	}
+	want := []string{"ftp://localhost/", ts.URL}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dead letters = %v, want %v", got, want)
+	}
+}
+
+func TestReporter_Remove(t *testing.T) {
+	received := make(chan string, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path
+	}))
+	defer ts.Close()
+
+	r, err := NewReporter(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err = r.Report(ts.URL+"/a", NewECReports("spec", "report", []string{})); err != nil {
+		t.Fatal(err)
+	}
+	// the queued report is still delivered
+	r.Remove(ts.URL + "/a")
+	r.Remove(ts.URL + "/b")
+	r.mutex.Lock()
+	n := len(r.workers)
+	r.mutex.Unlock()
+	if n != 0 {
+		t.Errorf("Reporter.Remove() left %v workers", n)
+	}
+	if err = r.Report(ts.URL+"/a", NewECReports("spec", "report", []string{})); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case got := <-received:
+			if got != "/a" {
+				t.Errorf("Reporter.Report() delivered to %v, want /a", got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Reporter.Report() didn't deliver the report")
+		}
+	}
+}
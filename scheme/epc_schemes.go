@@ -0,0 +1,398 @@
+// Package scheme contains scheme related utilities
+package scheme
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/iomz/go-llrp/binutil"
+)
+
+// Key values for PartitionTables of the other EPC schemes
+const (
+	LRBits PartitionTableKey = iota + IARDigits + 1
+	LRDigits
+	DTBits
+	DTDigits
+	SRBits
+	SRDigits
+	PRBits
+	PRDigits
+	CRBits
+	CRDigits
+)
+
+// CPI96PartitionTable is PT for CPI-96
+var CPI96PartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, PRBits: 11, PRDigits: 3},
+	11: {PValue: 1, CPBits: 37, PRBits: 14, PRDigits: 4},
+	10: {PValue: 2, CPBits: 34, PRBits: 17, PRDigits: 5},
+	9:  {PValue: 3, CPBits: 30, PRBits: 21, PRDigits: 6},
+	8:  {PValue: 4, CPBits: 27, PRBits: 24, PRDigits: 7},
+	7:  {PValue: 5, CPBits: 24, PRBits: 27, PRDigits: 8},
+	6:  {PValue: 6, CPBits: 20, PRBits: 31, PRDigits: 9},
+}
+
+// CPIVarPartitionTable is PT for CPI-var
+// PRDigits is the "max" length
+var CPIVarPartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, PRBits: 114, PRDigits: 18},
+	11: {PValue: 1, CPBits: 37, PRBits: 120, PRDigits: 19},
+	10: {PValue: 2, CPBits: 34, PRBits: 126, PRDigits: 20},
+	9:  {PValue: 3, CPBits: 30, PRBits: 132, PRDigits: 21},
+	8:  {PValue: 4, CPBits: 27, PRBits: 138, PRDigits: 22},
+	7:  {PValue: 5, CPBits: 24, PRBits: 144, PRDigits: 23},
+	6:  {PValue: 6, CPBits: 20, PRBits: 150, PRDigits: 24},
+}
+
+// GDTIPartitionTable is PT for GDTI
+var GDTIPartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, DTBits: 1, DTDigits: 0},
+	11: {PValue: 1, CPBits: 37, DTBits: 4, DTDigits: 1},
+	10: {PValue: 2, CPBits: 34, DTBits: 7, DTDigits: 2},
+	9:  {PValue: 3, CPBits: 30, DTBits: 11, DTDigits: 3},
+	8:  {PValue: 4, CPBits: 27, DTBits: 14, DTDigits: 4},
+	7:  {PValue: 5, CPBits: 24, DTBits: 17, DTDigits: 5},
+	6:  {PValue: 6, CPBits: 20, DTBits: 21, DTDigits: 6},
+}
+
+// GIAI202PartitionTable is PT for GIAI-202
+// IARDigits is the "max" length
+var GIAI202PartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, IARBits: 148, IARDigits: 18},
+	11: {PValue: 1, CPBits: 37, IARBits: 151, IARDigits: 19},
+	10: {PValue: 2, CPBits: 34, IARBits: 154, IARDigits: 20},
+	9:  {PValue: 3, CPBits: 30, IARBits: 158, IARDigits: 21},
+	8:  {PValue: 4, CPBits: 27, IARBits: 161, IARDigits: 22},
+	7:  {PValue: 5, CPBits: 24, IARBits: 164, IARDigits: 23},
+	6:  {PValue: 6, CPBits: 20, IARBits: 168, IARDigits: 24},
+}
+
+// GSRNPartitionTable is PT for GSRN and GSRNP
+var GSRNPartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, SRBits: 18, SRDigits: 5},
+	11: {PValue: 1, CPBits: 37, SRBits: 21, SRDigits: 6},
+	10: {PValue: 2, CPBits: 34, SRBits: 24, SRDigits: 7},
+	9:  {PValue: 3, CPBits: 30, SRBits: 28, SRDigits: 8},
+	8:  {PValue: 4, CPBits: 27, SRBits: 31, SRDigits: 9},
+	7:  {PValue: 5, CPBits: 24, SRBits: 34, SRDigits: 10},
+	6:  {PValue: 6, CPBits: 20, SRBits: 38, SRDigits: 11},
+}
+
+// SGCNPartitionTable is PT for SGCN
+var SGCNPartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, CRBits: 1, CRDigits: 0},
+	11: {PValue: 1, CPBits: 37, CRBits: 4, CRDigits: 1},
+	10: {PValue: 2, CPBits: 34, CRBits: 7, CRDigits: 2},
+	9:  {PValue: 3, CPBits: 30, CRBits: 11, CRDigits: 3},
+	8:  {PValue: 4, CPBits: 27, CRBits: 14, CRDigits: 4},
+	7:  {PValue: 5, CPBits: 24, CRBits: 17, CRDigits: 5},
+	6:  {PValue: 6, CPBits: 20, CRBits: 21, CRDigits: 6},
+}
+
+// SGLNPartitionTable is PT for SGLN
+var SGLNPartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, LRBits: 1, LRDigits: 0},
+	11: {PValue: 1, CPBits: 37, LRBits: 4, LRDigits: 1},
+	10: {PValue: 2, CPBits: 34, LRBits: 7, LRDigits: 2},
+	9:  {PValue: 3, CPBits: 30, LRBits: 11, LRDigits: 3},
+	8:  {PValue: 4, CPBits: 27, LRBits: 14, LRDigits: 4},
+	7:  {PValue: 5, CPBits: 24, LRBits: 17, LRDigits: 5},
+	6:  {PValue: 6, CPBits: 20, LRBits: 21, LRDigits: 6},
+}
+
+// epcField is a field of the EPC with its value in the pattern URI
+type epcField struct {
+	value string
+	bits  func() ([]rune, error)
+}
+
+// GetNumericString returns the numeric string with the leading 1 as rune slice
+func GetNumericString(s string, length int) ([]rune, error) {
+	if s == "" {
+		return GetSerial("", length), nil
+	}
+	return GetUint("1"+s, length)
+}
+
+// GetPartition returns the partition and the Company Prefix as rune slice
+func GetPartition(cp string, pt PartitionTable) ([]rune, error) {
+	pr, ok := pt[len(cp)]
+	if !ok {
+		return []rune{}, fmt.Errorf("invalid companyPrefix: %v", cp)
+	}
+	partition := []rune(fmt.Sprintf("%.3b", pr[PValue]))
+	return append(partition, GetCompanyPrefix(cp, pt)...), nil
+}
+
+// GetReference returns the reference padded to the digits as rune slice
+func GetReference(ref string, bits int, digits int) ([]rune, error) {
+	switch {
+	case ref == "" && digits != 0:
+		reference, _ := binutil.GenerateNLengthRandomBinRuneSlice(bits, uint(math.Pow(float64(10), float64(digits))))
+		return reference, nil
+	case len(ref) != digits:
+		return []rune{}, fmt.Errorf("reference %v, want %v digits", ref, digits)
+	case ref == "":
+		return GetUint("0", bits)
+	}
+	return GetUint(ref, bits)
+}
+
+// GetString returns the string in charBits characters as rune slice,
+// padded with zeros to length, or terminated with zeros if terminated
+func GetString(s string, charBits int, length int, terminated bool) ([]rune, error) {
+	str := []rune{}
+	for _, c := range []byte(s) {
+		if charBits == 6 && (c < 0x20 || 0x60 <= c || c == '@') || charBits != 6 && (c == 0 || 1<<uint(charBits) <= int(c)) {
+			return []rune{}, fmt.Errorf("invalid character in %v", s)
+		}
+		str = append(str, []rune(fmt.Sprintf("%0*b", charBits, c&(1<<uint(charBits)-1)))...)
+	}
+	if terminated {
+		str = append(str, binutil.GenerateNLengthZeroPaddingRuneSlice(charBits)...)
+	}
+	if len(str) > length {
+		return []rune{}, fmt.Errorf("%v is too long for %v bits", s, length)
+	}
+	if !terminated {
+		str = append(str, binutil.GenerateNLengthZeroPaddingRuneSlice(length-len(str))...)
+	}
+	return str, nil
+}
+
+// GetUint returns the decimal in length bits as rune slice
+func GetUint(s string, length int) ([]rune, error) {
+	if s == "" {
+		return GetSerial("", length), nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || length < 64 && n >= 1<<uint(length) {
+		return []rune{}, fmt.Errorf("%v overflows %v bits", s, length)
+	}
+	return []rune(fmt.Sprintf("%0*b", length, n)), nil
+}
+
+// MakeADIVar generates ADI-var
+func MakeADIVar(pf bool, fv string, cage string, pn string, ser string) ([]byte, string, string, error) {
+	return makeEPC(pf, 0x3B, "adi-var", 0, []epcField{
+		{fv, func() ([]rune, error) { return GetUint(fv, 6) }},
+		{cage, func() ([]rune, error) { return GetString(fmt.Sprintf("%6s", cage), 6, 36, false) }},
+		{pn, func() ([]rune, error) { return GetString(pn, 6, 198, true) }},
+		{ser, func() ([]rune, error) { return GetString(ser, 6, 186, true) }},
+	})
+}
+
+// MakeCPI96 generates CPI-96
+func MakeCPI96(pf bool, fv string, cp string, pr string, ser string) ([]byte, string, string, error) {
+	return makeEPC(pf, 0x3C, "cpi-96", 96, []epcField{
+		{fv, func() ([]rune, error) { return GetFilter(fv), nil }},
+		{cp, func() ([]rune, error) { return GetPartition(cp, CPI96PartitionTable) }},
+		{pr, func() ([]rune, error) { return GetUint(pr, CPI96PartitionTable[len(cp)][PRBits]) }},
+		{ser, func() ([]rune, error) { return GetUint(ser, 31) }},
+	})
+}
+
+// MakeCPIVar generates CPI-var
+func MakeCPIVar(pf bool, fv string, cp string, pr string, ser string) ([]byte, string, string, error) {
+	return makeEPC(pf, 0x3D, "cpi-var", 0, []epcField{
+		{fv, func() ([]rune, error) { return GetFilter(fv), nil }},
+		{cp, func() ([]rune, error) { return GetPartition(cp, CPIVarPartitionTable) }},
+		{pr, func() ([]rune, error) { return GetString(pr, 6, CPIVarPartitionTable[len(cp)][PRBits], true) }},
+		{ser, func() ([]rune, error) { return GetUint(ser, 40) }},
+	})
+}
+
+// MakeGDTI96 generates GDTI-96
+func MakeGDTI96(pf bool, fv string, cp string, dt string, ser string) ([]byte, string, string, error) {
+	return makeGDTI(pf, 0x2C, "gdti-96", 96, fv, cp, dt, epcField{ser, func() ([]rune, error) { return GetUint(ser, 41) }})
+}
+
+// MakeGDTI113 generates GDTI-113
+func MakeGDTI113(pf bool, fv string, cp string, dt string, ser string) ([]byte, string, string, error) {
+	return makeGDTI(pf, 0x3A, "gdti-113", 113, fv, cp, dt, epcField{ser, func() ([]rune, error) { return GetNumericString(ser, 58) }})
+}
+
+// MakeGDTI174 generates GDTI-174
+func MakeGDTI174(pf bool, fv string, cp string, dt string, ser string) ([]byte, string, string, error) {
+	return makeGDTI(pf, 0x3E, "gdti-174", 174, fv, cp, dt, epcField{ser, func() ([]rune, error) { return GetString(ser, 7, 119, false) }})
+}
+
+// MakeGIAI202 generates GIAI-202
+func MakeGIAI202(pf bool, fv string, cp string, iar string) ([]byte, string, string, error) {
+	return makeEPC(pf, 0x38, "giai-202", 202, []epcField{
+		{fv, func() ([]rune, error) { return GetFilter(fv), nil }},
+		{cp, func() ([]rune, error) { return GetPartition(cp, GIAI202PartitionTable) }},
+		{iar, func() ([]rune, error) { return GetString(iar, 7, GIAI202PartitionTable[len(cp)][IARBits], false) }},
+	})
+}
+
+// MakeGID96 generates GID-96
+func MakeGID96(pf bool, gmn string, oc string, ser string) ([]byte, string, string, error) {
+	return makeEPC(pf, 0x35, "gid-96", 96, []epcField{
+		{gmn, func() ([]rune, error) { return GetUint(gmn, 28) }},
+		{oc, func() ([]rune, error) { return GetUint(oc, 24) }},
+		{ser, func() ([]rune, error) { return GetUint(ser, 36) }},
+	})
+}
+
+// MakeGRAI170 generates GRAI-170
+func MakeGRAI170(pf bool, fv string, cp string, at string, ser string) ([]byte, string, string, error) {
+	return makeEPC(pf, 0x37, "grai-170", 170, []epcField{
+		{fv, func() ([]rune, error) { return GetFilter(fv), nil }},
+		{cp, func() ([]rune, error) { return GetPartition(cp, GRAI96PartitionTable) }},
+		{at, func() ([]rune, error) {
+			pr := GRAI96PartitionTable[len(cp)]
+			return GetReference(at, pr[ATBits], pr[ATDigits])
+		}},
+		{ser, func() ([]rune, error) { return GetString(ser, 7, 112, false) }},
+	})
+}
+
+// MakeGSRN96 generates GSRN-96
+func MakeGSRN96(pf bool, fv string, cp string, sr string) ([]byte, string, string, error) {
+	return makeGSRN(pf, 0x2D, "gsrn-96", fv, cp, sr)
+}
+
+// MakeGSRNP96 generates GSRNP-96
+func MakeGSRNP96(pf bool, fv string, cp string, sr string) ([]byte, string, string, error) {
+	return makeGSRN(pf, 0x2E, "gsrnp-96", fv, cp, sr)
+}
+
+// MakeSGCN96 generates SGCN-96
+func MakeSGCN96(pf bool, fv string, cp string, cr string, ser string) ([]byte, string, string, error) {
+	return makeEPC(pf, 0x3F, "sgcn-96", 96, []epcField{
+		{fv, func() ([]rune, error) { return GetFilter(fv), nil }},
+		{cp, func() ([]rune, error) { return GetPartition(cp, SGCNPartitionTable) }},
+		{cr, func() ([]rune, error) {
+			pr := SGCNPartitionTable[len(cp)]
+			return GetReference(cr, pr[CRBits], pr[CRDigits])
+		}},
+		{ser, func() ([]rune, error) { return GetNumericString(ser, 41) }},
+	})
+}
+
+// MakeSGLN96 generates SGLN-96
+func MakeSGLN96(pf bool, fv string, cp string, lr string, ext string) ([]byte, string, string, error) {
+	return makeSGLN(pf, 0x32, "sgln-96", 96, fv, cp, lr, epcField{ext, func() ([]rune, error) { return GetUint(ext, 41) }})
+}
+
+// MakeSGLN195 generates SGLN-195
+func MakeSGLN195(pf bool, fv string, cp string, lr string, ext string) ([]byte, string, string, error) {
+	return makeSGLN(pf, 0x39, "sgln-195", 195, fv, cp, lr, epcField{ext, func() ([]rune, error) { return GetString(ext, 7, 140, false) }})
+}
+
+// MakeSGTIN198 generates SGTIN-198
+func MakeSGTIN198(pf bool, fv string, cp string, ir string, ser string) ([]byte, string, string, error) {
+	return makeEPC(pf, 0x36, "sgtin-198", 198, []epcField{
+		{fv, func() ([]rune, error) { return GetFilter(fv), nil }},
+		{cp, func() ([]rune, error) { return GetPartition(cp, SGTIN96PartitionTable) }},
+		{ir, func() ([]rune, error) {
+			pr := SGTIN96PartitionTable[len(cp)]
+			return GetReference(ir, pr[IRBits], pr[IRDigits])
+		}},
+		{ser, func() ([]rune, error) { return GetString(ser, 7, 140, false) }},
+	})
+}
+
+// MakeUSDOD96 generates USDOD-96
+func MakeUSDOD96(pf bool, fv string, cage string, ser string) ([]byte, string, string, error) {
+	return makeEPC(pf, 0x2F, "usdod-96", 96, []epcField{
+		{fv, func() ([]rune, error) { return GetUint(fv, 4) }},
+		{cage, func() ([]rune, error) { return GetString(fmt.Sprintf("%6s", cage), 8, 48, false) }},
+		{ser, func() ([]rune, error) { return GetUint(ser, 36) }},
+	})
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// makeEPC generates the EPC of the fields following the header,
+// the EPC is padded to the 16-bit boundary
+// if pf is true, returns the prefix and the pattern until an empty field instead
+func makeEPC(pf bool, header uint8, patternType string, size int, fields []epcField) ([]byte, string, string, error) {
+	bs := []rune{}
+	values := []string{}
+	for _, f := range fields {
+		if pf && f.value == "" {
+			break
+		}
+		b, err := f.bits()
+		if err != nil {
+			return []byte{}, "", "", err
+		}
+		bs = append(bs, b...)
+		values = append(values, escapeURI(f.value))
+	}
+
+	if pf {
+		return []byte{}, fmt.Sprintf("%.8b", header) + string(bs), "urn:epc:pat:" + patternType + ":" + strings.Join(values, "."), nil
+	}
+
+	if size != 0 && len(bs) != size-8 {
+		return []byte{}, "", "", fmt.Errorf("len(bs): %v, want %v", len(bs), size-8)
+	}
+	if padding := (len(bs) + 8) % 16; padding != 0 {
+		bs = append(bs, binutil.GenerateNLengthZeroPaddingRuneSlice(16-padding)...)
+	}
+
+	p, err := binutil.ParseBinRuneSliceToUint8Slice(bs)
+	if err != nil {
+		return []byte{}, "", "", err
+	}
+	return append([]byte{header}, p...), "", "", nil
+}
+
+// makeGDTI generates GDTI with the serial
+func makeGDTI(pf bool, header uint8, patternType string, size int, fv string, cp string, dt string, ser epcField) ([]byte, string, string, error) {
+	return makeEPC(pf, header, patternType, size, []epcField{
+		{fv, func() ([]rune, error) { return GetFilter(fv), nil }},
+		{cp, func() ([]rune, error) { return GetPartition(cp, GDTIPartitionTable) }},
+		{dt, func() ([]rune, error) {
+			pr := GDTIPartitionTable[len(cp)]
+			return GetReference(dt, pr[DTBits], pr[DTDigits])
+		}},
+		ser,
+	})
+}
+
+// makeGSRN generates GSRN or GSRNP
+func makeGSRN(pf bool, header uint8, patternType string, fv string, cp string, sr string) ([]byte, string, string, error) {
+	return makeEPC(pf, header, patternType, 96, []epcField{
+		{fv, func() ([]rune, error) { return GetFilter(fv), nil }},
+		{cp, func() ([]rune, error) { return GetPartition(cp, GSRNPartitionTable) }},
+		{sr, func() ([]rune, error) {
+			pr := GSRNPartitionTable[len(cp)]
+			return GetReference(sr, pr[SRBits], pr[SRDigits])
+		}},
+		// 24 bits reserved
+		{"", func() ([]rune, error) { return binutil.GenerateNLengthZeroPaddingRuneSlice(24), nil }},
+	})
+}
+
+// makeSGLN generates SGLN with the extension
+func makeSGLN(pf bool, header uint8, patternType string, size int, fv string, cp string, lr string, ext epcField) ([]byte, string, string, error) {
+	return makeEPC(pf, header, patternType, size, []epcField{
+		{fv, func() ([]rune, error) { return GetFilter(fv), nil }},
+		{cp, func() ([]rune, error) { return GetPartition(cp, SGLNPartitionTable) }},
+		{lr, func() ([]rune, error) {
+			pr := SGLNPartitionTable[len(cp)]
+			return GetReference(lr, pr[LRBits], pr[LRDigits])
+		}},
+		ext,
+	})
+}
+
+// escapeURI escapes the characters reserved in the EPC URI
+func escapeURI(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if strings.IndexByte("\"#%&/<>?", c) < 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,109 @@
+package scheme
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/iomz/gosstrak/tdt"
+)
+
+func TestMakeEPCSchemes_roundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		make    func(pf bool) ([]byte, string, string, error)
+		want    string
+		wantPat string
+	}{
+		{"SGTIN-198", func(pf bool) ([]byte, string, string, error) {
+			return MakeSGTIN198(pf, "3", "0614141", "812345", "12345/XYZ")
+		}, "urn:epc:id:sgtin:0614141.812345.12345%2FXYZ", "urn:epc:pat:sgtin-198:3.0614141.812345.12345%2FXYZ"},
+		{"SGLN-96", func(pf bool) ([]byte, string, string, error) {
+			return MakeSGLN96(pf, "3", "0614141", "12345", "5678")
+		}, "urn:epc:id:sgln:0614141.12345.5678", "urn:epc:pat:sgln-96:3.0614141.12345.5678"},
+		{"SGLN-195 without LR", func(pf bool) ([]byte, string, string, error) {
+			return MakeSGLN195(pf, "3", "061414112345", "", "32a/b")
+		}, "urn:epc:id:sgln:061414112345..32a%2Fb", "urn:epc:pat:sgln-195:3.061414112345"},
+		{"GRAI-170", func(pf bool) ([]byte, string, string, error) {
+			return MakeGRAI170(pf, "3", "0614141", "12345", "32a/b")
+		}, "urn:epc:id:grai:0614141.12345.32a%2Fb", "urn:epc:pat:grai-170:3.0614141.12345.32a%2Fb"},
+		{"GIAI-202", func(pf bool) ([]byte, string, string, error) {
+			return MakeGIAI202(pf, "3", "0614141", "12345ABC")
+		}, "urn:epc:id:giai:0614141.12345ABC", "urn:epc:pat:giai-202:3.0614141.12345ABC"},
+		{"GDTI-96", func(pf bool) ([]byte, string, string, error) {
+			return MakeGDTI96(pf, "3", "0614141", "12345", "400")
+		}, "urn:epc:id:gdti:0614141.12345.400", "urn:epc:pat:gdti-96:3.0614141.12345.400"},
+		{"GDTI-113", func(pf bool) ([]byte, string, string, error) {
+			return MakeGDTI113(pf, "3", "0614141", "12345", "0000400")
+		}, "urn:epc:id:gdti:0614141.12345.0000400", "urn:epc:pat:gdti-113:3.0614141.12345.0000400"},
+		{"GDTI-174", func(pf bool) ([]byte, string, string, error) {
+			return MakeGDTI174(pf, "3", "0614141", "12345", "ABC-1")
+		}, "urn:epc:id:gdti:0614141.12345.ABC-1", "urn:epc:pat:gdti-174:3.0614141.12345.ABC-1"},
+		{"GSRN-96", func(pf bool) ([]byte, string, string, error) {
+			return MakeGSRN96(pf, "3", "0614141", "1234567890")
+		}, "urn:epc:id:gsrn:0614141.1234567890", "urn:epc:pat:gsrn-96:3.0614141.1234567890"},
+		{"GSRNP-96", func(pf bool) ([]byte, string, string, error) {
+			return MakeGSRNP96(pf, "3", "0614141", "1234567890")
+		}, "urn:epc:id:gsrnp:0614141.1234567890", "urn:epc:pat:gsrnp-96:3.0614141.1234567890"},
+		{"CPI-96", func(pf bool) ([]byte, string, string, error) {
+			return MakeCPI96(pf, "3", "0614141", "123", "5678")
+		}, "urn:epc:id:cpi:0614141.123.5678", "urn:epc:pat:cpi-96:3.0614141.123.5678"},
+		{"CPI-var", func(pf bool) ([]byte, string, string, error) {
+			return MakeCPIVar(pf, "3", "0614141", "5PQ7/Z43", "12345")
+		}, "urn:epc:id:cpi:0614141.5PQ7%2FZ43.12345", "urn:epc:pat:cpi-var:3.0614141.5PQ7%2FZ43.12345"},
+		{"SGCN-96", func(pf bool) ([]byte, string, string, error) {
+			return MakeSGCN96(pf, "3", "4012345", "67890", "04711")
+		}, "urn:epc:id:sgcn:4012345.67890.04711", "urn:epc:pat:sgcn-96:3.4012345.67890.04711"},
+		{"GID-96", func(pf bool) ([]byte, string, string, error) {
+			return MakeGID96(pf, "95100000", "12345", "400")
+		}, "urn:epc:id:gid:95100000.12345.400", "urn:epc:pat:gid-96:95100000.12345.400"},
+		{"USDOD-96", func(pf bool) ([]byte, string, string, error) {
+			return MakeUSDOD96(pf, "3", "2S194", "12345678901")
+		}, "urn:epc:id:usdod:2S194.12345678901", "urn:epc:pat:usdod-96:3.2S194.12345678901"},
+		{"ADI-var", func(pf bool) ([]byte, string, string, error) {
+			return MakeADIVar(pf, "3", "W81X9C", "3KL984PX1", "#2WMA52")
+		}, "urn:epc:id:adi:W81X9C.3KL984PX1.%232WMA52", "urn:epc:pat:adi-var:3.W81X9C.3KL984PX1.%232WMA52"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, _, _, err := tt.make(false)
+			if err != nil {
+				t.Fatalf("encode error = %v", err)
+			}
+			if len(id)%2 != 0 {
+				t.Errorf("len(id) = %v, want words", len(id))
+			}
+			pc := []byte{uint8(len(id) / 2 << 3), 0}
+			got, err := tdt.NewCore().Translate(pc, id)
+			if err != nil {
+				t.Fatalf("Translate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Translate() = %v, want %v", got, tt.want)
+			}
+
+			_, prefix, pat, err := tt.make(true)
+			if err != nil {
+				t.Fatalf("prefix error = %v", err)
+			}
+			if pat != tt.wantPat {
+				t.Errorf("pattern = %v, want %v", pat, tt.wantPat)
+			}
+			tf := strings.Split(strings.TrimPrefix(pat, "urn:epc:pat:"), ":")
+			fs, err := tdt.MakePrefixFilterString(tf[0], strings.Split(tf[1], "."))
+			if err != nil {
+				t.Fatalf("MakePrefixFilterString() error = %v", err)
+			}
+			if fs != prefix {
+				t.Errorf("MakePrefixFilterString() = %v, want %v", fs, prefix)
+			}
+			bs := ""
+			for _, b := range id {
+				bs += fmt.Sprintf("%.8b", b)
+			}
+			if !strings.HasPrefix(bs, prefix) {
+				t.Errorf("prefix %v doesn't match the id %v", prefix, bs)
+			}
+		})
+	}
+}
@@ -36,6 +36,12 @@ func MakeEPC(pf bool, cs string, fv string, cp string, ir string, ext string, se
 		uii, f, elem, _ = MakeSGTIN96(pf, fv, cp, ir, ser)
 	case "SSCC-96":
 		uii, f, elem, _ = MakeSSCC96(pf, fv, cp, ext)
+	case "GIAI-202":
+		uii, f, elem, _ = MakeGIAI202(pf, fv, cp, iar)
+	case "GRAI-170":
+		uii, f, elem, _ = MakeGRAI170(pf, fv, cp, at, ser)
+	case "SGTIN-198":
+		uii, f, elem, _ = MakeSGTIN198(pf, fv, cp, ir, ser)
 	}
 
 	// If only prefix flag is on, return prefix as epc
@@ -43,10 +49,9 @@ func MakeEPC(pf bool, cs string, fv string, cp string, ir string, ext string, se
 		return f, elem
 	}
 
-	// TODO: update pc when length changed (for non-96-bit codes)
 	pc := binutil.Pack([]interface{}{
-		uint8(48), // L4-0=11000(6words=96bits), UMI=0, XI=0
-		uint8(0),  // RFU=0
+		uint8(len(uii) / 2 << 3), // L4-0=the length in words (11000 for 96bits), UMI=0, XI=0
+		uint8(0),                 // RFU=0
 	})
 
 	uiibs, _ := binutil.ParseHexStringToBinString(hex.EncodeToString(uii))
@@ -71,10 +76,22 @@ func MakeISO(pf bool, std string, oc string, ei string, csn string, di string, i
 		afi := "A9" // 0xA9 ISO 17363 freight containers
 		uii, length, f, elem, _ = MakeISO17363(pf, oc, ei, csn)
 		pc = MakeISOPC(length, afi)
+	case "17364":
+		afi := "A3" // 0xA3 ISO 17364 returnable transport items
+		uii, length, f, elem, _ = MakeISO17364(pf, di, iac, cin, sn)
+		pc = MakeISOPC(length, afi)
 	case "17365":
 		afi := "A2" // 0xA2 ISO 17365 transport uit
 		uii, length, f, elem, _ = MakeISO17365(pf, di, iac, cin, sn)
 		pc = MakeISOPC(length, afi)
+	case "17366":
+		afi := "A5" // 0xA5 ISO 17366 product packaging
+		uii, length, f, elem, _ = MakeISO17366(pf, di, iac, cin, sn)
+		pc = MakeISOPC(length, afi)
+	case "17367":
+		afi := "A1" // 0xA1 ISO 17367 product tagging
+		uii, length, f, elem, _ = MakeISO17367(pf, di, iac, cin, sn)
+		pc = MakeISOPC(length, afi)
 	}
 
 	// If only prefix flag is on, return prefix as iso uii
@@ -87,14 +87,55 @@ func MakeISO17363(pf bool, oc string, ei string, csn string) ([]byte, int, strin
 	return binutil.Pack(iso17363), length, "", "", nil
 }
 
-// MakeISO17365 generates a random 17367 code
+// MakeISO17364 generates a random 17364 code of the returnable transport item
+func MakeISO17364(pf bool, di string, iac string, cin string, sn string) ([]byte, int, string, string, error) {
+	return makeISO15459("iso17364", pf, di, iac, cin, sn)
+}
+
+// MakeISO17365 generates a random 17365 code of the transport unit
 func MakeISO17365(pf bool, di string, iac string, cin string, sn string) ([]byte, int, string, string, error) {
+	return makeISO15459("iso17365", pf, di, iac, cin, sn)
+}
+
+// MakeISO17366 generates a random 17366 code of the product packaging
+func MakeISO17366(pf bool, di string, iac string, cin string, sn string) ([]byte, int, string, string, error) {
+	return makeISO15459("iso17366", pf, di, iac, cin, sn)
+}
+
+// MakeISO17367 generates a random 17367 code of the product
+func MakeISO17367(pf bool, di string, iac string, cin string, sn string) ([]byte, int, string, string, error) {
+	return makeISO15459("iso17367", pf, di, iac, cin, sn)
+}
+
+// Pad6BitEncodingRuneSlice returns a new length
+// and 16-bit (word-length) padded binary string in rune slice
+// @ISO15962
+func Pad6BitEncodingRuneSlice(bs []rune) ([]rune, int) {
+	length := len(bs)
+	remainder := length % 16
+	var padding []rune
+	if remainder != 0 {
+		padRuneSlice := binutil.ParseDecimalStringToBinRuneSlice("32") // pad string "100000"
+		for i := 0; i < 16-remainder; i++ {
+			padding = append(padding, padRuneSlice[i%6])
+		}
+		bs = append(bs, padding...)
+		length += 16 - remainder
+	}
+	return bs, length
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// makeISO15459 generates a random code of the standard with the IAC, CIN and SN of ISO/IEC 15459
+func makeISO15459(standard string, pf bool, di string, iac string, cin string, sn string) ([]byte, int, string, string, error) {
+	pat := "urn:epc:pat:" + standard + ":"
 	dataIdentifier := binutil.ParseRuneSliceTo6BinRuneSlice([]rune(di))
 
 	// IAC
 	if iac == "" {
 		if pf {
-			return []byte{}, 0, string(dataIdentifier), "urn:epc:pat:iso17365:" + di, nil
+			return []byte{}, 0, string(dataIdentifier), pat + di, nil
 		}
 		return []byte{}, 0, "", "", errors.New("IAC not provided")
 	}
@@ -103,7 +144,7 @@ func MakeISO17365(pf bool, di string, iac string, cin string, sn string) ([]byte
 	// CIN
 	if cin == "" {
 		if pf {
-			return []byte{}, 0, string(dataIdentifier) + string(issuingAgencyCode), "urn:epc:pat:iso17365:" + di + "." + iac, nil
+			return []byte{}, 0, string(dataIdentifier) + string(issuingAgencyCode), pat + di + "." + iac, nil
 		}
 		return []byte{}, 0, "", "", errors.New("CIN not provided")
 	}
@@ -112,7 +153,7 @@ func MakeISO17365(pf bool, di string, iac string, cin string, sn string) ([]byte
 	// SN
 	if sn == "" {
 		if pf {
-			return []byte{}, 0, string(dataIdentifier) + string(issuingAgencyCode) + string(companyIdentification), "urn:epc:pat:iso17365:" + di + "." + iac + "." + cin, nil
+			return []byte{}, 0, string(dataIdentifier) + string(issuingAgencyCode) + string(companyIdentification), pat + di + "." + iac + "." + cin, nil
 		}
 		sn = binutil.GenerateNLengthHexString(18)
 	}
@@ -120,7 +161,7 @@ func MakeISO17365(pf bool, di string, iac string, cin string, sn string) ([]byte
 
 	// Exact match filter
 	if pf {
-		return []byte{}, 0, string(dataIdentifier) + string(issuingAgencyCode) + string(companyIdentification) + string(serialNumber), "urn:epc:pat:iso17365:" + di + "." + iac + "." + cin + "." + sn, nil
+		return []byte{}, 0, string(dataIdentifier) + string(issuingAgencyCode) + string(companyIdentification) + string(serialNumber), pat + di + "." + iac + "." + cin + "." + sn, nil
 	}
 
 	bs := append(dataIdentifier, issuingAgencyCode...)
@@ -135,25 +176,5 @@ func MakeISO17365(pf bool, di string, iac string, cin string, sn string) ([]byte
 		return []byte{}, 0, "", "", err
 	}
 
-	var iso17365 = []interface{}{p}
-
-	return binutil.Pack(iso17365), length, "", "", nil
-}
-
-// Pad6BitEncodingRuneSlice returns a new length
-// and 16-bit (word-length) padded binary string in rune slice
-// @ISO15962
-func Pad6BitEncodingRuneSlice(bs []rune) ([]rune, int) {
-	length := len(bs)
-	remainder := length % 16
-	var padding []rune
-	if remainder != 0 {
-		padRuneSlice := binutil.ParseDecimalStringToBinRuneSlice("32") // pad string "100000"
-		for i := 0; i < 16-remainder; i++ {
-			padding = append(padding, padRuneSlice[i%6])
-		}
-		bs = append(bs, padding...)
-		length += 16 - remainder
-	}
-	return bs, length
+	return binutil.Pack([]interface{}{p}), length, "", "", nil
 }
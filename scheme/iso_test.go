@@ -123,6 +123,63 @@ func TestMakeISO17365(t *testing.T) {
 	}
 }
 
+func TestMakeISO15459(t *testing.T) {
+	type args struct {
+		pf  bool
+		di  string
+		iac string
+		cin string
+		sn  string
+	}
+	tests := []struct {
+		name    string
+		std     string
+		make    func(bool, string, string, string, string) ([]byte, int, string, string, error)
+		args    args
+		want    []byte
+		want1   int
+		want2   string
+		want3   string
+		wantPC  string
+		wantErr bool
+	}{
+		{"ISO17364", "17364", MakeISO17364, args{false, "25B", "UN", "043325711", "MH8031200000000001"}, []byte{203, 80, 149, 59, 13, 51, 207, 45, 119, 199, 19, 72, 227, 12, 241, 203, 12, 48, 195, 12, 48, 195, 12, 49}, 192, "", "", "61a3", false},
+		{"ISO17364 prefix", "17364", MakeISO17364, args{true, "25B", "UN", "043325711", ""}, []byte{}, 0, "110010110101000010010101001110110000110100110011110011110010110101110111110001110001", "urn:epc:pat:iso17364:25B.UN.043325711", "", false},
+		{"ISO17366", "17366", MakeISO17366, args{false, "25S", "UN", "043325711", "MH8031200000000001"}, []byte{203, 84, 213, 59, 13, 51, 207, 45, 119, 199, 19, 72, 227, 12, 241, 203, 12, 48, 195, 12, 48, 195, 12, 49}, 192, "", "", "61a5", false},
+		{"ISO17366 prefix", "17366", MakeISO17366, args{true, "25S", "UN", "043325711", ""}, []byte{}, 0, "110010110101010011010101001110110000110100110011110011110010110101110111110001110001", "urn:epc:pat:iso17366:25S.UN.043325711", "", false},
+		{"ISO17367", "17367", MakeISO17367, args{false, "25S", "UN", "043325711", "MH8031200000000001"}, []byte{203, 84, 213, 59, 13, 51, 207, 45, 119, 199, 19, 72, 227, 12, 241, 203, 12, 48, 195, 12, 48, 195, 12, 49}, 192, "", "", "61a1", false},
+		{"ISO17367 prefix", "17367", MakeISO17367, args{true, "25S", "UN", "043325711", ""}, []byte{}, 0, "110010110101010011010101001110110000110100110011110011110010110101110111110001110001", "urn:epc:pat:iso17367:25S.UN.043325711", "", false},
+		{"ISO17367 no IAC", "17367", MakeISO17367, args{false, "25S", "", "", ""}, []byte{}, 0, "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1, got2, got3, err := tt.make(tt.args.pf, tt.args.di, tt.args.iac, tt.args.cin, tt.args.sn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MakeISO%v() error = %v, wantErr %v", tt.std, err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MakeISO%v() got = %v, want %v", tt.std, got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("MakeISO%v() got1 = %v, want %v", tt.std, got1, tt.want1)
+			}
+			if got2 != tt.want2 {
+				t.Errorf("MakeISO%v() got2 = %v, want %v", tt.std, got2, tt.want2)
+			}
+			if got3 != tt.want3 {
+				t.Errorf("MakeISO%v() got3 = %v, want %v", tt.std, got3, tt.want3)
+			}
+			if len(tt.wantPC) == 0 {
+				return
+			}
+			if _, pc := MakeISO(false, tt.std, "", "", "", tt.args.di, tt.args.iac, tt.args.cin, tt.args.sn); pc != tt.wantPC {
+				t.Errorf("MakeISO(%v) pc = %v, want %v", tt.std, pc, tt.wantPC)
+			}
+		})
+	}
+}
+
 func TestPad6BitEncodingRuneSlice(t *testing.T) {
 	type args struct {
 		bs []rune
@@ -0,0 +1,203 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package smoothing suppresses the duplicate reads of the tags in front of the filtering engines
+package smoothing
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of the Event
+type EventType int
+
+// EventType values
+const (
+	// Appeared is when a tag is read EntryThreshold times in a window
+	Appeared EventType = iota
+	// Disappeared is when a tag is not read for ExitThreshold windows
+	Disappeared
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Appeared:
+		return "appeared"
+	case Disappeared:
+		return "disappeared"
+	}
+	return "unknown"
+}
+
+// Event is a tag appeared in or disappeared from a source
+type Event struct {
+	Type   EventType
+	Source string
+	Tag    string
+	Time   time.Time
+}
+
+// Config holds the smoothing parameters for Smoother
+type Config struct {
+	Window         time.Duration // the interval to pass the reads of a present tag
+	EntryThreshold int           // the number of reads in a window for a tag to appear
+	ExitThreshold  int           // the number of windows without reads for a tag to disappear
+}
+
+// DefaultConfig is used for the zero values in Config
+var DefaultConfig = Config{
+	Window:         time.Second,
+	EntryThreshold: 1,
+	ExitThreshold:  2,
+}
+
+// Smoother tracks the presence of the tags per source,
+// e.g., a reader, and passes a read of a present tag once in a window
+type Smoother struct {
+	config Config
+	notify func(Event)
+	tags   map[key]*state
+	mutex  sync.Mutex
+	quit   chan struct{}
+	done   chan struct{}
+}
+
+// key identifies a tag in a source
+type key struct {
+	source string
+	tag    string
+}
+
+// state is the presence of a tag in a source
+type state struct {
+	present     bool
+	windowStart time.Time
+	reads       int
+	lastSeen    time.Time
+	lastPassed  time.Time
+}
+
+// NewSmoother returns the pointer to a new Smoother instance,
+// notify is called for every Event if not nil
+func NewSmoother(config Config, notify func(Event)) *Smoother {
+	if config.Window <= 0 {
+		config.Window = DefaultConfig.Window
+	}
+	if config.EntryThreshold <= 0 {
+		config.EntryThreshold = DefaultConfig.EntryThreshold
+	}
+	if config.ExitThreshold <= 0 {
+		config.ExitThreshold = DefaultConfig.ExitThreshold
+	}
+	s := &Smoother{
+		config: config,
+		notify: notify,
+		tags:   make(map[key]*state),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Close stops the Smoother, the present tags are not notified to disappear
+func (s *Smoother) Close() {
+	close(s.quit)
+	<-s.done
+}
+
+// Observe records a read of the tag from the source at now
+// and returns true if the read should be passed to the engines
+func (s *Smoother) Observe(source, tag string, now time.Time) bool {
+	s.mutex.Lock()
+	k := key{source, tag}
+	st, ok := s.tags[k]
+	if !ok {
+		st = &state{windowStart: now}
+		s.tags[k] = st
+	}
+	st.lastSeen = now
+	if st.present {
+		pass := now.Sub(st.lastPassed) >= s.config.Window
+		if pass {
+			st.lastPassed = now
+		}
+		s.mutex.Unlock()
+		return pass
+	}
+	if now.Sub(st.windowStart) >= s.config.Window {
+		// the previous reads are too old to count
+		st.windowStart = now
+		st.reads = 0
+	}
+	st.reads++
+	if st.reads < s.config.EntryThreshold {
+		s.mutex.Unlock()
+		return false
+	}
+	st.present = true
+	st.lastPassed = now
+	s.mutex.Unlock()
+	s.emit(Event{Appeared, source, tag, now})
+	return true
+}
+
+// Present returns the number of the present tags
+func (s *Smoother) Present() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n := 0
+	for _, st := range s.tags {
+		if st.present {
+			n++
+		}
+	}
+	return n
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// emit notifies the Event
+func (s *Smoother) emit(ev Event) {
+	if s.notify != nil {
+		s.notify(ev)
+	}
+}
+
+// run sweeps the tags every window until the Smoother is closed
+func (s *Smoother) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.config.Window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case now := <-ticker.C:
+			s.sweep(now)
+		}
+	}
+}
+
+// sweep forgets the tags not read for ExitThreshold windows,
+// and notifies the present ones to disappear
+func (s *Smoother) sweep(now time.Time) {
+	exit := time.Duration(s.config.ExitThreshold) * s.config.Window
+	events := []Event{}
+	s.mutex.Lock()
+	for k, st := range s.tags {
+		if st.present && now.Sub(st.lastSeen) >= exit {
+			events = append(events, Event{Disappeared, k.source, k.tag, now})
+			delete(s.tags, k)
+		} else if !st.present && now.Sub(st.windowStart) >= s.config.Window {
+			delete(s.tags, k)
+		}
+	}
+	s.mutex.Unlock()
+	for _, ev := range events {
+		s.emit(ev)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package smoothing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// read is a tag read at the offset from the epoch
+type read struct {
+	source string
+	tag    string
+	at     time.Duration
+}
+
+func TestSmoother_Observe(t *testing.T) {
+	epoch := time.Unix(0, 0)
+	tests := []struct {
+		name   string
+		config Config
+		reads  []read
+		want   []bool
+		events []Event
+	}{
+		{
+			"SuppressDuplicates",
+			Config{Window: time.Hour},
+			[]read{{"r1", "a", 0}, {"r1", "a", time.Minute}, {"r1", "a", time.Hour}, {"r1", "a", time.Hour + time.Minute}},
+			[]bool{true, false, true, false},
+			[]Event{{Appeared, "r1", "a", epoch}},
+		},
+		{
+			"EntryThreshold",
+			Config{Window: time.Hour, EntryThreshold: 3},
+			[]read{{"r1", "a", 0}, {"r1", "a", time.Minute}, {"r1", "a", 2 * time.Minute}, {"r1", "a", 3 * time.Minute}},
+			[]bool{false, false, true, false},
+			[]Event{{Appeared, "r1", "a", epoch.Add(2 * time.Minute)}},
+		},
+		{
+			"EntryThresholdExpired",
+			Config{Window: time.Hour, EntryThreshold: 2},
+			[]read{{"r1", "a", 0}, {"r1", "a", 2 * time.Hour}, {"r1", "a", 2*time.Hour + time.Minute}},
+			[]bool{false, false, true},
+			[]Event{{Appeared, "r1", "a", epoch.Add(2*time.Hour + time.Minute)}},
+		},
+		{
+			"PerSource",
+			Config{Window: time.Hour},
+			[]read{{"r1", "a", 0}, {"r2", "a", time.Minute}, {"r1", "b", 2 * time.Minute}, {"r2", "a", 3 * time.Minute}},
+			[]bool{true, true, true, false},
+			[]Event{
+				{Appeared, "r1", "a", epoch},
+				{Appeared, "r2", "a", epoch.Add(time.Minute)},
+				{Appeared, "r1", "b", epoch.Add(2 * time.Minute)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := []Event{}
+			s := NewSmoother(tt.config, func(ev Event) { events = append(events, ev) })
+			defer s.Close()
+			got := []bool{}
+			for _, r := range tt.reads {
+				got = append(got, s.Observe(r.source, r.tag, epoch.Add(r.at)))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Smoother.Observe() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(events, tt.events) {
+				t.Errorf("Smoother.Observe() events = %v, want %v", events, tt.events)
+			}
+		})
+	}
+}
+
+func TestSmoother_sweep(t *testing.T) {
+	epoch := time.Unix(0, 0)
+	events := []Event{}
+	s := NewSmoother(Config{Window: time.Hour, EntryThreshold: 2, ExitThreshold: 2}, func(ev Event) {
+		if ev.Type == Disappeared {
+			events = append(events, ev)
+		}
+	})
+	defer s.Close()
+	s.Observe("r1", "a", epoch)
+	s.Observe("r1", "a", epoch)
+	s.Observe("r1", "b", epoch)
+	if s.Present() != 1 {
+		t.Errorf("Smoother.Present() = %v, want 1", s.Present())
+	}
+
+	// a is still present and b is not
+	s.sweep(epoch.Add(time.Hour))
+	if s.Present() != 1 || len(s.tags) != 1 || len(events) != 0 {
+		t.Errorf("Smoother.sweep() left %v tags and %v events, want 1 and 0", len(s.tags), len(events))
+	}
+
+	// a disappears after 2 windows
+	now := epoch.Add(2 * time.Hour)
+	s.sweep(now)
+	if want := []Event{{Disappeared, "r1", "a", now}}; !reflect.DeepEqual(events, want) {
+		t.Errorf("Smoother.sweep() events = %v, want %v", events, want)
+	}
+	if s.Present() != 0 {
+		t.Errorf("Smoother.Present() = %v, want 0", s.Present())
+	}
+
+	// a needs to enter again
+	if s.Observe("r1", "a", now) {
+		t.Errorf("Smoother.Observe() = true after disappeared, want false")
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tagmemory
+
+import "fmt"
+
+// DuplicateNameError is returned when the TMSpec is already defined
+type DuplicateNameError struct {
+	SpecName string
+}
+
+func (e *DuplicateNameError) Error() string {
+	return fmt.Sprintf("duplicate TMSpec name: %s", e.SpecName)
+}
+
+// NoSuchNameError is returned when the TMSpec is not defined
+type NoSuchNameError struct {
+	SpecName string
+}
+
+func (e *NoSuchNameError) Error() string {
+	return fmt.Sprintf("no such TMSpec: %s", e.SpecName)
+}
+
+// InUseError is returned when a fieldname of the TMSpec is used in the filters or the reports
+type InUseError struct {
+	SpecName  string
+	FieldName string
+}
+
+func (e *InUseError) Error() string {
+	return fmt.Sprintf("%s in %s is in use", e.FieldName, e.SpecName)
+}
+
+// ValidationError is returned when the TMSpec or the fieldname is invalid
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Reason
+}
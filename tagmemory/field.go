@@ -0,0 +1,236 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package tagmemory implements the fieldnames of the ALE tag memory API,
+// which name the fields in the memory banks of the tags for the filters and the reports
+package tagmemory
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/iomz/gosstrak/tdt"
+)
+
+// Datatypes of the fields
+const (
+	Uint           = "uint"
+	EPC            = "epc"
+	ISO15962String = "iso-15962-string"
+)
+
+// Formats of the fields
+const (
+	Hex        = "hex"
+	Decimal    = "decimal"
+	EPCPure    = "epc-pure"
+	EPCTag     = "epc-tag"
+	EPCHex     = "epc-hex"
+	EPCDecimal = "epc-decimal"
+	String     = "string"
+)
+
+// datatypeFormats are the formats available for each datatype, the first one is the default
+var datatypeFormats = map[string][]string{
+	Uint:           {Hex, Decimal},
+	EPC:            {EPCTag, EPCPure, EPCHex, EPCDecimal},
+	ISO15962String: {String},
+}
+
+// Field is a fixed field in a memory bank of the tags, or a variable field of the OID
+type Field struct {
+	Name string
+	Bank int
+	// Length is the bits of the field, 0 for the rest of the bank
+	Length int
+	Offset int
+	// OID is of the variable field in the ISO/IEC 15962 data sets, e.g., urn:oid:1.0.15961.10.2
+	OID      string
+	Datatype string
+	Format   string
+}
+
+// builtinFields are the fieldnames predefined in ALE
+var builtinFields = map[string]Field{
+	"epc":       {Name: "epc", Bank: 1, Offset: 32, Datatype: EPC, Format: EPCTag},
+	"killPwd":   {Name: "killPwd", Bank: 0, Length: 32, Offset: 0, Datatype: Uint, Format: Hex},
+	"accessPwd": {Name: "accessPwd", Bank: 0, Length: 32, Offset: 32, Datatype: Uint, Format: Hex},
+	"epcBank":   {Name: "epcBank", Bank: 1, Datatype: Uint, Format: Hex},
+	"tidBank":   {Name: "tidBank", Bank: 2, Datatype: Uint, Format: Hex},
+	"userBank":  {Name: "userBank", Bank: 3, Datatype: Uint, Format: Hex},
+	"afi":       {Name: "afi", Bank: 1, Length: 8, Offset: 24, Datatype: Uint, Format: Hex},
+	"nsi":       {Name: "nsi", Bank: 1, Length: 9, Offset: 23, Datatype: Uint, Format: Hex},
+}
+
+// Banks returns the memory banks of the tag indexed by the bank number, the reserved bank is never read
+// and the EPC bank has the zero CRC since the readers don't report it, nor is it known without the PC
+func Banks(pc []byte, id []byte, tid []byte, user []byte) [][]byte {
+	var epcBank []byte
+	if len(pc) != 0 {
+		epcBank = append(append([]byte{0, 0}, pc...), id...)
+	}
+	return [][]byte{nil, epcBank, tid, user}
+}
+
+// IsBuiltin returns true if the fieldname is predefined in ALE or in the form of @bank.length.offset or @bank.oid
+func IsBuiltin(fieldname string) bool {
+	_, ok := builtinFields[fieldname]
+	return ok || strings.HasPrefix(fieldname, "@")
+}
+
+// ParseField returns the Field of the predefined fieldname, @bank.length.offset in bits,
+// or @bank.oid of a variable field in the iso-15962-string, e.g., @3.urn:oid:1.0.15961.10.2
+func ParseField(fieldname string) (*Field, error) {
+	if f, ok := builtinFields[fieldname]; ok {
+		return &f, nil
+	}
+	if bo := strings.SplitN(strings.TrimPrefix(fieldname, "@"), ".", 2); len(bo) == 2 && strings.HasPrefix(bo[1], "urn:oid:") {
+		f := &Field{Name: fieldname, OID: bo[1], Datatype: ISO15962String, Format: String}
+		bank, err := strconv.Atoi(bo[0])
+		if !strings.HasPrefix(fieldname, "@") || err != nil || !isOID(strings.TrimPrefix(f.OID, "urn:oid:")) {
+			return nil, &ValidationError{"invalid fieldname: " + fieldname}
+		}
+		f.Bank = bank
+		if err := f.Validate(); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	blo := strings.Split(strings.TrimPrefix(fieldname, "@"), ".")
+	if !strings.HasPrefix(fieldname, "@") || len(blo) != 3 {
+		return nil, &ValidationError{"unknown fieldname: " + fieldname}
+	}
+	f := &Field{Name: fieldname, Datatype: Uint, Format: Hex}
+	var errs [3]error
+	f.Bank, errs[0] = strconv.Atoi(blo[0])
+	f.Length, errs[1] = strconv.Atoi(blo[1])
+	f.Offset, errs[2] = strconv.Atoi(blo[2])
+	if errs[0] != nil || errs[1] != nil || errs[2] != nil || f.Length <= 0 {
+		return nil, &ValidationError{"invalid fieldname: " + fieldname}
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Bits returns the bits of the field in the banks, ok is false if the bank is not read or too short,
+// or for the variable fields
+func (f *Field) Bits(banks [][]byte) (bits string, ok bool) {
+	if f.Bank >= len(banks) || banks[f.Bank] == nil || len(f.OID) != 0 {
+		return "", false
+	}
+	data := banks[f.Bank]
+	length := f.Length
+	if length == 0 {
+		length = len(data)*8 - f.Offset
+		// the length of the EPC is in the PC bits
+		if f.Name == "epc" && len(data) > 2 {
+			length = int(data[2]>>3) * 16
+		}
+	}
+	if length <= 0 || len(data)*8 < f.Offset+length {
+		return "", false
+	}
+	w := &strings.Builder{}
+	for _, b := range data[f.Offset/8 : (f.Offset+length+7)/8] {
+		fmt.Fprintf(w, "%08b", b)
+	}
+	start := f.Offset % 8
+	return w.String()[start : start+length], true
+}
+
+// Validate checks the bank, the length and the offset, and the datatype and the format of the Field
+func (f *Field) Validate() error {
+	if f.Bank < 0 || 3 < f.Bank {
+		return &ValidationError{fmt.Sprintf("invalid bank of %s: %v", f.Name, f.Bank)}
+	}
+	if f.Length < 0 || f.Offset < 0 {
+		return &ValidationError{fmt.Sprintf("invalid length or offset of %s: %v, %v", f.Name, f.Length, f.Offset)}
+	}
+	// the ISO/IEC 15962 strings are only in the variable fields, and vice versa
+	if f.Datatype == ISO15962String && len(f.OID) == 0 {
+		return &ValidationError{fmt.Sprintf("%s is not a datatype of the fixed field %s", f.Datatype, f.Name)}
+	}
+	if f.Datatype != ISO15962String && len(f.OID) != 0 {
+		return &ValidationError{fmt.Sprintf("%s is not a datatype of the variable field %s", f.Datatype, f.Name)}
+	}
+	formats, ok := datatypeFormats[f.Datatype]
+	if !ok {
+		return &ValidationError{fmt.Sprintf("unknown datatype of %s: %s", f.Name, f.Datatype)}
+	}
+	for _, format := range formats {
+		if f.Format == format {
+			return nil
+		}
+	}
+	return &ValidationError{fmt.Sprintf("%s is not a format of %s in %s", f.Format, f.Datatype, f.Name)}
+}
+
+// Value returns the field in the banks in its datatype and format,
+// the tdt.Core translates the epc datatype and the undecodable EPCs are in the raw hex
+func (f *Field) Value(banks [][]byte, c *tdt.Core) (string, error) {
+	if len(f.OID) != 0 {
+		if f.Bank >= len(banks) || banks[f.Bank] == nil {
+			return "", fmt.Errorf("%s is not read", f.Name)
+		}
+		sets, err := decodeDataSets(banks[f.Bank])
+		if err != nil {
+			return "", err
+		}
+		v, ok := sets[f.OID]
+		if !ok {
+			return "", fmt.Errorf("%s is not in the data sets", f.Name)
+		}
+		return v, nil
+	}
+	bits, ok := f.Bits(banks)
+	if !ok {
+		return "", fmt.Errorf("%s is not read", f.Name)
+	}
+	v, _ := new(big.Int).SetString(bits, 2)
+	hex := fmt.Sprintf("%0*X", (len(bits)+3)/4, v)
+	switch f.Format {
+	case Hex:
+		return "x" + hex, nil
+	case Decimal:
+		return v.String(), nil
+	case EPCTag, EPCPure:
+		level := tdt.TagEncoding
+		if f.Format == EPCPure {
+			level = tdt.PureIdentity
+		}
+		if uri, err := c.Convert(bits, nil, level); err == nil {
+			return uri, nil
+		}
+		return fmt.Sprintf("urn:epc:raw:%d.x%s", len(bits), hex), nil
+	case EPCHex:
+		return fmt.Sprintf("urn:epc:raw:%d.x%s", len(bits), hex), nil
+	case EPCDecimal:
+		return fmt.Sprintf("urn:epc:raw:%d.%s", len(bits), v), nil
+	}
+	return "", fmt.Errorf("unknown format of %s: %s", f.Name, f.Format)
+}
+
+// WithFormat returns a copy of the Field in the datatype and the format,
+// the current ones are kept if empty and the default format of the datatype is used if only the datatype is given
+func (f *Field) WithFormat(datatype string, format string) (*Field, error) {
+	clone := *f
+	if len(datatype) != 0 && datatype != f.Datatype {
+		clone.Datatype = datatype
+		if formats, ok := datatypeFormats[datatype]; ok {
+			clone.Format = formats[0]
+		}
+	}
+	if len(format) != 0 {
+		clone.Format = format
+	}
+	if err := clone.Validate(); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
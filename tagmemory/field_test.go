@@ -0,0 +1,111 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tagmemory
+
+import (
+	"testing"
+
+	"github.com/iomz/gosstrak/tdt"
+)
+
+func TestParseField(t *testing.T) {
+	tests := []struct {
+		fieldname string
+		want      Field
+		wantErr   bool
+	}{
+		{"epc", Field{Name: "epc", Bank: 1, Offset: 32, Datatype: EPC, Format: EPCTag}, false},
+		{"tidBank", Field{Name: "tidBank", Bank: 2, Datatype: Uint, Format: Hex}, false},
+		{"@3.16.8", Field{Name: "@3.16.8", Bank: 3, Length: 16, Offset: 8, Datatype: Uint, Format: Hex}, false},
+		{"@4.16.0", Field{}, true},
+		{"@3.0.0", Field{}, true},
+		{"@3.16", Field{}, true},
+		{"@3.urn:oid:1.0.15961.10.2", Field{Name: "@3.urn:oid:1.0.15961.10.2", Bank: 3, OID: "urn:oid:1.0.15961.10.2", Datatype: ISO15962String, Format: String}, false},
+		{"@3.urn:oid:1.0..2", Field{}, true},
+		{"@4.urn:oid:1.0.15961.10.2", Field{}, true},
+		{"lotNumber", Field{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseField(tt.fieldname)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseField(%v) error = %v, wantErr %v", tt.fieldname, err, tt.wantErr)
+			continue
+		}
+		if err == nil && *got != tt.want {
+			t.Errorf("ParseField(%v) = %+v, want %+v", tt.fieldname, *got, tt.want)
+		}
+	}
+}
+
+func TestField_Value(t *testing.T) {
+	banks := Banks(
+		[]byte{0x30, 0x00},
+		[]byte{48, 116, 37, 123, 247, 25, 78, 64, 0, 0, 26, 133},
+		[]byte{0xe2, 0x80, 0x11, 0x05, 0x20, 0x00},
+		[]byte{0x04, 0x20, 0xe0, 0x12, 0x34, 0x56},
+	)
+	c := tdt.NewCore()
+	tests := []struct {
+		fieldname string
+		datatype  string
+		format    string
+		want      string
+		wantErr   bool
+	}{
+		{"epc", "", "", "urn:epc:tag:sgtin-96:3.0614141.812345.6789", false},
+		{"epc", "", EPCPure, "urn:epc:id:sgtin:0614141.812345.6789", false},
+		{"epc", "", EPCHex, "urn:epc:raw:96.x3074257BF7194E4000001A85", false},
+		{"epc", "", EPCDecimal, "urn:epc:raw:96.14995692880814596164774009477", false},
+		{"afi", "", "", "x00", false},
+		{"tidBank", "", "", "xE28011052000", false},
+		{"@2.12.8", "", "", "x801", false},
+		{"@2.12.8", "", Decimal, "2049", false},
+		{"@3.16.28", "", "", "x2345", false},
+		{"@3.16.40", "", "", "", true},
+		{"killPwd", "", "", "", true},
+	}
+	for _, tt := range tests {
+		f, err := ParseField(tt.fieldname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f, err = f.WithFormat(tt.datatype, tt.format); err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Value(banks, c)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Field.Value() %v error = %v, wantErr %v", tt.fieldname, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Field.Value() %v = %v, want %v", tt.fieldname, got, tt.want)
+		}
+	}
+}
+
+func TestField_WithFormat(t *testing.T) {
+	f, _ := ParseField("tidBank")
+	if _, err := f.WithFormat("", EPCTag); err == nil {
+		t.Error("Field.WithFormat() accepted epc-tag for uint")
+	}
+	if _, err := f.WithFormat("float", ""); err == nil {
+		t.Error("Field.WithFormat() accepted an unknown datatype")
+	}
+	if _, err := f.WithFormat(ISO15962String, ""); err == nil {
+		t.Error("Field.WithFormat() accepted iso-15962-string for a fixed field")
+	}
+	got, err := f.WithFormat(EPC, "")
+	if err != nil || got.Format != EPCTag || f.Datatype != Uint {
+		t.Errorf("Field.WithFormat() = %+v, %v", got, err)
+	}
+	v, _ := ParseField("@3.urn:oid:1.0.15961.10.2")
+	if _, err := v.WithFormat(Uint, ""); err == nil {
+		t.Error("Field.WithFormat() accepted uint for a variable field")
+	}
+	if got, err := v.WithFormat(ISO15962String, ""); err != nil || got.Format != String {
+		t.Errorf("Field.WithFormat() = %+v, %v", got, err)
+	}
+}
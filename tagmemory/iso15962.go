@@ -0,0 +1,131 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tagmemory
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/iomz/gosstrak/tdt"
+)
+
+// Compaction schemes of the ISO/IEC 15962 data sets
+const (
+	applicationDefined = iota
+	integerCompaction
+	numericCompaction
+	fiveBitCompaction
+	sixBitCompaction
+	sevenBitCompaction
+	octetString
+)
+
+// decodeDataSets decodes the ISO/IEC 15962 data sets in the no-directory access method into the strings by the OIDs,
+// the DSFID gives the root OID urn:oid:1.0.15961.<data format> of the relative OIDs in the precursors
+func decodeDataSets(data []byte) (map[string]string, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no DSFID in the data sets")
+	}
+	// access method in the bits 8-7, data format in the bits 5-1
+	accessMethod, dataFormat := data[0]>>6, data[0]&0x1f
+	if accessMethod != 0 || dataFormat < 3 {
+		return nil, fmt.Errorf("unsupported DSFID: %#x", data[0])
+	}
+	root := "urn:oid:1.0.15961." + strconv.Itoa(int(dataFormat)) + "."
+	sets := map[string]string{}
+	for i := 1; i < len(data) && data[i] != 0; {
+		// offset flag in the bit 8, compaction in the bits 7-5, and relative OID in the bits 4-1
+		precursor := data[i]
+		i++
+		if precursor&0x80 != 0 {
+			return nil, fmt.Errorf("unsupported precursor with the offset: %#x", precursor)
+		}
+		relativeOID := int(precursor & 0x0f)
+		if relativeOID == 0x0f {
+			if i >= len(data) || data[i]&0x80 != 0 {
+				return nil, fmt.Errorf("invalid relative OID after %#x", precursor)
+			}
+			relativeOID += int(data[i])
+			i++
+		}
+		length := 0
+		for ; i < len(data); i++ {
+			length = length<<7 | int(data[i]&0x7f)
+			if data[i]&0x80 == 0 {
+				break
+			}
+		}
+		i++
+		if i+length > len(data) {
+			return nil, fmt.Errorf("the data set of %s%d exceeds the bank", root, relativeOID)
+		}
+		v, err := decompact(int(precursor>>4&0x07), data[i:i+length])
+		if err != nil {
+			return nil, err
+		}
+		sets[root+strconv.Itoa(relativeOID)] = v
+		i += length
+	}
+	return sets, nil
+}
+
+// decompact returns the string of the compacted object
+func decompact(compaction int, object []byte) (string, error) {
+	switch compaction {
+	case applicationDefined, octetString:
+		return string(object), nil
+	case integerCompaction:
+		return new(big.Int).SetBytes(object).String(), nil
+	case fiveBitCompaction:
+		// A-Z and [\]^_ without the bit 7
+		return unpackChars(object, 5, 0x40), nil
+	case sixBitCompaction:
+		return tdt.Decode6BitString(object)
+	case sevenBitCompaction:
+		return unpackChars(object, 7, 0), nil
+	}
+	return "", fmt.Errorf("unsupported compaction: %v", compaction)
+}
+
+// unpackChars returns the characters packed in the bits with the base, the zero padding bits are dropped
+func unpackChars(object []byte, bits int, base byte) string {
+	w := &strings.Builder{}
+	v := new(big.Int).SetBytes(object)
+	n := len(object) * 8 / bits
+	for j := 0; j < n; j++ {
+		var c byte
+		for k := 0; k < bits; k++ {
+			c = c<<1 | byte(v.Bit(len(object)*8-1-j*bits-k))
+		}
+		if c == 0 {
+			break
+		}
+		w.WriteByte(base | c)
+	}
+	return w.String()
+}
+
+// isOID returns true if s is the arcs of an OID separated by the dots
+func isOID(s string) bool {
+	for _, arc := range strings.Split(s, ".") {
+		if len(arc) == 0 || !isDigits(arc) {
+			return false
+		}
+	}
+	return true
+}
+
+// isDigits returns true if s consists only of the digits
+func isDigits(s string) bool {
+	for _, c := range []byte(s) {
+		if c < '0' || '9' < c {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tagmemory
+
+import (
+	"reflect"
+	"testing"
+)
+
+// userDataSets is the no-directory data sets of the root OID urn:oid:1.0.15961.10
+var userDataSets = []byte{
+	0x0a,
+	0x42, 0x03, 0x04, 0x20, 0xe0, // 6-bit ABC of 2
+	0x6f, 0x05, 0x02, 'x', 'y', // octets xy of 20
+	0x13, 0x02, 0x01, 0x00, // integer 256 of 3
+	0x34, 0x02, 0x08, 0x80, // 5-bit AB of 4
+	0x55, 0x02, 0xd1, 0xa4, // 7-bit hi of 5
+	0x00, 0xff,
+}
+
+func Test_decodeDataSets(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    map[string]string
+		wantErr bool
+	}{
+		{"DataSets", userDataSets, map[string]string{
+			"urn:oid:1.0.15961.10.2":  "ABC",
+			"urn:oid:1.0.15961.10.20": "xy",
+			"urn:oid:1.0.15961.10.3":  "256",
+			"urn:oid:1.0.15961.10.4":  "AB",
+			"urn:oid:1.0.15961.10.5":  "hi",
+		}, false},
+		{"Empty", []byte{0x0a, 0x00}, map[string]string{}, false},
+		{"NoDSFID", []byte{}, nil, true},
+		{"DirectoryAccessMethod", []byte{0x4a, 0x00}, nil, true},
+		{"FullFeatured", []byte{0x01, 0x00}, nil, true},
+		{"Offset", []byte{0x0a, 0xc2, 0x01, 0x00}, nil, true},
+		{"Numeric", []byte{0x0a, 0x22, 0x01, 0x0c}, nil, true},
+		{"ExceedsBank", []byte{0x0a, 0x62, 0x04, 'x'}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeDataSets(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeDataSets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeDataSets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestField_Value_variable(t *testing.T) {
+	banks := Banks([]byte{0x30, 0x00}, []byte{0x30, 0x74}, nil, userDataSets)
+	tests := []struct {
+		fieldname string
+		want      string
+		wantErr   bool
+	}{
+		{"@3.urn:oid:1.0.15961.10.2", "ABC", false},
+		{"@3.urn:oid:1.0.15961.10.20", "xy", false},
+		{"@3.urn:oid:1.0.15961.10.6", "", true},
+		{"@2.urn:oid:1.0.15961.10.2", "", true}, // not read
+	}
+	for _, tt := range tests {
+		f, err := ParseField(tt.fieldname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Value(banks, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Field.Value() %v error = %v, wantErr %v", tt.fieldname, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Field.Value() %v = %v, want %v", tt.fieldname, got, tt.want)
+		}
+	}
+}
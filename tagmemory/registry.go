@@ -0,0 +1,180 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tagmemory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"sync"
+)
+
+// TMFixedFieldListSpec is the ALE TMSpec defining the fieldnames of the fixed fields
+type TMFixedFieldListSpec struct {
+	FixedFields []TMFixedFieldSpec `xml:"fixedFields>fixedField" json:"fixedFields"`
+}
+
+// TMFixedFieldSpec defines a fieldname for the bits in a memory bank,
+// the datatype and the format default to uint and hex
+type TMFixedFieldSpec struct {
+	FieldName       string `xml:"fieldname" json:"fieldname"`
+	Bank            int    `xml:"bank" json:"bank"`
+	Length          int    `xml:"length" json:"length"`
+	Offset          int    `xml:"offset" json:"offset"`
+	DefaultDatatype string `xml:"defaultDatatype,omitempty" json:"defaultDatatype,omitempty"`
+	DefaultFormat   string `xml:"defaultFormat,omitempty" json:"defaultFormat,omitempty"`
+}
+
+// InUse returns true if the fieldname is used in the filters or the reports
+type InUse func(fieldname string) bool
+
+// Registry holds the TMSpecs and resolves the fieldnames,
+// the predefined fieldnames are always available
+type Registry struct {
+	mutex  sync.RWMutex
+	specs  map[string]*TMFixedFieldListSpec
+	fields map[string]*Field
+	inUse  InUse
+}
+
+// NewRegistry returns the pointer to a new Registry instance
+func NewRegistry() *Registry {
+	return &Registry{
+		specs:  make(map[string]*TMFixedFieldListSpec),
+		fields: make(map[string]*Field),
+	}
+}
+
+// LoadSpecsFromJSONFile takes a JSON file name and returns the TMSpecs keyed by the spec name
+func LoadSpecsFromJSONFile(f string) (map[string]*TMFixedFieldListSpec, error) {
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	specs := map[string]*TMFixedFieldListSpec{}
+	if err = json.Unmarshal(data, &specs); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// Define validates the TMSpec and defines its fieldnames
+func (r *Registry) Define(specName string, spec *TMFixedFieldListSpec) error {
+	if spec == nil || len(spec.FixedFields) == 0 {
+		return &ValidationError{"no fixed field in " + specName}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.specs[specName]; ok {
+		return &DuplicateNameError{specName}
+	}
+	fields := map[string]*Field{}
+	for _, ff := range spec.FixedFields {
+		if len(ff.FieldName) == 0 {
+			return &ValidationError{"the fieldname is empty in " + specName}
+		}
+		if _, ok := r.fields[ff.FieldName]; ok || IsBuiltin(ff.FieldName) || fields[ff.FieldName] != nil {
+			return &ValidationError{fmt.Sprintf("duplicate fieldname in %s: %s", specName, ff.FieldName)}
+		}
+		if ff.Length <= 0 {
+			return &ValidationError{fmt.Sprintf("invalid length of %s: %v", ff.FieldName, ff.Length)}
+		}
+		f := &Field{
+			Name:     ff.FieldName,
+			Bank:     ff.Bank,
+			Length:   ff.Length,
+			Offset:   ff.Offset,
+			Datatype: Uint,
+			Format:   Hex,
+		}
+		f, err := f.WithFormat(ff.DefaultDatatype, ff.DefaultFormat)
+		if err != nil {
+			return err
+		}
+		fields[ff.FieldName] = f
+	}
+	for name, f := range fields {
+		r.fields[name] = f
+	}
+	r.specs[specName] = spec
+	log.Printf("[TagMemory] defined %s", specName)
+	return nil
+}
+
+// Field returns a copy of the Field of the fieldname, a nil Registry only resolves the predefined ones
+func (r *Registry) Field(fieldname string) (*Field, error) {
+	if IsBuiltin(fieldname) || r == nil {
+		return ParseField(fieldname)
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	f, ok := r.fields[fieldname]
+	if !ok {
+		return nil, &ValidationError{"unknown fieldname: " + fieldname}
+	}
+	clone := *f
+	return &clone, nil
+}
+
+// Get returns the TMSpec of the name
+func (r *Registry) Get(specName string) (*TMFixedFieldListSpec, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	spec, ok := r.specs[specName]
+	if !ok {
+		return nil, &NoSuchNameError{specName}
+	}
+	return spec, nil
+}
+
+// Names returns the names of the defined TMSpecs
+func (r *Registry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	names := make([]string, 0, len(r.specs))
+	for name := range r.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetInUse sets the InUse to keep the fieldnames in use from being undefined
+func (r *Registry) SetInUse(inUse InUse) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.inUse = inUse
+}
+
+// Undefine removes the TMSpec and its fieldnames unless they are in use,
+// the InUse is called without the lock so that it can resolve the fieldnames
+func (r *Registry) Undefine(specName string) error {
+	spec, err := r.Get(specName)
+	if err != nil {
+		return err
+	}
+	r.mutex.RLock()
+	inUse := r.inUse
+	r.mutex.RUnlock()
+	for _, ff := range spec.FixedFields {
+		if inUse != nil && inUse(ff.FieldName) {
+			return &InUseError{specName, ff.FieldName}
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.specs[specName] != spec {
+		return &NoSuchNameError{specName}
+	}
+	for _, ff := range spec.FixedFields {
+		delete(r.fields, ff.FieldName)
+	}
+	delete(r.specs, specName)
+	log.Printf("[TagMemory] undefined %s", specName)
+	return nil
+}
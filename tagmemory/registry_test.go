@@ -0,0 +1,108 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tagmemory
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRegistry_Define(t *testing.T) {
+	r := NewRegistry()
+	spec := &TMFixedFieldListSpec{
+		FixedFields: []TMFixedFieldSpec{
+			{FieldName: "mdid", Bank: 2, Length: 12, Offset: 8},
+			{FieldName: "itemEPC", Bank: 3, Length: 96, Offset: 16, DefaultDatatype: EPC},
+		},
+	}
+	if err := r.Define("tid", spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Define("tid", spec); err == nil {
+		t.Error("Registry.Define() accepted a duplicate name")
+	}
+	for _, invalid := range []TMFixedFieldSpec{
+		{FieldName: "mdid", Bank: 2, Length: 12, Offset: 8},
+		{FieldName: "epc", Bank: 1, Length: 96, Offset: 32},
+		{FieldName: "lot", Bank: 4, Length: 16},
+		{FieldName: "lot", Bank: 3},
+		{FieldName: "lot", Bank: 3, Length: 16, DefaultFormat: EPCTag},
+		{FieldName: "lot", Bank: 3, Length: 24, DefaultDatatype: ISO15962String},
+	} {
+		if err := r.Define("invalid", &TMFixedFieldListSpec{[]TMFixedFieldSpec{invalid}}); err == nil {
+			t.Errorf("Registry.Define() accepted %+v", invalid)
+		}
+	}
+
+	got, err := r.Field("itemEPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Field{Name: "itemEPC", Bank: 3, Length: 96, Offset: 16, Datatype: EPC, Format: EPCTag}); *got != want {
+		t.Errorf("Registry.Field() = %+v, want %+v", *got, want)
+	}
+	if _, err = r.Field("tidBank"); err != nil {
+		t.Errorf("Registry.Field() error = %v for a predefined fieldname", err)
+	}
+	if _, err = (*Registry)(nil).Field("mdid"); err == nil {
+		t.Error("nil Registry.Field() resolved a defined fieldname")
+	}
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"tid"}) {
+		t.Errorf("Registry.Names() = %v", names)
+	}
+}
+
+func TestRegistry_Undefine(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Define("tid", &TMFixedFieldListSpec{[]TMFixedFieldSpec{{FieldName: "mdid", Bank: 2, Length: 12, Offset: 8}}}); err != nil {
+		t.Fatal(err)
+	}
+	used := true
+	r.SetInUse(func(fieldname string) bool {
+		return used && fieldname == "mdid"
+	})
+	if _, ok := r.Undefine("tid").(*InUseError); !ok {
+		t.Error("Registry.Undefine() removed a fieldname in use")
+	}
+	used = false
+	if err := r.Undefine("tid"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Undefine("tid").(*NoSuchNameError); !ok {
+		t.Error("Registry.Undefine() removed a missing TMSpec")
+	}
+	if _, err := r.Field("mdid"); err == nil {
+		t.Error("Registry.Field() resolved an undefined fieldname")
+	}
+}
+
+func TestLoadSpecsFromJSONFile(t *testing.T) {
+	fp, err := ioutil.TempFile("", "tmspecs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fp.Name())
+	fp.WriteString(`{
+  "items": {"fixedFields": [{"fieldname": "itemEPC", "bank": 3, "length": 96, "offset": 16, "defaultDatatype": "epc"}]}
+}`)
+	fp.Close()
+
+	want := map[string]*TMFixedFieldListSpec{
+		"items": {FixedFields: []TMFixedFieldSpec{{FieldName: "itemEPC", Bank: 3, Length: 96, Offset: 16, DefaultDatatype: EPC}}},
+	}
+	got, err := LoadSpecsFromJSONFile(fp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadSpecsFromJSONFile() = %v, want %v", got, want)
+	}
+	if _, err = LoadSpecsFromJSONFile(fp.Name() + ".none"); err == nil {
+		t.Errorf("LoadSpecsFromJSONFile() error = nil for a missing file")
+	}
+}
@@ -0,0 +1,506 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tdt
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// epcTagEncodings are the tag encodings of the pure identity schemes in the order to try
+var epcTagEncodings = map[string][]string{
+	"adi":   {"adi-var"},
+	"cpi":   {"cpi-96", "cpi-var"},
+	"gdti":  {"gdti-96", "gdti-113", "gdti-174"},
+	"giai":  {"giai-96", "giai-202"},
+	"gid":   {"gid-96"},
+	"grai":  {"grai-96", "grai-170"},
+	"gsrn":  {"gsrn-96"},
+	"gsrnp": {"gsrnp-96"},
+	"sgcn":  {"sgcn-96"},
+	"sgln":  {"sgln-96", "sgln-195"},
+	"sgtin": {"sgtin-96", "sgtin-198"},
+	"sscc":  {"sscc-96"},
+	"usdod": {"usdod-96"},
+}
+
+// epc96PatternTypes are the tag encodings decoded by buildEPC
+var epc96PatternTypes = map[byte]string{
+	48: "sgtin-96",
+	49: "sscc-96",
+	51: "grai-96",
+	52: "giai-96",
+}
+
+// gs1KeyAIs are the AIs of the GS1 keys in the element strings and their keys in the legacy format
+var gs1KeyAIs = map[string]string{
+	"00":   "sscc",
+	"01":   "gtin",
+	"253":  "gdti",
+	"255":  "sgcn",
+	"414":  "gln",
+	"8003": "grai",
+	"8004": "giai",
+	"8010": "cpi",
+	"8017": "gsrnp",
+	"8018": "gsrn",
+}
+
+// serialAIs are the AIs of the serials for the GS1 keys, "serial" in the legacy format
+var serialAIs = map[string]string{
+	"01":   "21",
+	"414":  "254",
+	"8010": "8011",
+}
+
+// Encode converts the identifier in any level to the PC bits and the ID to write to a tag
+func (c *Core) Encode(input string, params map[string]string) ([]byte, []byte, error) {
+	bs, err := c.Convert(input, params, Binary)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := bitsToBytes(bs)
+	// L4-0 is the length in words, UMI=0, XI=0, T=0
+	pc := []byte{uint8(len(id) / 2 << 3), 0}
+	return pc, id, nil
+}
+
+// TagURI returns the tag URI of the id with the filter value, e.g., urn:epc:tag:sgtin-96:3.0614141.812345.6789
+func (c *Core) TagURI(id []byte) (string, error) {
+	return c.Convert(binaryString(id), nil, TagEncoding)
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// epcIdentity is an EPC in the fields of the pure identity URI, with the tag encoding if known
+type epcIdentity struct {
+	name        string
+	patternType string
+	filter      string
+	fields      []string
+}
+
+// convertBuiltin translates the identifier in any level to the output level without the scheme definitions
+func (c *Core) convertBuiltin(input string, params map[string]string, outputLevel LevelType) (string, error) {
+	epc, err := c.parseIdentity(input, params)
+	if err != nil {
+		return "", err
+	}
+	switch outputLevel {
+	case PureIdentity:
+		return "urn:epc:id:" + epc.name + ":" + strings.Join(epc.fields, "."), nil
+	case Binary, TagEncoding:
+		bs, tag, err := c.encodeIdentity(epc, params)
+		if outputLevel == Binary {
+			return bs, err
+		}
+		return tag, err
+	case ElementString, Legacy:
+		ais, err := elementStrings(epc)
+		if err != nil {
+			return "", err
+		}
+		return formatElementStrings(ais, outputLevel == Legacy), nil
+	}
+	return "", fmt.Errorf("unknown level: %v", outputLevel)
+}
+
+// parseIdentity parses the identifier in the binary, the URIs, the element string, or the legacy format
+func (c *Core) parseIdentity(input string, params map[string]string) (*epcIdentity, error) {
+	switch {
+	case strings.HasPrefix(input, "urn:epc:tag:"):
+		tf := strings.SplitN(strings.TrimPrefix(input, "urn:epc:tag:"), ":", 2)
+		if len(tf) != 2 {
+			return nil, fmt.Errorf("invalid tag URI: %v", input)
+		}
+		epc := &epcIdentity{name: strings.Split(tf[0], "-")[0], patternType: tf[0], fields: strings.Split(tf[1], ".")}
+		if epc.name != "gid" {
+			epc.filter, epc.fields = epc.fields[0], epc.fields[1:]
+		}
+		return epc, nil
+	case strings.HasPrefix(input, "urn:epc:id:"):
+		nf := strings.SplitN(strings.TrimPrefix(input, "urn:epc:id:"), ":", 2)
+		if len(nf) != 2 {
+			return nil, fmt.Errorf("invalid pure identity URI: %v", input)
+		}
+		return &epcIdentity{name: nf[0], fields: strings.Split(nf[1], ".")}, nil
+	case strings.HasPrefix(input, "("):
+		ais, err := parseElementStrings(input)
+		if err != nil {
+			return nil, err
+		}
+		return parseGS1Keys(ais, params)
+	case strings.Contains(input, "="):
+		ais, err := parseLegacy(input)
+		if err != nil {
+			return nil, err
+		}
+		return parseGS1Keys(ais, params)
+	case input != "" && strings.Trim(input, "01") == "":
+		return c.parseBinary(bitsToBytes(input))
+	}
+	return nil, fmt.Errorf("unknown identifier: %v", input)
+}
+
+// parseBinary decodes the id to the epcIdentity
+func (c *Core) parseBinary(id []byte) (*epcIdentity, error) {
+	if len(id) == 0 {
+		return nil, fmt.Errorf("empty id")
+	}
+	if s, ok := epcSchemes[id[0]]; ok {
+		filter, values, err := s.decode(id)
+		if err != nil {
+			return nil, err
+		}
+		return &epcIdentity{s.name, s.patternType, filter, values}, nil
+	}
+	patternType, ok := epc96PatternTypes[id[0]]
+	if !ok || len(id) < 12 {
+		return nil, fmt.Errorf("unknown EPC header: %v", id[0])
+	}
+	urn, err := c.buildEPC(id[:12])
+	if err != nil {
+		return nil, err
+	}
+	nf := strings.SplitN(strings.TrimPrefix(urn, "urn:epc:id:"), ":", 2)
+	return &epcIdentity{nf[0], patternType, strconv.Itoa(int(id[1] >> 5)), strings.Split(nf[1], ".")}, nil
+}
+
+// encodeIdentity encodes the epcIdentity to the binary and the tag URI in the tag encoding,
+// given by the taglength param, or the first one able to encode the fields
+func (c *Core) encodeIdentity(epc *epcIdentity, params map[string]string) (string, string, error) {
+	candidates := epcTagEncodings[epc.name]
+	if tl, ok := params["taglength"]; ok {
+		candidates = []string{epc.name + "-" + tl}
+	} else if epc.patternType != "" {
+		candidates = []string{epc.patternType}
+	}
+	if len(candidates) == 0 {
+		return "", "", fmt.Errorf("no tag encoding for %v", epc.name)
+	}
+	fields := epc.fields
+	if epc.name != "gid" {
+		filter := epc.filter
+		if filter == "" {
+			filter = params["filter"]
+		}
+		if filter == "" {
+			return "", "", fmt.Errorf("missing parameter: filter")
+		}
+		fields = append([]string{filter}, fields...)
+	}
+	var err error
+	for _, patternType := range candidates {
+		var bs string
+		if bs, err = c.encodeTag(patternType, fields, epc); err == nil {
+			return bs, "urn:epc:tag:" + patternType + ":" + strings.Join(fields, "."), nil
+		}
+	}
+	return "", "", err
+}
+
+// encodeTag encodes the tag URI fields in the tag encoding and verifies it decodes to the same identity
+func (c *Core) encodeTag(patternType string, fields []string, epc *epcIdentity) (string, error) {
+	size := 96
+	if _, ok := epcPatternSchemes[patternType]; ok {
+		// the built-in 96-bit encoders take only digits
+		for _, f := range fields {
+			if f == "" || strings.Trim(f, "0123456789") != "" {
+				return "", fmt.Errorf("%v can't encode %q", patternType, fields)
+			}
+		}
+	} else {
+		found := false
+		for _, s := range epcSchemes {
+			if s.patternType == patternType {
+				size, found = s.size, true
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("unknown tag encoding: %v", patternType)
+		}
+	}
+	bs, err := MakePrefixFilterString(patternType, fields)
+	if err != nil {
+		return "", err
+	}
+	if size != 0 && len(bs) > size {
+		return "", fmt.Errorf("%v can't encode %q", patternType, fields)
+	}
+	if len(bs) < size {
+		bs += strings.Repeat("0", size-len(bs))
+	}
+	if padding := len(bs) % 16; padding != 0 {
+		bs += strings.Repeat("0", 16-padding)
+	}
+	decoded, err := c.parseBinary(bitsToBytes(bs))
+	if err != nil || decoded.name != epc.name || strings.Join(decoded.fields, ".") != strings.Join(epc.fields, ".") {
+		return "", fmt.Errorf("%v can't encode %q", patternType, fields)
+	}
+	return bs, nil
+}
+
+// elementStrings returns the AIs and their values of the epcIdentity
+func elementStrings(epc *epcIdentity) (map[string]string, error) {
+	f := make([]string, len(epc.fields))
+	for i, v := range epc.fields {
+		var err error
+		if f[i], err = url.PathUnescape(v); err != nil {
+			return nil, err
+		}
+	}
+	want := map[string]int{"sgtin": 3, "sscc": 2, "sgln": 3, "grai": 3, "giai": 2, "gsrn": 2, "gsrnp": 2, "gdti": 3, "cpi": 3, "sgcn": 3}
+	if n, ok := want[epc.name]; !ok {
+		return nil, fmt.Errorf("no GS1 element string for %v", epc.name)
+	} else if len(f) != n || f[1] == "" && epc.name != "sgln" && epc.name != "gdti" && epc.name != "sgcn" {
+		return nil, fmt.Errorf("invalid fields for %v: %q", epc.name, epc.fields)
+	}
+	cp := f[0]
+	switch epc.name {
+	case "sgtin":
+		gtin := f[1][:1] + cp + f[1][1:]
+		return withChecksum(map[string]string{"01": gtin, "21": f[2]}, "01", gtin, "")
+	case "sscc":
+		sscc := f[1][:1] + cp + f[1][1:]
+		return withChecksum(map[string]string{}, "00", sscc, "")
+	case "sgln":
+		ais := map[string]string{}
+		if f[2] != "0" {
+			ais["254"] = f[2]
+		}
+		return withChecksum(ais, "414", cp+f[1], "")
+	case "grai":
+		return withChecksum(map[string]string{}, "8003", "0"+cp+f[1], f[2])
+	case "giai":
+		return map[string]string{"8004": cp + f[1]}, nil
+	case "gsrn":
+		return withChecksum(map[string]string{}, "8018", cp+f[1], "")
+	case "gsrnp":
+		return withChecksum(map[string]string{}, "8017", cp+f[1], "")
+	case "gdti":
+		return withChecksum(map[string]string{}, "253", cp+f[1], f[2])
+	case "cpi":
+		return map[string]string{"8010": cp + f[1], "8011": f[2]}, nil
+	}
+	// sgcn
+	return withChecksum(map[string]string{}, "255", cp+f[1], f[2])
+}
+
+// withChecksum sets the AI to the key with the check digit followed by the serial
+func withChecksum(ais map[string]string, ai string, key string, serial string) (map[string]string, error) {
+	checkDigit, err := gs1Checksum(key)
+	if err != nil {
+		return nil, err
+	}
+	ais[ai] = key + checkDigit + serial
+	return ais, nil
+}
+
+// formatElementStrings formats the AIs in the element string, or in the legacy format
+func formatElementStrings(ais map[string]string, legacy bool) string {
+	keys := []string{}
+	for ai := range ais {
+		keys = append(keys, ai)
+	}
+	// the GS1 key first
+	sort.Slice(keys, func(i, j int) bool {
+		_, ki := gs1KeyAIs[keys[i]]
+		_, kj := gs1KeyAIs[keys[j]]
+		return ki && !kj || ki == kj && keys[i] < keys[j]
+	})
+	elems := make([]string, len(keys))
+	for i, ai := range keys {
+		switch key, ok := gs1KeyAIs[ai]; {
+		case !legacy:
+			elems[i] = "(" + ai + ")" + ais[ai]
+		case ok:
+			elems[i] = key + "=" + ais[ai]
+		default:
+			elems[i] = "serial=" + ais[ai]
+		}
+	}
+	if legacy {
+		return strings.Join(elems, ";")
+	}
+	return strings.Join(elems, "")
+}
+
+// parseElementStrings parses the element string, e.g., (01)80614141123458(21)6789
+func parseElementStrings(input string) (map[string]string, error) {
+	ais := map[string]string{}
+	ai := ""
+	for rest := input; rest != ""; {
+		// the value continues until the next known AI in parentheses
+		next := -1
+		for i := strings.IndexByte(rest, '('); i >= 0; {
+			if end := strings.IndexByte(rest[i:], ')'); end > 0 {
+				candidate := rest[i+1 : i+end]
+				_, isKey := gs1KeyAIs[candidate]
+				if isKey || candidate == "21" || candidate == "254" || candidate == "8011" {
+					next = i
+					break
+				}
+			}
+			j := strings.IndexByte(rest[i+1:], '(')
+			if j < 0 {
+				break
+			}
+			i += j + 1
+		}
+		if ai == "" && next != 0 {
+			return nil, fmt.Errorf("invalid element string: %v", input)
+		}
+		if next < 0 {
+			next = len(rest)
+		}
+		if ai != "" {
+			ais[ai] = rest[:next]
+		}
+		if next == len(rest) {
+			break
+		}
+		end := strings.IndexByte(rest[next:], ')')
+		ai, rest = rest[next+1:next+end], rest[next+end+1:]
+		if rest == "" {
+			ais[ai] = ""
+		}
+	}
+	return ais, nil
+}
+
+// parseLegacy parses the legacy format, e.g., gtin=80614141123458;serial=6789
+func parseLegacy(input string) (map[string]string, error) {
+	ais := map[string]string{}
+	serial, hasSerial := "", false
+	keyAI := ""
+	for _, kv := range strings.Split(input, ";") {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid legacy format: %v", input)
+		}
+		key, value := kv[:i], kv[i+1:]
+		if key == "serial" {
+			serial, hasSerial = value, true
+			continue
+		}
+		found := false
+		for ai, k := range gs1KeyAIs {
+			if k == key {
+				ais[ai], keyAI, found = value, ai, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown key in legacy format: %v", key)
+		}
+	}
+	if hasSerial {
+		ai, ok := serialAIs[keyAI]
+		if !ok {
+			return nil, fmt.Errorf("no serial for %v", gs1KeyAIs[keyAI])
+		}
+		ais[ai] = serial
+	}
+	return ais, nil
+}
+
+// parseGS1Keys returns the epcIdentity of the AIs with the gs1companyprefixlength param
+func parseGS1Keys(ais map[string]string, params map[string]string) (*epcIdentity, error) {
+	l, err := strconv.Atoi(params["gs1companyprefixlength"])
+	if err != nil {
+		return nil, fmt.Errorf("missing parameter: gs1companyprefixlength")
+	}
+	if l < 6 || 12 < l {
+		return nil, fmt.Errorf("invalid gs1companyprefixlength: %v", l)
+	}
+	for ai, name := range map[string]string{"00": "sscc", "01": "sgtin", "253": "gdti", "255": "sgcn", "414": "sgln", "8003": "grai", "8004": "giai", "8010": "cpi", "8017": "gsrnp", "8018": "gsrn"} {
+		v, ok := ais[ai]
+		if !ok {
+			continue
+		}
+		var fields []string
+		switch ai {
+		case "01":
+			if err = checkDigits(v, 14, l+1); err == nil {
+				fields = []string{v[1 : 1+l], v[:1] + v[1+l:13], ais["21"]}
+			}
+		case "00":
+			if err = checkDigits(v, 18, l+1); err == nil {
+				fields = []string{v[1 : 1+l], v[:1] + v[1+l:17]}
+			}
+		case "414":
+			if err = checkDigits(v, 13, l); err == nil {
+				ext, ok := ais["254"]
+				if !ok {
+					ext = "0"
+				}
+				fields = []string{v[:l], v[l:12], ext}
+			}
+		case "8003":
+			if len(v) < 14 || v[0] != '0' {
+				err = fmt.Errorf("invalid GRAI: %v", v)
+			} else if err = checkDigits(v[:14], 14, l+1); err == nil {
+				fields = []string{v[1 : 1+l], v[1+l : 13], v[14:]}
+			}
+		case "253", "255":
+			if len(v) < 13 {
+				err = fmt.Errorf("invalid %v: %v", name, v)
+			} else if err = checkDigits(v[:13], 13, l); err == nil {
+				fields = []string{v[:l], v[l:12], v[13:]}
+			}
+		case "8017", "8018":
+			if err = checkDigits(v, 18, l); err == nil {
+				fields = []string{v[:l], v[l:17]}
+			}
+		case "8004", "8010":
+			if len(v) <= l || strings.Trim(v[:l], "0123456789") != "" {
+				err = fmt.Errorf("invalid %v: %v", name, v)
+			} else {
+				fields = []string{v[:l], v[l:]}
+				if ai == "8010" {
+					fields = append(fields, ais["8011"])
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, f := range fields {
+			fields[i] = escapeURI(f)
+		}
+		return &epcIdentity{name: name, fields: fields}, nil
+	}
+	return nil, fmt.Errorf("no GS1 key in %v", ais)
+}
+
+// checkDigits returns an error if the value is not the digits of the length with the check digit,
+// or shorter than the minimum length
+func checkDigits(v string, length int, min int) error {
+	if len(v) != length || length < min || strings.Trim(v, "0123456789") != "" {
+		return fmt.Errorf("invalid GS1 key: %v", v)
+	}
+	checkDigit, _ := gs1Checksum(v[:length-1])
+	if checkDigit != v[length-1:] {
+		return fmt.Errorf("invalid check digit: %v", v)
+	}
+	return nil
+}
+
+// bitsToBytes packs the bits in string padded to the word boundary
+func bitsToBytes(bs string) []byte {
+	if padding := len(bs) % 16; padding != 0 {
+		bs += strings.Repeat("0", 16-padding)
+	}
+	id := make([]byte, len(bs)/8)
+	for i := range id {
+		for _, b := range bs[i*8 : i*8+8] {
+			id[i] = id[i]<<1 | byte(b-'0')
+		}
+	}
+	return id
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCore_Convert_builtin(t *testing.T) {
+	c := &Core{}
+	gcp7 := map[string]string{"gs1companyprefixlength": "7", "filter": "3"}
+	type args struct {
+		input       string
+		params      map[string]string
+		outputLevel LevelType
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{"SGTIN-96 BINARY to ELEMENT_STRING", args{sgtin96Binary, nil, ElementString}, "(01)80614141123458(21)6789", false},
+		{"SGTIN-96 BINARY to LEGACY", args{sgtin96Binary, nil, Legacy}, "gtin=80614141123458;serial=6789", false},
+		{"SGTIN-96 BINARY to TAG_ENCODING", args{sgtin96Binary, nil, TagEncoding}, "urn:epc:tag:sgtin-96:3.0614141.812345.6789", false},
+		{"ELEMENT_STRING to TAG_ENCODING", args{"(01)80614141123458(21)6789", gcp7, TagEncoding}, "urn:epc:tag:sgtin-96:3.0614141.812345.6789", false},
+		{"LEGACY to BINARY", args{"gtin=80614141123458;serial=6789", gcp7, Binary}, sgtin96Binary, false},
+		{"TAG_ENCODING to BINARY", args{"urn:epc:tag:sgtin-96:3.0614141.812345.6789", nil, Binary}, sgtin96Binary, false},
+		{"PURE_IDENTITY to TAG_ENCODING in SGTIN-198", args{"urn:epc:id:sgtin:0614141.812345.abc%2FXYZ", gcp7, TagEncoding}, "urn:epc:tag:sgtin-198:3.0614141.812345.abc%2FXYZ", false},
+		{"ELEMENT_STRING with a serial to PURE_IDENTITY", args{"(01)80614141123458(21)abc/XYZ", gcp7, PureIdentity}, "urn:epc:id:sgtin:0614141.812345.abc%2FXYZ", false},
+		{"SSCC PURE_IDENTITY to ELEMENT_STRING", args{"urn:epc:id:sscc:0614141.1234567890", nil, ElementString}, "(00)106141412345678908", false},
+		{"SGLN PURE_IDENTITY to LEGACY", args{"urn:epc:id:sgln:0614141.12345.400", nil, Legacy}, "gln=0614141123452;serial=400", false},
+		{"GRAI ELEMENT_STRING to PURE_IDENTITY", args{"(8003)006141411234525678", gcp7, PureIdentity}, "urn:epc:id:grai:0614141.12345.5678", false},
+		{"GID PURE_IDENTITY to TAG_ENCODING", args{"urn:epc:id:gid:95100000.12345.400", nil, TagEncoding}, "urn:epc:tag:gid-96:95100000.12345.400", false},
+		{"GID PURE_IDENTITY to ELEMENT_STRING", args{"urn:epc:id:gid:95100000.12345.400", nil, ElementString}, "", true},
+		{"invalid check digit", args{"(01)80614141123459(21)6789", gcp7, PureIdentity}, "", true},
+		{"missing gs1companyprefixlength", args{"(01)80614141123458(21)6789", nil, PureIdentity}, "", true},
+		{"missing filter", args{"urn:epc:id:sgtin:0614141.812345.6789", nil, Binary}, "", true},
+		{"serial too long for SGTIN-96", args{"urn:epc:tag:sgtin-96:3.0614141.812345.abc", nil, Binary}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Convert(tt.args.input, tt.args.params, tt.args.outputLevel)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Core.Convert() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Core.Convert() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCore_Encode(t *testing.T) {
+	c := &Core{}
+	pc, id, err := c.Encode("(01)80614141123458(21)6789", map[string]string{"gs1companyprefixlength": "7", "filter": "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{48, 0}; !reflect.DeepEqual(pc, want) {
+		t.Errorf("Core.Encode() pc = %v, want %v", pc, want)
+	}
+	if want := []byte{48, 116, 37, 123, 247, 25, 78, 64, 0, 0, 26, 133}; !reflect.DeepEqual(id, want) {
+		t.Errorf("Core.Encode() id = %v, want %v", id, want)
+	}
+}
@@ -9,60 +9,26 @@ package tdt
 import (
 	"errors"
 	"fmt"
-	//"io/ioutil"
-	//"log"
 	"math/big"
-	//"strconv"
 	"strings"
-	//"xml"
 )
 
 // Core is the TDT core
 type Core struct {
-	//schemePrefixMap map[schemePrefix]string
+	// schemes are the TDT scheme definitions used before the built-in translation
+	schemes       []*tdtScheme
 	epcTDSVersion string
 }
 
-// NewCore returns a new instance of TDT core
+// NewCore returns a new instance of TDT core with the scheme definitions loaded by LoadDefaultSchemes
 func NewCore() *Core {
 	c := new(Core)
-	//c.loadEPCTagDataTranslation()
+	defaultSchemesMu.RLock()
+	c.schemes = defaultSchemes
+	defaultSchemesMu.RUnlock()
 	return c
 }
 
-// LoadEPCTagDataTranslation loads EPC scheme from scheme files
-func (c *Core) LoadEPCTagDataTranslation() {
-	//schemaDir := os.Getenv("GOPATH") + "/src/github.com/iomz/gosstrak/vendor/schemes/"
-	//files, err := ioutil.ReadDir(schemaDir)
-	//if err != nil {
-	//	log.Fatal(err)
-	//}
-
-	//for _, f := range files {
-	//}
-}
-
-/*
-type schemePrefix struct {
-	prefixMatch     []byte
-	prefixBitLength int
-}
-
-type schemePatternMap map[string][]schemePattern
-
-type schemePattern struct {
-	pattern string
-	fields  []schemeField
-}
-
-type schemeFiled struct {
-	decimalMinimum int
-	decimalMaximum int
-	bitLength      int
-	name           string
-}
-*/
-
 // Translate takes ID in binary ([]byte) and returns the corresponding PureIdentity
 func (c *Core) Translate(pc []byte, id []byte) (string, error) {
 	if len(pc) != 2 {
@@ -73,6 +39,11 @@ func (c *Core) Translate(pc []byte, id []byte) (string, error) {
 	// 00000001 & pc[0]
 	switch 1 & pc[0] {
 	case 0: // GS1
+		if len(c.schemes) != 0 {
+			if urn, err := c.Convert(binaryString(id), nil, PureIdentity); err == nil {
+				return urn, nil
+			}
+		}
 		return c.buildEPC(id)
 	case 1: // ISO
 		return c.buildUII(id, pc[1])
@@ -796,44 +767,20 @@ func (c *Core) buildEPC(id []byte) (string, error) {
 			z.SetBytes(iar)
 			urn += z.String()
 		}
+	default:
+		if s, ok := epcSchemes[id[0]]; ok {
+			return s.pureIdentity(id)
+		}
 	}
 	return urn, nil
 }
 
 func (c *Core) buildUII(id []byte, afi byte) (string, error) {
-	urn := "urn:epc:id:iso"
-	switch afi {
-	case 161:
-		urn += "17367:"
-	case 162:
-		urn += "17365:"
-	case 163:
-		urn += "17364:"
-	case 164:
-		urn += "17367h:"
-	case 165:
-		urn += "17366:"
-	case 166:
-		urn += "17366h:"
-	case 167:
-		urn += "17365h:"
-	case 168:
-		urn += "17364h:"
-	case 169:
-		urn += "17363:"
-	case 170:
-		urn += "17363h:"
-	default:
-		return "", errors.New("invalid afi")
-	}
-
-	sid, err := parse6BitEncodedByteSliceToString(id)
+	uii, err := DecodeUII(afi, id)
 	if err != nil {
 		return "", err
 	}
-
-	urn += sid
-	return urn, nil
+	return uii.URI(), nil
 }
 
 func (c *Core) buildProprietary(id []byte) (string, error) {
@@ -841,8 +788,11 @@ func (c *Core) buildProprietary(id []byte) (string, error) {
 }
 
 // MakePrefixFilterString takes a pattern type and a slice of fields
-// return a binary reporesentation of the prefix filter in string
+// return a binary reporesentation of the prefix filter in string,
+// the filters of the ISO standards start with the AFI followed by the UII (see FilterID)
 func MakePrefixFilterString(patternType string, fields []string) (string, error) {
+	var uii string
+	var err error
 	switch patternType { // type
 	case "giai-96":
 		return NewPrefixFilterGIAI96(fields)
@@ -852,13 +802,38 @@ func MakePrefixFilterString(patternType string, fields []string) (string, error)
 		return NewPrefixFilterSGTIN96(fields)
 	case "sscc-96":
 		return NewPrefixFilterSSCC96(fields)
-	case "iso17363":
-		return NewPrefixFilterISO17363(fields)
-	case "iso17365":
-		return NewPrefixFilterISO17365(fields)
+	case "iso17363", "iso17363h":
+		uii, err = NewPrefixFilterISO17363(fields)
+	case "iso17364", "iso17364h":
+		uii, err = NewPrefixFilterISO17364(fields)
+	case "iso17365", "iso17365h":
+		uii, err = NewPrefixFilterISO17365(fields)
+	case "iso17366", "iso17366h":
+		uii, err = NewPrefixFilterISO17366(fields)
+	case "iso17367", "iso17367h":
+		uii, err = NewPrefixFilterISO17367(fields)
 	default:
-		return "", fmt.Errorf("unknown patternType: %v", patternType)
+		return NewPrefixFilterEPC(patternType, fields)
+	}
+	if err != nil {
+		return "", err
+	}
+	// the standards sharing a data identifier are told apart by the AFI
+	for afi, standard := range uiiStandards {
+		if standard == patternType {
+			return fmt.Sprintf("%08b", afi) + uii, nil
+		}
+	}
+	return "", fmt.Errorf("unknown standard: %v", patternType)
+}
+
+// FilterID returns the bits of the tag to match with the prefix filters,
+// the AFI in the PC precedes the UII for the tags with the ISO toggle
+func FilterID(pc []byte, id []byte) []byte {
+	if len(pc) != 2 || 1&pc[0] == 0 {
+		return id
 	}
+	return append([]byte{pc[1]}, id...)
 }
 
 func parse6BitEncodedByteSliceToString(in []byte) (string, error) {
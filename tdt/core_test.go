@@ -240,15 +240,50 @@ func Test_core_Translate(t *testing.T) {
 			"ISO17363_7B_ABC_U_1234560",
 			fields{""},
 			args{[]byte{41, 169}, []byte{220, 32, 66, 13, 92, 114, 207, 77, 118, 194}},
-			"urn:epc:id:iso17363:7BABCU1234560",
+			"urn:epc:id:iso17363:7B.ABC.U.123456.0",
 			false,
-		},
-		{
+		}, {
+			"ISO17363_7B_ABC_U_1234561",
+			fields{""},
+			args{[]byte{41, 169}, []byte{220, 32, 66, 13, 92, 114, 207, 77, 118, 198}},
+			"",
+			true,
+		}, {
+			"ISO17365_25S_UN_123456789_0THANK0YOU0FOR0READING0THIS1",
+			fields{""},
+			args{[]byte{129, 162}, []byte{203, 84, 213, 59, 28, 179, 211, 93, 183, 227, 156, 20, 32, 19, 139, 193, 147, 213, 192, 99, 210, 193, 33, 65, 16, 147, 135, 193, 66, 9, 79, 24}},
+			"urn:epc:id:iso17365:25S.UN.123456789.0THANK0YOU0FOR0READING0THIS1",
+			false,
+		}, {
 			"ISO17365_25S_UN_ABC_0THANK0YOU0FOR0READING0THIS1",
 			fields{""},
 			args{[]byte{113, 162}, []byte{203, 84, 213, 56, 16, 131, 193, 66, 1, 56, 188, 25, 61, 92, 6, 61, 44, 18, 20, 17, 9, 56, 124, 20, 32, 148, 241, 130}},
 			"urn:epc:id:iso17365:25SUNABC0THANK0YOU0FOR0READING0THIS1",
 			false,
+		}, {
+			"ISO17365h_1J_UN_123456789_A/B",
+			fields{""},
+			args{[]byte{49, 167}, []byte{196, 165, 78, 199, 44, 244, 215, 109, 248, 228, 27, 194}},
+			"urn:epc:id:iso17365h:1J.UN.123456789.A%2FB",
+			false,
+		}, {
+			"ISO17364_25B_UN_123456789_RTI-0001",
+			fields{""},
+			args{[]byte{73, 163}, []byte{203, 80, 149, 59, 28, 179, 211, 93, 183, 227, 148, 148, 38, 220, 48, 195, 24, 32}},
+			"urn:epc:id:iso17364:25B.UN.123456789.RTI-0001",
+			false,
+		}, {
+			"ISO17363_25S_UN_123456789_0THANK0YOU0FOR0READING0THIS1",
+			fields{""},
+			args{[]byte{129, 169}, []byte{203, 84, 213, 59, 28, 179, 211, 93, 183, 227, 156, 20, 32, 19, 139, 193, 147, 213, 192, 99, 210, 193, 33, 65, 16, 147, 135, 193, 66, 9, 79, 24}},
+			"",
+			true,
+		}, {
+			"ISO17367_25S_XX_123456789_1",
+			fields{""},
+			args{[]byte{49, 161}, []byte{203, 84, 216, 99, 28, 179, 211, 93, 183, 227, 156, 96}},
+			"urn:epc:id:iso17367:25SXX1234567891",
+			false,
 		},
 	}
 	for _, tt := range tests {
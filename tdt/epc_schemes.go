@@ -0,0 +1,505 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tdt
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Key values for the PartitionTables of the other EPC schemes
+const (
+	LRBits PartitionTableKey = iota + IARDigits + 1
+	LRDigits
+	DTBits
+	DTDigits
+	SRBits
+	SRDigits
+	PRBits
+	PRDigits
+	CRBits
+	CRDigits
+)
+
+// CPI96PartitionTable is PT for CPI-96
+var CPI96PartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, PRBits: 11, PRDigits: 3},
+	11: {PValue: 1, CPBits: 37, PRBits: 14, PRDigits: 4},
+	10: {PValue: 2, CPBits: 34, PRBits: 17, PRDigits: 5},
+	9:  {PValue: 3, CPBits: 30, PRBits: 21, PRDigits: 6},
+	8:  {PValue: 4, CPBits: 27, PRBits: 24, PRDigits: 7},
+	7:  {PValue: 5, CPBits: 24, PRBits: 27, PRDigits: 8},
+	6:  {PValue: 6, CPBits: 20, PRBits: 31, PRDigits: 9},
+}
+
+// CPIVarPartitionTable is PT for CPI-var, PRDigits is the maximum number of characters
+var CPIVarPartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, PRBits: 114, PRDigits: 18},
+	11: {PValue: 1, CPBits: 37, PRBits: 120, PRDigits: 19},
+	10: {PValue: 2, CPBits: 34, PRBits: 126, PRDigits: 20},
+	9:  {PValue: 3, CPBits: 30, PRBits: 132, PRDigits: 21},
+	8:  {PValue: 4, CPBits: 27, PRBits: 138, PRDigits: 22},
+	7:  {PValue: 5, CPBits: 24, PRBits: 144, PRDigits: 23},
+	6:  {PValue: 6, CPBits: 20, PRBits: 150, PRDigits: 24},
+}
+
+// GDTIPartitionTable is PT for GDTI
+var GDTIPartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, DTBits: 1, DTDigits: 0},
+	11: {PValue: 1, CPBits: 37, DTBits: 4, DTDigits: 1},
+	10: {PValue: 2, CPBits: 34, DTBits: 7, DTDigits: 2},
+	9:  {PValue: 3, CPBits: 30, DTBits: 11, DTDigits: 3},
+	8:  {PValue: 4, CPBits: 27, DTBits: 14, DTDigits: 4},
+	7:  {PValue: 5, CPBits: 24, DTBits: 17, DTDigits: 5},
+	6:  {PValue: 6, CPBits: 20, DTBits: 21, DTDigits: 6},
+}
+
+// GIAI202PartitionTable is PT for GIAI-202, IARDigits is the maximum number of characters
+var GIAI202PartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, IARBits: 148, IARDigits: 18},
+	11: {PValue: 1, CPBits: 37, IARBits: 151, IARDigits: 19},
+	10: {PValue: 2, CPBits: 34, IARBits: 154, IARDigits: 20},
+	9:  {PValue: 3, CPBits: 30, IARBits: 158, IARDigits: 21},
+	8:  {PValue: 4, CPBits: 27, IARBits: 161, IARDigits: 22},
+	7:  {PValue: 5, CPBits: 24, IARBits: 164, IARDigits: 23},
+	6:  {PValue: 6, CPBits: 20, IARBits: 168, IARDigits: 24},
+}
+
+// GSRNPartitionTable is PT for GSRN and GSRNP
+var GSRNPartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, SRBits: 18, SRDigits: 5},
+	11: {PValue: 1, CPBits: 37, SRBits: 21, SRDigits: 6},
+	10: {PValue: 2, CPBits: 34, SRBits: 24, SRDigits: 7},
+	9:  {PValue: 3, CPBits: 30, SRBits: 28, SRDigits: 8},
+	8:  {PValue: 4, CPBits: 27, SRBits: 31, SRDigits: 9},
+	7:  {PValue: 5, CPBits: 24, SRBits: 34, SRDigits: 10},
+	6:  {PValue: 6, CPBits: 20, SRBits: 38, SRDigits: 11},
+}
+
+// SGCNPartitionTable is PT for SGCN
+var SGCNPartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, CRBits: 1, CRDigits: 0},
+	11: {PValue: 1, CPBits: 37, CRBits: 4, CRDigits: 1},
+	10: {PValue: 2, CPBits: 34, CRBits: 7, CRDigits: 2},
+	9:  {PValue: 3, CPBits: 30, CRBits: 11, CRDigits: 3},
+	8:  {PValue: 4, CPBits: 27, CRBits: 14, CRDigits: 4},
+	7:  {PValue: 5, CPBits: 24, CRBits: 17, CRDigits: 5},
+	6:  {PValue: 6, CPBits: 20, CRBits: 21, CRDigits: 6},
+}
+
+// SGLNPartitionTable is PT for SGLN
+var SGLNPartitionTable = PartitionTable{
+	12: {PValue: 0, CPBits: 40, LRBits: 1, LRDigits: 0},
+	11: {PValue: 1, CPBits: 37, LRBits: 4, LRDigits: 1},
+	10: {PValue: 2, CPBits: 34, LRBits: 7, LRDigits: 2},
+	9:  {PValue: 3, CPBits: 30, LRBits: 11, LRDigits: 3},
+	8:  {PValue: 4, CPBits: 27, LRBits: 14, LRDigits: 4},
+	7:  {PValue: 5, CPBits: 24, LRBits: 17, LRDigits: 5},
+	6:  {PValue: 6, CPBits: 20, LRBits: 21, LRDigits: 6},
+}
+
+// epcEncoding is the encoding method of a field in the binary EPC
+type epcEncoding int
+
+const (
+	// integerEncoding is a decimal without padding
+	integerEncoding epcEncoding = iota
+	// paddedIntegerEncoding is a decimal padded with zeros to the digits in the partition table
+	paddedIntegerEncoding
+	// partitionEncoding is the partition and the company prefix
+	partitionEncoding
+	// numericStringEncoding is a decimal after the leading 1 to keep the leading zeros
+	numericStringEncoding
+	// string7Encoding is the 7-bit characters padded with zeros
+	string7Encoding
+	// string6Encoding is the 6-bit characters terminated by zeros
+	string6Encoding
+	// cageEncoding is the CAGE or DoDAAC code in 6 characters padded with spaces
+	cageEncoding
+)
+
+// epcField is a field of the EPC following the filter value
+type epcField struct {
+	encoding epcEncoding
+	// the bit length, or the keys in the partition table
+	bits      int
+	bitsKey   PartitionTableKey
+	digitsKey PartitionTableKey
+	// charBits is the bits of a character in the cageEncoding
+	charBits int
+}
+
+// epcScheme describes the binary layout of an EPC scheme
+type epcScheme struct {
+	name        string
+	patternType string
+	header      byte
+	// size is the bit length, 0 for the variable length
+	size       int
+	filterBits int
+	pt         PartitionTable
+	fields     []epcField
+}
+
+// epcSchemes are the schemes decoded by the epcScheme, keyed by the header
+var epcSchemes = map[byte]*epcScheme{
+	0x2C: {"gdti", "gdti-96", 0x2C, 96, 3, GDTIPartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: paddedIntegerEncoding, bitsKey: DTBits, digitsKey: DTDigits},
+		{encoding: integerEncoding, bits: 41},
+	}},
+	0x2D: {"gsrn", "gsrn-96", 0x2D, 96, 3, GSRNPartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: paddedIntegerEncoding, bitsKey: SRBits, digitsKey: SRDigits},
+	}},
+	0x2E: {"gsrnp", "gsrnp-96", 0x2E, 96, 3, GSRNPartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: paddedIntegerEncoding, bitsKey: SRBits, digitsKey: SRDigits},
+	}},
+	0x2F: {"usdod", "usdod-96", 0x2F, 96, 4, nil, []epcField{
+		{encoding: cageEncoding, bits: 48, charBits: 8},
+		{encoding: integerEncoding, bits: 36},
+	}},
+	0x32: {"sgln", "sgln-96", 0x32, 96, 3, SGLNPartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: paddedIntegerEncoding, bitsKey: LRBits, digitsKey: LRDigits},
+		{encoding: integerEncoding, bits: 41},
+	}},
+	0x35: {"gid", "gid-96", 0x35, 96, 0, nil, []epcField{
+		{encoding: integerEncoding, bits: 28},
+		{encoding: integerEncoding, bits: 24},
+		{encoding: integerEncoding, bits: 36},
+	}},
+	0x36: {"sgtin", "sgtin-198", 0x36, 198, 3, SGTIN96PartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: paddedIntegerEncoding, bitsKey: IRBits, digitsKey: IRDigits},
+		{encoding: string7Encoding, bits: 140},
+	}},
+	0x37: {"grai", "grai-170", 0x37, 170, 3, GRAI96PartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: paddedIntegerEncoding, bitsKey: ATBits, digitsKey: ATDigits},
+		{encoding: string7Encoding, bits: 112},
+	}},
+	0x38: {"giai", "giai-202", 0x38, 202, 3, GIAI202PartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: string7Encoding, bitsKey: IARBits},
+	}},
+	0x39: {"sgln", "sgln-195", 0x39, 195, 3, SGLNPartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: paddedIntegerEncoding, bitsKey: LRBits, digitsKey: LRDigits},
+		{encoding: string7Encoding, bits: 140},
+	}},
+	0x3A: {"gdti", "gdti-113", 0x3A, 113, 3, GDTIPartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: paddedIntegerEncoding, bitsKey: DTBits, digitsKey: DTDigits},
+		{encoding: numericStringEncoding, bits: 58},
+	}},
+	0x3B: {"adi", "adi-var", 0x3B, 0, 6, nil, []epcField{
+		{encoding: cageEncoding, bits: 36, charBits: 6},
+		{encoding: string6Encoding, bits: 198},
+		{encoding: string6Encoding, bits: 186},
+	}},
+	0x3C: {"cpi", "cpi-96", 0x3C, 96, 3, CPI96PartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: integerEncoding, bitsKey: PRBits},
+		{encoding: integerEncoding, bits: 31},
+	}},
+	0x3D: {"cpi", "cpi-var", 0x3D, 0, 3, CPIVarPartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: string6Encoding, bitsKey: PRBits},
+		{encoding: integerEncoding, bits: 40},
+	}},
+	0x3E: {"gdti", "gdti-174", 0x3E, 174, 3, GDTIPartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: paddedIntegerEncoding, bitsKey: DTBits, digitsKey: DTDigits},
+		{encoding: string7Encoding, bits: 119},
+	}},
+	0x3F: {"sgcn", "sgcn-96", 0x3F, 96, 3, SGCNPartitionTable, []epcField{
+		{encoding: partitionEncoding},
+		{encoding: paddedIntegerEncoding, bitsKey: CRBits, digitsKey: CRDigits},
+		{encoding: numericStringEncoding, bits: 41},
+	}},
+}
+
+// NewPrefixFilterEPC takes a pattern type of the EPC schemes other than
+// GIAI-96, GRAI-96, SGTIN-96, and SSCC-96, and field values in a slice and return a prefix filter string
+func NewPrefixFilterEPC(patternType string, fields []string) (string, error) {
+	var s *epcScheme
+	for _, scheme := range epcSchemes {
+		if scheme.patternType == patternType {
+			s = scheme
+			break
+		}
+	}
+	if s == nil {
+		return "", fmt.Errorf("unknown patternType: %v", patternType)
+	}
+	return s.prefixFilter(fields)
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// pureIdentity decodes the id to the pure identity URI
+func (s *epcScheme) pureIdentity(id []byte) (string, error) {
+	_, values, err := s.decode(id)
+	if err != nil {
+		return "", err
+	}
+	return "urn:epc:id:" + s.name + ":" + strings.Join(values, "."), nil
+}
+
+// decode decodes the id to the filter value and the fields of the pure identity URI
+func (s *epcScheme) decode(id []byte) (string, []string, error) {
+	if s.size != 0 && len(id)*8 < s.size {
+		return "", nil, errors.New("Invalid ID")
+	}
+	r := &bitReader{id: id, offset: 8}
+	filter := ""
+	if s.filterBits != 0 {
+		fv, err := r.uint(s.filterBits)
+		if err != nil {
+			return "", nil, err
+		}
+		filter = strconv.FormatUint(fv, 10)
+	}
+	var pr map[PartitionTableKey]int
+	var cpDigits int
+	values := make([]string, 0, len(s.fields))
+	for _, f := range s.fields {
+		bits := f.bits
+		if f.bitsKey != 0 {
+			bits = pr[f.bitsKey]
+		}
+		var v string
+		var err error
+		switch f.encoding {
+		case partitionEncoding:
+			var partition uint64
+			if partition, err = r.uint(3); err != nil {
+				return "", nil, err
+			}
+			for k, p := range s.pt {
+				if p[PValue] == int(partition) {
+					pr, cpDigits = p, k
+				}
+			}
+			if pr == nil {
+				return "", nil, fmt.Errorf("invalid partition: %v", partition)
+			}
+			v, err = r.decimal(pr[CPBits], cpDigits)
+		case integerEncoding:
+			v, err = r.decimal(bits, 0)
+		case paddedIntegerEncoding:
+			v, err = r.decimal(bits, pr[f.digitsKey])
+			// the field without digits is empty in the URI
+			if err == nil && pr[f.digitsKey] == 0 {
+				if v != "0" {
+					return "", nil, fmt.Errorf("invalid value for no digits: %v", v)
+				}
+				v = ""
+			}
+		case numericStringEncoding:
+			if v, err = r.decimal(bits, 0); err == nil {
+				if !strings.HasPrefix(v, "1") {
+					return "", nil, fmt.Errorf("invalid numeric string: %v", v)
+				}
+				v = v[1:]
+			}
+		case string7Encoding:
+			v, err = r.chars(bits, 7, true)
+		case string6Encoding:
+			v, err = r.chars(bits, 6, false)
+		case cageEncoding:
+			v, err = r.chars(bits, f.charBits, true)
+			v = strings.TrimLeft(v, " ")
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		values = append(values, escapeURI(v))
+	}
+	return filter, values, nil
+}
+
+// prefixFilter returns the binary prefix filter for the pattern fields
+func (s *epcScheme) prefixFilter(fields []string) (string, error) {
+	nFields := len(fields)
+	if nFields == 0 {
+		return "", fmt.Errorf("wrong fields: %q", fields)
+	}
+	w := &strings.Builder{}
+	w.WriteString(fmt.Sprintf("%08b", s.header))
+	if s.filterBits != 0 {
+		if err := writeUint(w, fields[0], s.filterBits); err != nil {
+			return "", err
+		}
+		fields = fields[1:]
+	}
+	if len(fields) > len(s.fields) {
+		return "", fmt.Errorf("unknown fields provided %q", fields)
+	}
+	var pr map[PartitionTableKey]int
+	for i, value := range fields {
+		f := s.fields[i]
+		bits := f.bits
+		if f.bitsKey != 0 {
+			bits = pr[f.bitsKey]
+		}
+		value, err := url.PathUnescape(value)
+		if err != nil {
+			return "", err
+		}
+		switch f.encoding {
+		case partitionEncoding:
+			var ok bool
+			if pr, ok = s.pt[len(value)]; !ok {
+				return "", fmt.Errorf("invalid company prefix: %v", value)
+			}
+			w.WriteString(fmt.Sprintf("%03b", pr[PValue]))
+			err = writeUint(w, value, pr[CPBits])
+		case integerEncoding:
+			err = writeUint(w, value, bits)
+		case paddedIntegerEncoding:
+			if len(value) != pr[f.digitsKey] {
+				return "", fmt.Errorf("invalid digits: %v", value)
+			}
+			if value == "" {
+				value = "0"
+			}
+			err = writeUint(w, value, bits)
+		case numericStringEncoding:
+			err = writeUint(w, "1"+value, bits)
+		case string7Encoding:
+			err = writeChars(w, value, 7, bits, true)
+		case string6Encoding:
+			err = writeChars(w, value, 6, bits, false)
+		case cageEncoding:
+			err = writeChars(w, fmt.Sprintf("%*s", bits/f.charBits, value), f.charBits, bits, true)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return w.String(), nil
+}
+
+// bitReader reads the values from the bits of an id
+type bitReader struct {
+	id     []byte
+	offset int
+}
+
+// uint reads n bits as an unsigned integer
+func (r *bitReader) uint(n int) (v uint64, err error) {
+	if r.offset+n > len(r.id)*8 {
+		return 0, errors.New("Invalid ID")
+	}
+	for i := 0; i < n; i++ {
+		bit := (r.id[(r.offset+i)/8] >> uint(7-(r.offset+i)%8)) & 1
+		v = v<<1 | uint64(bit)
+	}
+	r.offset += n
+	return v, nil
+}
+
+// decimal reads n bits as a decimal string padded to the digits
+func (r *bitReader) decimal(n int, digits int) (string, error) {
+	v, err := r.uint(n)
+	if err != nil {
+		return "", err
+	}
+	d := strconv.FormatUint(v, 10)
+	if len(d) < digits {
+		d = strings.Repeat("0", digits-len(d)) + d
+	}
+	return d, nil
+}
+
+// chars reads the characters of charBits up to n bits,
+// the fixed field skips the padding and the variable field stops after the terminator
+func (r *bitReader) chars(n int, charBits int, fixed bool) (string, error) {
+	end := r.offset + n
+	var buf []byte
+	for r.offset+charBits <= end {
+		c, err := r.uint(charBits)
+		if err != nil {
+			return "", err
+		}
+		if c == 0 {
+			break
+		}
+		if charBits == 6 && c&32 == 0 {
+			c |= 64
+		}
+		buf = append(buf, byte(c))
+	}
+	if fixed {
+		r.offset = end
+	}
+	return string(buf), nil
+}
+
+// escapeURI escapes the characters reserved in the EPC URI
+func escapeURI(s string) string {
+	if !strings.ContainsAny(s, "\"#%&/<>?") {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if strings.IndexByte("\"#%&/<>?", c) < 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// writeChars writes the characters of charBits, padded with zeros to n bits for the fixed field,
+// or terminated with zeros for the variable field
+func writeChars(w *strings.Builder, s string, charBits int, n int, fixed bool) error {
+	if len(s)*charBits > n || !fixed && len(s)*charBits+charBits > n {
+		return fmt.Errorf("too long: %v", s)
+	}
+	for _, c := range []byte(s) {
+		if !validChar(c, charBits) {
+			return fmt.Errorf("invalid character in %v", s)
+		}
+		w.WriteString(fmt.Sprintf("%0*b", charBits, c&(1<<uint(charBits)-1)))
+	}
+	if fixed {
+		w.WriteString(strings.Repeat("0", n-len(s)*charBits))
+	} else {
+		w.WriteString(strings.Repeat("0", charBits))
+	}
+	return nil
+}
+
+// validChar returns true if the character can be encoded in charBits
+func validChar(c byte, charBits int) bool {
+	switch charBits {
+	case 5:
+		// the 5-bit characters are from A to _
+		return 'A' <= c && c < 0x60
+	case 6:
+		// the 6-bit characters are from 0x20 to 0x5F except @ for the terminator
+		return 0x20 <= c && c < 0x60 && c != '@'
+	}
+	return 0 < c && int(c) < 1<<uint(charBits)
+}
+
+// writeUint writes the decimal string in n bits
+func writeUint(w *strings.Builder, s string, n int) error {
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n < 64 && v >= 1<<uint(n) {
+		return fmt.Errorf("invalid value for %v bits: %v", n, s)
+	}
+	w.WriteString(fmt.Sprintf("%0*b", n, v))
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tdt
+
+import (
+	"testing"
+)
+
+func TestNewPrefixFilterEPC(t *testing.T) {
+	type args struct {
+		patternType string
+		fields      []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{"GID-96_95100000", args{"gid-96", []string{"95100000"}}, "001101010101101010110001110001100000", false},
+		{"SGLN-96_3_0614141", args{"sgln-96", []string{"3", "0614141"}}, "00110010011101000010010101111011111101", false},
+		{"SGLN-96_3_0614141_12345", args{"sgln-96", []string{"3", "0614141", "12345"}}, "0011001001110100001001010111101111110100011000000111001", false},
+		{"SGLN-96 with wrong LR digits", args{"sgln-96", []string{"3", "0614141", "123"}}, "", true},
+		{"SGLN-96 with invalid CP", args{"sgln-96", []string{"3", "061"}}, "", true},
+		{"GSRN-96 with too many fields", args{"gsrn-96", []string{"3", "0614141", "1234567890", "1"}}, "", true},
+		{"SGTIN-198 with invalid character", args{"sgtin-198", []string{"3", "0614141", "812345", "é"}}, "", true},
+		{"unknown", args{"foo-96", []string{"3"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewPrefixFilterEPC(tt.args.patternType, tt.args.fields)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewPrefixFilterEPC() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("NewPrefixFilterEPC() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_epcScheme_pureIdentity(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      []byte
+		want    string
+		wantErr bool
+	}{
+		{"GID-96", []byte{53, 90, 177, 198, 0, 3, 3, 144, 0, 0, 1, 144}, "urn:epc:id:gid:95100000.12345.400", false},
+		{"SGTIN-198 too short", []byte{54, 116, 37, 123, 247, 25, 78, 64, 0, 0, 26, 133}, "", true},
+		{"SGLN-96 with invalid partition", []byte{50, 124, 37, 123, 247, 25, 78, 64, 0, 0, 26, 133}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := epcSchemes[tt.id[0]].pureIdentity(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("pureIdentity() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("pureIdentity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package tdt contains Tag Data Translation module from binary to Pure Identity
+package tdt
+
+// IACAssignment is a table for the ISO/IEC 15459-2 issuing agency codes
+// and the length of the company identification numbers issued by them,
+// the UIIs of the other agencies are translated without the separators (see UII.Data)
+var IACAssignment = map[string]int{
+	"UN": 9, // Dun & Bradstreet DUNS
+}
+
+// IACNumeric is the issuing agency codes of the company identification numbers only in the digits
+var IACNumeric = map[string]bool{
+	"UN": true,
+}
@@ -45,6 +45,12 @@ func pad6BitEncodingRuneSlice(bs []rune) ([]rune, int) {
 	return bs, length
 }
 
+// Decode6BitString decodes the ISO/IEC 15962 6-bit compacted bytes into a string,
+// the padding spaces are dropped
+func Decode6BitString(in []byte) (string, error) {
+	return parse6BitEncodedByteSliceToString(in)
+}
+
 // NewPrefixFilterISO17363 takes fields and return the prefix filter in string
 func NewPrefixFilterISO17363(fields []string) (string, error) {
 	nFields := len(fields) // ownerCode, equipmentIdentifier, containerSerialNumber
@@ -91,8 +97,31 @@ func NewPrefixFilterISO17363(fields []string) (string, error) {
 	return "", fmt.Errorf("unknown fields provided: %q", fields)
 }
 
+// NewPrefixFilterISO17364 takes fields and return the prefix filter in string
+func NewPrefixFilterISO17364(fields []string) (string, error) {
+	return newPrefixFilterISO15459("iso17364", fields)
+}
+
 // NewPrefixFilterISO17365 takes fields and return the prefix filter in string
 func NewPrefixFilterISO17365(fields []string) (string, error) {
+	return newPrefixFilterISO15459("iso17365", fields)
+}
+
+// NewPrefixFilterISO17366 takes fields and return the prefix filter in string
+func NewPrefixFilterISO17366(fields []string) (string, error) {
+	return newPrefixFilterISO15459("iso17366", fields)
+}
+
+// NewPrefixFilterISO17367 takes fields and return the prefix filter in string
+func NewPrefixFilterISO17367(fields []string) (string, error) {
+	return newPrefixFilterISO15459("iso17367", fields)
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// newPrefixFilterISO15459 returns the prefix filter of the standard with the IAC, CIN and SN of ISO/IEC 15459,
+// the data identifier must be of the standard
+func newPrefixFilterISO15459(standard string, fields []string) (string, error) {
 	nFields := len(fields) // dataIdentifier, issuingAgencyCode, companyIdentification, serialNumber
 
 	if nFields == 0 {
@@ -100,6 +129,9 @@ func NewPrefixFilterISO17365(fields []string) (string, error) {
 	}
 
 	// dataIdentifier
+	if _, rest, err := parseDataIdentifier(fields[0], uiiDataIdentifiers[standard]); err != nil || len(rest) != 0 {
+		return "", fmt.Errorf("invalid data identifier for %v: %v", standard, fields[0])
+	}
 	dataIdentifier := binutil.ParseRuneSliceTo6BinRuneSlice([]rune(fields[0]))
 	if nFields == 1 {
 		return string(dataIdentifier), nil
@@ -0,0 +1,292 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tdt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxFilterStrings is the maximum number of filters compiled from a pattern
+const MaxFilterStrings = 256
+
+// epcPatternScheme describes the binary layout of an EPC scheme for the patterns
+type epcPatternScheme struct {
+	header string
+	pt     PartitionTable
+	// the bits and digits keys of the fields following the company prefix
+	bitsKeys   []PartitionTableKey
+	digitsKeys []PartitionTableKey
+	// serialBits is the bit length of the serial after the fields if any
+	serialBits int
+}
+
+var epcPatternSchemes = map[string]epcPatternScheme{
+	"giai-96":  {"00110100", GIAI96PartitionTable, []PartitionTableKey{IARBits}, []PartitionTableKey{IARDigits}, 0},
+	"grai-96":  {"00110011", GRAI96PartitionTable, []PartitionTableKey{ATBits}, []PartitionTableKey{ATDigits}, 38},
+	"sgtin-96": {"00110000", SGTIN96PartitionTable, []PartitionTableKey{IRBits}, []PartitionTableKey{IRDigits}, 38},
+	"sscc-96":  {"00110001", SSCC96PartitionTable, []PartitionTableKey{EBits}, []PartitionTableKey{EDigits}, 0},
+}
+
+// patternField is a field in the EPC pattern URI
+type patternField struct {
+	any    bool
+	lo, hi uint64
+	// digits is the number of digits in the field, 0 for "*" or a range
+	digits int
+}
+
+// MakeFilterStrings takes a pattern type and a slice of fields in the pattern URI grammar,
+// a field is a value, "*" for any value, "[lo-hi]" for a range, or a value with the trailing "X" digits,
+// returns the binary filters in string with 'x' for the wildcard bits
+func MakeFilterStrings(patternType string, fields []string) ([]string, error) {
+	// the trailing wildcards make a prefix
+	for len(fields) > 1 && fields[len(fields)-1] == "*" {
+		fields = fields[:len(fields)-1]
+	}
+	scheme, ok := epcPatternSchemes[patternType]
+	wildcard := false
+	for _, f := range fields {
+		if f == "*" || strings.HasPrefix(f, "[") || ok && strings.HasSuffix(strings.ToUpper(f), "X") {
+			wildcard = true
+			break
+		}
+	}
+	// the fully specified fields make a prefix filter
+	if !wildcard {
+		fs, err := MakePrefixFilterString(patternType, fields)
+		if err != nil {
+			return nil, err
+		}
+		return []string{fs}, nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("no wildcard or range supported in %v: %q", patternType, fields)
+	}
+	return scheme.filterStrings(fields)
+}
+
+// MatchPatternFields returns true if the fields of a pure identity match the fields of a pattern,
+// the pattern may have less fields than the pure identity
+func MatchPatternFields(pattern []string, fields []string) bool {
+	if len(pattern) > len(fields) {
+		return false
+	}
+	for i, p := range pattern {
+		if p == fields[i] {
+			continue
+		}
+		pf, err := parsePatternField(p)
+		if err != nil {
+			return false
+		}
+		if pf.any {
+			continue
+		}
+		if pf.digits != 0 && pf.digits != len(fields[i]) {
+			return false
+		}
+		v, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil || v < pf.lo || pf.hi < v {
+			return false
+		}
+	}
+	return true
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// filterStrings compiles the fields: filter, companyPrefix, the scheme fields, and serial
+func (s epcPatternScheme) filterStrings(fields []string) ([]string, error) {
+	nFields := len(fields)
+	if nFields == 0 || nFields > 2+len(s.bitsKeys)+btoi(s.serialBits != 0) {
+		return nil, fmt.Errorf("wrong fields: %q", fields)
+	}
+	pfs := make([]patternField, nFields)
+	for i, f := range fields {
+		pf, err := parsePatternField(f)
+		if err != nil {
+			return nil, err
+		}
+		pfs[i] = pf
+	}
+
+	// filter
+	filter, err := pfs[0].blocks(3)
+	if err != nil {
+		return nil, err
+	}
+	blocks := [][]string{{s.header}, filter}
+	if nFields == 1 {
+		return product(blocks)
+	}
+
+	// companyPrefix, the partition comes from the number of digits
+	// or from the following field if the company prefix is "*"
+	cp := pfs[1]
+	if !cp.any && cp.digits == 0 {
+		return nil, fmt.Errorf("no range supported in the company prefix: %q", fields)
+	}
+	partition := cp.digits
+	if partition == 0 {
+		for i, key := range s.digitsKeys {
+			if 2+i < nFields && pfs[2+i].digits != 0 {
+				partition = s.pt.cpDigits(key, pfs[2+i].digits)
+				if partition == 0 {
+					return nil, fmt.Errorf("no partition for %q", fields)
+				}
+				break
+			}
+		}
+	}
+	if partition == 0 {
+		// the partition is unknown, so all the fields up to the serial are wildcards
+		for i := range s.bitsKeys {
+			if 2+i < nFields && !pfs[2+i].any {
+				return nil, fmt.Errorf("the company prefix is needed for %q", fields)
+			}
+		}
+		var bits int
+		for _, pr := range s.pt {
+			bits = pr[CPBits]
+			for _, key := range s.bitsKeys {
+				bits += pr[key]
+			}
+			break
+		}
+		blocks = append(blocks, []string{strings.Repeat("x", 3+bits)})
+	} else {
+		pr, ok := s.pt[partition]
+		if !ok {
+			return nil, fmt.Errorf("no partition for %q", fields)
+		}
+		cpBlocks, err := cp.blocks(pr[CPBits])
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, []string{fmt.Sprintf("%.3b", pr[PValue])}, cpBlocks)
+		for i, key := range s.bitsKeys {
+			if 2+i < nFields {
+				b, err := pfs[2+i].blocks(pr[key])
+				if err != nil {
+					return nil, err
+				}
+				blocks = append(blocks, b)
+			}
+		}
+	}
+
+	// serial
+	if nFields == 3+len(s.bitsKeys) {
+		b, err := pfs[nFields-1].blocks(s.serialBits)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return product(blocks)
+}
+
+// cpDigits returns the number of company prefix digits for the digits of the field, 0 if none
+func (pt PartitionTable) cpDigits(key PartitionTableKey, digits int) int {
+	for cpDigits, pr := range pt {
+		if pr[key] == digits {
+			return cpDigits
+		}
+	}
+	return 0
+}
+
+// blocks returns the binary strings of n bits covering the field
+func (pf patternField) blocks(n int) ([]string, error) {
+	if pf.any {
+		return []string{strings.Repeat("x", n)}, nil
+	}
+	if n < 64 && pf.hi >= 1<<uint(n) {
+		return nil, fmt.Errorf("%v exceeds %v bits", pf.hi, n)
+	}
+	bs := []string{}
+	for lo := pf.lo; lo <= pf.hi; {
+		// the largest aligned block from lo within hi
+		size := 0
+		for size < n && lo&(1<<uint(size)) == 0 && lo+(1<<uint(size+1))-1 <= pf.hi {
+			size++
+		}
+		b := fmt.Sprintf("%0*b", n, lo)
+		bs = append(bs, b[:n-size]+strings.Repeat("x", size))
+		if len(bs) > MaxFilterStrings {
+			return nil, fmt.Errorf("too many filters for [%v-%v]", pf.lo, pf.hi)
+		}
+		next := lo + 1<<uint(size)
+		if next <= lo {
+			break
+		}
+		lo = next
+	}
+	return bs, nil
+}
+
+// parsePatternField parses a field in the pattern URI
+func parsePatternField(f string) (pf patternField, err error) {
+	switch {
+	case f == "*":
+		pf.any = true
+	case strings.HasPrefix(f, "[") && strings.HasSuffix(f, "]"):
+		lohi := strings.Split(f[1:len(f)-1], "-")
+		if len(lohi) != 2 {
+			return pf, fmt.Errorf("invalid range: %v", f)
+		}
+		if pf.lo, err = strconv.ParseUint(lohi[0], 10, 64); err != nil {
+			return pf, fmt.Errorf("invalid range: %v", f)
+		}
+		if pf.hi, err = strconv.ParseUint(lohi[1], 10, 64); err != nil || pf.hi < pf.lo {
+			return pf, fmt.Errorf("invalid range: %v", f)
+		}
+	default:
+		// the trailing X digits are any digits
+		value := strings.TrimRight(strings.ToUpper(f), "X")
+		pf.digits = len(f)
+		if len(value) == 0 {
+			pf.any = true
+			return
+		}
+		x := strings.Repeat("9", len(f)-len(value))
+		if pf.lo, err = strconv.ParseUint(value+strings.Repeat("0", len(x)), 10, 64); err != nil {
+			return pf, fmt.Errorf("invalid field: %v", f)
+		}
+		pf.hi, _ = strconv.ParseUint(value+x, 10, 64)
+	}
+	return
+}
+
+// product returns the concatenations of the blocks without the trailing wildcard bits
+func product(blocks [][]string) ([]string, error) {
+	fss := []string{""}
+	for _, bs := range blocks {
+		next := make([]string, 0, len(fss)*len(bs))
+		for _, fs := range fss {
+			for _, b := range bs {
+				next = append(next, fs+b)
+			}
+		}
+		if len(next) > MaxFilterStrings {
+			return nil, fmt.Errorf("too many filters: %v", len(next))
+		}
+		fss = next
+	}
+	for i := range fss {
+		fss[i] = strings.TrimRight(fss[i], "x")
+	}
+	return fss, nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
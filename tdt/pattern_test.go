@@ -0,0 +1,115 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tdt
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMakeFilterStrings(t *testing.T) {
+	prefix, _ := MakePrefixFilterString("sgtin-96", []string{"3", "0614141"})
+	item, _ := MakePrefixFilterString("sgtin-96", []string{"3", "0614141", "812345"})
+	tests := []struct {
+		name        string
+		patternType string
+		fields      []string
+		want        []string
+		wantErr     bool
+	}{
+		{"trailing wildcards", "sgtin-96", []string{"3", "0614141", "*", "*"}, []string{prefix}, false},
+		{"company prefix wildcard", "sgtin-96", []string{"3", "*", "812345", "*"}, []string{"00110000" + "011" + "101" + strings.Repeat("x", 24) + "11000110010100111001"}, false},
+		{"item reference wildcard", "sgtin-96", []string{"3", "0614141", "*", "1"}, []string{prefix + strings.Repeat("x", 20) + fmt.Sprintf("%038b", 1)}, false},
+		{"serial range", "sgtin-96", []string{"3", "0614141", "812345", "[4-7]"}, []string{item + fmt.Sprintf("%036b", 1)}, false},
+		{"serial range blocks", "sgtin-96", []string{"3", "0614141", "812345", "[3-4]"}, []string{item + fmt.Sprintf("%038b", 3), item + fmt.Sprintf("%038b", 4)}, false},
+		{"X digits", "sgtin-96", []string{"3", "0614141", "81234X", "*"}, []string{prefix + fmt.Sprintf("%020b", 812340)[:18], prefix + fmt.Sprintf("%020b", 812344)[:18], prefix + fmt.Sprintf("%020b", 812348)[:19]}, false},
+		{"filter range", "sgtin-96", []string{"[0-3]", "0614141"}, []string{"00110000" + "0xx" + prefix[11:]}, false},
+		{"all wildcards", "sgtin-96", []string{"*", "*", "*", "[0-1]"}, []string{"00110000" + strings.Repeat("x", 50) + strings.Repeat("0", 37)}, false},
+		{"iso prefix", "iso17365", []string{"25S", "UN", "ABC"}, nil, false},
+		{"iso17364 prefix", "iso17364", []string{"25B", "UN", "123456789"}, nil, false},
+		{"iso17366h prefix", "iso17366h", []string{"25S", "UN"}, nil, false},
+		{"iso17367 prefix", "iso17367", []string{"25S", "UN", "123456789", "1"}, nil, false},
+		{"iso17364 invalid data identifier", "iso17364", []string{"25S", "UN"}, nil, true},
+		{"company prefix range", "sgtin-96", []string{"3", "[0-1]", "*", "*"}, nil, true},
+		{"item reference without company prefix", "sgtin-96", []string{"3", "*", "[0-1]", "*"}, nil, true},
+		{"serial overflow", "sgtin-96", []string{"3", "0614141", "812345", "[0-274877906944]"}, nil, true},
+		{"invalid range", "sgtin-96", []string{"3", "0614141", "812345", "[7-4]"}, nil, true},
+		{"too many fields", "sscc-96", []string{"3", "0614141", "1234567890", "1"}, nil, true},
+		{"iso wildcard", "iso17365", []string{"25S", "*", "ABC"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MakeFilterStrings(tt.patternType, tt.fields)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MakeFilterStrings() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.want == nil {
+				if !tt.wantErr && len(got) != 1 {
+					t.Errorf("MakeFilterStrings() = %v, want a prefix filter", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MakeFilterStrings() = \n%v, want \n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_patternField_blocks(t *testing.T) {
+	for _, r := range [][2]uint64{{0, 255}, {0, 0}, {100, 200}, {1, 254}, {37, 38}, {128, 255}} {
+		pf := patternField{lo: r[0], hi: r[1]}
+		bs, err := pf.blocks(8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for v := 0; v < 256; v++ {
+			s := fmt.Sprintf("%08b", v)
+			matches := 0
+			for _, b := range bs {
+				if len(b) == 8 && matchBits(b, s) {
+					matches++
+				}
+			}
+			if want := uint64(v) >= r[0] && uint64(v) <= r[1]; (matches == 1) != want || matches > 1 {
+				t.Errorf("patternField.blocks() for %v matches %v %v times in %v", r, v, matches, bs)
+			}
+		}
+	}
+}
+
+func TestMatchPatternFields(t *testing.T) {
+	fields := []string{"0614141", "812345", "6789"}
+	tests := []struct {
+		pattern []string
+		want    bool
+	}{
+		{[]string{"0614141"}, true},
+		{[]string{"0614141", "*", "[6000-7000]"}, true},
+		{[]string{"*", "81234X", "*"}, true},
+		{[]string{"*", "8123XX", "[0-6788]"}, false},
+		{[]string{"0614142"}, false},
+		{[]string{"614141"}, false},
+		{[]string{"0614141", "812345", "6789", "1"}, false},
+	}
+	for _, tt := range tests {
+		if got := MatchPatternFields(tt.pattern, fields); got != tt.want {
+			t.Errorf("MatchPatternFields(%v, %v) = %v, want %v", tt.pattern, fields, got, tt.want)
+		}
+	}
+}
+
+func matchBits(filter string, s string) bool {
+	for i := range filter {
+		if filter[i] != 'x' && filter[i] != s[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,521 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tdt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LevelType is the representation level of an identifier in TDT
+type LevelType string
+
+// The levels in the TDT scheme definitions
+const (
+	Binary       LevelType = "BINARY"
+	TagEncoding  LevelType = "TAG_ENCODING"
+	PureIdentity LevelType = "PURE_IDENTITY"
+	Legacy       LevelType = "LEGACY"
+	// ElementString is the GS1 element string, e.g., (01)80614141123458(21)6789
+	ElementString LevelType = "ELEMENT_STRING"
+)
+
+var (
+	defaultSchemes   []*tdtScheme
+	defaultSchemesMu sync.RWMutex
+)
+
+// LoadDefaultSchemes loads the TDT scheme definitions in the dir for the Cores created afterwards
+func LoadDefaultSchemes(dir string) error {
+	c := &Core{}
+	if err := c.LoadEPCTagDataTranslation(dir); err != nil {
+		return err
+	}
+	defaultSchemesMu.Lock()
+	defaultSchemes = c.schemes
+	defaultSchemesMu.Unlock()
+	return nil
+}
+
+// LoadEPCTagDataTranslation loads the TDT scheme definitions from the XML files in the dir
+func (c *Core) LoadEPCTagDataTranslation(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.xml"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		err = c.LoadScheme(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// LoadScheme loads the TDT scheme definitions in an epcTagDataTranslation XML document
+func (c *Core) LoadScheme(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	def := tdtDefinition{}
+	if err = xml.Unmarshal(data, &def); err != nil {
+		return err
+	}
+	for _, s := range def.Schemes {
+		if err = s.compile(); err != nil {
+			return fmt.Errorf("scheme %v: %v", s.Name, err)
+		}
+	}
+	if def.EPCTDSVersion != "" {
+		c.epcTDSVersion = def.EPCTDSVersion
+	}
+	c.schemes = append(c.schemes, def.Schemes...)
+	return nil
+}
+
+// Convert translates the identifier to the output level with the scheme definitions, or the built-in codec otherwise,
+// the params give the fields missing in the input, e.g., filter, gs1companyprefixlength, and taglength
+func (c *Core) Convert(input string, params map[string]string, outputLevel LevelType) (string, error) {
+	var lastErr error
+	for _, s := range c.schemes {
+		if tl, ok := params["taglength"]; ok && s.TagLength != tl {
+			continue
+		}
+		if s.level(outputLevel) == nil {
+			continue
+		}
+		for _, l := range s.Levels {
+			if !strings.HasPrefix(input, l.PrefixMatch) {
+				continue
+			}
+			o, fields, err := s.parse(l, input, params)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			return s.format(o.OptionKey, fields, outputLevel)
+		}
+	}
+	if lastErr != nil {
+		return "", lastErr
+	}
+	// fall back to the built-in codec
+	return c.convertBuiltin(input, params, outputLevel)
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// tdtDefinition is the root element of the TDT scheme definitions
+type tdtDefinition struct {
+	XMLName       xml.Name     `xml:"epcTagDataTranslation"`
+	Version       string       `xml:"version,attr"`
+	EPCTDSVersion string       `xml:"epcTDSVersion,attr"`
+	Schemes       []*tdtScheme `xml:"scheme"`
+}
+
+// tdtScheme is a coding scheme with the representations in the levels
+type tdtScheme struct {
+	Name      string      `xml:"name,attr"`
+	OptionKey string      `xml:"optionKey,attr"`
+	TagLength string      `xml:"tagLength,attr"`
+	Levels    []*tdtLevel `xml:"level"`
+}
+
+// tdtLevel is a representation of the scheme
+type tdtLevel struct {
+	Type                         LevelType    `xml:"type,attr"`
+	PrefixMatch                  string       `xml:"prefixMatch,attr"`
+	RequiredParsingParameters    string       `xml:"requiredParsingParameters,attr"`
+	RequiredFormattingParameters string       `xml:"requiredFormattingParameters,attr"`
+	Options                      []*tdtOption `xml:"option"`
+	Rules                        []*tdtRule   `xml:"rule"`
+}
+
+// tdtOption is the pattern and the grammar of a level for an option key, e.g., the company prefix length
+type tdtOption struct {
+	OptionKey string      `xml:"optionKey,attr"`
+	Pattern   string      `xml:"pattern,attr"`
+	Grammar   string      `xml:"grammar,attr"`
+	Fields    []*tdtField `xml:"field"`
+	re        *regexp.Regexp
+	grammar   []grammarToken
+}
+
+// tdtField is a field captured by the pattern in the order of seq
+type tdtField struct {
+	Seq            int    `xml:"seq,attr"`
+	Name           string `xml:"name,attr"`
+	BitLength      int    `xml:"bitLength,attr"`
+	Length         int    `xml:"length,attr"`
+	CharacterSet   string `xml:"characterSet,attr"`
+	DecimalMinimum string `xml:"decimalMinimum,attr"`
+	DecimalMaximum string `xml:"decimalMaximum,attr"`
+	Compaction     string `xml:"compaction,attr"`
+	PadChar        string `xml:"padChar,attr"`
+	PadDir         string `xml:"padDir,attr"`
+	BitPadDir      string `xml:"bitPadDir,attr"`
+	charSet        *regexp.Regexp
+}
+
+// tdtRule derives a field from the other fields with the function,
+// EXTRACT rules run after parsing the input and FORMAT rules before formatting the output
+type tdtRule struct {
+	Type         string `xml:"type,attr"`
+	Seq          int    `xml:"seq,attr"`
+	NewFieldName string `xml:"newFieldName,attr"`
+	Length       int    `xml:"length,attr"`
+	PadChar      string `xml:"padChar,attr"`
+	PadDir       string `xml:"padDir,attr"`
+	Function     string `xml:"function,attr"`
+}
+
+// grammarToken is a literal or a field name in the grammar
+type grammarToken struct {
+	literal bool
+	value   string
+}
+
+// compile compiles the patterns, the character sets, and the grammars in the scheme
+func (s *tdtScheme) compile() (err error) {
+	for _, l := range s.Levels {
+		for _, o := range l.Options {
+			if o.re, err = regexp.Compile("^(?:" + o.Pattern + ")"); err != nil {
+				return err
+			}
+			if o.grammar, err = parseGrammar(o.Grammar); err != nil {
+				return err
+			}
+			for _, f := range o.Fields {
+				if f.CharacterSet == "" {
+					continue
+				}
+				if f.charSet, err = regexp.Compile("^(?:" + f.CharacterSet + ")$"); err != nil {
+					return err
+				}
+			}
+			sort.Slice(o.Fields, func(i, j int) bool { return o.Fields[i].Seq < o.Fields[j].Seq })
+		}
+		sort.SliceStable(l.Rules, func(i, j int) bool { return l.Rules[i].Seq < l.Rules[j].Seq })
+	}
+	return nil
+}
+
+// level returns the level of the type in the scheme
+func (s *tdtScheme) level(levelType LevelType) *tdtLevel {
+	for _, l := range s.Levels {
+		if l.Type == levelType {
+			return l
+		}
+	}
+	return nil
+}
+
+// parse matches the input with the options in the level and returns the option and the fields
+func (s *tdtScheme) parse(l *tdtLevel, input string, params map[string]string) (*tdtOption, map[string]string, error) {
+	if err := requireFields(l.RequiredParsingParameters, params); err != nil {
+		return nil, nil, err
+	}
+	for _, o := range l.Options {
+		if key, ok := params[s.OptionKey]; ok && o.OptionKey != key {
+			continue
+		}
+		m := o.re.FindStringSubmatch(input)
+		if m == nil {
+			continue
+		}
+		rest := input[len(m[0]):]
+		// the binary is padded to the word boundary
+		if l.Type == Binary && strings.Trim(rest, "0") != "" || l.Type != Binary && rest != "" {
+			continue
+		}
+		if len(m)-1 != len(o.Fields) {
+			return nil, nil, fmt.Errorf("%v fields for %v groups in %v", len(o.Fields), len(m)-1, o.Pattern)
+		}
+		fields := map[string]string{}
+		for k, v := range params {
+			fields[k] = v
+		}
+		for i, f := range o.Fields {
+			v, err := f.parse(l, m[i+1])
+			if err != nil {
+				return nil, nil, err
+			}
+			fields[f.Name] = v
+		}
+		if err := runRules(l.Rules, "EXTRACT", fields); err != nil {
+			return nil, nil, err
+		}
+		return o, fields, nil
+	}
+	return nil, nil, fmt.Errorf("no option in %v %v matches %v", s.Name, l.Type, input)
+}
+
+// format formats the fields in the option of the output level
+func (s *tdtScheme) format(optionKey string, fields map[string]string, outputLevel LevelType) (string, error) {
+	l := s.level(outputLevel)
+	if l == nil {
+		return "", fmt.Errorf("no %v level in %v", outputLevel, s.Name)
+	}
+	if err := requireFields(l.RequiredFormattingParameters, fields); err != nil {
+		return "", err
+	}
+	var o *tdtOption
+	for _, opt := range l.Options {
+		if opt.OptionKey == optionKey {
+			o = opt
+			break
+		}
+	}
+	if o == nil {
+		return "", fmt.Errorf("no option %v in %v %v", optionKey, s.Name, outputLevel)
+	}
+	if err := runRules(l.Rules, "FORMAT", fields); err != nil {
+		return "", err
+	}
+	out := &strings.Builder{}
+	for _, t := range o.grammar {
+		if t.literal {
+			out.WriteString(t.value)
+			continue
+		}
+		v, ok := fields[t.value]
+		if !ok {
+			return "", fmt.Errorf("missing field %v for %v %v", t.value, s.Name, outputLevel)
+		}
+		for _, f := range o.Fields {
+			if f.Name == t.value {
+				var err error
+				if v, err = f.format(l, v); err != nil {
+					return "", err
+				}
+				break
+			}
+		}
+		out.WriteString(v)
+	}
+	return out.String(), nil
+}
+
+// parse returns the value of the field captured in the level
+func (f *tdtField) parse(l *tdtLevel, v string) (string, error) {
+	if l.Type != Binary {
+		if strings.HasPrefix(l.PrefixMatch, "urn:") {
+			return url.PathUnescape(v)
+		}
+		return v, nil
+	}
+	if f.Compaction != "" {
+		charBits, err := compactionBits(f.Compaction)
+		if err != nil {
+			return "", err
+		}
+		return decodeChars(v, charBits, f.BitPadDir), nil
+	}
+	n, ok := new(big.Int).SetString(v, 2)
+	if !ok {
+		return "", fmt.Errorf("invalid %v bits: %v", f.Name, v)
+	}
+	if err := f.checkRange(n); err != nil {
+		return "", err
+	}
+	return pad(n.String(), f.Length, f.PadChar, f.PadDir), nil
+}
+
+// format returns the value of the field in the level
+func (f *tdtField) format(l *tdtLevel, v string) (string, error) {
+	if l.Type == Binary {
+		return f.formatBinary(v)
+	}
+	v = pad(v, f.Length, f.PadChar, f.PadDir)
+	if strings.HasPrefix(l.PrefixMatch, "urn:") {
+		v = escapeURI(v)
+	}
+	if f.charSet != nil && !f.charSet.MatchString(v) {
+		return "", fmt.Errorf("%v %v doesn't match %v", f.Name, v, f.CharacterSet)
+	}
+	return v, nil
+}
+
+// formatBinary returns the bits of the value in the field
+func (f *tdtField) formatBinary(v string) (string, error) {
+	if f.Compaction != "" {
+		charBits, err := compactionBits(f.Compaction)
+		if err != nil {
+			return "", err
+		}
+		w := &strings.Builder{}
+		for _, c := range []byte(v) {
+			if !validChar(c, charBits) {
+				return "", fmt.Errorf("invalid character in %v: %v", f.Name, v)
+			}
+			fmt.Fprintf(w, "%0*b", charBits, c&(1<<uint(charBits)-1))
+		}
+		if w.Len() > f.BitLength {
+			return "", fmt.Errorf("%v %v exceeds %v bits", f.Name, v, f.BitLength)
+		}
+		if f.BitPadDir == "LEFT" {
+			return strings.Repeat("0", f.BitLength-w.Len()) + w.String(), nil
+		}
+		return w.String() + strings.Repeat("0", f.BitLength-w.Len()), nil
+	}
+	n, ok := new(big.Int).SetString(v, 10)
+	if !ok || n.Sign() < 0 {
+		return "", fmt.Errorf("invalid %v: %v", f.Name, v)
+	}
+	if err := f.checkRange(n); err != nil {
+		return "", err
+	}
+	bs := n.Text(2)
+	if n.Sign() == 0 {
+		bs = ""
+	}
+	if len(bs) > f.BitLength {
+		return "", fmt.Errorf("%v %v exceeds %v bits", f.Name, v, f.BitLength)
+	}
+	return strings.Repeat("0", f.BitLength-len(bs)) + bs, nil
+}
+
+// checkRange returns an error if the value is out of the decimal range of the field
+func (f *tdtField) checkRange(n *big.Int) error {
+	if min, ok := new(big.Int).SetString(f.DecimalMinimum, 10); ok && n.Cmp(min) < 0 {
+		return fmt.Errorf("%v %v is less than %v", f.Name, n, min)
+	}
+	if max, ok := new(big.Int).SetString(f.DecimalMaximum, 10); ok && n.Cmp(max) > 0 {
+		return fmt.Errorf("%v %v is greater than %v", f.Name, n, max)
+	}
+	return nil
+}
+
+// binaryString returns the bits of the id in string
+func binaryString(id []byte) string {
+	w := &strings.Builder{}
+	for _, b := range id {
+		fmt.Fprintf(w, "%08b", b)
+	}
+	return w.String()
+}
+
+// compactionBits returns the bits per character of the compaction
+func compactionBits(compaction string) (int, error) {
+	switch compaction {
+	case "5-bit":
+		return 5, nil
+	case "6-bit":
+		return 6, nil
+	case "7-bit":
+		return 7, nil
+	case "8-bit":
+		return 8, nil
+	}
+	return 0, fmt.Errorf("unknown compaction: %v", compaction)
+}
+
+// decodeChars decodes the bits of the characters without the zero padding
+func decodeChars(bs string, charBits int, bitPadDir string) string {
+	if bitPadDir == "LEFT" {
+		bs = bs[len(bs)%charBits:]
+	}
+	var buf []byte
+	for i := 0; i+charBits <= len(bs); i += charBits {
+		c := byte(0)
+		for _, b := range bs[i : i+charBits] {
+			c = c<<1 | byte(b-'0')
+		}
+		switch {
+		case c == 0:
+			continue
+		case charBits == 5:
+			c |= 64
+		case charBits == 6 && c&32 == 0:
+			c |= 64
+		}
+		buf = append(buf, c)
+	}
+	return string(buf)
+}
+
+// pad pads the value with padChar to the length
+func pad(v string, length int, padChar string, padDir string) string {
+	if length <= len(v) || padChar == "" {
+		return v
+	}
+	padding := strings.Repeat(padChar, length-len(v))
+	if padDir == "RIGHT" {
+		return v + padding
+	}
+	return padding + v
+}
+
+// parseGrammar splits the grammar into the quoted literals and the field names
+func parseGrammar(grammar string) ([]grammarToken, error) {
+	tokens := []grammarToken{}
+	for i := 0; i < len(grammar); {
+		switch c := grammar[i]; {
+		case c == ' ':
+			i++
+		case c == '\'':
+			end := strings.IndexByte(grammar[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated literal in %v", grammar)
+			}
+			tokens = append(tokens, grammarToken{true, grammar[i+1 : i+1+end]})
+			i += end + 2
+		default:
+			end := strings.IndexAny(grammar[i:], " '")
+			if end < 0 {
+				end = len(grammar) - i
+			}
+			tokens = append(tokens, grammarToken{false, grammar[i : i+end]})
+			i += end
+		}
+	}
+	return tokens, nil
+}
+
+// requireFields returns an error if any of the comma separated names is missing in the fields
+func requireFields(names string, fields map[string]string) error {
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, ok := fields[name]; !ok {
+			return fmt.Errorf("missing parameter: %v", name)
+		}
+	}
+	return nil
+}
+
+// runRules sets the fields derived by the rules of the type
+func runRules(rules []*tdtRule, ruleType string, fields map[string]string) error {
+	for _, r := range rules {
+		if r.Type != ruleType {
+			continue
+		}
+		v, err := evalFunction(r.Function, fields)
+		if err != nil {
+			return fmt.Errorf("%v rule for %v: %v", ruleType, r.NewFieldName, err)
+		}
+		fields[r.NewFieldName] = pad(v, r.Length, r.PadChar, r.PadDir)
+	}
+	return nil
+}
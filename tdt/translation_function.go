@@ -0,0 +1,156 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tdt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// evalFunction evaluates the function of a rule, e.g., SUBSTR(gtin,0,1), with the fields,
+// the arguments are the nested functions, the field names, the quoted strings, or the integers
+func evalFunction(expr string, fields map[string]string) (string, error) {
+	expr = strings.TrimSpace(expr)
+	open := strings.IndexByte(expr, '(')
+	switch {
+	case expr == "":
+		return "", errors.New("empty expression")
+	case len(expr) >= 2 && expr[0] == '\'' && expr[len(expr)-1] == '\'':
+		return expr[1 : len(expr)-1], nil
+	case open < 0:
+		if v, ok := fields[expr]; ok {
+			return v, nil
+		}
+		if _, err := strconv.Atoi(expr); err == nil {
+			return expr, nil
+		}
+		return "", fmt.Errorf("unknown field: %v", expr)
+	case expr[len(expr)-1] != ')':
+		return "", fmt.Errorf("invalid function: %v", expr)
+	}
+	args := []string{}
+	for _, arg := range splitArgs(expr[open+1 : len(expr)-1]) {
+		v, err := evalFunction(arg, fields)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, v)
+	}
+	return callFunction(strings.ToUpper(strings.TrimSpace(expr[:open])), args)
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// callFunction calls the TDT function with the evaluated arguments
+func callFunction(name string, args []string) (string, error) {
+	switch name {
+	case "CONCAT":
+		return strings.Join(args, ""), nil
+	case "LENGTH":
+		if len(args) != 1 {
+			return "", fmt.Errorf("LENGTH takes 1 argument: %q", args)
+		}
+		return strconv.Itoa(len(args[0])), nil
+	case "SUBSTR":
+		return substr(args)
+	case "GS1CHECKSUM":
+		if len(args) != 1 {
+			return "", fmt.Errorf("GS1CHECKSUM takes 1 argument: %q", args)
+		}
+		return gs1Checksum(args[0])
+	case "ADD", "SUBTRACT", "MULTIPLY", "DIVIDE", "MOD":
+		if len(args) != 2 {
+			return "", fmt.Errorf("%v takes 2 arguments: %q", name, args)
+		}
+		x, errX := strconv.ParseInt(args[0], 10, 64)
+		y, errY := strconv.ParseInt(args[1], 10, 64)
+		if errX != nil || errY != nil {
+			return "", fmt.Errorf("%v takes integers: %q", name, args)
+		}
+		switch name {
+		case "ADD":
+			x += y
+		case "SUBTRACT":
+			x -= y
+		case "MULTIPLY":
+			x *= y
+		default:
+			if y == 0 {
+				return "", fmt.Errorf("%v by zero", name)
+			}
+			if name == "DIVIDE" {
+				x /= y
+			} else {
+				x %= y
+			}
+		}
+		return strconv.FormatInt(x, 10), nil
+	}
+	return "", fmt.Errorf("unsupported function: %v", name)
+}
+
+// gs1Checksum returns the GS1 check digit of the digits
+func gs1Checksum(digits string) (string, error) {
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if d < '0' || '9' < d {
+			return "", fmt.Errorf("GS1CHECKSUM takes digits: %v", digits)
+		}
+		if i%2 == 0 {
+			sum += 3 * int(d-'0')
+		} else {
+			sum += int(d - '0')
+		}
+	}
+	return strconv.Itoa((10 - sum%10) % 10), nil
+}
+
+// splitArgs splits the arguments at the commas outside the parentheses and the quotes
+func splitArgs(s string) []string {
+	args := []string{}
+	depth, quoted, start := 0, false, 0
+	for i, c := range s {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, s[start:i])
+			start = i + 1
+		}
+	}
+	if strings.TrimSpace(s) != "" {
+		args = append(args, s[start:])
+	}
+	return args
+}
+
+// substr returns SUBSTR(s, start) or SUBSTR(s, start, length) with the zero-based start
+func substr(args []string) (string, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return "", fmt.Errorf("SUBSTR takes 2 or 3 arguments: %q", args)
+	}
+	s := args[0]
+	start, err := strconv.Atoi(args[1])
+	if err != nil || start < 0 || len(s) < start {
+		return "", fmt.Errorf("invalid start for SUBSTR: %q", args)
+	}
+	if len(args) == 2 {
+		return s[start:], nil
+	}
+	length, err := strconv.Atoi(args[2])
+	if err != nil || length < 0 || len(s) < start+length {
+		return "", fmt.Errorf("invalid length for SUBSTR: %q", args)
+	}
+	return s[start : start+length], nil
+}
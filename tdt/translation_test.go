@@ -0,0 +1,153 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tdt
+
+import (
+	"testing"
+)
+
+const (
+	schemeDir = "../test/data/schemes"
+	// urn:epc:tag:sgtin-96:3.0614141.812345.6789
+	sgtin96Binary = "001100000111010000100101011110111111011100011001010011100100000000000000000000000001101010000101"
+)
+
+func TestCore_Convert(t *testing.T) {
+	c := &Core{}
+	if err := c.LoadEPCTagDataTranslation(schemeDir); err != nil {
+		t.Fatal(err)
+	}
+	type args struct {
+		input       string
+		params      map[string]string
+		outputLevel LevelType
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{"SGTIN-96 BINARY to PURE_IDENTITY", args{sgtin96Binary, nil, PureIdentity}, "urn:epc:id:sgtin:0614141.812345.6789", false},
+		{"SGTIN-96 BINARY to TAG_ENCODING", args{sgtin96Binary, nil, TagEncoding}, "urn:epc:tag:sgtin-96:3.0614141.812345.6789", false},
+		{"SGTIN-96 BINARY to LEGACY", args{sgtin96Binary, nil, Legacy}, "gtin=80614141123458;serial=6789", false},
+		{"SGTIN-96 padded BINARY to PURE_IDENTITY", args{sgtin96Binary + "0000", nil, PureIdentity}, "urn:epc:id:sgtin:0614141.812345.6789", false},
+		{"SGTIN-96 TAG_ENCODING to BINARY", args{"urn:epc:tag:sgtin-96:3.0614141.812345.6789", map[string]string{"taglength": "96"}, Binary}, sgtin96Binary, false},
+		{"SGTIN-96 PURE_IDENTITY to BINARY", args{"urn:epc:id:sgtin:0614141.812345.6789", map[string]string{"filter": "3", "taglength": "96"}, Binary}, sgtin96Binary, false},
+		{"SGTIN-96 LEGACY to TAG_ENCODING", args{"gtin=80614141123458;serial=6789", map[string]string{"gs1companyprefixlength": "7", "filter": "3", "taglength": "96"}, TagEncoding}, "urn:epc:tag:sgtin-96:3.0614141.812345.6789", false},
+		{"SGTIN-198 PURE_IDENTITY to TAG_ENCODING", args{"urn:epc:id:sgtin:0614141.812345.12345%2FXYZ", map[string]string{"filter": "3", "taglength": "198"}, TagEncoding}, "urn:epc:tag:sgtin-198:3.0614141.812345.12345%2FXYZ", false},
+		{"GID-96 TAG_ENCODING to PURE_IDENTITY", args{"urn:epc:tag:gid-96:95100000.12345.400", nil, PureIdentity}, "urn:epc:id:gid:95100000.12345.400", false},
+		{"PURE_IDENTITY to BINARY without filter", args{"urn:epc:id:sgtin:0614141.812345.6789", map[string]string{"taglength": "96"}, Binary}, "", true},
+		{"LEGACY without gs1companyprefixlength", args{"gtin=80614141123458;serial=6789", nil, PureIdentity}, "", true},
+		{"SGTIN-96 serial overflow", args{"urn:epc:tag:sgtin-96:3.0614141.812345.274877906944", map[string]string{"taglength": "96"}, Binary}, "", true},
+		{"unknown scheme", args{"urn:epc:id:foo:1", nil, Binary}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Convert(tt.args.input, tt.args.params, tt.args.outputLevel)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Core.Convert() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Core.Convert() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCore_Convert_roundTrip(t *testing.T) {
+	c := &Core{}
+	if err := c.LoadEPCTagDataTranslation(schemeDir); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pureIdentity string
+		taglength    string
+	}{
+		{"urn:epc:id:sgtin:061414112345.8.1", "96"},
+		{"urn:epc:id:sgtin:061414.1234567.274877906943", "96"},
+		{"urn:epc:id:sgtin:0614141.812345.12345%2FXYZ", "198"},
+		{"urn:epc:id:gid:95100000.12345.400", "96"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pureIdentity, func(t *testing.T) {
+			bs, err := c.Convert(tt.pureIdentity, map[string]string{"filter": "1", "taglength": tt.taglength}, Binary)
+			if err != nil {
+				t.Fatalf("Core.Convert() to BINARY error = %v", err)
+			}
+			if tt.taglength == "96" && len(bs) != 96 {
+				t.Errorf("len(bs) = %v, want 96", len(bs))
+			}
+			got, err := c.Convert(bs, nil, PureIdentity)
+			if err != nil {
+				t.Fatalf("Core.Convert() to PURE_IDENTITY error = %v", err)
+			}
+			if got != tt.pureIdentity {
+				t.Errorf("Core.Convert() = %v, want %v", got, tt.pureIdentity)
+			}
+		})
+	}
+}
+
+func TestCore_Translate_definitions(t *testing.T) {
+	c := &Core{}
+	if err := c.LoadEPCTagDataTranslation(schemeDir); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		id   []byte
+		want string
+	}{
+		{"SGTIN-96", []byte{48, 116, 37, 123, 247, 25, 78, 64, 0, 0, 26, 133}, "urn:epc:id:sgtin:0614141.812345.6789"},
+		{"GID-96", []byte{53, 90, 177, 198, 0, 3, 3, 144, 0, 0, 1, 144}, "urn:epc:id:gid:95100000.12345.400"},
+		// not in the definitions
+		{"SSCC-96", []byte{49, 96, 114, 250, 100, 104, 80, 0, 1, 0, 0, 0}, "urn:epc:id:sscc:123456789012.00001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Translate([]byte{48, 0}, tt.id)
+			if err != nil {
+				t.Fatalf("Core.Translate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Core.Translate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_evalFunction(t *testing.T) {
+	fields := map[string]string{"gtin": "80614141123458", "gs1companyprefixlength": "7"}
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{"SUBSTR(gtin,0,1)", "8", false},
+		{"SUBSTR(gtin,add(gs1companyprefixlength,1),subtract(12,gs1companyprefixlength))", "12345", false},
+		{"CONCAT(SUBSTR(gtin,1),'-',LENGTH(gtin))", "0614141123458-14", false},
+		{"GS1CHECKSUM('8061414112345')", "8", false},
+		{"mod(multiply(7,3),divide(9,2))", "1", false},
+		{"SUBSTR(gtin,15)", "", true},
+		{"divide(1,0)", "", true},
+		{"SUBSTR(unknown,0)", "", true},
+		{"TABLELOOKUP(gtin,table,a,b)", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := evalFunction(tt.expr, fields)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("evalFunction() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("evalFunction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package tdt contains Tag Data Translation module from binary to Pure Identity
+package tdt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// uiiStandards maps the AFIs to the ISO standards of the UII
+var uiiStandards = map[byte]string{
+	0xa1: "iso17367",
+	0xa2: "iso17365",
+	0xa3: "iso17364",
+	0xa4: "iso17367h",
+	0xa5: "iso17366",
+	0xa6: "iso17366h",
+	0xa7: "iso17365h",
+	0xa8: "iso17364h",
+	0xa9: "iso17363",
+	0xaa: "iso17363h",
+}
+
+// uiiDataIdentifiers are the ISO/IEC 15961 data identifiers of the UII in each standard
+var uiiDataIdentifiers = map[string][]string{
+	"iso17363": {"7B"},
+	"iso17364": {"25B"},
+	"iso17365": {"J", "1J", "2J", "3J", "4J", "5J", "6J", "25S"},
+	"iso17366": {"25S"},
+	"iso17367": {"25S"},
+}
+
+// iso6346EquipmentCategories are the equipment category identifiers of the freight containers
+const iso6346EquipmentCategories = "JUZ"
+
+// UII is the unique item identifier decoded from the UII memory of an ISO tag
+type UII struct {
+	// Standard is the ISO standard of the AFI, suffixed with h for the hazardous materials
+	Standard       string
+	DataIdentifier string
+	// OwnerCode, EquipmentCategory, SerialNumber and CheckDigit are of ISO 6346 for ISO 17363
+	OwnerCode         string
+	EquipmentCategory string
+	// IssuingAgencyCode, CompanyIdentification and SerialNumber are of ISO/IEC 15459 for the others
+	IssuingAgencyCode     string
+	CompanyIdentification string
+	SerialNumber          string
+	CheckDigit            string
+	// Data is the rest after the data identifier when the IAC is unknown or the fields are invalid
+	Data string
+}
+
+// DecodeUII decodes the 6-bit compacted UII of the AFI into the fields,
+// and validates them including the ISO 6346 check digit
+func DecodeUII(afi byte, id []byte) (*UII, error) {
+	standard, ok := uiiStandards[afi]
+	if !ok {
+		return nil, fmt.Errorf("invalid afi: %#x", afi)
+	}
+	s, err := parse6BitEncodedByteSliceToString(id)
+	if err != nil {
+		return nil, err
+	}
+	// the data after EOT is padding
+	if i := strings.IndexByte(s, '!'); i >= 0 {
+		s = s[:i]
+	}
+	uii := &UII{Standard: standard}
+	if uii.DataIdentifier, s, err = parseDataIdentifier(s, uiiDataIdentifiers[strings.TrimSuffix(standard, "h")]); err != nil {
+		return nil, err
+	}
+	if uii.DataIdentifier == "7B" {
+		return uii, uii.decodeISO6346(s)
+	}
+	return uii, uii.decodeISO15459(s)
+}
+
+// Fields returns the fields of the UII in the order of the pattern URI
+func (uii *UII) Fields() []string {
+	if uii.DataIdentifier == "7B" {
+		return []string{uii.DataIdentifier, uii.OwnerCode, uii.EquipmentCategory, uii.SerialNumber, uii.CheckDigit}
+	}
+	if len(uii.IssuingAgencyCode) == 0 {
+		return []string{uii.DataIdentifier + escapeURI(uii.Data)}
+	}
+	return []string{uii.DataIdentifier, uii.IssuingAgencyCode, uii.CompanyIdentification, escapeURI(uii.SerialNumber)}
+}
+
+// URI returns the pure identity URI of the UII, e.g., urn:epc:id:iso17363:7B.ABC.U.123456.0,
+// or the unstructured one without the separators for the Data, e.g., urn:epc:id:iso17365:25SLAXYZ123
+func (uii *UII) URI() string {
+	return "urn:epc:id:" + uii.Standard + ":" + strings.Join(uii.Fields(), ".")
+}
+
+// Internal helper methods -----------------------------------------------------
+
+// decodeISO6346 decodes the owner code, the equipment category, the serial number and the check digit
+func (uii *UII) decodeISO6346(s string) error {
+	if len(s) != 11 {
+		return fmt.Errorf("invalid ISO 6346 container code: %v", s)
+	}
+	uii.OwnerCode, uii.EquipmentCategory, uii.SerialNumber, uii.CheckDigit = s[:3], s[3:4], s[4:10], s[10:]
+	if !isUpperAlpha(uii.OwnerCode) {
+		return fmt.Errorf("invalid owner code: %v", uii.OwnerCode)
+	}
+	if !strings.Contains(iso6346EquipmentCategories, uii.EquipmentCategory) {
+		return fmt.Errorf("invalid equipment category identifier: %v", uii.EquipmentCategory)
+	}
+	if !isDigits(uii.SerialNumber) {
+		return fmt.Errorf("invalid container serial number: %v", uii.SerialNumber)
+	}
+	cd, err := getISO6346CD(s[:10])
+	if err != nil {
+		return err
+	}
+	if uii.CheckDigit != strconv.Itoa(cd) {
+		return fmt.Errorf("invalid check digit of %v: %v", s[:10], uii.CheckDigit)
+	}
+	return nil
+}
+
+// decodeISO15459 decodes the issuing agency code, the company identification and the serial number,
+// the UII is kept unstructured in the Data when the IAC isn't in IACAssignment or the fields are invalid
+func (uii *UII) decodeISO15459(s string) error {
+	if len(s) == 0 {
+		return fmt.Errorf("no UII after the data identifier %v", uii.DataIdentifier)
+	}
+	for n := 1; n <= 3 && n <= len(s); n++ {
+		l, ok := IACAssignment[s[:n]]
+		if !ok {
+			continue
+		}
+		iac, cin, sn := s[:n], s[n:], ""
+		if len(cin) > l {
+			cin, sn = cin[:l], cin[l:]
+		}
+		if len(sn) == 0 || !isUpperAlnum(cin, "") || IACNumeric[iac] && !isDigits(cin) || !isUpperAlnum(sn, "-/") {
+			break
+		}
+		uii.IssuingAgencyCode, uii.CompanyIdentification, uii.SerialNumber = iac, cin, sn
+		return nil
+	}
+	uii.Data = s
+	return nil
+}
+
+// isDigits returns true if s consists only of the digits
+func isDigits(s string) bool {
+	for _, c := range []byte(s) {
+		if c < '0' || '9' < c {
+			return false
+		}
+	}
+	return true
+}
+
+// isUpperAlnum returns true if s consists only of the upper case letters, the digits and the others
+func isUpperAlnum(s string, others string) bool {
+	for _, c := range []byte(s) {
+		if (c < 'A' || 'Z' < c) && (c < '0' || '9' < c) && strings.IndexByte(others, c) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isUpperAlpha returns true if s consists only of the upper case letters
+func isUpperAlpha(s string) bool {
+	for _, c := range []byte(s) {
+		if c < 'A' || 'Z' < c {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDataIdentifier returns the data identifier in the dis and the rest of s,
+// a data identifier is the digits followed by a letter
+func parseDataIdentifier(s string, dis []string) (string, string, error) {
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	if i == len(s) {
+		return "", "", fmt.Errorf("no data identifier: %v", s)
+	}
+	di := s[:i+1]
+	for _, d := range dis {
+		if d == di {
+			return di, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("invalid data identifier: %v", di)
+}
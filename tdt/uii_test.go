@@ -0,0 +1,57 @@
+// Copyright (c) 2018 Iori Mizutani
+//
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package tdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeUII(t *testing.T) {
+	tests := []struct {
+		name    string
+		afi     byte
+		id      []byte
+		want    *UII
+		wantErr bool
+	}{
+		{"ISO17363", 0xa9, []byte{220, 32, 66, 13, 92, 114, 207, 77, 118, 194}, &UII{
+			Standard:          "iso17363",
+			DataIdentifier:    "7B",
+			OwnerCode:         "ABC",
+			EquipmentCategory: "U",
+			SerialNumber:      "123456",
+			CheckDigit:        "0",
+		}, false},
+		{"ISO17366h", 0xa6, []byte{203, 84, 213, 59, 28, 179, 211, 93, 183, 227, 156, 20, 32, 19, 139, 193, 147, 213, 192, 99, 210, 193, 33, 65, 16, 147, 135, 193, 66, 9, 79, 24}, &UII{
+			Standard:              "iso17366h",
+			DataIdentifier:        "25S",
+			IssuingAgencyCode:     "UN",
+			CompanyIdentification: "123456789",
+			SerialNumber:          "0THANK0YOU0FOR0READING0THIS1",
+		}, false},
+		{"ISO17365 invalid company identification", 0xa2, []byte{203, 84, 213, 56, 16, 131, 193, 66, 1, 56, 188, 25, 61, 92, 6, 61, 44, 18, 20, 17, 9, 56, 124, 20, 32, 148, 241, 130}, &UII{
+			Standard:       "iso17365",
+			DataIdentifier: "25S",
+			Data:           "UNABC0THANK0YOU0FOR0READING0THIS1",
+		}, false},
+		{"invalid afi", 0xb0, []byte{220, 32, 66, 13, 92, 114, 207, 77, 118, 194}, nil, true},
+		{"invalid check digit", 0xaa, []byte{220, 32, 66, 13, 92, 114, 207, 77, 118, 198}, nil, true},
+		{"invalid data identifier", 0xa3, []byte{220, 32, 66, 13, 92, 114, 207, 77, 118, 194}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeUII(tt.afi, tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecodeUII() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeUII() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}